@@ -0,0 +1,416 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+var (
+	magicELF     = []byte{0x7f, 'E', 'L', 'F'}
+	magicPE      = []byte{'M', 'Z'}
+	magicMachO32 = []byte{0xfe, 0xed, 0xfa, 0xce}
+	magicMachO64 = []byte{0xfe, 0xed, 0xfa, 0xcf}
+	magicMachOLE = [][]byte{
+		{0xce, 0xfa, 0xed, 0xfe},
+		{0xcf, 0xfa, 0xed, 0xfe},
+	}
+	magicMachOFat = []byte{0xca, 0xfe, 0xba, 0xbe}
+	magicWasm     = []byte{0x00, 'a', 's', 'm'}
+	// Scripts such as shell scripts are run by the interpreter on their first line on Unix
+	magicShebang = []byte{'#', '!'}
+)
+
+// executableMagics returns the magic headers which an executable for the given OS can start with.
+// nil is returned when the executable format of the OS is not known.
+func executableMagics(goos string) [][]byte {
+	switch goos {
+	case windows:
+		return [][]byte{magicPE}
+	case "darwin", "ios":
+		return append(append([][]byte{magicMachO32, magicMachO64, magicMachOFat}, magicMachOLE...), magicShebang)
+	case "linux", "android", "freebsd", "openbsd", "netbsd", "dragonfly", "solaris", "illumos":
+		return [][]byte{magicELF, magicShebang}
+	case "js", "wasip1":
+		return [][]byte{magicWasm}
+	default:
+		return nil
+	}
+}
+
+// executableExt returns the file extension of executables for the given OS such as '.exe' on Windows.
+func executableExt(goos string) string {
+	switch goos {
+	case windows:
+		return ".exe"
+	case "js", "wasip1":
+		return ".wasm"
+	default:
+		return ""
+	}
+}
+
+// checkExecutableHeader checks that the header of a file looks like an executable for the given OS.
+func checkExecutableHeader(header []byte, goos string) error {
+	magics := executableMagics(goos)
+	if magics == nil {
+		log.Println("Executable format of", goos, "is unknown. Skip checking the header of the new executable")
+
+		return nil
+	}
+
+	for _, m := range magics {
+		if bytes.HasPrefix(header, m) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("file does not start with a magic number of an executable for %s (got %q)", goos, header)
+}
+
+// checkExecutable checks that the file at path was written as a plausible executable for the OS.
+// This catches corrupted or truncated downloads (e.g. an HTML error page) before they are put in place.
+func checkExecutable(path, goos string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open new executable %s: %w", path, err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat new executable %s: %w", path, err)
+	}
+
+	if runtime.GOOS != windows && stat.Mode()&0o111 == 0 {
+		return fmt.Errorf("new executable %s does not have executable permission: %s", path, stat.Mode())
+	}
+
+	header := make([]byte, 4)
+
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read header of new executable %s: %w", path, err)
+	}
+
+	if err := checkExecutableHeader(header[:n], goos); err != nil {
+		return fmt.Errorf("new executable %s is broken: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyUpdate replaces the file at cmdPath with the content read from src.
+//
+// The new content is first written to /path/to/.cmd.new and checked to be an executable. Then the current
+// executable is moved to /path/to/.cmd.old and the new one is renamed to /path/to/cmd. The old executable is
+// removed on success (or hidden on Windows, where a running executable cannot be removed). When the final rename
+// fails, the old executable is moved back to its original location.
+func applyUpdate(src io.Reader, cmdPath string) error {
+	return applyUpdateFor(src, cmdPath, runtime.GOOS, nil, applyHooks{})
+}
+
+// applyHooks customize how the new executable is applied.
+type applyHooks struct {
+	// smokeTest is called with the path of the new executable after it was checked. The update is aborted when it
+	// fails. Nothing is run when nil
+	smokeTest func(newBinaryPath string) error
+	// commit puts the new executable in place. CommitByRename is used when nil
+	commit func(newBinaryPath, targetPath string) error
+	// mode is the permission bits of the new executable. The ones of the current executable are kept when zero
+	mode os.FileMode
+	// verify reads the executable back after it was put in place and rolls back to the previous one unless it matches
+	// the written one
+	verify bool
+	// skipCheck skips checking the permission and the header of the new executable
+	skipCheck bool
+}
+
+// applyUpdateFor is the same as applyUpdate, but the new executable is checked to be an executable for the OS, such
+// as a WebAssembly module for 'wasip1'. When archs is not empty, the new executable is also checked to be built for
+// any of them. The checked executable is smoke-tested, put in place and verified with the hooks.
+func applyUpdateFor(src io.Reader, cmdPath, goos string, archs []string, hooks applyHooks) error { //nolint:cyclop,funlen
+	dir, name := filepath.Split(cmdPath)
+
+	newPath := filepath.Join(dir, fmt.Sprintf(".%s.new", name))
+
+	fp, err := os.OpenFile(newPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create new executable %s: %w", newPath, err)
+	}
+
+	// The digest of the written executable is compared with the one read back after it was put in place
+	digest := sha256.New()
+
+	var w io.Writer = fp
+	if hooks.verify {
+		w = io.MultiWriter(fp, digest)
+	}
+
+	_, err = io.Copy(w, src)
+
+	// The file must be closed before it is moved, otherwise Windows considers it still in use
+	fp.Close()
+
+	if err != nil {
+		os.Remove(newPath)
+
+		return fmt.Errorf("failed to write new executable %s: %w", newPath, err)
+	}
+
+	if mode := newExecutableMode(cmdPath, hooks.mode); mode != 0 && runtime.GOOS != windows {
+		if err := os.Chmod(newPath, mode); err != nil {
+			os.Remove(newPath)
+
+			return fmt.Errorf("failed to change mode of new executable %s to %s: %w", newPath, mode, err)
+		}
+	}
+
+	if hooks.skipCheck {
+		log.Println("Skip checking the new executable", newPath)
+	} else if err := checkExecutable(newPath, goos); err != nil {
+		os.Remove(newPath)
+
+		return err
+	}
+
+	if len(archs) > 0 {
+		if err := checkExecutablePlatform(newPath, goos, archs); err != nil {
+			os.Remove(newPath)
+
+			return err
+		}
+	}
+
+	if hooks.smokeTest != nil {
+		if err := hooks.smokeTest(newPath); err != nil {
+			os.Remove(newPath)
+
+			return fmt.Errorf("smoke test of new executable failed: %w", err)
+		}
+	}
+
+	backup := ""
+	if hooks.verify {
+		if backup, err = backupExecutable(cmdPath); err != nil {
+			os.Remove(newPath)
+
+			return err
+		}
+	}
+
+	if err := commitExecutable(newPath, cmdPath, hooks.commit); err != nil {
+		if backup != "" {
+			os.Remove(backup)
+		}
+
+		return err
+	}
+
+	if hooks.verify {
+		return verifyInstalled(cmdPath, backup, digest.Sum(nil))
+	}
+
+	return nil
+}
+
+// commitExecutable puts the new executable in place with the commit function, or CommitByRename when it is nil.
+func commitExecutable(newPath, cmdPath string, commit func(newBinaryPath, targetPath string) error) error {
+	if commit == nil {
+		return CommitByRename(newPath, cmdPath)
+	}
+
+	err := commit(newPath, cmdPath)
+
+	// The new executable is left when the function copied it rather than moving it
+	os.Remove(newPath)
+
+	if err != nil {
+		return fmt.Errorf("failed to commit new executable to %s: %w", cmdPath, err)
+	}
+
+	return nil
+}
+
+// newExecutableMode returns the permission bits of the new executable replacing the one at cmdPath. The ones of the
+// current executable are returned when mode is zero, and zero is returned when it is missing or not executable so
+// that the default is kept.
+func newExecutableMode(cmdPath string, mode os.FileMode) os.FileMode {
+	if mode != 0 {
+		return mode.Perm()
+	}
+
+	stat, err := os.Stat(cmdPath)
+	if err != nil || stat.Mode().Perm()&0o111 == 0 {
+		return 0
+	}
+
+	return stat.Mode().Perm()
+}
+
+// CommitByRename replaces the executable at targetPath with the new one at newBinaryPath, which is in the same
+// directory. This is the default of Config.CommitFunc. The current executable is moved to '.<name>.old' next to it and
+// the new one is renamed to targetPath. The old executable is removed on success (or hidden on Windows, where
+// a running executable cannot be removed). When the final rename fails, the old executable is moved back to its
+// original location. It is also useful to wrap it in a custom CommitFunc, e.g. to relabel the file for SELinux after it.
+func CommitByRename(newBinaryPath, targetPath string) error {
+	newPath, cmdPath := newBinaryPath, targetPath
+	dir, name := filepath.Split(cmdPath)
+	oldPath := filepath.Join(dir, fmt.Sprintf(".%s.old", name))
+
+	// Remove the previous old executable if any. Rename fails on Windows if the destination already exists
+	_ = os.Remove(oldPath)
+
+	if err := os.Rename(cmdPath, oldPath); err != nil {
+		os.Remove(newPath)
+
+		return fmt.Errorf("failed to move current executable %s to %s: %w", cmdPath, oldPath, err)
+	}
+
+	if err := os.Rename(newPath, cmdPath); err != nil {
+		if rerr := os.Rename(oldPath, cmdPath); rerr != nil {
+			return fmt.Errorf("failed to move new executable to %s: %v, and failed to roll back from %s: %w", cmdPath, err, oldPath, rerr)
+		}
+
+		return fmt.Errorf("failed to move new executable to %s: %w", cmdPath, err)
+	}
+
+	if err := os.Remove(oldPath); err != nil {
+		// Windows cannot remove the executable of the running process. Hide it instead
+		_ = hideFile(oldPath)
+	}
+
+	return nil
+}
+
+// ApplyOptions is the options of ApplyFromReader.
+type ApplyOptions struct {
+	// AssetName is the file name of the content such as 'foo_linux_amd64.tar.gz'. Its extension tells how the
+	// executable is extracted from the content, and validators may use it. When empty, the content is applied as an
+	// uncompressed executable.
+	AssetName string
+	// BinaryName is the name of the executable in the archive. When empty, the file name of the target path is
+	// looked up. See Config.ArchiveBinaryName
+	BinaryName string
+	// BinaryAlternatives are other names of the executable in the archive tried as well as BinaryName.
+	BinaryAlternatives []string
+	// ZipPassword is the password to decrypt the executable in an encrypted zip archive.
+	ZipPassword string
+	// PlainBinaryExtensions are the extensions of AssetName applied as uncompressed executables. See
+	// Config.PlainBinaryExtensions
+	PlainBinaryExtensions []string
+	// Validator validates the content against ValidationData before the executable is extracted from it. The
+	// content is not validated when nil.
+	Validator Validator
+	// ValidationData is the content of the validation file passed to Validator, such as a SHA256 hash or
+	// a signature.
+	ValidationData []byte
+	// CheckExecutablePlatform checks that the extracted executable was built for the running platform. See
+	// Config.CheckExecutablePlatform
+	CheckExecutablePlatform bool
+	// TempDir is the directory of the temporary file holding the content while it is validated. See Config.TempDir
+	TempDir string
+	// CommitFunc puts the new executable in place instead of CommitByRename. See Config.CommitFunc
+	CommitFunc func(newBinaryPath, targetPath string) error
+	// SmokeTest is called with the path of the new executable before it is put in place. See Config.SmokeTest
+	SmokeTest func(newBinaryPath string) error
+	// FileMode is the permission bits of the new executable. See Config.FileMode
+	FileMode os.FileMode
+	// VerifyInstalled reads the executable back after it was put in place. See Config.VerifyInstalled
+	VerifyInstalled bool
+	// SkipExecutableCheck skips checking that the new executable looks like an executable. See
+	// Config.SkipExecutableCheck
+	SkipExecutableCheck bool
+}
+
+// ApplyFromReader replaces the executable at targetPath with the one read from r, without detecting releases on
+// GitHub. This is the apply half of the update for contents obtained by other means. The content is validated with
+// opts.Validator, then the executable is extracted from it and replaces the current one as UpdateTo does: it is
+// written next to the current one, checked to be an executable, and moved into place. The current executable is
+// restored when the replacement fails.
+//
+// When the validator implements StreamValidator, the content is validated while it is read into a temporary file
+// instead of being buffered in memory.
+func ApplyFromReader(r io.Reader, targetPath string, opts ApplyOptions) error {
+	src := r
+
+	if opts.Validator != nil {
+		if validate := streamValidation(opts.Validator, opts.AssetName); validate != nil {
+			tmp, err := validateToTempFile(r, opts.TempDir, validate, opts.ValidationData)
+			if err != nil {
+				return err
+			}
+
+			defer func() {
+				tmp.Close()
+				os.Remove(tmp.Name())
+			}()
+
+			src = tmp
+		} else {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return fmt.Errorf("failed reading content: %w", err)
+			}
+
+			if err := validateAsset(opts.Validator, opts.AssetName, data, opts.ValidationData); err != nil {
+				return markError(ErrValidationFailed, fmt.Errorf("failed validating content: %w", err))
+			}
+
+			src = bytes.NewReader(data)
+		}
+	}
+
+	p := runtimePlatform()
+
+	var archs []string
+	if opts.CheckExecutablePlatform {
+		archs = []string{p.goarch}
+	}
+
+	return uncompressAndUpdate(src, opts.AssetName, targetPath, archiveBinaryNames(targetPath, opts.BinaryName, opts.BinaryAlternatives, p.goos), opts.ZipPassword, opts.PlainBinaryExtensions, p, archs, applyHooks{smokeTest: opts.SmokeTest, commit: opts.CommitFunc, mode: opts.FileMode, verify: opts.VerifyInstalled, skipCheck: opts.SkipExecutableCheck})
+}
+
+// validateToTempFile validates the content read from src while writing it into a temporary file in dir. The file is
+// returned at its beginning after the validation succeeded. os.TempDir() is used when dir is empty.
+func validateToTempFile(src io.Reader, dir string, validate func(io.Reader, []byte) error, validationData []byte) (*os.File, error) {
+	tmp, err := ioutil.TempFile(dir, "selfupdate-asset-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for validating content: %w", err)
+	}
+
+	fail := func(err error) (*os.File, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return nil, err
+	}
+
+	tee := io.TeeReader(src, tmp)
+
+	if err := validate(tee, validationData); err != nil {
+		return fail(markError(ErrValidationFailed, fmt.Errorf("failed validating content: %w", err)))
+	}
+
+	// Bytes which the validator did not read are not validated
+	n, err := io.Copy(ioutil.Discard, tee)
+	if err != nil {
+		return fail(fmt.Errorf("failed reading content: %w", err))
+	}
+
+	if n > 0 {
+		return fail(markError(ErrValidationFailed, fmt.Errorf("failed validating content: validator did not read the last %d bytes", n)))
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("failed to read content from temporary file: %w", err))
+	}
+
+	return tmp, nil
+}
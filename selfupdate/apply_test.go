@@ -0,0 +1,404 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func fakeExecutableContent(t *testing.T, body string) []byte {
+	magics := executableMagics(runtime.GOOS)
+	if magics == nil {
+		t.Skip("executable format of", runtime.GOOS, "is unknown")
+	}
+	return append(append([]byte{}, magics[0]...), body...)
+}
+
+func setupOldExecutable(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "foo")
+	if err := ioutil.WriteFile(path, []byte("old executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyUpdate(t *testing.T) {
+	path := setupOldExecutable(t)
+	content := fakeExecutableContent(t, "new executable")
+
+	if err := applyUpdate(bytes.NewReader(content), path); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatalf("executable was not replaced: %q", b)
+	}
+
+	dir := filepath.Dir(path)
+	for _, f := range []string{".foo.new", ".foo.old"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil && runtime.GOOS != "windows" {
+			t.Error("Temporary file was not removed:", f)
+		}
+	}
+}
+
+func TestApplyUpdateBrokenExecutable(t *testing.T) {
+	if executableMagics(runtime.GOOS) == nil {
+		t.Skip("executable format of", runtime.GOOS, "is unknown")
+	}
+
+	for _, content := range []string{
+		"<!DOCTYPE html><html><body>Not Found</body></html>",
+		"",
+		"\x7f",
+	} {
+		path := setupOldExecutable(t)
+
+		err := applyUpdate(strings.NewReader(content), path)
+		if err == nil {
+			t.Fatalf("Error should occur for broken executable %q", content)
+		}
+		if !strings.Contains(err.Error(), "is broken") {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "old executable" {
+			t.Fatalf("Old executable should be kept but got %q", b)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), ".foo.new")); err == nil {
+			t.Error("Broken new executable was not removed")
+		}
+	}
+}
+
+func TestCheckExecutableHeader(t *testing.T) {
+	for _, tc := range []struct {
+		goos   string
+		header string
+		ok     bool
+	}{
+		{"linux", "\x7fELF", true},
+		{"freebsd", "\x7fELF", true},
+		{"linux", "MZ\x90\x00", false},
+		{"windows", "MZ\x90\x00", true},
+		{"windows", "\x7fELF", false},
+		{"darwin", "\xcf\xfa\xed\xfe", true},
+		{"darwin", "\xca\xfe\xba\xbe", true},
+		{"darwin", "<htm", false},
+		{"plan9", "<htm", true},
+		{"linux", "#!/b", true},
+		{"darwin", "#!/b", true},
+		{"windows", "#!/b", false},
+	} {
+		err := checkExecutableHeader([]byte(tc.header), tc.goos)
+		if tc.ok && err != nil {
+			t.Errorf("Header %q should be accepted for %s: %s", tc.header, tc.goos, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("Header %q should be rejected for %s", tc.header, tc.goos)
+		}
+	}
+}
+
+func TestApplyFromReader(t *testing.T) {
+	content := fakeExecutableContent(t, "new executable")
+	tarball := tarGz(t, map[string][]byte{"foo": content})
+	hash := []byte(fmt.Sprintf("%x", sha256.Sum256(tarball)))
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		what    string
+		content []byte
+		opts    ApplyOptions
+		want    string
+	}{
+		{"uncompressed", content, ApplyOptions{}, ""},
+		{"archive", tarball, ApplyOptions{AssetName: "foo_linux_amd64.tar.gz"}, ""},
+		{"streaming validator", tarball, ApplyOptions{AssetName: "foo.tar.gz", Validator: &SHA2Validator{}, ValidationData: hash}, ""},
+		{"validator", content, ApplyOptions{Validator: &Ed25519Validator{PublicKey: pub}, ValidationData: ed25519.Sign(priv, content)}, ""},
+		{"binary name", tarGz(t, map[string][]byte{"server": content}), ApplyOptions{AssetName: "foo.tgz", BinaryName: "server"}, ""},
+		{"hash mismatch", tarball, ApplyOptions{AssetName: "foo.tar.gz", Validator: &SHA2Validator{}, ValidationData: bytes.Repeat([]byte("0"), 64)}, "hash mismatch"},
+		{"bad signature", content, ApplyOptions{Validator: &Ed25519Validator{PublicKey: pub}, ValidationData: make([]byte, ed25519.SignatureSize)}, "failed validating content"},
+		{"not executable", []byte("<html></html>"), ApplyOptions{}, "is broken"},
+		{"unsupported format", content, ApplyOptions{AssetName: "foo_darwin_amd64.dmg"}, "unsupported file extension"},
+		{"plain binary extension", content, ApplyOptions{AssetName: "foo_linux_amd64.run", PlainBinaryExtensions: []string{".run"}}, ""},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			path := setupOldExecutable(t)
+
+			err := ApplyFromReader(bytes.NewReader(tc.content), path, tc.opts)
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("wanted %q in error but got %v", tc.want, err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("executable should not be replaced: %q", b)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Fatalf("executable was not replaced: %q", b)
+			}
+		})
+	}
+}
+
+func TestApplyFromReaderOtherExecutables(t *testing.T) {
+	if executableMagics(runtime.GOOS) == nil {
+		t.Skip("executable format of", runtime.GOOS, "is unknown")
+	}
+
+	script := []byte("#!/bin/sh\necho 1.2.3\n")
+
+	for _, tc := range []struct {
+		what    string
+		content []byte
+		opts    ApplyOptions
+	}{
+		{"script", script, ApplyOptions{CheckExecutablePlatform: true}},
+		{"skip check", []byte("<html></html>"), ApplyOptions{SkipExecutableCheck: true}},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			if tc.what == "script" && runtime.GOOS == "windows" {
+				t.Skip("scripts are not executables on Windows")
+			}
+
+			path := setupOldExecutable(t)
+			if err := ApplyFromReader(bytes.NewReader(tc.content), path, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tc.content) {
+				t.Fatalf("executable was not replaced: %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateSkipExecutableCheck(t *testing.T) {
+	content := []byte("<html>not an executable</html>")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": content})}}})
+
+	for _, skip := range []bool{false, true} {
+		t.Run(fmt.Sprint(skip), func(t *testing.T) {
+			if !skip && executableMagics(runtime.GOOS) == nil {
+				t.Skip("executable format of", runtime.GOOS, "is unknown")
+			}
+
+			up, _ := newTestUpdater(t, Config{SkipExecutableCheck: skip}, gh)
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if !skip {
+				if err == nil || !strings.Contains(err.Error(), "is broken") {
+					t.Fatal("Broken executable should be rejected but got", err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Fatalf("executable was not replaced: %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateWithCommitFunc(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": exe})}}})
+
+	t.Run("staging directory", func(t *testing.T) {
+		staging := filepath.Join(t.TempDir(), "foo.staged")
+		var committed []string
+		up, _ := newTestUpdater(t, Config{CommitFunc: func(newBinaryPath, targetPath string) error {
+			committed = []string{newBinaryPath, targetPath}
+			b, err := ioutil.ReadFile(newBinaryPath)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(staging, b, 0755)
+		}}, gh)
+
+		path := setupOldExecutable(t)
+		if _, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(committed) != 2 || committed[1] != path || filepath.Dir(committed[0]) != filepath.Dir(path) {
+			t.Fatal("CommitFunc should be called with the new executable and the target:", committed)
+		}
+		if _, err := os.Stat(committed[0]); !os.IsNotExist(err) {
+			t.Error("New executable should be removed after commit:", err)
+		}
+		if b, err := ioutil.ReadFile(staging); err != nil || !bytes.Equal(b, exe) {
+			t.Fatalf("New executable should be staged but got %q: %v", b, err)
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != "old executable" {
+			t.Fatalf("Target should not be replaced by the default commit but got %q: %v", b, err)
+		}
+	})
+
+	t.Run("wrapping default", func(t *testing.T) {
+		called := false
+		up, _ := newTestUpdater(t, Config{CommitFunc: func(newBinaryPath, targetPath string) error {
+			if err := CommitByRename(newBinaryPath, targetPath); err != nil {
+				return err
+			}
+			called = true
+			return nil
+		}}, gh)
+
+		path := setupOldExecutable(t)
+		if _, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, exe) || !called {
+			t.Fatalf("Executable should be replaced but got %q: %v", b, err)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		errCommit := errors.New("supervisor is not running")
+		up, _ := newTestUpdater(t, Config{CommitFunc: func(newBinaryPath, targetPath string) error {
+			return errCommit
+		}}, gh)
+
+		path := setupOldExecutable(t)
+		_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+		if !errors.Is(err, errCommit) {
+			t.Fatal("Error of CommitFunc should be returned:", err)
+		}
+		files, err := ioutil.ReadDir(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Error("New executable should be removed on failure:", files)
+		}
+	})
+}
+
+func TestApplyFromReaderWithCommitFunc(t *testing.T) {
+	content := fakeExecutableContent(t, "new executable")
+	path := setupOldExecutable(t)
+	var target string
+
+	err := ApplyFromReader(bytes.NewReader(content), path, ApplyOptions{CommitFunc: func(newBinaryPath, targetPath string) error {
+		target = targetPath
+		return os.Rename(newBinaryPath, targetPath)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, content) || target != path {
+		t.Fatalf("Executable should be committed by CommitFunc but got %q: %v", b, err)
+	}
+}
+
+func TestUpdateWithFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode is ignored on Windows")
+	}
+
+	exe := fakeExecutableContent(t, "v1.2.3")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": exe})}}})
+
+	for _, tc := range []struct {
+		what    string
+		mode    os.FileMode
+		current os.FileMode
+		want    os.FileMode
+	}{
+		{"configured", 0o750, 0o755, 0o750},
+		{"configured with extra bits", os.ModeSetuid | 0o700, 0o755, 0o700},
+		{"kept", 0, 0o710, 0o710},
+		{"current not executable", 0, 0o600, 0o755},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			path := setupOldExecutable(t)
+			if err := os.Chmod(path, tc.current); err != nil {
+				t.Fatal(err)
+			}
+
+			up, _ := newTestUpdater(t, Config{FileMode: tc.mode}, gh)
+			if _, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+				t.Fatal(err)
+			}
+
+			st, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			perm := st.Mode().Perm()
+			if tc.mode == 0 && tc.current&0o111 == 0 {
+				// The default mode is masked by umask
+				if perm&^tc.want != 0 || perm&0o100 == 0 {
+					t.Fatalf("Wanted mode %s masked by umask but got %s", tc.want, perm)
+				}
+				return
+			}
+			if perm != tc.want {
+				t.Fatalf("Wanted mode %s but got %s", tc.want, perm)
+			}
+		})
+	}
+
+	t.Run("apply from reader", func(t *testing.T) {
+		path := setupOldExecutable(t)
+		if err := ApplyFromReader(bytes.NewReader(exe), path, ApplyOptions{FileMode: 0o700}); err != nil {
+			t.Fatal(err)
+		}
+		if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0o700 {
+			t.Fatal("FileMode should be applied:", st.Mode(), err)
+		}
+	})
+}
@@ -0,0 +1,631 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+const (
+	// GitHubActionsOIDCIssuer is the OIDC issuer of certificates issued to GitHub Actions workflows.
+	GitHubActionsOIDCIssuer = "https://token.actions.githubusercontent.com"
+
+	inTotoPayloadType = "application/vnd.in-toto+json"
+)
+
+var (
+	// OIDC issuer extensions of Fulcio certificates. The former is deprecated and contains a raw string while
+	// the latter contains a DER-encoded UTF8String.
+	oidFulcioIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidFulcioIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// AttestationValidator validates a release asset with its artifact attestation published by GitHub
+// (`gh attestation verify`). Attestations are not release assets: they are fetched from the attestations API of
+// the repository with the SHA-256 digest of the downloaded asset. The attestation is a sigstore bundle whose
+// DSSE envelope contains an in-toto statement about the asset. It is verified as follows:
+//
+// - The signing certificate chains to Roots and was valid when the entry was integrated in the transparency log, as
+// the signed entry timestamp of the log promises
+// - The certificate was issued to CertificateIdentity by OIDCIssuer
+// - The envelope is signed by the certificate and its statement has the digest of the asset as subject
+// - The entry of the transparency log matches the envelope and is included in the log of RekorPublicKey
+type AttestationValidator struct {
+	// Roots are the trusted root certificates of the certificate authority (Fulcio) issuing signing certificates.
+	Roots *x509.CertPool
+	// Intermediates are the intermediate certificates of the certificate authority. Certificates in bundles are
+	// also used.
+	Intermediates *x509.CertPool
+	// RekorPublicKey is the public key of the transparency log (Rekor) which signs its checkpoints.
+	RekorPublicKey crypto.PublicKey
+	// CertificateIdentity is a regular expression matched with the subject alternative name of the signing
+	// certificate, e.g. `^https://github\.com/owner/repo/\.github/workflows/release\.yml@refs/tags/` for the workflow
+	// building the release. It must be set since the public certificate authority issues certificates to anyone.
+	CertificateIdentity string
+	// OIDCIssuer is the expected issuer of the identity. If empty, GitHubActionsOIDCIssuer is used.
+	OIDCIssuer string
+	// PredicateType is the expected predicate type of the attestation such as "https://slsa.dev/provenance/v1".
+	// If empty, any predicate type is accepted.
+	PredicateType string
+}
+
+// remoteValidator is implemented by validators whose validation data is not a release asset, e.g. it is fetched
+// from GitHub API. Such validators do not require a validation asset on detecting releases.
+type remoteValidator interface {
+	fetchValidationData(ctx context.Context, api *github.Client, rel *Release, release []byte) ([]byte, error)
+}
+
+func isRemoteValidator(v Validator) bool {
+	_, ok := v.(remoteValidator)
+
+	return ok
+}
+
+// Suffix is not used by AttestationValidator since attestations are not release assets.
+func (v *AttestationValidator) Suffix() string {
+	return ""
+}
+
+func (v *AttestationValidator) fetchValidationData(ctx context.Context, api *github.Client, rel *Release, release []byte) ([]byte, error) {
+	digest := sha256.Sum256(release)
+
+	req, err := api.NewRequest("GET", fmt.Sprintf("repos/%s/%s/attestations/sha256:%x", rel.RepoOwner, rel.RepoName, digest), nil)
+	if err != nil {
+		return nil, fmt.Errorf("attestation: failed to create request: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := api.Do(ctx, req, &buf); err != nil {
+		return nil, fmt.Errorf("attestation: failed to fetch attestations of %s from repository '%s/%s': %w", rel.assetName(), rel.RepoOwner, rel.RepoName, asRateLimitError(err))
+	}
+
+	return buf.Bytes(), nil
+}
+
+type sigstoreRawBytes struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+type sigstoreBundle struct {
+	VerificationMaterial struct {
+		Certificate          *sigstoreRawBytes `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []sigstoreRawBytes `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []sigstoreTlogEntry `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	DSSEEnvelope *struct {
+		Payload     []byte `json:"payload"`
+		PayloadType string `json:"payloadType"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	} `json:"dsseEnvelope"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+type sigstoreTlogEntry struct {
+	KindVersion struct {
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+	} `json:"kindVersion"`
+	LogIndex string `json:"logIndex"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	IntegratedTime   string `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex   string   `json:"logIndex"`
+		RootHash   []byte   `json:"rootHash"`
+		TreeSize   string   `json:"treeSize"`
+		Hashes     [][]byte `json:"hashes"`
+		Checkpoint struct {
+			Envelope string `json:"envelope"`
+		} `json:"checkpoint"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+// Validate validates the release against attestations. asset is either the response of the attestations API,
+// which can contain several attestations, or a single sigstore bundle. Validation succeeds when any of
+// the attestations is verified.
+func (v *AttestationValidator) Validate(release, asset []byte) error {
+	var res struct {
+		Attestations []struct {
+			Bundle json.RawMessage `json:"bundle"`
+		} `json:"attestations"`
+	}
+
+	if err := json.Unmarshal(asset, &res); err != nil {
+		return fmt.Errorf("attestation: failed to parse attestations: %w", err)
+	}
+
+	bundles := make([]json.RawMessage, 0, len(res.Attestations))
+	for _, a := range res.Attestations {
+		bundles = append(bundles, a.Bundle)
+	}
+
+	if res.Attestations == nil {
+		bundles = append(bundles, asset)
+	}
+
+	if len(bundles) == 0 {
+		return fmt.Errorf("attestation: no attestation is found")
+	}
+
+	digest := sha256.Sum256(release)
+
+	errs := make([]string, 0, len(bundles))
+
+	for _, b := range bundles {
+		var bundle sigstoreBundle
+		if err := json.Unmarshal(b, &bundle); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to parse bundle: %s", err))
+
+			continue
+		}
+
+		if err := v.verifyBundle(&bundle, digest[:]); err != nil {
+			errs = append(errs, err.Error())
+
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("attestation: validation failed: %s", strings.Join(errs, "; "))
+}
+
+func (v *AttestationValidator) verifyBundle(b *sigstoreBundle, digest []byte) error {
+	if b.DSSEEnvelope == nil || len(b.DSSEEnvelope.Signatures) == 0 {
+		return fmt.Errorf("bundle has no signed DSSE envelope")
+	}
+
+	leaf, entry, err := verifyBundleCertificate(b, v.Roots, v.Intermediates, []crypto.PublicKey{v.RekorPublicKey})
+	if err != nil {
+		return err
+	}
+
+	if err := v.verifyIdentity(leaf); err != nil {
+		return err
+	}
+
+	env := b.DSSEEnvelope
+	sig := env.Signatures[0].Sig
+
+	if err := verifyWithCertificate(leaf, dssePAE(env.PayloadType, env.Payload), sig); err != nil {
+		return fmt.Errorf("failed to verify signature of DSSE envelope: %w", err)
+	}
+
+	if err := v.verifyStatement(env.PayloadType, env.Payload, digest); err != nil {
+		return err
+	}
+
+	return v.verifyTlogEntry(entry, env.Payload, sig, leaf)
+}
+
+// verifyBundleCertificate verifies that the signing certificate of the bundle chains to roots at the integrated time
+// of its transparency log entry signed by any of the keys, and returns it with the entry.
+func verifyBundleCertificate(b *sigstoreBundle, roots, intermediates *x509.CertPool, keys []crypto.PublicKey) (*x509.Certificate, *sigstoreTlogEntry, error) { //nolint:cyclop
+	certs := []sigstoreRawBytes{}
+	if b.VerificationMaterial.Certificate != nil {
+		certs = append(certs, *b.VerificationMaterial.Certificate)
+	} else if b.VerificationMaterial.X509CertificateChain != nil {
+		certs = b.VerificationMaterial.X509CertificateChain.Certificates
+	}
+
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("bundle has no signing certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(certs[0].RawBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+
+	if len(b.VerificationMaterial.TlogEntries) == 0 {
+		return nil, nil, fmt.Errorf("bundle has no transparency log entry")
+	}
+
+	entry := &b.VerificationMaterial.TlogEntries[0]
+
+	integrated, err := verifyIntegratedTime(entry, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if intermediates != nil {
+		pool = intermediates.Clone()
+	}
+
+	for _, c := range certs[1:] {
+		cert, err := x509.ParseCertificate(c.RawBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse certificate in chain: %w", err)
+		}
+
+		pool.AddCert(cert)
+	}
+
+	// Signing certificates are short-lived. They must be valid when the signature was logged
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		CurrentTime:   integrated,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, nil, fmt.Errorf("failed to verify signing certificate: %w", err)
+	}
+
+	return leaf, entry, nil
+}
+
+// verifyIntegratedTime verifies the signed entry timestamp (inclusion promise) of the transparency log entry with any
+// of the keys and returns the integrated time of the entry. The time is not trusted without it since anyone can edit
+// the bundle. RFC 3161 timestamps are not supported.
+func verifyIntegratedTime(entry *sigstoreTlogEntry, keys []crypto.PublicKey) (time.Time, error) {
+	integrated, err := strconv.ParseInt(entry.IntegratedTime, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid integrated time %q of transparency log entry: %w", entry.IntegratedTime, err)
+	}
+
+	if entry.InclusionPromise == nil || len(entry.InclusionPromise.SignedEntryTimestamp) == 0 {
+		return time.Time{}, fmt.Errorf("transparency log entry has no signed entry timestamp to verify its integrated time")
+	}
+
+	index, err := strconv.ParseInt(entry.LogIndex, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid log index %q of transparency log entry: %w", entry.LogIndex, err)
+	}
+
+	// The signed entry timestamp signs the canonical JSON of the entry, whose keys are sorted
+	promise, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{
+		Body:           base64.StdEncoding.EncodeToString(entry.CanonicalizedBody),
+		IntegratedTime: integrated,
+		LogID:          hex.EncodeToString(entry.LogID.KeyID),
+		LogIndex:       index,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to encode transparency log entry: %w", err)
+	}
+
+	trusted := false
+
+	for _, k := range keys {
+		if k == nil {
+			continue
+		}
+
+		trusted = true
+
+		if verifyWithPublicKey(k, promise, entry.InclusionPromise.SignedEntryTimestamp) == nil {
+			return time.Unix(integrated, 0), nil
+		}
+	}
+
+	if !trusted {
+		return time.Time{}, fmt.Errorf("public key of transparency log is not set")
+	}
+
+	return time.Time{}, fmt.Errorf("signed entry timestamp of transparency log entry cannot be verified")
+}
+
+func (v *AttestationValidator) verifyIdentity(cert *x509.Certificate) error {
+	// An empty regular expression matches any identity
+	if v.CertificateIdentity == "" {
+		return fmt.Errorf("CertificateIdentity is not set. Set the identity of the workflow building the release")
+	}
+
+	issuer := v.OIDCIssuer
+	if issuer == "" {
+		issuer = GitHubActionsOIDCIssuer
+	}
+
+	return verifyCertificateIdentity(cert, v.CertificateIdentity, issuer)
+}
+
+// verifyCertificateIdentity verifies that the certificate was issued by the OIDC issuer to an identity matching the
+// regular expression. The issuer is not checked when it is empty, and an empty identity matches any identity, so
+// callers must reject them unless any identity is explicitly allowed.
+func verifyCertificateIdentity(cert *x509.Certificate, identity, issuer string) error {
+	actual := ""
+
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidFulcioIssuerV2):
+			var s string
+			if _, err := asn1.Unmarshal(ext.Value, &s); err == nil {
+				actual = s
+			}
+		case ext.Id.Equal(oidFulcioIssuerV1) && actual == "":
+			actual = string(ext.Value)
+		}
+	}
+
+	if issuer != "" && actual != issuer {
+		return fmt.Errorf("OIDC issuer of signing certificate mismatch: expected=%q, got=%q", issuer, actual)
+	}
+
+	re, err := regexp.Compile(identity)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression %q for certificate identity: %w", identity, err)
+	}
+
+	ids := make([]string, 0, len(cert.URIs)+len(cert.EmailAddresses))
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+
+	ids = append(ids, cert.EmailAddresses...)
+
+	for _, id := range ids {
+		if re.MatchString(id) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("identity %q of signing certificate does not match %q", ids, identity)
+}
+
+func (v *AttestationValidator) verifyStatement(payloadType string, payload, digest []byte) error {
+	if payloadType != inTotoPayloadType {
+		return fmt.Errorf("unexpected payload type %q of DSSE envelope", payloadType)
+	}
+
+	var statement struct {
+		Subject []struct {
+			Name   string            `json:"name"`
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		PredicateType string `json:"predicateType"`
+	}
+
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return fmt.Errorf("failed to parse in-toto statement: %w", err)
+	}
+
+	if v.PredicateType != "" && statement.PredicateType != v.PredicateType {
+		return fmt.Errorf("predicate type mismatch: expected=%q, got=%q", v.PredicateType, statement.PredicateType)
+	}
+
+	want := hex.EncodeToString(digest)
+	for _, s := range statement.Subject {
+		if strings.EqualFold(s.Digest["sha256"], want) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("sha256 digest %s of asset is not a subject of the attestation", want)
+}
+
+func (v *AttestationValidator) verifyTlogEntry(entry *sigstoreTlogEntry, payload, sig []byte, cert *x509.Certificate) error { //nolint:cyclop
+	if entry.KindVersion.Kind != "dsse" {
+		return fmt.Errorf("unsupported kind %q of transparency log entry", entry.KindVersion.Kind)
+	}
+
+	// The logged entry must be the one for this envelope
+	var body struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			PayloadHash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"payloadHash"`
+			Signatures []struct {
+				Signature []byte `json:"signature"`
+				Verifier  []byte `json:"verifier"`
+			} `json:"signatures"`
+		} `json:"spec"`
+	}
+
+	if err := json.Unmarshal(entry.CanonicalizedBody, &body); err != nil {
+		return fmt.Errorf("failed to parse transparency log entry: %w", err)
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	if body.Kind != "dsse" || body.Spec.PayloadHash.Algorithm != "sha256" || body.Spec.PayloadHash.Value != hex.EncodeToString(payloadHash[:]) {
+		return fmt.Errorf("transparency log entry does not match the payload of DSSE envelope")
+	}
+
+	logged := false
+
+	for _, s := range body.Spec.Signatures {
+		block, _ := pem.Decode(s.Verifier)
+		if bytes.Equal(s.Signature, sig) && block != nil && bytes.Equal(block.Bytes, cert.Raw) {
+			logged = true
+
+			break
+		}
+	}
+
+	if !logged {
+		return fmt.Errorf("transparency log entry does not match the signature of DSSE envelope")
+	}
+
+	return verifyTlogInclusion(entry, []crypto.PublicKey{v.RekorPublicKey})
+}
+
+// verifyTlogInclusion verifies the inclusion proof of the transparency log entry offline with the checkpoint signed by
+// any of the keys of the transparency log.
+func verifyTlogInclusion(entry *sigstoreTlogEntry, keys []crypto.PublicKey) error {
+	proof := entry.InclusionProof
+	if proof == nil {
+		return fmt.Errorf("transparency log entry has no inclusion proof")
+	}
+
+	index, err := strconv.ParseInt(proof.LogIndex, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid log index %q of inclusion proof: %w", proof.LogIndex, err)
+	}
+
+	size, err := strconv.ParseInt(proof.TreeSize, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid tree size %q of inclusion proof: %w", proof.TreeSize, err)
+	}
+
+	if err := verifyInclusion(entry.CanonicalizedBody, index, size, proof.Hashes, proof.RootHash); err != nil {
+		return err
+	}
+
+	return verifyCheckpoint(keys, proof.Checkpoint.Envelope, size, proof.RootHash)
+}
+
+// verifyCheckpoint verifies the checkpoint of the transparency log, a signed note whose body consists of the origin,
+// the tree size and the base64-encoded root hash.
+func verifyCheckpoint(keys []crypto.PublicKey, note string, size int64, root []byte) error {
+	trusted := make([]crypto.PublicKey, 0, len(keys))
+	for _, k := range keys {
+		if k != nil {
+			trusted = append(trusted, k)
+		}
+	}
+
+	if len(trusted) == 0 {
+		return fmt.Errorf("public key of transparency log is not set")
+	}
+
+	sep := strings.Index(note, "\n\n")
+	if sep < 0 {
+		return fmt.Errorf("invalid checkpoint of transparency log")
+	}
+
+	text, sigs := note[:sep+1], note[sep+2:]
+
+	lines := strings.Split(text, "\n")
+	if len(lines) < 3 || lines[1] != strconv.FormatInt(size, 10) || lines[2] != base64.StdEncoding.EncodeToString(root) {
+		return fmt.Errorf("checkpoint of transparency log does not match inclusion proof")
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(sigs), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "—" {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(fields[2])
+		// The first 4 bytes are the hint of the key
+		if err != nil || len(b) <= 4 {
+			continue
+		}
+
+		for _, k := range trusted {
+			if verifyWithPublicKey(k, []byte(text), b[4:]) == nil {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("signature of checkpoint of transparency log cannot be verified")
+}
+
+// dssePAE returns the pre-authentication encoding of DSSE, which is what a DSSE envelope signs.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func verifyWithCertificate(cert *x509.Certificate, message, sig []byte) error {
+	return verifyWithPublicKey(cert.PublicKey, message, sig)
+}
+
+func verifyWithPublicKey(key crypto.PublicKey, message, sig []byte) error {
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	var digest []byte
+
+	if pub.Curve == elliptic.P384() {
+		h := crypto.SHA384.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	} else {
+		h := sha256.Sum256(message)
+		digest = h[:]
+	}
+
+	if !ecdsa.VerifyASN1(pub, digest, sig) {
+		return fmt.Errorf("ecdsa: signature verification failed")
+	}
+
+	return nil
+}
+
+// verifyInclusion verifies the Merkle inclusion proof of the leaf at index in the tree of size as specified by
+// RFC 9162 section 2.1.3.2.
+func verifyInclusion(leaf []byte, index, size int64, proof [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("log index %d of inclusion proof is out of tree size %d", index, size)
+	}
+
+	hash := sha256.Sum256(append([]byte{0}, leaf...))
+	r := hash[:]
+	fn, sn := index, size-1
+
+	for _, p := range proof {
+		if sn == 0 {
+			return fmt.Errorf("inclusion proof is too long")
+		}
+
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, root) {
+		return fmt.Errorf("inclusion proof of transparency log entry cannot be verified")
+	}
+
+	return nil
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,429 @@
+package selfupdate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAttestationIdentity = "https://github.com/owner/repo/.github/workflows/release.yml@refs/tags/v1.2.3"
+
+// fakeSigstore issues attestations in the same format as GitHub artifact attestations with a throwaway CA and
+// transparency log.
+type fakeSigstore struct {
+	roots    *x509.CertPool
+	caKey    *ecdsa.PrivateKey
+	ca       *x509.Certificate
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newFakeSigstore(t *testing.T) *fakeSigstore {
+	caKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return &fakeSigstore{roots: roots, caKey: caKey, ca: ca, rekorKey: rekorKey}
+}
+
+func (s *fakeSigstore) validator() *AttestationValidator {
+	return &AttestationValidator{
+		Roots:               s.roots,
+		RekorPublicKey:      &s.rekorKey.PublicKey,
+		CertificateIdentity: `^https://github\.com/owner/repo/\.github/workflows/release\.yml@`,
+	}
+}
+
+// issue returns the key and the DER of a signing certificate issued to the identity by the issuer.
+func (s *fakeSigstore) issue(t *testing.T, identity, issuer string) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerExt, err := asn1.MarshalWithParams(issuer, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{u},
+		ExtraExtensions: []pkix.Extension{{Id: oidFulcioIssuerV2, Value: issuerExt}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, &key.PublicKey, s.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, der
+}
+
+// logEntry returns the transparency log entry of the body logged at index 2 of a transparency log with 5 entries.
+func (s *fakeSigstore) logEntry(t *testing.T, kind string, body []byte) map[string]interface{} {
+	leaves := [][]byte{[]byte("a"), []byte("b"), body, []byte("d"), []byte("e")}
+	hashes := make([][]byte, 0, len(leaves))
+	for _, l := range leaves {
+		h := sha256.Sum256(append([]byte{0}, l...))
+		hashes = append(hashes, h[:])
+	}
+	// Tree of 5 leaves: root = H(H(H(0,1), H(2,3)), 4)
+	n01 := merkleNodeHash(hashes[0], hashes[1])
+	n23 := merkleNodeHash(hashes[2], hashes[3])
+	root := merkleNodeHash(merkleNodeHash(n01, n23), hashes[4])
+	proof := [][]byte{hashes[3], n01, hashes[4]}
+
+	note := fmt.Sprintf("rekor.example.com - 1234\n5\n%s\n", base64.StdEncoding.EncodeToString(root))
+	noteSig := append([]byte{1, 2, 3, 4}, signTest(t, s.rekorKey, []byte(note))...)
+	checkpoint := fmt.Sprintf("%s\n— rekor.example.com %s\n", note, base64.StdEncoding.EncodeToString(noteSig))
+
+	pub, err := x509.MarshalPKIXPublicKey(&s.rekorKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(pub)
+	integrated := time.Now().Unix()
+	promise, err := json.Marshal(map[string]interface{}{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": integrated,
+		"logID":          fmt.Sprintf("%x", logID),
+		"logIndex":       2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"logIndex":         "2",
+		"logId":            map[string][]byte{"keyId": logID[:]},
+		"kindVersion":      map[string]string{"kind": kind, "version": "0.0.1"},
+		"integratedTime":   fmt.Sprint(integrated),
+		"inclusionPromise": map[string][]byte{"signedEntryTimestamp": signTest(t, s.rekorKey, promise)},
+		"inclusionProof": map[string]interface{}{
+			"logIndex":   "2",
+			"rootHash":   root,
+			"treeSize":   "5",
+			"hashes":     proof,
+			"checkpoint": map[string]string{"envelope": checkpoint},
+		},
+		"canonicalizedBody": body,
+	}
+}
+
+// attest returns a sigstore bundle attesting the content, signed by a certificate issued to the identity.
+func (s *fakeSigstore) attest(t *testing.T, content []byte, identity, issuer string) []byte {
+	digest := sha256.Sum256(content)
+	payload := fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"foo","digest":{"sha256":"%x"}}],"predicateType":"https://slsa.dev/provenance/v1","predicate":{}}`, digest)
+	return s.attestStatement(t, payload, identity, issuer)
+}
+
+// attestStatement returns a sigstore bundle of the in-toto statement, signed by a certificate issued to the identity.
+func (s *fakeSigstore) attestStatement(t *testing.T, statement, identity, issuer string) []byte {
+	key, der := s.issue(t, identity, issuer)
+
+	payload := []byte(statement)
+	sig := signTest(t, key, dssePAE(inTotoPayloadType, payload))
+
+	payloadHash := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]interface{}{
+			"payloadHash": map[string]string{"algorithm": "sha256", "value": fmt.Sprintf("%x", payloadHash)},
+			"signatures": []map[string][]byte{{
+				"signature": sig,
+				"verifier":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{
+			"certificate": map[string][]byte{"rawBytes": der},
+			"tlogEntries": []map[string]interface{}{s.logEntry(t, "dsse", body)},
+		},
+		"dsseEnvelope": map[string]interface{}{
+			"payload":     payload,
+			"payloadType": inTotoPayloadType,
+			"signatures":  []map[string][]byte{{"sig": sig}},
+		},
+	}
+	b, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func signTest(t *testing.T, key *ecdsa.PrivateKey, message []byte) []byte {
+	h := sha256.Sum256(message)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// tamperTlogEntry returns the bundle whose transparency log entry is modified by tamper.
+func tamperTlogEntry(t *testing.T, bundle []byte, tamper func(entry map[string]interface{})) []byte {
+	var b map[string]interface{}
+	if err := json.Unmarshal(bundle, &b); err != nil {
+		t.Fatal(err)
+	}
+	tamper(b["verificationMaterial"].(map[string]interface{})["tlogEntries"].([]interface{})[0].(map[string]interface{}))
+	tampered, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tampered
+}
+
+func attestationsResponse(bundles ...[]byte) []byte {
+	var b strings.Builder
+	b.WriteString(`{"attestations":[`)
+	for i, bundle := range bundles {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"repository_id":1,"bundle":%s}`, bundle)
+	}
+	b.WriteString("]}")
+	return []byte(b.String())
+}
+
+func TestAttestationValidator(t *testing.T) {
+	s := newFakeSigstore(t)
+	content := []byte("release asset")
+	bundle := s.attest(t, content, testAttestationIdentity, GitHubActionsOIDCIssuer)
+
+	if err := s.validator().Validate(content, bundle); err != nil {
+		t.Fatal("bundle was not verified:", err)
+	}
+	if err := s.validator().Validate(content, attestationsResponse(bundle)); err != nil {
+		t.Fatal("API response was not verified:", err)
+	}
+
+	other := s.attest(t, []byte("other asset"), testAttestationIdentity, GitHubActionsOIDCIssuer)
+	if err := s.validator().Validate(content, attestationsResponse(other, bundle)); err != nil {
+		t.Fatal("any of attestations should be verified:", err)
+	}
+
+	v := s.validator()
+	v.PredicateType = "https://slsa.dev/provenance/v1"
+	if err := v.Validate(content, bundle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttestationValidatorFail(t *testing.T) {
+	s := newFakeSigstore(t)
+	content := []byte("release asset")
+	bundle := s.attest(t, content, testAttestationIdentity, GitHubActionsOIDCIssuer)
+
+	otherIssuer := s.validator()
+	otherIssuer.OIDCIssuer = "https://issuer.example.com"
+	otherPredicate := s.validator()
+	otherPredicate.PredicateType = "https://spdx.dev/Document"
+	otherRekor := s.validator()
+	otherRekor.RekorPublicKey = &s.caKey.PublicKey
+	untrusted := s.validator()
+	untrusted.Roots = x509.NewCertPool()
+	noIdentity := s.validator()
+	noIdentity.CertificateIdentity = ""
+
+	var tampered map[string]interface{}
+	if err := json.Unmarshal(bundle, &tampered); err != nil {
+		t.Fatal(err)
+	}
+	proof := tampered["verificationMaterial"].(map[string]interface{})["tlogEntries"].([]interface{})[0].(map[string]interface{})["inclusionProof"].(map[string]interface{})
+	proof["logIndex"] = "3"
+	tamperedProof, err := json.Marshal(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedTime := tamperTlogEntry(t, bundle, func(entry map[string]interface{}) {
+		entry["integratedTime"] = fmt.Sprint(time.Now().Add(-30 * time.Second).Unix())
+	})
+	noPromise := tamperTlogEntry(t, bundle, func(entry map[string]interface{}) { delete(entry, "inclusionPromise") })
+
+	for _, tc := range []struct {
+		what      string
+		validator *AttestationValidator
+		content   []byte
+		asset     []byte
+		want      string
+	}{
+		{"other content", s.validator(), []byte("malicious"), bundle, "is not a subject"},
+		{"other identity", s.validator(), content, s.attest(t, content, "https://github.com/evil/repo/.github/workflows/release.yml@refs/tags/v1.2.3", GitHubActionsOIDCIssuer), "does not match"},
+		{"other issuer", otherIssuer, content, bundle, "OIDC issuer"},
+		{"no identity", noIdentity, content, bundle, "CertificateIdentity is not set"},
+		{"other predicate", otherPredicate, content, bundle, "predicate type mismatch"},
+		{"other transparency log", otherRekor, content, bundle, "signed entry timestamp"},
+		{"untrusted CA", untrusted, content, bundle, "failed to verify signing certificate"},
+		{"tampered inclusion proof", s.validator(), content, tamperedProof, "inclusion proof"},
+		{"tampered integrated time", s.validator(), content, tamperedTime, "signed entry timestamp of transparency log entry cannot be verified"},
+		{"no signed entry timestamp", s.validator(), content, noPromise, "has no signed entry timestamp"},
+		{"no attestation", s.validator(), content, []byte(`{"attestations":[]}`), "no attestation"},
+		{"broken JSON", s.validator(), content, []byte(`{`), "failed to parse"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := tc.validator.Validate(tc.content, tc.asset)
+			if err == nil {
+				t.Fatal("error was not returned")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("wanted %q in error but got %q", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	leaves := [][]byte{[]byte("0"), []byte("1"), []byte("2")}
+	hashes := make([][]byte, 0, len(leaves))
+	for _, l := range leaves {
+		h := sha256.Sum256(append([]byte{0}, l...))
+		hashes = append(hashes, h[:])
+	}
+	n01 := merkleNodeHash(hashes[0], hashes[1])
+	root := merkleNodeHash(n01, hashes[2])
+
+	for _, tc := range []struct {
+		index int64
+		proof [][]byte
+	}{
+		{0, [][]byte{hashes[1], hashes[2]}},
+		{1, [][]byte{hashes[0], hashes[2]}},
+		{2, [][]byte{n01}},
+	} {
+		if err := verifyInclusion(leaves[tc.index], tc.index, 3, tc.proof, root); err != nil {
+			t.Errorf("leaf %d was not verified: %s", tc.index, err)
+		}
+	}
+
+	single := sha256.Sum256([]byte{0, 'x'})
+	if err := verifyInclusion([]byte("x"), 0, 1, nil, single[:]); err != nil {
+		t.Error("tree of one leaf was not verified:", err)
+	}
+	if err := verifyInclusion(leaves[2], 2, 3, [][]byte{hashes[0]}, root); err == nil {
+		t.Error("wrong proof was verified")
+	}
+	if err := verifyInclusion(leaves[0], 3, 3, nil, root); err == nil {
+		t.Error("out of range index was verified")
+	}
+}
+
+func TestUpdateWithAttestationValidator(t *testing.T) {
+	s := newFakeSigstore(t)
+	exe := fakeExecutableContent(t, "new executable")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+
+	for _, tc := range []struct {
+		what     string
+		attested []byte
+		wantErr  bool
+	}{
+		{"attested", asset, false},
+		{"not attested", []byte("other asset"), true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: platformAssetName("foo", ".tar.gz"), content: asset},
+			}})
+			digest := sha256.Sum256(tc.attested)
+			attestations := attestationsResponse(s.attest(t, tc.attested, testAttestationIdentity, GitHubActionsOIDCIssuer))
+			requested := ""
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.Contains(r.URL.Path, "/attestations/") {
+					requested = r.URL.Path
+					if r.URL.Path != fmt.Sprintf("/api/v3/repos/owner/repo/attestations/sha256:%x", digest) {
+						http.NotFound(w, r)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.Write(attestations)
+					return
+				}
+				gh.ServeHTTP(w, r)
+			})
+			up, _ := newTestUpdater(t, Config{Validator: s.validator()}, handler)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("release was not found")
+			}
+
+			path := setupOldExecutable(t)
+			err = up.UpdateTo(rel, path)
+			if requested == "" {
+				t.Fatal("attestations were not fetched")
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("error was not returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != string(exe) {
+				t.Fatalf("executable was not updated: %q", b)
+			}
+		})
+	}
+}
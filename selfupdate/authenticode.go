@@ -0,0 +1,539 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+var (
+	oidSignedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSpcIndirectData     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidAttrContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRFC3161CounterSign  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+	oidTSTInfo             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	authenticodeDigestOIDs = map[string]crypto.Hash{
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+const winCertTypePKCSSignedData = 2
+
+// AuthenticodeValidator validates a Windows executable with the Authenticode signature embedded in it, as Windows
+// does before running a downloaded program. No validation file is needed. The signature is verified in pure Go, so
+// Windows assets can be verified on any platform. Map it to "windows" in Config.PlatformValidators to check only
+// Windows assets. When the asset is an archive, set Config.ValidateTarget to ValidateBinary so that the extracted
+// executable is validated. It is verified as follows:
+//
+// - The digest of the PE image excluding its checksum and signature matches the digest signed by the signature
+// - The signature is made by the signing certificate, which chains to Roots for code signing at the time of the RFC 3161
+// timestamp of the signature, or at the current time when the signature has no timestamp
+// - The timestamp is signed by a time stamping certificate chaining to TimestampRoots for the signature
+// - The certificate has Subject and Thumbprint when they are set
+//
+// As Windows does, a timestamped signature stays valid after the signing certificate expires. Only SHA-256, SHA-384
+// and SHA-512 digests with RSA or ECDSA keys are supported. Legacy Authenticode countersignatures, which are not
+// RFC 3161 timestamps, are ignored, so such signatures are verified at the current time. Nested signatures are ignored.
+type AuthenticodeValidator struct {
+	// Roots are the trusted root certificates. The system roots are used when nil.
+	Roots *x509.CertPool
+	// Subject is the expected subject of the signing certificate, compared with its common name or with its whole
+	// distinguished name such as "CN=Foo Inc.,O=Foo Inc.,C=US". Any subject is accepted when empty.
+	Subject string
+	// Thumbprint is the expected SHA-1 thumbprint of the signing certificate as displayed by Windows, or its SHA-256
+	// fingerprint, in hex. Spaces and colons are ignored. Any certificate is accepted when empty.
+	Thumbprint string
+	// TimestampRoots are the trusted root certificates of time stamping authorities. Roots are used when nil.
+	TimestampRoots *x509.CertPool
+}
+
+type authenticodeContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type authenticodeSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      authenticodeContentInfo
+	Certificates     asn1.RawValue            `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue            `asn1:"optional,tag:1"`
+	SignerInfos      []authenticodeSignerInfo `asn1:"set"`
+}
+
+type authenticodeSignerInfo struct {
+	Version               int
+	IssuerAndSerialNumber struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type authenticodeAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// tstInfo is the content of an RFC 3161 timestamp token. The optional fields after genTime are not read.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	SerialNumber *big.Int
+	GenTime      time.Time `asn1:"generalized"`
+}
+
+type spcIndirectDataContent struct {
+	Data          asn1.RawValue
+	MessageDigest struct {
+		DigestAlgorithm pkix.AlgorithmIdentifier
+		Digest          []byte
+	}
+}
+
+// peSignatureLayout is the location of the fields of a PE image which are excluded from its Authenticode digest.
+type peSignatureLayout struct {
+	checksum int
+	secDir   int
+	certs    int
+	certSize int
+}
+
+// Suffix is not used by AuthenticodeValidator since the signature is embedded in the executable.
+func (v *AuthenticodeValidator) Suffix() string {
+	return ""
+}
+
+func (v *AuthenticodeValidator) fetchValidationData(ctx context.Context, api *github.Client, rel *Release, release []byte) ([]byte, error) {
+	return nil, nil
+}
+
+// Validate verifies the Authenticode signature embedded in the Windows executable release. asset is not used.
+func (v *AuthenticodeValidator) Validate(release, asset []byte) error {
+	l, err := peSignatureLayoutOf(release)
+	if err != nil {
+		return fmt.Errorf("authenticode: %w", err)
+	}
+
+	if l.certSize == 0 {
+		return fmt.Errorf("authenticode: executable is not signed")
+	}
+
+	signed, err := authenticodeSignature(release[l.certs : l.certs+l.certSize])
+	if err != nil {
+		return fmt.Errorf("authenticode: %w", err)
+	}
+
+	cert, err := v.verifySignedData(signed, release, l)
+	if err != nil {
+		return fmt.Errorf("authenticode: validation failed: %w", err)
+	}
+
+	log.Println("Authenticode signature was verified. Signer:", cert.Subject)
+
+	return nil
+}
+
+// peSignatureLayoutOf reads the offsets of the checksum, the entry of the certificate table in the data directories
+// and the certificate table itself from the headers of the PE image.
+func peSignatureLayoutOf(data []byte) (peSignatureLayout, error) {
+	if len(data) < 0x40 || data[0] != 'M' || data[1] != 'Z' {
+		return peSignatureLayout{}, fmt.Errorf("executable is not a PE image")
+	}
+
+	pe := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	// Signature, file header and the magic of the optional header
+	if pe < 0 || pe+24+2 > len(data) || !bytes.Equal(data[pe:pe+4], []byte("PE\x00\x00")) {
+		return peSignatureLayout{}, fmt.Errorf("executable is not a PE image")
+	}
+
+	opt := pe + 24
+
+	var dirs int
+
+	switch magic := binary.LittleEndian.Uint16(data[opt:]); magic {
+	case 0x10b:
+		dirs = opt + 96
+	case 0x20b:
+		dirs = opt + 112
+	default:
+		return peSignatureLayout{}, fmt.Errorf("unknown magic 0x%x of PE optional header", magic)
+	}
+
+	// The certificate table is the fifth data directory
+	l := peSignatureLayout{checksum: opt + 64, secDir: dirs + 4*8}
+	if l.secDir+8 > len(data) || binary.LittleEndian.Uint32(data[dirs-4:]) < 5 {
+		return l, nil
+	}
+
+	// Unlike the other data directories, the address of the certificate table is a file offset
+	l.certs = int(binary.LittleEndian.Uint32(data[l.secDir:]))
+	l.certSize = int(binary.LittleEndian.Uint32(data[l.secDir+4:]))
+
+	if l.certSize > 0 && (l.certs <= l.secDir || l.certs+l.certSize > len(data) || l.certs+l.certSize < l.certs) {
+		return peSignatureLayout{}, fmt.Errorf("certificate table of PE image is out of the file")
+	}
+
+	return l, nil
+}
+
+// authenticodeDigest returns the Authenticode digest of the PE image, which is the hash of the whole file except
+// the checksum, the entry of the certificate table and the certificate table.
+func authenticodeDigest(data []byte, l peSignatureLayout, hash crypto.Hash) []byte {
+	h := hash.New()
+	h.Write(data[:l.checksum])
+	h.Write(data[l.checksum+4 : l.secDir])
+
+	if l.certSize == 0 {
+		h.Write(data[l.secDir+8:])
+	} else {
+		h.Write(data[l.secDir+8 : l.certs])
+		h.Write(data[l.certs+l.certSize:])
+	}
+
+	return h.Sum(nil)
+}
+
+// authenticodeSignature returns the PKCS#7 signed data of the first signature in the certificate table.
+func authenticodeSignature(table []byte) ([]byte, error) {
+	// WIN_CERTIFICATE is the length, the revision and the type followed by the certificate
+	if len(table) < 8 {
+		return nil, fmt.Errorf("certificate table of PE image is broken")
+	}
+
+	length := int(binary.LittleEndian.Uint32(table))
+	if length < 8 || length > len(table) {
+		return nil, fmt.Errorf("certificate table of PE image is broken")
+	}
+
+	if typ := binary.LittleEndian.Uint16(table[6:]); typ != winCertTypePKCSSignedData {
+		return nil, fmt.Errorf("unsupported type %d of certificate in PE image", typ)
+	}
+
+	return table[8:length], nil
+}
+
+func (v *AuthenticodeValidator) verifySignedData(der, image []byte, l peSignatureLayout) (*x509.Certificate, error) { //nolint:cyclop,funlen
+	var info authenticodeContentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil || !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("signature is not PKCS#7 signed data")
+	}
+
+	var sd authenticodeSignedData
+	// Raw values of explicitly tagged fields keep the tag, so the element is in the contents
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signed data: %w", err)
+	}
+
+	if !sd.ContentInfo.ContentType.Equal(oidSpcIndirectData) {
+		return nil, fmt.Errorf("unexpected content type %s of Authenticode signature", sd.ContentInfo.ContentType)
+	}
+
+	var signed asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse signed content: %w", err)
+	}
+
+	var content spcIndirectDataContent
+	if _, err := asn1.Unmarshal(signed.FullBytes, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse signed content: %w", err)
+	}
+
+	hash, ok := authenticodeDigestOIDs[content.MessageDigest.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s of PE image", content.MessageDigest.DigestAlgorithm.Algorithm)
+	}
+
+	if digest := authenticodeDigest(image, l, hash); !bytes.Equal(digest, content.MessageDigest.Digest) {
+		return nil, fmt.Errorf("digest %x of PE image does not match signed digest %x. The executable was modified after it was signed", digest, content.MessageDigest.Digest)
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("signature must have exactly one signer but has %d", len(sd.SignerInfos))
+	}
+
+	signer := sd.SignerInfos[0]
+
+	leaf, intermediates, err := signerCertificate(&sd, &signer)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signer signs the attributes, which contain the digest of the content without its tag and length
+	if err := verifySignerInfo(&signer, leaf, oidSpcIndirectData, signed.Bytes); err != nil {
+		return nil, err
+	}
+
+	signedAt, err := v.verifyTimestamp(&signer)
+	if err != nil {
+		return nil, err
+	}
+
+	// The current time is used when signedAt is zero
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   signedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to verify signing certificate %q: %w", leaf.Subject, err)
+	}
+
+	if err := v.verifySigner(leaf); err != nil {
+		return nil, err
+	}
+
+	return leaf, nil
+}
+
+// signerCertificate returns the certificate of the signer and the other certificates in the signed data.
+func signerCertificate(sd *authenticodeSignedData, signer *authenticodeSignerInfo) (*x509.Certificate, *x509.CertPool, error) {
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificates in signature: %w", err)
+	}
+
+	var leaf *x509.Certificate
+
+	intermediates := x509.NewCertPool()
+
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, signer.IssuerAndSerialNumber.Issuer.FullBytes) && c.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 {
+			leaf = c
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+
+	if leaf == nil {
+		return nil, nil, fmt.Errorf("signing certificate is not found in signature")
+	}
+
+	return leaf, intermediates, nil
+}
+
+// verifySignerInfo verifies that the signer signed its authenticated attributes with the certificate and that the
+// attributes have the content type and the digest of the content.
+func verifySignerInfo(signer *authenticodeSignerInfo, cert *x509.Certificate, contentType asn1.ObjectIdentifier, content []byte) error {
+	attrHash, ok := authenticodeDigestOIDs[signer.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm %s of signer", signer.DigestAlgorithm.Algorithm)
+	}
+
+	if err := verifyAuthenticodeAttributes(signer.AuthenticatedAttributes.Bytes, attrHash, contentType, content); err != nil {
+		return err
+	}
+
+	if len(signer.AuthenticatedAttributes.FullBytes) == 0 {
+		return fmt.Errorf("signer has no authenticated attributes")
+	}
+
+	// The attributes are signed as an explicit SET rather than the implicitly tagged field
+	signedAttrs := append([]byte{}, signer.AuthenticatedAttributes.FullBytes...)
+	signedAttrs[0] = 0x31
+
+	h := attrHash.New()
+	h.Write(signedAttrs)
+
+	return verifyDigestSignature(cert.PublicKey, attrHash, h.Sum(nil), signer.EncryptedDigest)
+}
+
+// verifyTimestamp verifies the RFC 3161 timestamp in the unauthenticated attributes of the signer and returns its time.
+// The zero time is returned when the signer has no timestamp.
+func (v *AuthenticodeValidator) verifyTimestamp(signer *authenticodeSignerInfo) (time.Time, error) { //nolint:cyclop
+	var token []byte
+
+	for rest := signer.UnauthenticatedAttributes.Bytes; len(rest) > 0; {
+		var attr authenticodeAttribute
+
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse unauthenticated attributes: %w", err)
+		}
+
+		if attr.Type.Equal(oidRFC3161CounterSign) {
+			token = attr.Values.Bytes
+
+			break
+		}
+	}
+
+	if token == nil {
+		return time.Time{}, nil
+	}
+
+	var info authenticodeContentInfo
+	if _, err := asn1.Unmarshal(token, &info); err != nil || !info.ContentType.Equal(oidSignedData) {
+		return time.Time{}, fmt.Errorf("timestamp is not PKCS#7 signed data")
+	}
+
+	var sd authenticodeSignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse signed data of timestamp: %w", err)
+	}
+
+	if !sd.ContentInfo.ContentType.Equal(oidTSTInfo) {
+		return time.Time{}, fmt.Errorf("unexpected content type %s of timestamp", sd.ContentInfo.ContentType)
+	}
+
+	var content []byte
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse content of timestamp: %w", err)
+	}
+
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(content, &tst); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse timestamp: %w", err)
+	}
+
+	// The timestamp is of the signature of the signer
+	hash, ok := authenticodeDigestOIDs[tst.MessageImprint.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unsupported digest algorithm %s of timestamp", tst.MessageImprint.HashAlgorithm.Algorithm)
+	}
+
+	h := hash.New()
+	h.Write(signer.EncryptedDigest)
+
+	if !bytes.Equal(h.Sum(nil), tst.MessageImprint.HashedMessage) {
+		return time.Time{}, fmt.Errorf("timestamp is not of the signature")
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return time.Time{}, fmt.Errorf("timestamp must have exactly one signer but has %d", len(sd.SignerInfos))
+	}
+
+	tsa := sd.SignerInfos[0]
+
+	cert, intermediates, err := signerCertificate(&sd, &tsa)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp: %w", err)
+	}
+
+	if err := verifySignerInfo(&tsa, cert, oidTSTInfo, content); err != nil {
+		return time.Time{}, fmt.Errorf("timestamp: %w", err)
+	}
+
+	roots := v.TimestampRoots
+	if roots == nil {
+		roots = v.Roots
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   tst.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return time.Time{}, fmt.Errorf("failed to verify time stamping certificate %q: %w", cert.Subject, err)
+	}
+
+	log.Println("Authenticode signature was timestamped at", tst.GenTime, "by", cert.Subject)
+
+	return tst.GenTime, nil
+}
+
+// verifyAuthenticodeAttributes checks that the authenticated attributes of the signer have the content type and
+// the digest of the content.
+func verifyAuthenticodeAttributes(attrs []byte, hash crypto.Hash, contentType asn1.ObjectIdentifier, content []byte) error {
+	if len(attrs) == 0 {
+		return fmt.Errorf("signer has no authenticated attributes")
+	}
+
+	h := hash.New()
+	h.Write(content)
+	want := h.Sum(nil)
+
+	for rest := attrs; len(rest) > 0; {
+		var attr authenticodeAttribute
+
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("failed to parse authenticated attributes: %w", err)
+		}
+
+		switch {
+		case attr.Type.Equal(oidAttrContentType):
+			var typ asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &typ); err != nil || !typ.Equal(contentType) {
+				return fmt.Errorf("unexpected content type in authenticated attributes")
+			}
+		case attr.Type.Equal(oidAttrMessageDigest):
+			var digest []byte
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+				return fmt.Errorf("failed to parse message digest in authenticated attributes: %w", err)
+			}
+
+			if !bytes.Equal(digest, want) {
+				return fmt.Errorf("message digest in authenticated attributes does not match signed content")
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("authenticated attributes have no message digest")
+}
+
+func verifyDigestSignature(key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			return fmt.Errorf("failed to verify signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return fmt.Errorf("failed to verify signature: ecdsa: signature verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T of signing certificate", key)
+	}
+
+	return nil
+}
+
+func (v *AuthenticodeValidator) verifySigner(cert *x509.Certificate) error {
+	if v.Subject != "" && v.Subject != cert.Subject.CommonName && v.Subject != cert.Subject.String() {
+		return fmt.Errorf("subject %q of signing certificate does not match %q", cert.Subject, v.Subject)
+	}
+
+	if v.Thumbprint == "" {
+		return nil
+	}
+
+	want := strings.ToLower(strings.NewReplacer(" ", "", ":", "").Replace(v.Thumbprint))
+	sha1Print := sha1.Sum(cert.Raw) //nolint:gosec
+	sha256Print := sha256.Sum256(cert.Raw)
+
+	if want != hex.EncodeToString(sha1Print[:]) && want != hex.EncodeToString(sha256Print[:]) {
+		return fmt.Errorf("thumbprint %x of signing certificate %q does not match %s", sha1Print, cert.Subject, v.Thumbprint)
+	}
+
+	return nil
+}
@@ -0,0 +1,459 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+var oidTestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+// fakeCodeSigning issues code signing certificates with a throwaway CA.
+type fakeCodeSigning struct {
+	roots *x509.CertPool
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+func newFakeCodeSigning(t *testing.T) *fakeCodeSigning {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake code signing CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return &fakeCodeSigning{roots: roots, ca: ca, caKey: caKey}
+}
+
+func (s *fakeCodeSigning) issue(t *testing.T, key crypto.Signer, subject string, usage x509.ExtKeyUsage) *x509.Certificate {
+	return s.issueValid(t, key, subject, usage, time.Now().Add(-time.Minute), time.Now().Add(10*time.Minute))
+}
+
+func (s *fakeCodeSigning) issueValid(t *testing.T, key crypto.Signer, subject string, usage x509.ExtKeyUsage, notBefore, notAfter time.Time) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: subject, Organization: []string{subject}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, key.Public(), s.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// unsignedPE returns a 64-bit PE image without sections whose body is the content.
+func unsignedPE(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	if err := binary.Write(&buf, binary.LittleEndian, &pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, SizeOfOptionalHeader: 240}); err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, &pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(content)
+	// The certificate table is aligned to 8 bytes
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// explicit0 wraps DER in the explicit [0] tag of ContentInfo since asn1 does not apply it to raw values.
+func explicit0(t *testing.T, der []byte) asn1.RawValue {
+	return asn1.RawValue{FullBytes: mustMarshalASN1(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der})}
+}
+
+func mustMarshalASN1(t *testing.T, v interface{}, params ...string) []byte {
+	var b []byte
+	var err error
+	if len(params) > 0 {
+		b, err = asn1.MarshalWithParams(v, params[0])
+	} else {
+		b, err = asn1.Marshal(v)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// signPE appends the Authenticode signature of the image made by the key of the leaf certificate.
+// signedAttributes returns the authenticated attributes with the content type and the digest of the content, and
+// their signature by the key.
+func signedAttributes(t *testing.T, key crypto.Signer, contentType asn1.ObjectIdentifier, content []byte) ([]byte, []byte) {
+	contentDigest := crypto.SHA256.New()
+	contentDigest.Write(content)
+
+	set := func(b []byte) asn1.RawValue {
+		return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: b}
+	}
+	var attrs []byte
+	attrs = append(attrs, mustMarshalASN1(t, authenticodeAttribute{Type: oidAttrContentType, Values: set(mustMarshalASN1(t, contentType))})...)
+	attrs = append(attrs, mustMarshalASN1(t, authenticodeAttribute{Type: oidAttrMessageDigest, Values: set(mustMarshalASN1(t, contentDigest.Sum(nil)))})...)
+	attrsDigest := crypto.SHA256.New()
+	attrsDigest.Write(mustMarshalASN1(t, set(attrs)))
+	sig, err := key.Sign(rand.Reader, attrsDigest.Sum(nil), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attrs, sig
+}
+
+// signerInfo returns the signer with the certificate of the attributes signed by signedAttributes.
+func signerInfo(cert *x509.Certificate, attrs, sig []byte) authenticodeSignerInfo {
+	signer := authenticodeSignerInfo{
+		Version:                   1,
+		DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidTestSHA256, Parameters: asn1.NullRawValue},
+		AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+		EncryptedDigest:           sig,
+	}
+	signer.IssuerAndSerialNumber.Issuer = asn1.RawValue{FullBytes: cert.RawIssuer}
+	signer.IssuerAndSerialNumber.SerialNumber = cert.SerialNumber
+	return signer
+}
+
+// timestamper returns a function making an RFC 3161 timestamp token of a signature at the time, signed by the key of
+// the time stamping certificate.
+func timestamper(t *testing.T, key crypto.Signer, cert *x509.Certificate, at time.Time) func(sig []byte) []byte {
+	return func(sig []byte) []byte {
+		var tst tstInfo
+		tst.Version = 1
+		tst.Policy = asn1.ObjectIdentifier{1, 2, 3, 4}
+		tst.MessageImprint.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidTestSHA256, Parameters: asn1.NullRawValue}
+		imprint := crypto.SHA256.New()
+		imprint.Write(sig)
+		tst.MessageImprint.HashedMessage = imprint.Sum(nil)
+		tst.SerialNumber = big.NewInt(1)
+		tst.GenTime = at.UTC().Truncate(time.Second)
+		content := mustMarshalASN1(t, tst)
+
+		attrs, tsaSig := signedAttributes(t, key, oidTSTInfo, content)
+		sd := authenticodeSignedData{
+			Version:          3,
+			DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidTestSHA256, Parameters: asn1.NullRawValue}},
+			ContentInfo:      authenticodeContentInfo{ContentType: oidTSTInfo, Content: explicit0(t, mustMarshalASN1(t, content))},
+			Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+			SignerInfos:      []authenticodeSignerInfo{signerInfo(cert, attrs, tsaSig)},
+		}
+		return mustMarshalASN1(t, authenticodeContentInfo{ContentType: oidSignedData, Content: explicit0(t, mustMarshalASN1(t, sd))})
+	}
+}
+
+func signPE(t *testing.T, image []byte, key crypto.Signer, leaf *x509.Certificate, chain ...*x509.Certificate) []byte {
+	return signTimestampedPE(t, image, key, nil, leaf, chain...)
+}
+
+// signTimestampedPE signs the image as signPE does and adds the timestamp token of the signature when timestamp is
+// not nil.
+func signTimestampedPE(t *testing.T, image []byte, key crypto.Signer, timestamp func(sig []byte) []byte, leaf *x509.Certificate, chain ...*x509.Certificate) []byte {
+	l, err := peSignatureLayoutOf(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256 := pkix.AlgorithmIdentifier{Algorithm: oidTestSHA256, Parameters: asn1.NullRawValue}
+
+	var content spcIndirectDataContent
+	// SpcPeImageData is not checked by the validator
+	content.Data = asn1.RawValue{FullBytes: mustMarshalASN1(t, struct{ Type asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}})}
+	content.MessageDigest.DigestAlgorithm = sha256
+	content.MessageDigest.Digest = authenticodeDigest(image, l, crypto.SHA256)
+	contentDER := mustMarshalASN1(t, content)
+	var inner asn1.RawValue
+	if _, err := asn1.Unmarshal(contentDER, &inner); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, sig := signedAttributes(t, key, oidSpcIndirectData, inner.Bytes)
+	signer := signerInfo(leaf, attrs, sig)
+	if timestamp != nil {
+		attr := authenticodeAttribute{Type: oidRFC3161CounterSign, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: timestamp(sig)}}
+		signer.UnauthenticatedAttributes = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: mustMarshalASN1(t, attr)}
+	}
+
+	var certs []byte
+	for _, c := range append([]*x509.Certificate{leaf}, chain...) {
+		certs = append(certs, c.Raw...)
+	}
+	sd := authenticodeSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256},
+		ContentInfo:      authenticodeContentInfo{ContentType: oidSpcIndirectData, Content: explicit0(t, contentDER)},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []authenticodeSignerInfo{signer},
+	}
+	pkcs7 := mustMarshalASN1(t, authenticodeContentInfo{ContentType: oidSignedData, Content: explicit0(t, mustMarshalASN1(t, sd))})
+
+	table := make([]byte, 8, 8+len(pkcs7)+8)
+	binary.LittleEndian.PutUint32(table, uint32(8+len(pkcs7)))
+	binary.LittleEndian.PutUint16(table[4:], 0x0200)
+	binary.LittleEndian.PutUint16(table[6:], winCertTypePKCSSignedData)
+	table = append(table, pkcs7...)
+	for len(table)%8 != 0 {
+		table = append(table, 0)
+	}
+
+	signed := append([]byte{}, image...)
+	binary.LittleEndian.PutUint32(signed[l.secDir:], uint32(len(image)))
+	binary.LittleEndian.PutUint32(signed[l.secDir+4:], uint32(len(table)))
+	return append(signed, table...)
+}
+
+func TestAuthenticodeValidator(t *testing.T) {
+	s := newFakeCodeSigning(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := s.issue(t, ecKey, "Foo Inc.", x509.ExtKeyUsageCodeSigning)
+	image := unsignedPE(t, "new executable")
+	signed := signPE(t, image, ecKey, leaf)
+
+	// The checksum is excluded from the digest since it is updated after signing
+	checksummed := append([]byte{}, signed...)
+	l, err := peSignatureLayoutOf(checksummed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(checksummed[l.checksum:], 0x12345678)
+
+	thumbprint := sha1.Sum(leaf.Raw)
+	colons := make([]string, 0, len(thumbprint))
+	for _, b := range thumbprint {
+		colons = append(colons, fmt.Sprintf("%02X", b))
+	}
+
+	for _, tc := range []struct {
+		what      string
+		validator *AuthenticodeValidator
+		exe       []byte
+	}{
+		{"ECDSA", &AuthenticodeValidator{Roots: s.roots}, signed},
+		{"RSA", &AuthenticodeValidator{Roots: s.roots}, signPE(t, image, rsaKey, s.issue(t, rsaKey, "Foo Inc.", x509.ExtKeyUsageCodeSigning))},
+		{"common name", &AuthenticodeValidator{Roots: s.roots, Subject: "Foo Inc."}, signed},
+		{"distinguished name", &AuthenticodeValidator{Roots: s.roots, Subject: "CN=Foo Inc.,O=Foo Inc."}, signed},
+		{"thumbprint", &AuthenticodeValidator{Roots: s.roots, Thumbprint: strings.Join(colons, ":")}, signed},
+		{"checksum", &AuthenticodeValidator{Roots: s.roots}, checksummed},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			if err := tc.validator.Validate(tc.exe, nil); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAuthenticodeValidatorFail(t *testing.T) {
+	s := newFakeCodeSigning(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := unsignedPE(t, "new executable")
+	signed := signPE(t, image, key, s.issue(t, key, "Foo Inc.", x509.ExtKeyUsageCodeSigning))
+
+	tampered := append([]byte{}, signed...)
+	copy(tampered[len(image)-16:], "evil")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		what      string
+		validator *AuthenticodeValidator
+		exe       []byte
+		want      string
+	}{
+		{"unsigned", &AuthenticodeValidator{Roots: s.roots}, image, "executable is not signed"},
+		{"not PE", &AuthenticodeValidator{Roots: s.roots}, []byte("\x7fELF"), "not a PE image"},
+		{"tampered", &AuthenticodeValidator{Roots: s.roots}, tampered, "executable was modified after it was signed"},
+		{"untrusted", &AuthenticodeValidator{Roots: x509.NewCertPool()}, signed, "failed to verify signing certificate"},
+		{"other key", &AuthenticodeValidator{Roots: s.roots}, signPE(t, image, otherKey, s.issue(t, key, "Foo Inc.", x509.ExtKeyUsageCodeSigning)), "failed to verify signature"},
+		{"not for code signing", &AuthenticodeValidator{Roots: s.roots}, signPE(t, image, key, s.issue(t, key, "Foo Inc.", x509.ExtKeyUsageServerAuth)), "failed to verify signing certificate"},
+		{"other subject", &AuthenticodeValidator{Roots: s.roots, Subject: "Evil Inc."}, signed, "does not match \"Evil Inc.\""},
+		{"other thumbprint", &AuthenticodeValidator{Roots: s.roots, Thumbprint: "0123456789abcdef0123456789abcdef01234567"}, signed, "thumbprint"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := tc.validator.Validate(tc.exe, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Wanted error %q but got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticodeValidatorTimestamp(t *testing.T) {
+	s := newFakeCodeSigning(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// The signing certificate expired 40 minutes ago
+	expired := s.issueValid(t, key, "Foo Inc.", x509.ExtKeyUsageCodeSigning, now.Add(-50*time.Minute), now.Add(-40*time.Minute))
+	tsa := s.issueValid(t, tsaKey, "Foo TSA", x509.ExtKeyUsageTimeStamping, now.Add(-50*time.Minute), now.Add(10*time.Minute))
+	notTSA := s.issueValid(t, tsaKey, "Foo TSA", x509.ExtKeyUsageCodeSigning, now.Add(-50*time.Minute), now.Add(10*time.Minute))
+	image := unsignedPE(t, "new executable")
+	signed := signTimestampedPE(t, image, key, timestamper(t, tsaKey, tsa, now.Add(-45*time.Minute)), expired)
+
+	t.Run("expired certificate", func(t *testing.T) {
+		if err := (&AuthenticodeValidator{Roots: s.roots}).Validate(signed, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("timestamp roots", func(t *testing.T) {
+		v := &AuthenticodeValidator{Roots: x509.NewCertPool(), TimestampRoots: s.roots}
+		err := v.Validate(signed, nil)
+		// The signing certificate is verified with Roots
+		if err == nil || !strings.Contains(err.Error(), "failed to verify signing certificate") {
+			t.Fatalf("Wanted error of signing certificate but got %v", err)
+		}
+		v = &AuthenticodeValidator{Roots: s.roots, TimestampRoots: s.roots}
+		if err := v.Validate(signed, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	otherSig := func(sig []byte) []byte {
+		return timestamper(t, tsaKey, tsa, now.Add(-45*time.Minute))([]byte("other signature"))
+	}
+	tampered := func(sig []byte) []byte {
+		token := timestamper(t, tsaKey, tsa, now.Add(-45*time.Minute))(sig)
+		// Changes the last byte of the signature of the time stamping authority
+		token[len(token)-1] ^= 0xff
+		return token
+	}
+
+	for _, tc := range []struct {
+		what      string
+		validator *AuthenticodeValidator
+		exe       []byte
+		want      string
+	}{
+		{"no timestamp", &AuthenticodeValidator{Roots: s.roots}, signPE(t, image, key, expired), "failed to verify signing certificate"},
+		{"untrusted authority", &AuthenticodeValidator{Roots: s.roots, TimestampRoots: x509.NewCertPool()}, signed, "failed to verify time stamping certificate"},
+		{"not for time stamping", &AuthenticodeValidator{Roots: s.roots}, signTimestampedPE(t, image, key, timestamper(t, tsaKey, notTSA, now.Add(-45*time.Minute)), expired), "failed to verify time stamping certificate"},
+		{"after expiration", &AuthenticodeValidator{Roots: s.roots}, signTimestampedPE(t, image, key, timestamper(t, tsaKey, tsa, now.Add(-30*time.Minute)), expired), "failed to verify signing certificate"},
+		{"other signature", &AuthenticodeValidator{Roots: s.roots}, signTimestampedPE(t, image, key, otherSig, expired), "timestamp is not of the signature"},
+		{"tampered", &AuthenticodeValidator{Roots: s.roots}, signTimestampedPE(t, image, key, tampered, expired), "timestamp: failed to verify signature"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := tc.validator.Validate(tc.exe, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Wanted error %q but got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestUpdateWithAuthenticodeValidator(t *testing.T) {
+	s := newFakeCodeSigning(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := signPE(t, unsignedPE(t, "new executable"), key, s.issue(t, key, "Foo Inc.", x509.ExtKeyUsageCodeSigning))
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/signed", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: "foo_windows_amd64.exe", content: signed}}})
+	gh.addRelease("owner/unsigned", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: "foo_windows_amd64.exe", content: unsignedPE(t, "new executable")}}})
+
+	for _, tc := range []struct {
+		slug    string
+		wantErr bool
+	}{
+		{"owner/signed", false},
+		{"owner/unsigned", true},
+	} {
+		t.Run(tc.slug, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "foo.exe")
+			if err := ioutil.WriteFile(path, []byte("old executable"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			up, _ := newTestUpdater(t, Config{
+				OS:                 "windows",
+				Arch:               "amd64",
+				PlatformValidators: map[string]Validator{"windows": &AuthenticodeValidator{Roots: s.roots, Subject: "Foo Inc."}},
+			}, gh)
+
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), tc.slug)
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "not signed") {
+					t.Fatal("Unsigned executable should be rejected:", err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, signed) {
+				t.Fatal("Executable was not updated")
+			}
+		})
+	}
+}
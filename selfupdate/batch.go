@@ -0,0 +1,173 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultDetectConcurrency is the number of repositories detected concurrently by DetectLatestBatch when
+// Config.DetectConcurrency is not set.
+const DefaultDetectConcurrency = 4
+
+// BatchError is returned by DetectLatestBatch when detecting the releases of some repositories failed.
+type BatchError struct {
+	// Errors maps the slugs of the failed repositories to their errors
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	slugs := make([]string, 0, len(e.Errors))
+	for s := range e.Errors {
+		slugs = append(slugs, s)
+	}
+
+	sort.Strings(slugs)
+
+	msgs := make([]string, 0, len(slugs))
+	for _, s := range slugs {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", s, e.Errors[s]))
+	}
+
+	return fmt.Sprintf("failed to detect releases of %d repositories: %s", len(slugs), strings.Join(msgs, "; "))
+}
+
+// Is returns true when the error of any failed repository matches target, so that errors.Is can inspect them. The
+// errors are not exposed with Unwrap() []error since it needs Go 1.20 while this module supports Go 1.13.
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error of the failed repositories in order of their slugs which matches target, so that
+// errors.As can inspect them.
+func (e *BatchError) As(target interface{}) bool {
+	slugs := make([]string, 0, len(e.Errors))
+	for s := range e.Errors {
+		slugs = append(slugs, s)
+	}
+
+	sort.Strings(slugs)
+
+	for _, s := range slugs {
+		if errors.As(e.Errors[s], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DetectLatestBatch detects the latest releases of the slugs (owner/repo) concurrently with at most
+// Config.DetectConcurrency requests at once. The result maps each slug to its release, or to nil when no release
+// was found. When detecting some of the repositories failed, the releases of the other repositories are returned
+// with *BatchError listing the failures.
+//
+// Once GitHub responds that the rate limit is exceeded, the repositories not detected yet are not requested since the
+// requests would fail as well. They fail with the same *RateLimitError. They also fail with the error of the context
+// when it is cancelled.
+func (up *Updater) DetectLatestBatch(ctx context.Context, slugs []string) (map[string]*Release, error) {
+	if ctx == nil {
+		ctx = up.apiCtx
+	}
+
+	workers := up.concurrency
+	if workers <= 0 {
+		workers = DefaultDetectConcurrency
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		results  = make(map[string]*Release, len(slugs))
+		failures = map[string]error{}
+		limited  error
+		queue    = make(chan string)
+	)
+
+	detect := func(slug string) {
+		mu.Lock()
+		stop := limited
+		mu.Unlock()
+
+		if stop == nil {
+			stop = ctx.Err()
+		}
+
+		var (
+			rel   *Release
+			found bool
+			err   = stop
+		)
+
+		if err == nil {
+			rel, found, err = up.detectVersion(ctx, slug, "", up.options())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		var rerr *RateLimitError
+		if errors.As(err, &rerr) && limited == nil {
+			log.Println("Rate limit exceeded while detecting", slug, ". Skip detecting the rest of repositories")
+
+			limited = rerr
+		}
+
+		switch {
+		case err != nil:
+			failures[slug] = err
+		case found:
+			results[slug] = rel
+		default:
+			results[slug] = nil
+		}
+	}
+
+	if workers > len(slugs) {
+		workers = len(slugs)
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for slug := range queue {
+				detect(slug)
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		if !seen[slug] {
+			seen[slug] = true
+			queue <- slug
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return results, &BatchError{Errors: failures}
+	}
+
+	return results, nil
+}
+
+// DetectLatestBatch detects the latest releases of the slugs (owner/repo) concurrently.
+// This function is a shortcut version of updater.DetectLatestBatch() method.
+func DetectLatestBatch(ctx context.Context, slugs []string) (map[string]*Release, error) {
+	return DefaultUpdater().DetectLatestBatch(ctx, slugs)
+}
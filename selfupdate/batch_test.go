@@ -0,0 +1,137 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetectLatestBatch(t *testing.T) {
+	gh := newFakeGitHub()
+	for _, slug := range []string{"owner/foo", "owner/bar", "owner/baz"} {
+		gh.addRelease(slug, fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("cmd", ".zip")}}})
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		gh.ServeHTTP(w, r)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	})
+
+	up, _ := newTestUpdater(t, Config{DetectConcurrency: 2}, h)
+	rels, err := up.DetectLatestBatch(context.Background(), []string{"owner/foo", "owner/bar", "owner/baz", "owner/none", "owner/foo", "invalid"})
+
+	var berr *BatchError
+	if !errors.As(err, &berr) {
+		t.Fatal("error should be BatchError:", err)
+	}
+	if len(berr.Errors) != 1 || berr.Errors["invalid"] == nil {
+		t.Fatal("only the invalid slug should fail:", berr.Errors)
+	}
+	if !strings.Contains(err.Error(), "invalid: invalid slug format") {
+		t.Fatal("unexpected error message:", err)
+	}
+
+	if len(rels) != 4 {
+		t.Fatal("wanted 4 results but got", rels)
+	}
+	for _, slug := range []string{"owner/foo", "owner/bar", "owner/baz"} {
+		if rels[slug] == nil || rels[slug].RepoName != slug[len("owner/"):] || rels[slug].Version.String() != "1.2.3" {
+			t.Fatalf("unexpected release of %s: %+v", slug, rels[slug])
+		}
+	}
+	if rel, ok := rels["owner/none"]; !ok || rel != nil {
+		t.Fatal("repository without release should be mapped to nil:", rel, ok)
+	}
+
+	if n := len(gh.requested()); n != 4 {
+		t.Fatal("each repository should be requested once but requests were", n)
+	}
+	if maxInFlight != 2 {
+		t.Fatal("wanted 2 concurrent requests but got", maxInFlight)
+	}
+}
+
+func TestBatchErrorIsAs(t *testing.T) {
+	err := error(&BatchError{Errors: map[string]error{
+		"owner/foo": fmt.Errorf("failed: %w", ErrAssetNotFound),
+		"owner/bar": fmt.Errorf("failed: %w", &RateLimitError{Remaining: 0}),
+		"owner/baz": &RateLimitError{Remaining: 1},
+	}})
+
+	if !errors.Is(err, ErrAssetNotFound) {
+		t.Error("error should match the error of any repository")
+	}
+	if errors.Is(err, ErrValidationFailed) {
+		t.Error("error should not match the error of no repository")
+	}
+
+	// The error of owner/bar is found first in order of the slugs
+	var rerr *RateLimitError
+	if !errors.As(err, &rerr) || rerr.Remaining != 0 {
+		t.Fatal("error should be RateLimitError of owner/bar:", rerr)
+	}
+	var perr *ProvenanceError
+	if errors.As(err, &perr) {
+		t.Error("error should not be ProvenanceError")
+	}
+}
+
+func TestDetectLatestBatchRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	n := 0
+	limited := rateLimitedHandler(time.Now().Add(time.Hour))
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n++
+		mu.Unlock()
+		limited(w, r)
+	})
+
+	up, _ := newTestUpdater(t, Config{DetectConcurrency: 1}, h)
+	rels, err := up.DetectLatestBatch(context.Background(), []string{"owner/foo", "owner/bar", "owner/baz"})
+	if len(rels) != 0 {
+		t.Fatal("no release should be detected:", rels)
+	}
+
+	var berr *BatchError
+	if !errors.As(err, &berr) || len(berr.Errors) != 3 {
+		t.Fatal("all repositories should fail:", err)
+	}
+	var rerr *RateLimitError
+	if !errors.As(err, &rerr) || rerr.Remaining != 0 {
+		t.Fatal("error should be RateLimitError:", err)
+	}
+	if n != 1 {
+		t.Fatal("repositories should not be requested after the rate limit was exceeded but requests were", n)
+	}
+}
+
+func TestDetectLatestBatchCancel(t *testing.T) {
+	up, _ := newTestUpdater(t, Config{}, newFakeGitHub())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := up.DetectLatestBatch(ctx, []string{"owner/foo", "owner/bar"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("error should be context.Canceled:", err)
+	}
+}
@@ -0,0 +1,71 @@
+package selfupdate
+
+import (
+	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
+)
+
+// versionsBehindPageSize is the number of releases fetched per request by VersionsBehind.
+const versionsBehindPageSize = 100
+
+// VersionsBehind counts the releases of the slug (owner/repo) newer than the current version, up to the latest one,
+// e.g. to nag users far out of date more than users one patch behind. Releases are selected as DetectLatest does:
+// drafts and pre-releases are counted only when Config.Draft and Config.PreRelease are set, Config.TagPrefix and
+// Config.TagFilter apply, and a release without an asset for the platform is not counted since it cannot be updated
+// to. Releases of the same version are counted once. Zero is returned when the current version is the latest or the
+// repository has no release.
+//
+// Releases are listed 100 per request, and the next page is requested only while the page has a newer release.
+func (up *Updater) VersionsBehind(slug string, current semver.Version) (int, error) {
+	repo, err := parseSlug(slug)
+	if err != nil {
+		return 0, err
+	}
+
+	opt := up.options()
+	suffixes := opt.platformSuffixes()
+	newer := map[string]struct{}{}
+	list := &github.ListOptions{PerPage: versionsBehindPageSize}
+
+	for {
+		rels, res, err := up.api.Repositories.ListReleases(up.apiCtx, repo[0], repo[1], list)
+		if err != nil {
+			if res != nil && res.StatusCode == 404 {
+				log.Println("API returned 404. Repository or release not found")
+
+				return 0, nil
+			}
+
+			return 0, asRateLimitError(err)
+		}
+
+		found := false
+
+		for _, rel := range rels {
+			if up.split != nil {
+				rel, _ = joinSplitAssets(rel, up.split)
+			}
+
+			if _, v, ok := findAssetFromRelease(rel, suffixes, "", up.filters, opt); ok && v.GT(current) {
+				newer[v.String()] = struct{}{}
+				found = true
+			}
+		}
+
+		if !found || res.NextPage == 0 {
+			break
+		}
+
+		list.Page = res.NextPage
+	}
+
+	log.Println(len(newer), "releases of", slug, "are newer than", current)
+
+	return len(newer), nil
+}
+
+// VersionsBehind counts the releases of the slug (owner/repo) newer than the current version.
+// This function is a shortcut version of updater.VersionsBehind() method.
+func VersionsBehind(slug string, current semver.Version) (int, error) {
+	return DefaultUpdater().VersionsBehind(slug, current)
+}
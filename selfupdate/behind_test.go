@@ -0,0 +1,104 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
+)
+
+// pagedReleasesHandler serves the pages of releases with Link headers as GitHub API does, and records the requested
+// pages.
+func pagedReleasesHandler(pages [][]*github.RepositoryRelease) (http.Handler, func() []int) {
+	var mu sync.Mutex
+	requested := []int{}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/owner/repo/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		mu.Lock()
+		requested = append(requested, page)
+		mu.Unlock()
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=%d&per_page=100>; rel="next"`, r.Host, r.URL.Path, page+1))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pages[page-1])
+	})
+
+	return h, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int{}, requested...)
+	}
+}
+
+func TestVersionsBehind(t *testing.T) {
+	release := func(tag string, prerelease bool, assets ...string) *github.RepositoryRelease {
+		rel := &github.RepositoryRelease{TagName: github.String(tag), Prerelease: github.Bool(prerelease)}
+		for _, a := range assets {
+			rel.Assets = append(rel.Assets, &github.ReleaseAsset{Name: github.String(a)})
+		}
+		return rel
+	}
+	name := platformAssetName("foo", ".tar.gz")
+	pages := [][]*github.RepositoryRelease{
+		{release("v1.5.0", false, name), release("1.5.0", false, name)},
+		{release("v1.4.0", false, "foo_plan9_mips.tar.gz"), release("v1.3.0-beta.1", true, name), release("v1.2.4", false, name)},
+		{release("v1.2.3", false, name), release("v1.0.0", false, name)},
+		{release("v0.9.0", false, name)},
+	}
+
+	for _, tc := range []struct {
+		what    string
+		config  Config
+		current string
+		want    int
+		pages   []int
+	}{
+		{"stable", Config{}, "1.2.3", 2, []int{1, 2, 3}},
+		{"pre-release", Config{PreRelease: true}, "1.2.3", 3, []int{1, 2, 3}},
+		{"latest", Config{}, "1.5.0", 0, []int{1}},
+		{"far behind", Config{}, "0.1.0", 5, []int{1, 2, 3, 4}},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			h, requested := pagedReleasesHandler(pages)
+			up, _ := newTestUpdater(t, tc.config, h)
+
+			n, err := up.VersionsBehind("owner/repo", semver.MustParse(tc.current))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tc.want {
+				t.Errorf("Wanted %d versions behind but got %d", tc.want, n)
+			}
+			if have, want := fmt.Sprint(requested()), fmt.Sprint(tc.pages); have != want {
+				t.Errorf("Wanted pages %s to be requested but got %s", want, have)
+			}
+		})
+	}
+}
+
+func TestVersionsBehindNoRepository(t *testing.T) {
+	up, _ := newTestUpdater(t, Config{}, newFakeGitHub())
+
+	n, err := up.VersionsBehind("owner/missing", semver.MustParse("1.2.3"))
+	if err != nil || n != 0 {
+		t.Fatal("Missing repository should have no release:", n, err)
+	}
+
+	if _, err := up.VersionsBehind("owner", semver.MustParse("1.2.3")); err == nil {
+		t.Fatal("Invalid slug should be rejected")
+	}
+}
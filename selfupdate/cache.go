@@ -0,0 +1,273 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// assetCacheMeta is the validators of a cached release file sent on conditional requests.
+type assetCacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// assetCacheEntry is a release file in the cache directory. It is set to the context of the request downloading
+// the file.
+type assetCacheEntry struct {
+	path string
+	meta *assetCacheMeta
+	// hit is set when the server responded 304 Not Modified and the cached copy was served
+	hit bool
+}
+
+type assetCacheKey struct{}
+
+// newAssetCacheEntry returns the entry of the release file in the cache directory. Its metadata is nil when the file
+// is not cached yet.
+func newAssetCacheEntry(dir string, owner, repo, name string) *assetCacheEntry {
+	e := &assetCacheEntry{path: filepath.Join(dir, filepath.Base(owner), filepath.Base(repo), filepath.Base(name))}
+
+	b, err := ioutil.ReadFile(e.path + ".json")
+	if err != nil {
+		return e
+	}
+
+	var meta assetCacheMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		log.Println("Ignoring broken metadata of cached file", e.path, ":", err)
+
+		return e
+	}
+
+	if _, err := os.Stat(e.path); err == nil {
+		e.meta = &meta
+	}
+
+	return e
+}
+
+// assetCacheTransport makes the requests of release files conditional with the ETag and the Last-Modified of their
+// cached copies. Both are sent since some origins support only one of them. A 304 Not Modified response is replaced
+// with the cached copy, and a 200 response is stored in the cache while it is read.
+type assetCacheTransport struct {
+	base http.RoundTripper
+}
+
+func (t *assetCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	e, ok := req.Context().Value(assetCacheKey{}).(*assetCacheEntry)
+	if !ok {
+		return base.RoundTrip(req)
+	}
+
+	if e.meta != nil {
+		req = req.Clone(req.Context())
+
+		if e.meta.ETag != "" {
+			req.Header.Set("If-None-Match", e.meta.ETag)
+		}
+
+		if e.meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", e.meta.LastModified)
+		}
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && e.meta != nil:
+		return e.cachedResponse(req, res)
+	case res.StatusCode == http.StatusOK && (res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""):
+		w, err := e.newWriter(req, res)
+		if err != nil {
+			log.Println("Could not store", req.URL, "in cache:", err)
+
+			return res, nil
+		}
+
+		res.Body = w
+	}
+
+	return res, nil
+}
+
+// cachedResponse replaces the 304 response with a 200 response serving the cached copy.
+func (e *assetCacheEntry) cachedResponse(req *http.Request, res *http.Response) (*http.Response, error) {
+	res.Body.Close()
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cached file %s: %w", e.path, err)
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, fmt.Errorf("failed to open cached file %s: %w", e.path, err)
+	}
+
+	log.Println("Using cached file", e.path, "since", req.URL, "was not modified")
+
+	e.hit = true
+
+	header := res.Header.Clone()
+	header.Set("Content-Type", "application/octet-stream")
+
+	if e.meta.ETag != "" && header.Get("ETag") == "" {
+		header.Set("ETag", e.meta.ETag)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         res.Proto,
+		ProtoMajor:    res.ProtoMajor,
+		ProtoMinor:    res.ProtoMinor,
+		Header:        header,
+		Body:          f,
+		ContentLength: st.Size(),
+		Request:       req,
+	}, nil
+}
+
+// assetCacheWriter stores the body of a response in the cache while it is read. The cached copy is committed only
+// when the body was read to the end.
+type assetCacheWriter struct {
+	body  io.ReadCloser
+	tmp   *os.File
+	entry *assetCacheEntry
+	meta  assetCacheMeta
+	done  bool
+}
+
+func (e *assetCacheEntry) newWriter(req *http.Request, res *http.Response) (*assetCacheWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(e.path), "."+filepath.Base(e.path)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &assetCacheWriter{
+		body:  res.Body,
+		tmp:   tmp,
+		entry: e,
+		meta:  assetCacheMeta{URL: req.URL.String(), ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified")},
+	}, nil
+}
+
+func (w *assetCacheWriter) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 && w.tmp != nil {
+		if _, werr := w.tmp.Write(p[:n]); werr != nil {
+			log.Println("Could not store", w.entry.path, "in cache:", werr)
+			w.discard()
+		}
+	}
+
+	if err == io.EOF && w.tmp != nil {
+		w.commit()
+	}
+
+	return n, err
+}
+
+func (w *assetCacheWriter) Close() error {
+	w.discard()
+
+	return w.body.Close()
+}
+
+func (w *assetCacheWriter) commit() {
+	tmp := w.tmp
+	w.tmp = nil
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return
+	}
+
+	meta, err := json.Marshal(&w.meta)
+	if err == nil {
+		// The metadata is removed first so that a crash never leaves it with another content
+		os.Remove(w.entry.path + ".json")
+
+		if err = os.Rename(tmp.Name(), w.entry.path); err == nil {
+			err = ioutil.WriteFile(w.entry.path+".json", meta, 0o644)
+		}
+	}
+
+	if err != nil {
+		log.Println("Could not store", w.entry.path, "in cache:", err)
+		os.Remove(tmp.Name())
+
+		return
+	}
+
+	log.Println("Stored", w.entry.path, "in cache")
+}
+
+// discard removes the partially stored copy.
+func (w *assetCacheWriter) discard() {
+	if w.tmp == nil {
+		return
+	}
+
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+	w.tmp = nil
+}
+
+// apiCacheTransport sends the requests to GitHub API via the HTTP cache given by Config.HTTPCache. Downloads of
+// release files through the asset endpoint are sent with base directly so that the cache never stores binaries.
+type apiCacheTransport struct {
+	base  http.RoundTripper
+	cache http.RoundTripper
+}
+
+func (t *apiCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Accept") == "application/octet-stream" {
+		return t.base.RoundTrip(req)
+	}
+
+	return t.cache.RoundTrip(req)
+}
+
+// withAPICache returns a copy of the client whose requests to GitHub API are sent via the transport created by wrap.
+func withAPICache(c *http.Client, wrap func(base http.RoundTripper) http.RoundTripper) *http.Client {
+	if wrap == nil {
+		return c
+	}
+
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	cache := wrap(base)
+	if cache == nil {
+		return c
+	}
+
+	wrapped := *c
+	wrapped.Transport = &apiCacheTransport{base: base, cache: cache}
+
+	return &wrapped
+}
@@ -0,0 +1,242 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func TestAssetCacheDir(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	modified := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		what         string
+		etag         bool
+		lastModified bool
+	}{
+		{"ETag", true, false},
+		{"Last-Modified", false, true},
+		{"both", true, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			exe := fakeExecutableContent(t, "v1")
+			asset := tarGz(t, map[string][]byte{"foo": exe})
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: name, content: asset},
+				{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+			}})
+
+			var notModified, served int
+			gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+				etag := fmt.Sprintf(`"%x"`, sha256.Sum256(a.content))
+				if tc.etag {
+					w.Header().Set("ETag", etag)
+					if r.Header.Get("If-None-Match") == etag {
+						notModified++
+						w.WriteHeader(http.StatusNotModified)
+						return true
+					}
+				} else if r.Header.Get("If-None-Match") != "" {
+					t.Error("If-None-Match was sent without ETag")
+				}
+				if tc.lastModified {
+					w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+					if r.Header.Get("If-Modified-Since") == modified.Format(http.TimeFormat) && !tc.etag {
+						notModified++
+						w.WriteHeader(http.StatusNotModified)
+						return true
+					}
+				} else if r.Header.Get("If-Modified-Since") != "" {
+					t.Error("If-Modified-Since was sent without Last-Modified")
+				}
+				served++
+				return false
+			}
+
+			dir := t.TempDir()
+			up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}, AssetCacheDir: dir}, gh)
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := setupOldExecutable(t)
+			res, err := up.UpdateToWithResult(rel, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if served != 2 || notModified != 0 {
+				t.Fatalf("files should be downloaded: served=%d, not modified=%d", served, notModified)
+			}
+			for _, d := range res.Downloads {
+				if d.Cached {
+					t.Error("file should not be cached on first download:", d.Name)
+				}
+			}
+			cached, err := ioutil.ReadFile(filepath.Join(dir, "owner", "repo", name))
+			if err != nil {
+				t.Fatal("asset was not cached:", err)
+			}
+			if !bytes.Equal(cached, asset) {
+				t.Fatal("cached asset is broken")
+			}
+
+			path = setupOldExecutable(t)
+			res, err = up.UpdateToWithResult(rel, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if served != 2 || notModified != 2 {
+				t.Fatalf("cached files should be used: served=%d, not modified=%d", served, notModified)
+			}
+			for _, d := range res.Downloads {
+				if !d.Cached {
+					t.Error("cached file should be used:", d.Name)
+				}
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatal("executable was not updated from cache")
+			}
+		})
+	}
+}
+
+func TestAssetCacheNotCommittedOnPartialRead(t *testing.T) {
+	dir := t.TempDir()
+	e := &assetCacheEntry{path: filepath.Join(dir, "foo")}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+	res := &http.Response{Header: http.Header{"Etag": {`"abc"`}}, Body: ioutil.NopCloser(bytes.NewReader([]byte("content")))}
+
+	w, err := e.newWriter(req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Read(make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatal("partially read file should not be cached:", files[0].Name())
+	}
+	if _, err := os.Stat(e.path); !os.IsNotExist(err) {
+		t.Fatal("cached file should not exist:", err)
+	}
+}
+
+// revalidatingCache is a minimal HTTP cache which revalidates the cached responses with their ETags.
+type revalidatingCache struct {
+	base      http.RoundTripper
+	mu        sync.Mutex
+	responses map[string]*http.Response
+	bodies    map[string][]byte
+	requested []*http.Request
+}
+
+func (c *revalidatingCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requested = append(c.requested, req)
+	cached, ok := c.responses[req.URL.String()]
+	body := c.bodies[req.URL.String()]
+	c.mu.Unlock()
+
+	if ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.Header.Get("ETag"))
+	}
+	res, err := c.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified && ok {
+		res.Body.Close()
+		served := *cached
+		served.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return &served, nil
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") == "" {
+		return res, nil
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.responses[req.URL.String()] = res
+	c.bodies[req.URL.String()] = b
+	c.mu.Unlock()
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return res, nil
+}
+
+func TestHTTPCache(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: asset}}})
+
+	var notModified int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/releases") {
+			if r.Header.Get("Authorization") == "" {
+				t.Error("API token should be sent via the cache")
+			}
+			w.Header().Set("ETag", `"releases"`)
+			if r.Header.Get("If-None-Match") == `"releases"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		gh.ServeHTTP(w, r)
+	})
+
+	var cache *revalidatingCache
+	up, _ := newTestUpdater(t, Config{HTTPCache: func(base http.RoundTripper) http.RoundTripper {
+		cache = &revalidatingCache{base: base, responses: map[string]*http.Response{}, bodies: map[string][]byte{}}
+		return cache
+	}}, handler)
+
+	for i := 0; i < 2; i++ {
+		rel, ok, err := up.DetectLatest("owner/repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || rel.Version.String() != "1.2.3" {
+			t.Fatal("Release should be detected from cached response:", rel)
+		}
+	}
+	if notModified != 1 {
+		t.Fatal("Second detection should be revalidated:", notModified)
+	}
+
+	if _, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range cache.requested {
+		if strings.Contains(r.URL.Path, "/releases/assets/") || strings.Contains(r.URL.Path, "/releases/download/") {
+			t.Fatal("Release asset should not be downloaded via the cache:", r.URL)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
+)
+
+// Release channels detected by DetectChannels.
+const (
+	ChannelStable  = "stable"
+	ChannelRC      = "rc"
+	ChannelBeta    = "beta"
+	ChannelAlpha   = "alpha"
+	ChannelNightly = "nightly"
+)
+
+// releaseChannel returns the channel of the release from its version. A version without pre-release identifiers is
+// stable unless the release is marked as a pre-release on GitHub. Otherwise the first pre-release identifier without
+// trailing digits and separators, such as 'beta' of '1.3.0-beta.2' or 'rc' of '1.3.0-rc1', is the channel. False is
+// returned when it is not one of the known channels.
+func releaseChannel(rel *github.RepositoryRelease, ver semver.Version) (string, bool) {
+	if len(ver.Pre) == 0 && !rel.GetPrerelease() {
+		return ChannelStable, true
+	}
+
+	if len(ver.Pre) == 0 || ver.Pre[0].IsNum {
+		return "", false
+	}
+
+	name := strings.ToLower(strings.TrimRight(ver.Pre[0].VersionStr, "0123456789-_"))
+
+	switch name {
+	case ChannelRC, ChannelBeta, ChannelAlpha, ChannelNightly:
+		return name, true
+	default:
+		return "", false
+	}
+}
+
+// DetectChannels detects the latest release of each release channel of the slug (owner/repo): stable releases and
+// pre-releases of 'rc', 'beta', 'alpha' and 'nightly' versions such as '1.3.0-beta.2'. The result maps the channels
+// (ChannelStable, ChannelBeta, ...) to their latest releases, so that users can choose one of them. Channels without
+// a release having an asset for the platform are not in the map, and pre-releases of other versions are ignored.
+//
+// Pre-releases are detected regardless of Config.PreRelease. The other configurations such as Config.Draft,
+// Config.TagPrefix and Config.SkipVersions apply as DetectLatest does. An empty map is returned when the repository is
+// not found.
+func (up *Updater) DetectChannels(slug string) (map[string]*Release, error) {
+	repo, err := parseSlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := map[string]*Release{}
+
+	rels, res, err := up.api.Repositories.ListReleases(up.apiCtx, repo[0], repo[1], nil)
+	if err != nil {
+		if res != nil && res.StatusCode == 404 {
+			log.Println("API returned 404. Repository or release not found")
+
+			return channels, nil
+		}
+
+		return nil, asRateLimitError(err)
+	}
+
+	parts := up.joinSplitAssets(rels)
+	opt := up.options()
+	opt.pre = true
+
+	grouped := map[string][]*github.RepositoryRelease{}
+
+	for _, rel := range rels {
+		ver, ok := opt.releaseVersion(rel)
+		if !ok {
+			continue
+		}
+
+		if ch, ok := releaseChannel(rel, ver); ok {
+			grouped[ch] = append(grouped[ch], rel)
+		}
+	}
+
+	for ch, rs := range grouped {
+		rel, asset, ver, err := selectReleaseAndAsset(rs, "", up.filters, opt)
+		if errors.Is(err, ErrNoReleaseFound) || errors.Is(err, ErrAssetNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w in repository %s", err, slug)
+		}
+
+		release, err := up.newRelease(rel, asset, ver, repo, parts[asset])
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Latest release of channel", ch, "is", rel.GetTagName())
+
+		channels[ch] = release
+	}
+
+	return channels, nil
+}
+
+// DetectChannels detects the latest release of each release channel of the slug (owner/repo).
+// This function is a shortcut version of updater.DetectChannels() method.
+func DetectChannels(slug string) (map[string]*Release, error) {
+	return DefaultUpdater().DetectChannels(slug)
+}
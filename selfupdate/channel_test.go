@@ -0,0 +1,81 @@
+package selfupdate
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
+)
+
+func TestReleaseChannel(t *testing.T) {
+	for _, tc := range []struct {
+		version    string
+		prerelease bool
+		want       string
+	}{
+		{"1.2.3", false, ChannelStable},
+		{"1.2.3", true, ""},
+		{"1.3.0-beta.2", true, ChannelBeta},
+		{"1.3.0-rc1", false, ChannelRC},
+		{"1.3.0-RC.1", true, ChannelRC},
+		{"1.3.0-alpha", true, ChannelAlpha},
+		{"1.3.0-nightly.20210101", true, ChannelNightly},
+		{"1.3.0-dev.1", true, ""},
+		{"1.3.0-1", true, ""},
+	} {
+		rel := &github.RepositoryRelease{Prerelease: github.Bool(tc.prerelease)}
+		ch, ok := releaseChannel(rel, semver.MustParse(tc.version))
+		if ch != tc.want || ok != (tc.want != "") {
+			t.Errorf("Wanted channel %q for %s (pre-release: %v) but got %q (%v)", tc.want, tc.version, tc.prerelease, ch, ok)
+		}
+	}
+}
+
+func TestDetectChannels(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	asset := []fakeAsset{{name: name, content: []byte("foo")}}
+
+	gh := newFakeGitHub()
+	for _, r := range []fakeRelease{
+		{tag: "v1.3.0-beta.2", assets: asset, prerelease: true},
+		{tag: "v1.3.0-rc.1", assets: []fakeAsset{{name: "foo_plan9_mips.tar.gz", content: []byte("foo")}}, prerelease: true},
+		{tag: "v1.3.0-beta.1", assets: asset, prerelease: true},
+		{tag: "v1.2.4-dev", assets: asset, prerelease: true},
+		{tag: "v1.2.3", assets: asset},
+		{tag: "v1.2.2", assets: asset},
+		{tag: "v1.4.0-alpha", assets: asset, prerelease: true, draft: true},
+	} {
+		gh.addRelease("owner/repo", r)
+	}
+
+	up, _ := newTestUpdater(t, Config{}, gh)
+	channels, err := up.DetectChannels("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	have := []string{}
+	for ch, rel := range channels {
+		have = append(have, ch+"="+rel.Version.String())
+	}
+	sort.Strings(have)
+	if want := "beta=1.3.0-beta.2 stable=1.2.3"; strings.Join(have, " ") != want {
+		t.Errorf("Wanted channels %q but got %q", want, strings.Join(have, " "))
+	}
+
+	up, _ = newTestUpdater(t, Config{Draft: true}, gh)
+	channels, err = up.DetectChannels("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel, ok := channels[ChannelAlpha]; !ok || rel.Version.String() != "1.4.0-alpha" {
+		t.Errorf("Draft should be detected with Config.Draft: %+v", channels)
+	}
+
+	channels, err = up.DetectChannels("owner/missing")
+	if err != nil || len(channels) != 0 {
+		t.Fatal("Missing repository should have no channel:", channels, err)
+	}
+}
@@ -0,0 +1,241 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for crypto.Hash
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultChecksumsFilename is the name of the checksum file used by ChecksumValidator by default.
+const DefaultChecksumsFilename = "checksums.txt"
+
+// ChecksumValidator validates a release asset against a checksum file shared by all assets of the release,
+// such as 'checksums.txt' generated by GoReleaser, sha256sum or shasum. Each line of the file consists of a hex-encoded
+// hash and a file name separated by spaces, optionally with the '*' binary mode indicator, or is a BSD-style line
+// such as 'SHA256 (foo.zip) = ...'. The file can be generated with GenerateChecksums.
+//
+// The checksum of the release asset is looked up by its file name, e.g. 'foo_1.2.3_linux_amd64.tar.gz' in the
+// checksums of GoReleaser. The downloaded archive is validated before the executable is extracted from it.
+type ChecksumValidator struct {
+	// Filename is the name of the checksum file in the release. If empty, DefaultChecksumsFilename is used.
+	Filename string
+	// Hash is the hash function used for the checksums. If zero, crypto.SHA256 is used.
+	Hash crypto.Hash
+	// Signature is an optional validator verifying the checksum file itself before its checksums are trusted.
+	// The signature file is looked up with the checksum file name and the suffix of the validator,
+	// e.g. 'checksums.txt.sig' for ECDSAValidator.
+	Signature Validator
+}
+
+// signedValidator is implemented by validators whose validation asset is verified by another validator first.
+type signedValidator interface {
+	signatureValidator() Validator
+}
+
+// signatureValidator returns the validator for the signature of the validation asset, or nil when the validation
+// asset is not signed.
+func signatureValidator(v Validator) Validator {
+	if sv, ok := v.(signedValidator); ok {
+		return sv.signatureValidator()
+	}
+
+	return nil
+}
+
+func (v *ChecksumValidator) signatureValidator() Validator {
+	return v.Signature
+}
+
+func (v *ChecksumValidator) hash() crypto.Hash {
+	if v.Hash == 0 {
+		return crypto.SHA256
+	}
+
+	return v.Hash
+}
+
+func (v *ChecksumValidator) checksum(release io.Reader) (string, error) {
+	h := v.hash()
+	if !h.Available() {
+		return "", fmt.Errorf("checksum: hash function %s is not available", h)
+	}
+
+	w := h.New()
+	if _, err := io.Copy(w, release); err != nil {
+		return "", fmt.Errorf("checksum: failed to read release: %w", err)
+	}
+
+	return hex.EncodeToString(w.Sum(nil)), nil
+}
+
+// Validate validates the release against the checksum file. Since the file name of the release is unknown here,
+// validation succeeds when any entry of the checksum file matches. ValidateAsset is used on updating.
+func (v *ChecksumValidator) Validate(release, asset []byte) error {
+	return v.ValidateStream(bytes.NewReader(release), asset)
+}
+
+// ValidateStream is the same as Validate, but the release is read from the reader.
+func (v *ChecksumValidator) ValidateStream(release io.Reader, asset []byte) error {
+	checksums, err := parseChecksums(asset)
+	if err != nil {
+		return err
+	}
+
+	calculated, err := v.checksum(release)
+	if err != nil {
+		return err
+	}
+
+	for _, sum := range checksums {
+		if sum == calculated {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("checksum: validation failed: hash %q is not found in checksum file", calculated)
+}
+
+// ValidateAsset validates the release asset named filename against the checksum file.
+func (v *ChecksumValidator) ValidateAsset(filename string, release, asset []byte) error {
+	return v.ValidateAssetStream(filename, bytes.NewReader(release), asset)
+}
+
+// ValidateAssetStream is the same as ValidateAsset, but the release is read from the reader. The checksum file is
+// parsed before reading the release so that a missing entry is reported without downloading the release.
+func (v *ChecksumValidator) ValidateAssetStream(filename string, release io.Reader, asset []byte) error {
+	checksums, err := parseChecksums(asset)
+	if err != nil {
+		return err
+	}
+
+	expected, ok := checksums[filename]
+	if !ok {
+		return fmt.Errorf("checksum: file %q is not found in checksum file", filename)
+	}
+
+	calculated, err := v.checksum(release)
+	if err != nil {
+		return err
+	}
+
+	if calculated != expected {
+		return fmt.Errorf("checksum: validation failed: hash mismatch: expected=%q, got=%q", expected, calculated)
+	}
+
+	return nil
+}
+
+// Suffix is not used by ChecksumValidator since the checksum file is shared by all assets. See GetValidationAssetName.
+func (v *ChecksumValidator) Suffix() string {
+	return ""
+}
+
+// GetValidationAssetName returns the name of the checksum file.
+func (v *ChecksumValidator) GetValidationAssetName(filename string) string {
+	if v.Filename == "" {
+		return DefaultChecksumsFilename
+	}
+
+	return v.Filename
+}
+
+// bsdChecksumLine matches a line of BSD-style checksum files such as the output of `shasum --tag` or `sha256 foo`.
+var bsdChecksumLine = regexp.MustCompile(`^[A-Za-z0-9-]+ \((.+)\) = ([0-9A-Fa-f]+)$`)
+
+// parseChecksums parses the content of a checksum file into a map from file names to lower-case hex-encoded hashes.
+// Lines of coreutils' sha256sum (one or two spaces, optionally with the '*' binary mode indicator) and BSD-style lines
+// such as 'SHA256 (foo.zip) = ...' are accepted.
+func parseChecksums(data []byte) (map[string]string, error) {
+	checksums := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+
+	for l := 1; s.Scan(); l++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		name, sum, ok := parseChecksumLine(line)
+		if !ok {
+			return nil, fmt.Errorf("checksum: invalid line %d in checksum file: %q", l, line)
+		}
+
+		checksums[name] = sum
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("checksum: failed to read checksum file: %w", err)
+	}
+
+	return checksums, nil
+}
+
+func parseChecksumLine(line string) (string, string, bool) {
+	var name, sum string
+
+	if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+		name, sum = m[1], m[2]
+	} else {
+		i := strings.IndexByte(line, ' ')
+		if i <= 0 {
+			return "", "", false
+		}
+
+		name, sum = line[i+1:], line[:i]
+
+		// The second separator is ' ' in text mode and '*' in binary mode
+		if strings.HasPrefix(name, " ") || strings.HasPrefix(name, "*") {
+			name = name[1:]
+		}
+	}
+
+	if name == "" {
+		return "", "", false
+	}
+
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", "", false
+	}
+
+	return name, strings.ToLower(sum), true
+}
+
+// GenerateChecksums generates the content of a checksum file for the given files, keyed by their names.
+// Lines are sorted by file name and have the same format as the output of coreutils' sha256sum, so the result can
+// be uploaded as a release asset and validated by ChecksumValidator with the same hash function.
+func GenerateChecksums(files map[string]io.Reader, hash crypto.Hash) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("checksum: hash function %s is not available", hash)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, "\r\n") {
+			return nil, fmt.Errorf("checksum: invalid file name %q", name)
+		}
+
+		h := hash.New()
+		if _, err := io.Copy(h, files[name]); err != nil {
+			return nil, fmt.Errorf("checksum: failed to read file %q: %w", name, err)
+		}
+
+		fmt.Fprintf(&buf, "%x  %s\n", h.Sum(nil), name)
+	}
+
+	return buf.Bytes(), nil
+}
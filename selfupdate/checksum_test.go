@@ -0,0 +1,340 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestGenerateChecksums(t *testing.T) {
+	out, err := GenerateChecksums(map[string]io.Reader{
+		"foo_linux_amd64.tar.gz":   strings.NewReader("foo"),
+		"foo_darwin_amd64.tar.gz":  strings.NewReader("bar"),
+		"foo_windows_amd64.tar.gz": strings.NewReader(""),
+	}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same as the output of `sha256sum foo_*`
+	want := "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9  foo_darwin_amd64.tar.gz\n" +
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  foo_linux_amd64.tar.gz\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  foo_windows_amd64.tar.gz\n"
+	if string(out) != want {
+		t.Fatalf("Unexpected checksums:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestGenerateChecksumsInvalidFileName(t *testing.T) {
+	for _, name := range []string{"", "foo\nbar"} {
+		_, err := GenerateChecksums(map[string]io.Reader{name: strings.NewReader("foo")}, crypto.SHA256)
+		if err == nil {
+			t.Errorf("Error should occur for file name %q", name)
+		}
+	}
+}
+
+func TestChecksumValidatorRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/foo.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range []crypto.Hash{0, crypto.SHA256, crypto.SHA512} {
+		hash := h
+		if hash == 0 {
+			hash = crypto.SHA256
+		}
+		checksums, err := GenerateChecksums(map[string]io.Reader{
+			"foo.zip":    bytes.NewReader(data),
+			"foo.tar.gz": strings.NewReader("other"),
+		}, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v := &ChecksumValidator{Hash: h}
+		if err := v.ValidateAsset("foo.zip", data, checksums); err != nil {
+			t.Errorf("Validation failed with %s: %s", hash, err)
+		}
+		if err := v.Validate(data, checksums); err != nil {
+			t.Errorf("Validation without file name failed with %s: %s", hash, err)
+		}
+		if err := v.ValidateAsset("foo.tar.gz", data, checksums); err == nil {
+			t.Errorf("Validation should fail for other file's checksum with %s", hash)
+		}
+		if err := v.ValidateAsset("unknown.zip", data, checksums); err == nil || !strings.Contains(err.Error(), "not found in checksum file") {
+			t.Errorf("Validation should fail for unknown file with %s: %v", hash, err)
+		}
+		if err := v.Validate([]byte("tampered"), checksums); err == nil {
+			t.Errorf("Validation should fail for tampered data with %s", hash)
+		}
+	}
+}
+
+func TestChecksumValidatorInvalidFile(t *testing.T) {
+	v := &ChecksumValidator{}
+	if err := v.ValidateAsset("foo.zip", []byte("foo"), []byte("this is not a checksum file\n")); err == nil {
+		t.Fatal("Error should occur for invalid checksum file")
+	}
+}
+
+func TestChecksumValidatorLineFormats(t *testing.T) {
+	data := []byte("foo")
+	sum := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	other := "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9  foo_darwin_amd64.tar.gz\n"
+
+	for _, tc := range []struct {
+		what string
+		line string
+	}{
+		{"two spaces", sum + "  foo_linux_amd64.tar.gz"},
+		{"one space", sum + " foo_linux_amd64.tar.gz"},
+		{"binary mode", sum + " *foo_linux_amd64.tar.gz"},
+		{"BSD style", "SHA256 (foo_linux_amd64.tar.gz) = " + sum},
+		{"uppercase hex", strings.ToUpper(sum) + "  foo_linux_amd64.tar.gz"},
+		{"BSD style with uppercase hex", "SHA256 (foo_linux_amd64.tar.gz) = " + strings.ToUpper(sum)},
+		{"CRLF", sum + " *foo_linux_amd64.tar.gz\r"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			checksums := []byte(other + tc.line + "\n")
+			v := &ChecksumValidator{}
+			if err := v.ValidateAsset("foo_linux_amd64.tar.gz", data, checksums); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.ValidateAsset("foo_linux_amd64.tar.gz", []byte("tampered"), checksums); err == nil {
+				t.Fatal("Validation should fail for tampered data")
+			}
+		})
+	}
+
+	for _, line := range []string{sum, sum + "  ", sum + " *", "SHA256 () = " + sum, "xyz  foo_linux_amd64.tar.gz"} {
+		if _, err := parseChecksums([]byte(line + "\n")); err == nil {
+			t.Errorf("Error should occur for invalid line %q", line)
+		}
+	}
+}
+
+func TestChecksumValidatorAssetName(t *testing.T) {
+	if n := validationAssetName(&ChecksumValidator{}, "foo.zip"); n != "checksums.txt" {
+		t.Error("Unexpected default validation asset name:", n)
+	}
+	if n := validationAssetName(&ChecksumValidator{Filename: "foo_1.2.3_checksums.txt"}, "foo.zip"); n != "foo_1.2.3_checksums.txt" {
+		t.Error("Unexpected validation asset name:", n)
+	}
+	if n := validationAssetName(&SHA2Validator{}, "foo.zip"); n != "foo.zip.sha256" {
+		t.Error("Unexpected validation asset name for SHA2Validator:", n)
+	}
+}
+
+func TestUpdateWithChecksumValidator(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what    string
+		content []byte
+		ok      bool
+	}{
+		{"valid", asset, true},
+		{"tampered", append(append([]byte{}, asset...), 0), false},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			checksums, err := GenerateChecksums(map[string]io.Reader{name: bytes.NewReader(asset)}, crypto.SHA256)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{
+				tag: "v1.2.3",
+				assets: []fakeAsset{
+					{name: name, content: tc.content},
+					{name: "checksums.txt", content: checksums},
+				},
+			})
+			up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}}, gh)
+
+			path := setupOldExecutable(t)
+			_, err = up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, exe) {
+					t.Fatalf("Executable was not updated: %q", b)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), "failed validating asset content") {
+				t.Fatal("Validation should fail for tampered asset:", err)
+			}
+			if string(b) != "old executable" {
+				t.Fatalf("Old executable should be kept but got %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateWithSignedChecksumValidator(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	checksums, err := GenerateChecksums(map[string]io.Reader{name: bytes.NewReader(asset)}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(priv, checksums)
+
+	tampered, err := GenerateChecksums(map[string]io.Reader{name: strings.NewReader("evil")}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		what      string
+		checksums []byte
+		sig       []byte
+		err       string
+	}{
+		{"valid", checksums, sig, ""},
+		{"tampered checksums", tampered, sig, "failed validating signature of validation asset checksums.txt"},
+		{"no signature", checksums, nil, `failed finding signature file "checksums.txt.sig" of validation file "checksums.txt"`},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			assets := []fakeAsset{
+				{name: name, content: asset},
+				{name: "checksums.txt", content: tc.checksums},
+			}
+			if tc.sig != nil {
+				assets = append(assets, fakeAsset{name: "checksums.txt.sig", content: tc.sig})
+			}
+
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: assets})
+			up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{Signature: &Ed25519Validator{PublicKey: pub}}}, gh)
+
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, exe) {
+					t.Fatalf("Executable was not updated: %q", b)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Wanted error %q but got %v", tc.err, err)
+			}
+			if string(b) != "old executable" {
+				t.Fatalf("Old executable should be kept but got %q", b)
+			}
+		})
+	}
+}
+
+// TestUpdateWithGoReleaserChecksums updates from the release archives and checksums.txt laid out as GoReleaser
+// generates them. The checksums cover the archives, so the archive must be validated before the executable is
+// extracted from it.
+func TestUpdateWithGoReleaserChecksums(t *testing.T) {
+	fixture := func(name string) []byte {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", "goreleaser", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	archive := fixture("foo_1.2.3_linux_amd64.tar.gz")
+	checksums := fixture("checksums.txt")
+	corrupted := append([]byte{}, archive...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	unlisted := []byte{}
+	for _, l := range strings.SplitAfter(string(checksums), "\n") {
+		if !strings.Contains(l, "linux_amd64") {
+			unlisted = append(unlisted, l...)
+		}
+	}
+
+	for _, tc := range []struct {
+		what      string
+		archive   []byte
+		checksums []byte
+		wantErr   string
+	}{
+		{"valid", archive, checksums, ""},
+		{"replaced archive", tarGz(t, map[string][]byte{"foo": []byte("\x7fELF malicious")}), checksums, "hash mismatch"},
+		{"corrupted archive", corrupted, checksums, "hash mismatch"},
+		{"archive not listed", archive, unlisted, `file "foo_1.2.3_linux_amd64.tar.gz" is not found in checksum file`},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: "foo_1.2.3_darwin_arm64.tar.gz", content: fixture("foo_1.2.3_darwin_arm64.tar.gz")},
+				{name: "foo_1.2.3_linux_amd64.tar.gz", content: tc.archive},
+				{name: "foo_1.2.3_windows_amd64.zip", content: fixture("foo_1.2.3_windows_amd64.zip")},
+				{name: "checksums.txt", content: tc.checksums},
+			}})
+			up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}, OS: "linux", Arch: "amd64"}, gh)
+
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != "\x7fELFfoo version 1.2.3\n" {
+					t.Fatalf("Executable should be extracted from the validated archive but got %q", b)
+				}
+				return
+			}
+
+			// Extracting the archive would fail with a different error for the corrupted archive
+			if !errors.Is(err, ErrValidationFailed) || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Wanted validation error %q before extraction but got %v", tc.wantErr, err)
+			}
+			if string(b) != "old executable" {
+				t.Fatalf("Old executable should be kept but got %q", b)
+			}
+			if files, _ := ioutil.ReadDir(filepath.Dir(path)); len(files) != 1 {
+				t.Error("No file should be extracted next to the executable:", files)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package selfupdate
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/blang/semver"
@@ -14,37 +17,145 @@ const windows = "windows"
 
 var reVersion = regexp.MustCompile(`\d+\.\d+\.\d+`)
 
+// DefaultAssetExtensionKey is the key of Config.AssetExtensions for the platforms not in the map.
+const DefaultAssetExtensionKey = "default"
+
+// assetExtensions are the file extensions of release assets in order of preference. An empty extension means
+// an uncompressed executable.
+var assetExtensions = []string{".zip", ".tar.gz", ".tgz", ".gzip", ".gz", ".tar.xz", ".xz", ".tar.lzma", ".tlz", ".lzma", ""}
+
+// SelectionStrategy specifies how the latest release is picked from the releases matching the platform.
+type SelectionStrategy int
+
+const (
+	// HighestVersion picks the release with the highest semantic version. This is the default.
+	HighestVersion SelectionStrategy = iota
+	// MostRecentlyPublished picks the release published most recently regardless of its version.
+	// This is useful when releases can be published out of version order (e.g. hotfixes of older versions).
+	MostRecentlyPublished
+)
+
+// AssetPreference specifies which asset is selected when both an archived asset and a bare executable match the
+// platform, such as 'foo_linux_amd64.tar.gz' and 'foo_linux_amd64'.
+type AssetPreference int
+
+const (
+	// PreferArchive selects the archived or compressed asset. This is the default.
+	PreferArchive AssetPreference = iota
+	// PreferBare selects the bare executable, e.g. 'foo_linux_amd64' or 'foo_windows_amd64.exe'.
+	PreferBare
+	// PreferAuto selects the asset having the validation file of Config.Validator in the release, such as
+	// 'foo_linux_amd64.tar.gz.sha256', and the archived asset when both or neither have it.
+	PreferAuto
+)
+
+// VersionSource specifies where the version of a release is read from.
+type VersionSource int
+
+const (
+	// VersionFromTag reads the version from the tag name of the release. This is the default.
+	VersionFromTag VersionSource = iota
+	// VersionFromName reads the version from the name (title) of the release such as 'v1.2.3 - Spring Update'. This is
+	// useful when tags do not carry versions, e.g. commit hashes.
+	VersionFromName
+	// VersionFromTagOrName reads the version from the tag name, and falls back to the release name when the tag does
+	// not have a version.
+	VersionFromTagOrName
+)
+
 type options struct {
-	draft bool
-	pre   bool
+	draft         bool
+	pre           bool
+	strategy      SelectionStrategy
+	extensions    []string
+	tagPrefix     string
+	tagFilter     *regexp.Regexp
+	versionSource VersionSource
+	versionParser func(string) (semver.Version, error)
+	// goos and goarch are the platform of the assets to detect. They are runtime.GOOS and runtime.GOARCH when empty
+	goos      string
+	goarch    string
+	emulation bool
+	// skipVersions are never detected as the latest version
+	skipVersions []semver.Version
+	// allAssets sets all assets of the detected release to Release.Assets
+	allAssets bool
+	// fallbackSuffixes are the suffixes of the assets running under emulation, tried when no native asset is found
+	fallbackSuffixes []string
+	// preference chooses among the assets matching the platform. validator is used by PreferAuto and is nil when the
+	// validation files are not release assets
+	preference AssetPreference
+	validator  Validator
+	// source selects the source archive of each release instead of the asset for the platform
+	source SourceArchive
+	// strict fails the selection when multiple candidate releases have the same version
+	strict bool
 }
 
-func findAssetFromRelease(rel *github.RepositoryRelease, suffixes []string, targetVersion string, filters []*regexp.Regexp, opt options) (*github.ReleaseAsset, semver.Version, bool) { //nolint:cyclop,gocognit
-	if targetVersion != "" && targetVersion != rel.GetTagName() {
-		log.Println("Skip", rel.GetTagName(), "not matching to specified version", targetVersion)
+// platform returns the target platform of the executable to update.
+func (up *Updater) platform() platform {
+	goos, goarch := up.options().platform()
 
-		return nil, semver.Version{}, false
+	return platform{goos, goarch}
+}
+
+func (opt options) platform() (string, string) {
+	goos, goarch := opt.goos, opt.goarch
+	if goos == "" {
+		goos = runtime.GOOS
 	}
 
-	if targetVersion == "" && rel.GetDraft() && !opt.draft {
-		log.Println("Skip draft version", rel.GetTagName())
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+
+	return goos, goarch
+}
 
-		return nil, semver.Version{}, false
+// isNewer returns true when the candidate release should be picked instead of the currently selected one.
+func (opt options) isNewer(candidate *github.RepositoryRelease, candidateVer semver.Version, selected *github.RepositoryRelease, selectedVer semver.Version) bool {
+	if opt.strategy == MostRecentlyPublished {
+		c, s := candidate.GetPublishedAt().Time, selected.GetPublishedAt().Time
+		if !c.Equal(s) {
+			return c.After(s)
+		}
 	}
 
-	if targetVersion == "" && rel.GetPrerelease() && !opt.pre {
-		log.Println("Skip pre-release version", rel.GetTagName())
+	// Note: any version with suffix is less than any version without suffix.
+	// e.g. 0.0.1 > 0.0.1-beta
+	return candidateVer.GTE(selectedVer)
+}
 
-		return nil, semver.Version{}, false
+// parseVersion parses the version in the text of a tag or a release name with the version parser. By default, the
+// text before the version number such as 'v' is stripped and the version ends at the first space, so that names like
+// 'v1.2.3 - Spring Update' are also parsed.
+func (opt options) parseVersion(text string) (semver.Version, bool) {
+	v, err := opt.parseVersionText(text)
+	if err != nil {
+		log.Println("Skip version:", err)
+
+		return semver.Version{}, false
+	}
+
+	return v, true
+}
+
+// parseVersionText is the same as parseVersion, but it returns the reason why the text has no version.
+func (opt options) parseVersionText(text string) (semver.Version, error) {
+	if opt.versionParser != nil {
+		v, err := opt.versionParser(text)
+		if err != nil {
+			return semver.Version{}, fmt.Errorf("failed to parse a version from %q: %w", text, err)
+		}
+
+		return v, nil
 	}
 
-	verText := rel.GetTagName()
+	verText := text
 	indices := reVersion.FindStringIndex(verText)
 
 	if indices == nil {
-		log.Println("Skip version not adopting semver", verText)
-
-		return nil, semver.Version{}, false
+		return semver.Version{}, fmt.Errorf("%q does not adopt semantic versioning", text)
 	}
 
 	if indices[0] > 0 {
@@ -53,106 +164,437 @@ func findAssetFromRelease(rel *github.RepositoryRelease, suffixes []string, targ
 		verText = verText[indices[0]:]
 	}
 
+	if i := strings.IndexAny(verText, " \t"); i >= 0 {
+		verText = verText[:i]
+	}
+
 	// If semver cannot parse the version text, it means that the text is not adopting
 	// the semantic versioning. So it should be skipped.
 	ver, err := semver.Make(verText)
 	if err != nil {
-		log.Println("Failed to parse a semantic version", verText)
+		return semver.Version{}, fmt.Errorf("failed to parse a semantic version %q: %w", verText, err)
+	}
 
-		return nil, semver.Version{}, false
+	return ver, nil
+}
+
+// releaseVersion returns the version of the release read from its tag or its name depending on the version source.
+func (opt options) releaseVersion(rel *github.RepositoryRelease) (semver.Version, bool) {
+	if opt.versionSource != VersionFromName {
+		if v, ok := opt.parseVersion(strings.TrimPrefix(rel.GetTagName(), opt.tagPrefix)); ok {
+			return v, true
+		}
+
+		if opt.versionSource == VersionFromTag {
+			return semver.Version{}, false
+		}
+
+		log.Println("Fall back to the release name", rel.GetName(), "for the version of", rel.GetTagName())
 	}
 
-	for _, asset := range rel.Assets {
-		name := asset.GetName()
+	return opt.parseVersion(rel.GetName())
+}
 
-		if len(filters) > 0 {
-			// if some filters are defined, match them: if any one matches, the asset is selected
-			matched := false
+// skipsVersion returns true when the version is one of Config.SkipVersions.
+func (opt options) skipsVersion(ver semver.Version) bool {
+	for _, v := range opt.skipVersions {
+		if v.Equals(ver) {
+			return true
+		}
+	}
 
-			for _, filter := range filters {
-				if filter.MatchString(name) {
-					log.Println("Selected filtered asset", name)
+	return false
+}
 
-					matched = true
+// parseSkipVersions parses Config.SkipVersions with the rules to read the versions of releases.
+func parseSkipVersions(config Config) ([]semver.Version, error) {
+	opt := options{tagPrefix: config.TagPrefix, versionParser: config.VersionParser}
+	vers := make([]semver.Version, 0, len(config.SkipVersions))
 
-					break
-				}
+	for _, s := range config.SkipVersions {
+		v, err := opt.parseVersionText(strings.TrimPrefix(s, opt.tagPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%w in SkipVersions: %v", ErrInvalidVersion, err)
+		}
 
-				log.Printf("Skipping asset %q not matching filter %v\n", name, filter)
-			}
+		vers = append(vers, v)
+	}
 
-			if !matched {
-				continue
-			}
+	return vers, nil
+}
+
+// matchesVersion returns true when the version specified to DetectVersion is the tag, the name or the version of the
+// release.
+func (opt options) matchesVersion(rel *github.RepositoryRelease, ver semver.Version, target string) bool {
+	if target == rel.GetTagName() || opt.tagPrefix+target == rel.GetTagName() || target == rel.GetName() {
+		return true
+	}
+
+	v, ok := opt.parseVersion(target)
+
+	return ok && v.Equals(ver)
+}
+
+func findAssetFromRelease(rel *github.RepositoryRelease, suffixes []string, targetVersion string, filters []*regexp.Regexp, opt options) (*github.ReleaseAsset, semver.Version, bool) {
+	asset, ver, err := selectAssetFromRelease(rel, suffixes, targetVersion, filters, opt)
+
+	return asset, ver, err == nil
+}
+
+// errReleaseSkipped is returned by selectAssetFromRelease when the release does not match the version or the
+// configuration.
+var errReleaseSkipped = errors.New("release is skipped")
+
+// selectAssetFromRelease returns the asset for the platform in the release. errReleaseSkipped is returned when the
+// release itself does not match, and ErrAssetNotFound when it matches but has no asset for the platform.
+func selectAssetFromRelease(rel *github.RepositoryRelease, suffixes []string, targetVersion string, filters []*regexp.Regexp, opt options) (*github.ReleaseAsset, semver.Version, error) {
+	ver, err := opt.selectRelease(rel, targetVersion)
+	if err != nil {
+		return nil, semver.Version{}, err
+	}
+
+	if opt.source != SourceArchiveNone {
+		if asset, ok := sourceArchiveAsset(rel, opt.source); ok {
+			return asset, ver, nil
+		}
+
+		log.Println("No source archive was found in release", rel.GetTagName())
+
+		return nil, semver.Version{}, ErrAssetNotFound
+	}
+
+	if asset, ok := opt.findAssetWithSuffixes(rel, suffixes, filters); ok {
+		return asset, ver, nil
+	}
+
+	if len(opt.fallbackSuffixes) > 0 {
+		if asset, ok := opt.findAssetWithSuffixes(rel, opt.fallbackSuffixes, filters); ok {
+			log.Println("No native asset was found in release", rel.GetTagName(), ". Fall back to", asset.GetName(), "running under emulation")
+
+			return asset, ver, nil
+		}
+	}
+
+	if asset, ok := opt.findBareWindowsExecutable(rel, filters); ok {
+		log.Println("No asset for the platform was found in release", rel.GetTagName(), ". Use bare executable", asset.GetName())
+
+		return asset, ver, nil
+	}
+
+	log.Println("No suitable asset was found in release", rel.GetTagName())
+
+	return nil, semver.Version{}, ErrAssetNotFound
+}
+
+// selectRelease returns the version of the release when the release matches the version and the configuration
+// regardless of its assets. Otherwise errReleaseSkipped is returned.
+func (opt options) selectRelease(rel *github.RepositoryRelease, targetVersion string) (semver.Version, error) { //nolint:cyclop
+	// Tags not matching the filter are not release tags, so they are skipped without logging
+	if opt.tagFilter != nil && !opt.tagFilter.MatchString(rel.GetTagName()) {
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	if opt.tagPrefix != "" && !strings.HasPrefix(rel.GetTagName(), opt.tagPrefix) {
+		log.Println("Skip", rel.GetTagName(), "not having tag prefix", opt.tagPrefix)
+
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	// The version can be specified with or without the tag prefix. When versions are read from release names, the
+	// specified version is compared after the version is parsed
+	if targetVersion != "" && opt.versionSource == VersionFromTag && targetVersion != rel.GetTagName() && opt.tagPrefix+targetVersion != rel.GetTagName() {
+		log.Println("Skip", rel.GetTagName(), "not matching to specified version", targetVersion)
+
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	if targetVersion == "" && rel.GetDraft() && !opt.draft {
+		log.Println("Skip draft version", rel.GetTagName())
+
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	if targetVersion == "" && rel.GetPrerelease() && !opt.pre {
+		log.Println("Skip pre-release version", rel.GetTagName())
+
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	ver, ok := opt.releaseVersion(rel)
+	if !ok {
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	if targetVersion != "" && opt.versionSource != VersionFromTag && !opt.matchesVersion(rel, ver, targetVersion) {
+		log.Println("Skip", rel.GetTagName(), "not matching to specified version", targetVersion)
+
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	if targetVersion == "" && opt.skipsVersion(ver) {
+		log.Println("Skip version", rel.GetTagName(), "listed in SkipVersions")
+
+		return semver.Version{}, errReleaseSkipped
+	}
+
+	return ver, nil
+}
+
+// findAssetWithSuffixes returns the asset of the release matching the filters and any of the suffixes. When multiple
+// assets match, the asset is chosen with the asset preference, and then the earliest suffix and the name break ties
+// so that the selection does not depend on the order of the assets.
+func (opt options) findAssetWithSuffixes(rel *github.RepositoryRelease, suffixes []string, filters []*regexp.Regexp) (*github.ReleaseAsset, bool) { //nolint:cyclop
+	var selected *github.ReleaseAsset
+
+	selectedRank, candidates := 0, 0
+
+	for _, asset := range rel.Assets {
+		name := asset.GetName()
+
+		if !matchesFilters(name, filters) {
+			continue
 		}
 
-		for _, s := range suffixes {
+		for i, s := range suffixes {
 			if strings.HasSuffix(name, s) { // require version, arch etc
-				// default: assume single artifact
-				return asset, ver, true
+				candidates++
+
+				rank := opt.preferenceRank(rel, name)*len(suffixes) + i
+				if selected == nil || rank < selectedRank || rank == selectedRank && name < selected.GetName() {
+					selected, selectedRank = asset, rank
+				}
+
+				break
 			}
 		}
 	}
 
-	log.Println("No suitable asset was found in release", rel.GetTagName())
+	if candidates > 1 {
+		log.Println("Selected asset", selected.GetName(), "among", candidates, "assets for the platform in release", rel.GetTagName())
+	}
 
-	return nil, semver.Version{}, false
+	return selected, selected != nil
 }
 
-func findValidationAsset(rel *github.RepositoryRelease, validationName string) (*github.ReleaseAsset, bool) {
+// matchesFilters returns true when no filter is defined or any of the filters matches the asset name.
+func matchesFilters(name string, filters []*regexp.Regexp) bool {
+	if len(filters) == 0 {
+		return true
+	}
+
+	for _, filter := range filters {
+		if filter.MatchString(name) {
+			log.Println("Selected filtered asset", name)
+
+			return true
+		}
+
+		log.Printf("Skipping asset %q not matching filter %v\n", name, filter)
+	}
+
+	return false
+}
+
+// findBareWindowsExecutable returns the executable uploaded to the release as-is without the platform in its name,
+// such as 'foo.exe', when the target OS is Windows. Assets having 'windows' in their names are for other archs, since
+// they did not match the platform. Nothing is returned when several assets are such executables.
+func (opt options) findBareWindowsExecutable(rel *github.RepositoryRelease, filters []*regexp.Regexp) (*github.ReleaseAsset, bool) {
+	if goos, _ := opt.platform(); goos != windows {
+		return nil, false
+	}
+
+	var found *github.ReleaseAsset
+
 	for _, asset := range rel.Assets {
-		if asset.GetName() == validationName {
-			return asset, true
+		name := asset.GetName()
+		if !strings.HasSuffix(strings.ToLower(name), ".exe") || strings.Contains(strings.ToLower(name), windows) || !matchesFilters(name, filters) {
+			continue
+		}
+
+		if found != nil {
+			log.Println("Bare executables", found.GetName(), "and", name, "are found in release", rel.GetTagName(), ". Neither is selected")
+
+			return nil, false
+		}
+
+		found = asset
+	}
+
+	return found, found != nil
+}
+
+// preferenceRank returns the rank of the asset named name in the release with the asset preference. A lower rank is
+// preferred.
+func (opt options) preferenceRank(rel *github.RepositoryRelease, name string) int {
+	bare := archiveFormatOf(name) == FormatRaw
+
+	switch opt.preference {
+	case PreferBare:
+		if bare {
+			return 0
+		}
+
+		return 1
+	case PreferAuto:
+		rank := 0
+		if bare {
+			rank = 1
+		}
+
+		if opt.validator != nil {
+			if _, ok := findValidationAsset(rel, validationAssetNames(opt.validator, name)...); !ok {
+				rank += 2
+			}
+		}
+
+		return rank
+	default:
+		if bare {
+			return 1
+		}
+
+		return 0
+	}
+}
+
+func findValidationAsset(rel *github.RepositoryRelease, validationNames ...string) (*github.ReleaseAsset, bool) {
+	for _, name := range validationNames {
+		for _, asset := range rel.Assets {
+			if asset.GetName() == name {
+				return asset, true
+			}
 		}
 	}
 
 	return nil, false
 }
 
-func findReleaseAndAsset(rels []*github.RepositoryRelease, targetVersion string, filters []*regexp.Regexp, opt options) (*github.RepositoryRelease, *github.ReleaseAsset, semver.Version, bool) {
-	// Generate candidates
-	suffixes := make([]string, 0, 2*7*2)
+// emulatedArchs maps the platforms which can run executables for another arch under emulation to the arch, such as
+// x64 emulation on Windows on ARM and Rosetta 2 on macOS.
+var emulatedArchs = map[string]string{
+	"windows/arm64": "amd64",
+	"darwin/arm64":  "amd64",
+}
+
+// goosAliases are the abbreviations of GOOS values used in the names of release assets by some releasers.
+var goosAliases = map[string][]string{
+	"freebsd": {"fbsd"},
+	"openbsd": {"obsd"},
+	"netbsd":  {"nbsd"},
+}
+
+// platformOSNames returns the names of the OS in release assets. GOOS comes first, followed by its abbreviations.
+func platformOSNames(goos string) []string {
+	return append([]string{goos}, goosAliases[goos]...)
+}
 
-	for _, sep := range []rune{'_', '-'} {
-		for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".gzip", ".gz", ".tar.xz", ".xz", ""} {
-			suffix := fmt.Sprintf("%s%c%s%s", runtime.GOOS, sep, runtime.GOARCH, ext)
-			suffixes = append(suffixes, suffix)
+// assetSuffixes returns the candidates of the suffixes of release asset names for the platform, such as
+// 'linux_amd64.tar.gz'.
+func assetSuffixes(goos, goarch string, exts []string) []string {
+	names := platformOSNames(goos)
+	suffixes := make([]string, 0, 2*len(exts)*2*len(names))
 
-			if runtime.GOOS == windows {
-				suffix = fmt.Sprintf("%s%c%s.exe%s", runtime.GOOS, sep, runtime.GOARCH, ext)
+	for _, name := range names {
+		for _, sep := range []rune{'_', '-'} {
+			for _, ext := range exts {
+				suffix := fmt.Sprintf("%s%c%s%s", name, sep, goarch, ext)
 				suffixes = append(suffixes, suffix)
+
+				// e.g. 'foo_windows_amd64.exe.zip' or 'foo_wasip1_wasm.wasm'
+				if exe := executableExt(goos); exe != "" {
+					suffix = fmt.Sprintf("%s%c%s%s%s", name, sep, goarch, exe, ext)
+					suffixes = append(suffixes, suffix)
+				}
 			}
 		}
 	}
 
+	return suffixes
+}
+
+// platformSuffixes returns the suffixes of the asset names for the platform, and sets the fallback suffixes of the
+// assets running under emulation when it is enabled.
+func (opt *options) platformSuffixes() []string {
+	exts := opt.extensions
+	if len(exts) == 0 {
+		exts = assetExtensions
+	}
+
+	goos, goarch := opt.platform()
+	suffixes := assetSuffixes(goos, goarch, exts)
+
+	if opt.emulation {
+		if arch, ok := emulatedArchs[goos+"/"+goarch]; ok {
+			opt.fallbackSuffixes = assetSuffixes(goos, arch, exts)
+		}
+	}
+
+	return suffixes
+}
+
+func findReleaseAndAsset(rels []*github.RepositoryRelease, targetVersion string, filters []*regexp.Regexp, opt options) (*github.RepositoryRelease, *github.ReleaseAsset, semver.Version, bool) {
+	rel, asset, ver, err := selectReleaseAndAsset(rels, targetVersion, filters, opt)
+
+	return rel, asset, ver, err == nil
+}
+
+// selectReleaseAndAsset returns the latest release having an asset for the platform. ErrNoReleaseFound is returned
+// when no release matches the version and the configuration, and ErrAssetNotFound when some releases match but none
+// of them has an asset for the platform. When opt.strict is set, ErrAmbiguousVersion is returned when multiple
+// releases having the asset have the same version.
+func selectReleaseAndAsset(rels []*github.RepositoryRelease, targetVersion string, filters []*regexp.Regexp, opt options) (*github.RepositoryRelease, *github.ReleaseAsset, semver.Version, error) { //nolint:cyclop
+	suffixes := opt.platformSuffixes()
+	goos, goarch := opt.platform()
+
 	var ver semver.Version
 
 	var asset *github.ReleaseAsset
 
 	var release *github.RepositoryRelease
 
+	noAsset := false
+
+	// Tags of the candidates by their versions without build metadata, which is ignored on comparing versions
+	tags := map[string]string{}
+
 	// Find the latest version from the list of releases.
 	// Returned list from GitHub API is in the order of the date when created.
 	//   ref: https://github.com/rhysd/go-github-selfupdate/issues/11
 	for _, rel := range rels {
-		if a, v, ok := findAssetFromRelease(rel, suffixes, targetVersion, filters, opt); ok {
-			// Note: any version with suffix is less than any version without suffix.
-			// e.g. 0.0.1 > 0.0.1-beta
-			if release == nil || v.GTE(ver) {
-				ver = v
-				asset = a
-				release = rel
+		a, v, err := selectAssetFromRelease(rel, suffixes, targetVersion, filters, opt)
+		if err != nil {
+			noAsset = noAsset || errors.Is(err, ErrAssetNotFound)
+
+			continue
+		}
+
+		if opt.strict {
+			key := semver.Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Pre: v.Pre}.String()
+			if tag, ok := tags[key]; ok {
+				return nil, nil, semver.Version{}, fmt.Errorf("%w: releases %q and %q have the same version %s", ErrAmbiguousVersion, tag, rel.GetTagName(), key)
 			}
+
+			tags[key] = rel.GetTagName()
+		}
+
+		if release == nil || opt.isNewer(rel, v, release, ver) {
+			ver = v
+			asset = a
+			release = rel
 		}
 	}
 
 	if release == nil {
-		log.Println("Could not find any release for", runtime.GOOS, "and", runtime.GOARCH)
+		log.Println("Could not find any release for", goos, "and", goarch)
+
+		if noAsset {
+			return nil, nil, semver.Version{}, ErrAssetNotFound
+		}
 
-		return nil, nil, semver.Version{}, false
+		return nil, nil, semver.Version{}, ErrNoReleaseFound
 	}
 
-	return release, asset, ver, true
+	return release, asset, ver, nil
 }
 
 // DetectLatest tries to get the latest version of the repository on GitHub. 'slug' means 'owner/name' formatted string.
@@ -160,72 +602,455 @@ func findReleaseAndAsset(rels []*github.RepositoryRelease, targetVersion string,
 // Drafts and pre-releases are ignored. Assets would be suffixed by the OS name and the arch name such as 'foo_linux_amd64'
 // where 'foo' is a command name. '-' can also be used as a separator. File can be compressed with zip, gzip, zxip, tar&zip or tar&zxip.
 // So the asset can have a file extension for the corresponding compression format such as '.zip'.
-// On Windows, '.exe' also can be contained such as 'foo_windows_amd64.exe.zip'.
+// On Windows, '.exe' also can be contained such as 'foo_windows_amd64.exe.zip', and an executable uploaded as-is without
+// the platform in its name such as 'foo.exe' is selected when the release has no asset for the platform.
 func (up *Updater) DetectLatest(slug string) (release *Release, found bool, err error) {
 	return up.DetectVersion(slug, "")
 }
 
+// DetectLatestIncludingAssets is the same as DetectLatest, but it also sets all assets of the detected release,
+// including the ones for other platforms, to Release.Assets. The assets are read from the same list of releases, so no
+// extra request is sent to GitHub API. This is useful for listing downloads of all platforms.
+func (up *Updater) DetectLatestIncludingAssets(slug string) (release *Release, found bool, err error) {
+	opt := up.options()
+	opt.allAssets = true
+
+	return up.detectVersion(up.apiCtx, slug, "", opt)
+}
+
+// DetectStable tries to get the latest stable version of the repository on GitHub. `slug` means `owner/name` formatted string.
+// Unlike DetectLatest, drafts and pre-releases are always ignored regardless of Config.PreRelease and Config.Draft.
+func (up *Updater) DetectStable(slug string) (release *Release, found bool, err error) {
+	opt := up.options()
+	opt.pre, opt.draft = false, false
+
+	return up.detectVersion(up.apiCtx, slug, "", opt)
+}
+
 // DetectVersion tries to get the given version of the repository on Github. `slug` means `owner/name` formatted string.
 // And version indicates the required version.
 func (up *Updater) DetectVersion(slug string, version string) (release *Release, found bool, err error) {
-	repo := strings.Split(slug, "/")
-	if len(repo) != 2 || repo[0] == "" || repo[1] == "" {
-		return nil, false, fmt.Errorf("invalid slug format. It should be 'owner/name': %s", slug)
+	return up.detectVersion(up.apiCtx, slug, version, up.options())
+}
+
+// CompareVersions compares two versions with the same rules as the updater reads the versions of releases: the tag
+// prefix and the text before the version number such as 'v' are stripped, or Config.VersionParser is applied when
+// set. It returns -1, 0 or +1 when a is lower than, equal to or greater than b in semantic versioning, where
+// a pre-release is lower than its release. An error matching ErrInvalidVersion is returned when either cannot be
+// parsed.
+func (up *Updater) CompareVersions(a, b string) (int, error) {
+	opt := up.options()
+
+	va, err := opt.parseVersionText(strings.TrimPrefix(a, opt.tagPrefix))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidVersion, err)
 	}
 
-	rels, res, err := up.api.Repositories.ListReleases(up.apiCtx, repo[0], repo[1], nil)
+	vb, err := opt.parseVersionText(strings.TrimPrefix(b, opt.tagPrefix))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+	}
+
+	return va.Compare(vb), nil
+}
+
+// FindRelease is the same as DetectVersion, but it returns an error instead of false when no release is detected,
+// so that the reason can be told to users: ErrNoReleaseFound is matched with errors.Is when the repository has no
+// release matching the version and the configuration, and ErrAssetNotFound when releases exist but none of them has
+// an asset for the platform. The latest release is detected when version is empty.
+func (up *Updater) FindRelease(slug string, version string) (*Release, error) {
+	return up.detectOrCached(up.apiCtx, slug, version, up.options())
+}
+
+// IsUpdateAvailable reports whether a release newer than the current version is available for the slug (owner/repo),
+// and returns the release when it is. This is meant for frequent background checks with minimum work: the versions
+// are compared from the list of releases only. Assets and validation files are not looked up until the release is
+// passed to UpdateTo, Release.Download or the like, which then fails with ErrAssetNotFound when the release has no
+// asset for the platform, so the asset fields of the returned release are empty until then. Config.ReleaseCache is
+// not used.
+func (up *Updater) IsUpdateAvailable(slug string, current semver.Version) (bool, *Release, error) {
+	repo, err := parseSlug(slug)
+	if err != nil {
+		return false, nil, err
+	}
+
+	rels, res, err := up.listReleases(up.apiCtx, repo, "")
+	if err != nil {
+		if res != nil && res.StatusCode == 404 {
+			return false, nil, nil
+		}
+
+		return false, nil, asRateLimitError(err)
+	}
+
+	opt := up.options()
+
+	var latest *github.RepositoryRelease
+
+	var ver semver.Version
+
+	for _, rel := range rels {
+		v, err := opt.selectRelease(rel, "")
+		if err != nil {
+			continue
+		}
+
+		if latest == nil || opt.isNewer(rel, v, latest, ver) {
+			latest, ver = rel, v
+		}
+	}
+
+	if latest == nil || ver.LTE(current) {
+		return false, nil, nil
+	}
+
+	log.Println("Update", latest.GetTagName(), "of", slug, "is available. Its asset is looked up on update")
+
+	return true, up.newUnresolvedRelease(latest, ver, repo), nil
+}
+
+// newUnresolvedRelease creates a Release whose asset is not looked up yet. See resolveRelease.
+func (up *Updater) newUnresolvedRelease(rel *github.RepositoryRelease, ver semver.Version, repo []string) *Release {
+	publishedAt := rel.GetPublishedAt().Time
+
+	return &Release{
+		Version:                    ver,
+		PreRelease:                 rel.GetPrerelease(),
+		Draft:                      rel.GetDraft(),
+		ValidationAssetID:          -1,
+		ValidationSignatureAssetID: -1,
+		ProvenanceAssetID:          -1,
+		URL:                        rel.GetHTMLURL(),
+		ReleaseNotes:               rel.GetBody(),
+		Name:                       rel.GetName(),
+		PublishedAt:                &publishedAt,
+		RepoOwner:                  repo[0],
+		RepoName:                   repo[1],
+		updater:                    up,
+		tagName:                    rel.GetTagName(),
+		raw:                        &rawRelease{id: rel.GetID()},
+		unresolved:                 true,
+	}
+}
+
+// resolveRelease looks up the asset and the validation files of the release returned by IsUpdateAvailable and sets
+// them to the release. It does nothing for releases whose asset is already looked up.
+func (up *Updater) resolveRelease(ctx context.Context, rel *Release) error {
+	if !rel.unresolved {
+		return nil
+	}
+
+	slug := rel.RepoOwner + "/" + rel.RepoName
+
+	resolved, err := up.detectRelease(ctx, slug, rel.tagName, up.options())
+	if err != nil {
+		return fmt.Errorf("failed to look up asset of release %s: %w", rel.tagName, err)
+	}
+
+	*rel = *resolved
+
+	return nil
+}
+
+// options returns the options of detecting releases configured in the updater.
+func (up *Updater) options() options {
+	return options{
+		pre:           up.pre,
+		draft:         up.draft,
+		strategy:      up.strategy,
+		extensions:    up.extensions,
+		tagPrefix:     up.tagPrefix,
+		tagFilter:     up.tagFilter,
+		versionSource: up.versionSource,
+		versionParser: up.versionParser,
+		emulation:     up.emulation,
+		goos:          up.goos,
+		goarch:        up.goarch,
+		skipVersions:  up.skipVersions,
+		preference:    up.preference,
+		validator:     up.assetValidator(),
+		source:        up.source,
+		strict:        up.strictVers,
+	}
+}
+
+// assetValidator returns the validator whose validation files are release assets, or nil.
+func (up *Updater) assetValidator() Validator {
+	if up.validator == nil || isRemoteValidator(up.validator) || up.valSource != nil {
+		return nil
+	}
+
+	return up.validator
+}
+
+func (up *Updater) detectVersion(ctx context.Context, slug string, version string, opt options) (release *Release, found bool, err error) {
+	release, err = up.detectOrCached(ctx, slug, version, opt)
+	if errors.Is(err, ErrNoReleaseFound) || errors.Is(err, ErrAssetNotFound) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return release, true, nil
+}
+
+// detectRelease is the same as detectVersion, but it returns ErrNoReleaseFound or ErrAssetNotFound when no release
+// is detected.
+func (up *Updater) detectRelease(ctx context.Context, slug string, version string, opt options) (*Release, error) { //nolint:cyclop,funlen
+	repo, err := parseSlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	rels, res, err := up.listReleases(ctx, repo, version)
 	if err != nil {
 		log.Println("API returned an error response:", err)
 
 		if res != nil && res.StatusCode == 404 {
 			// 404 means repository not found or release not found. It's not an error here.
-			err = nil
-
 			log.Println("API returned 404. Repository or release not found")
+
+			return nil, fmt.Errorf("%w in repository %s", ErrNoReleaseFound, slug)
 		}
 
-		return nil, false, err
+		return nil, asRateLimitError(err)
 	}
 
-	opt := options{pre: up.pre, draft: up.draft}
+	parts := up.joinSplitAssets(rels)
+	goos, goarch := opt.platform()
 
-	rel, asset, ver, found := findReleaseAndAsset(rels, version, up.filters, opt)
-	if !found {
-		return nil, false, nil
+	rel, asset, ver, err := selectReleaseAndAsset(rels, version, up.filters, opt)
+	if errors.Is(err, ErrAssetNotFound) && version == "" && up.latestFlag && up.skipNoAsset {
+		if rels, parts, err = up.releasesUntil(ctx, repo, rels[0], opt); err != nil {
+			return nil, err
+		}
+
+		rel, asset, ver, err = selectReleaseAndAsset(rels, version, up.filters, opt)
 	}
 
-	url := asset.GetBrowserDownloadURL()
-	log.Println("Successfully fetched the latest release. tag:", rel.GetTagName(), ", name:", rel.GetName(), ", URL:", rel.GetURL(), ", Asset:", url)
+	if errors.Is(err, ErrAssetNotFound) {
+		return nil, fmt.Errorf("%w: no release of %s has an asset for %s/%s", err, slug, goos, goarch)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w in repository %s", err, slug)
+	}
+
+	release, err := up.newRelease(rel, asset, ver, repo, parts[asset])
+
+	// Releases whose asset has no validation file are skipped as releases without the asset
+	for errors.Is(err, ErrValidationFailed) && version == "" && up.skipNoAsset {
+		log.Println("Skip release", rel.GetTagName(), ":", err)
+
+		rels = withoutRelease(rels, rel)
+
+		if rel, asset, ver, err = selectReleaseAndAsset(rels, version, up.filters, opt); err != nil {
+			return nil, fmt.Errorf("%w: no release of %s has an asset for %s/%s with its validation file", ErrAssetNotFound, slug, goos, goarch)
+		}
+
+		release, err = up.newRelease(rel, asset, ver, repo, parts[asset])
+	}
+
+	if err != nil {
+		return nil, err
+	}
 
+	log.Println("Successfully fetched the latest release. tag:", rel.GetTagName(), ", name:", rel.GetName(), ", URL:", rel.GetURL(), ", Asset:", asset.GetBrowserDownloadURL())
+
+	if opt.allAssets {
+		release.Assets = up.releaseAssets(rel)
+	}
+
+	return release, nil
+}
+
+// releasesUntil lists the releases of the repository which are not newer than the release marked as latest on GitHub,
+// so that the newest of them having an asset is detected when the latest one has no asset for the platform. See
+// Config.SkipReleasesWithoutAssets.
+func (up *Updater) releasesUntil(ctx context.Context, repo []string, latest *github.RepositoryRelease, opt options) ([]*github.RepositoryRelease, map[*github.ReleaseAsset][]AssetPart, error) {
+	log.Println("Release", latest.GetTagName(), "marked as latest has no asset for the platform. Look for older releases")
+
+	rels, _, err := up.api.Repositories.ListReleases(ctx, repo[0], repo[1], nil)
+	if err != nil {
+		return nil, nil, asRateLimitError(err)
+	}
+
+	parts := up.joinSplitAssets(rels)
+	latestVer, _ := opt.releaseVersion(latest)
+	older := make([]*github.RepositoryRelease, 0, len(rels))
+
+	for _, rel := range rels {
+		if ver, ok := opt.releaseVersion(rel); ok && (rel.GetID() == latest.GetID() || !opt.isNewer(rel, ver, latest, latestVer)) {
+			older = append(older, rel)
+		}
+	}
+
+	return older, parts, nil
+}
+
+// withoutRelease returns the releases except the release.
+func withoutRelease(rels []*github.RepositoryRelease, release *github.RepositoryRelease) []*github.RepositoryRelease {
+	others := make([]*github.RepositoryRelease, 0, len(rels))
+
+	for _, rel := range rels {
+		if rel != release {
+			others = append(others, rel)
+		}
+	}
+
+	return others
+}
+
+// joinSplitAssets joins the split assets of the releases in place with Config.SplitAssetPattern and returns the parts
+// of the joined assets.
+func (up *Updater) joinSplitAssets(rels []*github.RepositoryRelease) map[*github.ReleaseAsset][]AssetPart {
+	parts := map[*github.ReleaseAsset][]AssetPart{}
+
+	if up.split == nil {
+		return parts
+	}
+
+	for i, rel := range rels {
+		joined, p := joinSplitAssets(rel, up.split)
+		for a, ps := range p {
+			parts[a] = ps
+		}
+
+		rels[i] = joined
+	}
+
+	return parts
+}
+
+// releaseAssets returns all assets of the release. Split assets are listed as their joined asset.
+func (up *Updater) releaseAssets(rel *github.RepositoryRelease) []Asset {
+	assets := make([]Asset, 0, len(rel.Assets))
+	for _, a := range rel.Assets {
+		assets = append(assets, Asset{
+			Name:        a.GetName(),
+			URL:         a.GetBrowserDownloadURL(),
+			ID:          a.GetID(),
+			ByteSize:    a.GetSize(),
+			ContentType: a.GetContentType(),
+			Digest:      up.digests.get(a.GetID()),
+		})
+	}
+
+	return assets
+}
+
+// listReleases lists the releases of the repository to detect the version from. Only the release marked as latest
+// on GitHub is returned when the latest version is detected with Config.UseGitHubLatestFlag.
+func (up *Updater) listReleases(ctx context.Context, repo []string, version string) ([]*github.RepositoryRelease, *github.Response, error) {
+	if version != "" || !up.latestFlag {
+		return up.api.Repositories.ListReleases(ctx, repo[0], repo[1], nil) //nolint:wrapcheck
+	}
+
+	rel, res, err := up.api.Repositories.GetLatestRelease(ctx, repo[0], repo[1])
+	if err != nil {
+		return nil, res, err //nolint:wrapcheck
+	}
+
+	log.Println("Release marked as latest on GitHub:", rel.GetTagName())
+
+	return []*github.RepositoryRelease{rel}, res, nil
+}
+
+// newRelease creates a Release for the asset of the release in the repository. The validation files and the provenance
+// of the asset are looked up in the release.
+func (up *Updater) newRelease(rel *github.RepositoryRelease, asset *github.ReleaseAsset, ver semver.Version, repo []string, parts []AssetPart) (*Release, error) { //nolint:funlen
+	url := asset.GetBrowserDownloadURL()
 	publishedAt := rel.GetPublishedAt().Time
-	release = &Release{
-		ver,
-		rel.GetPrerelease(),
-		rel.GetDraft(),
-		url,
-		asset.GetSize(),
-		asset.GetID(),
-		-1,
-		rel.GetHTMLURL(),
-		rel.GetBody(),
-		rel.GetName(),
-		&publishedAt,
-		repo[0],
-		repo[1],
-	}
-
-	if up.validator != nil {
-		validationName := asset.GetName() + up.validator.Suffix()
-
-		validationAsset, ok := findValidationAsset(rel, validationName)
+	release := &Release{
+		Version:                    ver,
+		PreRelease:                 rel.GetPrerelease(),
+		Draft:                      rel.GetDraft(),
+		AssetURL:                   url,
+		AssetName:                  asset.GetName(),
+		AssetByteSize:              asset.GetSize(),
+		AssetID:                    asset.GetID(),
+		AssetParts:                 parts,
+		ValidationAssetID:          -1,
+		ValidationSignatureAssetID: -1,
+		ProvenanceAssetID:          -1,
+		URL:                        rel.GetHTMLURL(),
+		ReleaseNotes:               rel.GetBody(),
+		Name:                       rel.GetName(),
+		PublishedAt:                &publishedAt,
+		RepoOwner:                  repo[0],
+		RepoName:                   repo[1],
+		updater:                    up,
+		assetNames:                 make([]string, 0, len(rel.Assets)),
+		tagName:                    rel.GetTagName(),
+		raw:                        &rawRelease{id: rel.GetID()},
+	}
+
+	for _, a := range rel.Assets {
+		release.assetNames = append(release.assetNames, a.GetName())
+	}
+
+	// The digest of the first part is not the one of the joined asset
+	if len(parts) == 0 {
+		release.AssetDigest = up.digests.get(asset.GetID())
+	}
+
+	// Validation data of remote validators such as attestations are not release assets
+	if up.validator != nil && !isRemoteValidator(up.validator) && up.valSource == nil {
+		validationNames := validationAssetNames(up.validator, asset.GetName())
+
+		validationAsset, ok := findValidationAsset(rel, validationNames...)
 		if !ok {
-			return nil, false, fmt.Errorf("failed finding validation file %q", validationName)
+			quoted := make([]string, 0, len(validationNames))
+			for _, n := range validationNames {
+				quoted = append(quoted, strconv.Quote(n))
+			}
+
+			return nil, markError(ErrValidationFailed, fmt.Errorf("failed finding validation file %s", strings.Join(quoted, " or ")))
 		}
 
+		log.Println("Found validation file", validationAsset.GetName())
+
 		release.ValidationAssetID = validationAsset.GetID()
+		release.validationAssetName = validationAsset.GetName()
+		release.validationAssetURL = validationAsset.GetBrowserDownloadURL()
+
+		if sig := signatureValidator(up.validator); sig != nil {
+			sigNames := validationAssetNames(sig, validationAsset.GetName())
+
+			sigAsset, ok := findValidationAsset(rel, sigNames...)
+			if !ok {
+				return nil, markError(ErrValidationFailed, fmt.Errorf("failed finding signature file %q of validation file %q", sigNames[0], validationAsset.GetName()))
+			}
+
+			release.ValidationSignatureAssetID = sigAsset.GetID()
+			release.validationSignatureAssetName = sigAsset.GetName()
+			release.validationSignatureAssetURL = sigAsset.GetBrowserDownloadURL()
+		}
 	}
 
-	return release, true, nil
+	if up.provenance != nil {
+		if a, ok := findValidationAsset(rel, up.provenance.assetNames(asset.GetName())...); ok {
+			log.Println("Found SLSA provenance file", a.GetName())
+
+			release.ProvenanceAssetID = a.GetID()
+			release.provenanceAssetName = a.GetName()
+			release.provenanceAssetURL = a.GetBrowserDownloadURL()
+		}
+	}
+
+	return release, nil
+}
+
+// parseSlug splits the slug into the owner and the name of the repository.
+func parseSlug(slug string) ([]string, error) {
+	repo := strings.Split(slug, "/")
+	if len(repo) != 2 || repo[0] == "" || repo[1] == "" {
+		return nil, fmt.Errorf("invalid slug format. It should be 'owner/name': %s", slug)
+	}
+
+	return repo, nil
 }
 
 // DetectLatest detects the latest release of the slug (owner/repo).
@@ -234,6 +1059,36 @@ func DetectLatest(slug string) (*Release, bool, error) {
 	return DefaultUpdater().DetectLatest(slug)
 }
 
+// DetectLatestIncludingAssets detects the latest release of the slug (owner/repo) with all of its assets.
+// This function is a shortcut version of updater.DetectLatestIncludingAssets() method.
+func DetectLatestIncludingAssets(slug string) (*Release, bool, error) {
+	return DefaultUpdater().DetectLatestIncludingAssets(slug)
+}
+
+// DetectStable detects the latest stable release of the slug (owner/repo), ignoring drafts and pre-releases.
+// This function is a shortcut version of updater.DetectStable() method.
+func DetectStable(slug string) (*Release, bool, error) {
+	return DefaultUpdater().DetectStable(slug)
+}
+
+// IsUpdateAvailable reports whether a release newer than the current version is available for the slug (owner/repo).
+// This function is a shortcut version of updater.IsUpdateAvailable() method.
+func IsUpdateAvailable(slug string, current semver.Version) (bool, *Release, error) {
+	return DefaultUpdater().IsUpdateAvailable(slug, current)
+}
+
+// CompareVersions compares two versions with the rules of the default updater.
+// This function is a shortcut version of updater.CompareVersions() method.
+func CompareVersions(a, b string) (int, error) {
+	return DefaultUpdater().CompareVersions(a, b)
+}
+
+// FindRelease detects the given release of the slug (owner/repo), or the latest one when version is empty.
+// This function is a shortcut version of updater.FindRelease() method.
+func FindRelease(slug string, version string) (*Release, error) {
+	return DefaultUpdater().FindRelease(slug, version)
+}
+
 // DetectVersion detects the given release of the slug (owner/repo) from its version.
 func DetectVersion(slug string, version string) (*Release, bool, error) {
 	return DefaultUpdater().DetectVersion(slug, version)
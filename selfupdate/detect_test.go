@@ -1,11 +1,17 @@
 package selfupdate
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"regexp"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/google/go-github/v30/github"
@@ -455,3 +461,755 @@ func TestFindReleaseAndAsset(t *testing.T) {
 	}
 
 }
+
+func TestDetectStableIgnoresPreReleaseConfig(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.1.0-beta", prerelease: true, assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.0", draft: true, assets: []fakeAsset{{name: name}}})
+
+	up, _ := newTestUpdater(t, Config{PreRelease: true, Draft: true}, gh)
+
+	r, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || r.Version.String() != "1.2.0" {
+		t.Fatal("DetectLatest should respect Config but got", r)
+	}
+
+	r, ok, err = up.DetectStable("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Stable release was not found")
+	}
+	if r.Version.String() != "1.0.0" || r.PreRelease || r.Draft {
+		t.Error("Unexpected release detected:", r.Version, r.PreRelease, r.Draft)
+	}
+}
+
+func TestDetectWithSelectionStrategy(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	gh.addRelease("owner/repo", fakeRelease{tag: "v2.0.0", publishedAt: day(1), assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.9.1", publishedAt: day(3), assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.9.0", publishedAt: day(2), assets: []fakeAsset{{name: name}}})
+
+	for strategy, want := range map[SelectionStrategy]string{
+		HighestVersion:        "2.0.0",
+		MostRecentlyPublished: "1.9.1",
+	} {
+		up, _ := newTestUpdater(t, Config{SelectionStrategy: strategy}, gh)
+
+		for _, detect := range []func(string) (*Release, bool, error){up.DetectLatest, up.DetectStable} {
+			r, ok, err := detect("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("Release was not found with strategy", strategy)
+			}
+			if r.Version.String() != want {
+				t.Errorf("Wanted %s with strategy %d but got %s", want, strategy, r.Version)
+			}
+		}
+	}
+}
+
+func TestDetectValidationAssetCandidates(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	v := &NamedValidator{Validator: &SHA2Validator{}, Template: "{{asset}}.sig", FallbackTemplates: []string{"{{asset}}.asc"}}
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name}, {name: name + ".asc"}}})
+	up, _ := newTestUpdater(t, Config{Validator: v}, gh)
+
+	r, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Release was not found")
+	}
+	if r.ValidationAssetID != fakeAssetID("owner/repo", 0, 1) {
+		t.Error("Unexpected validation asset ID:", r.ValidationAssetID)
+	}
+
+	gh = newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name}, {name: name + ".minisig.txt"}}})
+	up, _ = newTestUpdater(t, Config{Validator: v}, gh)
+
+	_, _, err = up.DetectLatest("owner/repo")
+	if err == nil {
+		t.Fatal("Error should occur when no validation file is found")
+	}
+	if want := fmt.Sprintf(`failed finding validation file "%s.sig" or "%s.asc"`, name, name); err.Error() != want {
+		t.Errorf("Wanted error %q but got %q", want, err)
+	}
+}
+
+func TestDetectWithAssetExtensions(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: platformAssetName("foo", ".zip"), content: []byte("zip")},
+			{name: platformAssetName("foo", ".tar.gz"), content: []byte("tar.gz")},
+		},
+	})
+
+	for _, tc := range []struct {
+		exts map[string]string
+		want string
+	}{
+		{nil, ".zip"},
+		{map[string]string{runtime.GOOS: ".tar.gz", DefaultAssetExtensionKey: ".zip"}, ".tar.gz"},
+		{map[string]string{DefaultAssetExtensionKey: ".tar.gz"}, ".tar.gz"},
+		{map[string]string{"plan9": ".tar.gz"}, ".zip"},
+	} {
+		up, _ := newTestUpdater(t, Config{AssetExtensions: tc.exts}, gh)
+		r, ok, err := up.DetectLatest("owner/repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("Release was not found for", tc.exts)
+		}
+		if want := platformAssetName("foo", tc.want); r.AssetName != want {
+			t.Errorf("Wanted %q for %v but got %q", want, tc.exts, r.AssetName)
+		}
+	}
+
+	up, _ := newTestUpdater(t, Config{AssetExtensions: map[string]string{DefaultAssetExtensionKey: ".tar.xz"}}, gh)
+	if _, ok, _ := up.DetectLatest("owner/repo"); ok {
+		t.Error("Asset with other extension should not be detected")
+	}
+}
+
+func TestDetectWithTagPrefix(t *testing.T) {
+	name := platformAssetName("cmd", ".zip")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "cli/v1.2.3", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "agent/v3.0.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "cli/v1.3.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "agent/v0.9.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v9.9.9", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "cli/v1.2.4", assets: []fakeAsset{{name: name}}})
+
+	for prefix, want := range map[string]string{
+		"cli/":   "cli/v1.3.0",
+		"agent/": "agent/v3.0.0",
+		"":       "v9.9.9",
+	} {
+		up, _ := newTestUpdater(t, Config{TagPrefix: prefix}, gh)
+
+		r, ok, err := up.DetectLatest("owner/repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("Release was not found with prefix", prefix)
+		}
+		if !strings.HasSuffix(r.URL, "/releases/tag/"+want) {
+			t.Errorf("Wanted %s with prefix %q but got %s", want, prefix, r.URL)
+		}
+	}
+
+	up, _ := newTestUpdater(t, Config{TagPrefix: "cli/"}, gh)
+	for _, version := range []string{"v1.2.3", "cli/v1.2.3"} {
+		r, ok, err := up.DetectVersion("owner/repo", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || r.Version.String() != "1.2.3" {
+			t.Fatal("Release of version", version, "was not found:", r)
+		}
+	}
+
+	if _, ok, _ := up.DetectVersion("owner/repo", "v0.9.0"); ok {
+		t.Fatal("Release with other prefix should not be detected")
+	}
+}
+
+func TestDetectWithTagFilter(t *testing.T) {
+	name := platformAssetName("cmd", ".zip")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "nightly-20210101", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "docs-v2.0.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "ci-passed-1.3.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.1.0", assets: []fakeAsset{{name: name}}})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(ioutil.Discard)
+
+	up, _ := newTestUpdater(t, Config{TagFilter: regexp.MustCompile(`^v\d+\.\d+\.\d+$`)}, gh)
+	r, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || r.Version.String() != "1.2.0" {
+		t.Fatal("Tags not matching the filter should be ignored but got", r)
+	}
+
+	for _, tag := range []string{"nightly", "docs", "ci-passed"} {
+		if strings.Contains(buf.String(), tag) {
+			t.Errorf("Tag %q not matching the filter should be skipped silently: %s", tag, buf.String())
+		}
+	}
+}
+
+func TestDetectWithSkipVersions(t *testing.T) {
+	name := platformAssetName("cmd", ".zip")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.3.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.1", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.0", assets: []fakeAsset{{name: name}}})
+
+	for _, tc := range []struct {
+		skip []string
+		want string
+	}{
+		{nil, "1.3.0"},
+		{[]string{"1.3.0"}, "1.2.1"},
+		{[]string{"v1.3.0", "v1.2.1"}, "1.2.0"},
+		{[]string{"1.3.0", "1.2.1", "1.2.0"}, ""},
+	} {
+		t.Run(strings.Join(tc.skip, ","), func(t *testing.T) {
+			up, _ := newTestUpdater(t, Config{SkipVersions: tc.skip}, gh)
+			r, ok, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == "" {
+				if ok {
+					t.Fatal("All releases should be skipped but got", r.Version)
+				}
+				return
+			}
+			if !ok || r.Version.String() != tc.want {
+				t.Fatalf("Wanted %s but got %v", tc.want, r)
+			}
+		})
+	}
+
+	up, _ := newTestUpdater(t, Config{SkipVersions: []string{"1.3.0"}}, gh)
+	r, ok, err := up.DetectVersion("owner/repo", "v1.3.0")
+	if err != nil || !ok || r.Version.String() != "1.3.0" {
+		t.Fatal("Skipped version should be detected when specified:", r, ok, err)
+	}
+	n, err := up.VersionsBehind("owner/repo", semver.MustParse("1.2.0"))
+	if err != nil || n != 1 {
+		t.Fatal("Skipped version should not be counted:", n, err)
+	}
+
+	up, _ = newTestUpdater(t, Config{TagPrefix: "cli/", SkipVersions: []string{"cli/v1.3.0"}}, gh)
+	if len(up.skipVersions) != 1 || up.skipVersions[0].String() != "1.3.0" {
+		t.Fatal("Tag prefix should be stripped from skipped version:", up.skipVersions)
+	}
+
+	if _, err := NewUpdater(Config{SkipVersions: []string{"latest"}}); !errors.Is(err, ErrInvalidVersion) {
+		t.Fatal("Invalid skipped version should be rejected:", err)
+	}
+}
+
+func TestDetectWithVersionSource(t *testing.T) {
+	asset := platformAssetName("cmd", ".zip")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "3f2a9c1", name: "v1.2.3 — Spring Update", assets: []fakeAsset{{name: asset}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "8b7e0d4", name: "v1.10.0 — Summer Update", assets: []fakeAsset{{name: asset}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.4.0", name: "Autumn Update", assets: []fakeAsset{{name: asset}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "c0ffee0", name: "Nightly build", assets: []fakeAsset{{name: asset}}})
+
+	for source, want := range map[VersionSource]string{
+		VersionFromTag:       "1.4.0",
+		VersionFromName:      "1.10.0",
+		VersionFromTagOrName: "1.10.0",
+	} {
+		up, _ := newTestUpdater(t, Config{VersionSource: source}, gh)
+
+		r, ok, err := up.DetectLatest("owner/repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || r.Version.String() != want {
+			t.Errorf("Wanted %s with version source %d but got %v", want, source, r)
+		}
+	}
+
+	up, _ := newTestUpdater(t, Config{VersionSource: VersionFromName}, gh)
+	for _, version := range []string{"v1.2.3", "1.2.3", "3f2a9c1", "v1.2.3 — Spring Update"} {
+		r, ok, err := up.DetectVersion("owner/repo", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || r.Version.String() != "1.2.3" {
+			t.Errorf("Release of version %q was not found: %v", version, r)
+		}
+	}
+}
+
+func TestDetectWithVersionParser(t *testing.T) {
+	asset := platformAssetName("cmd", ".zip")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "a1", name: "Release 2 (build 7)", assets: []fakeAsset{{name: asset}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "b2", name: "Release 3 (build 1)", assets: []fakeAsset{{name: asset}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "c3", name: "Preview", assets: []fakeAsset{{name: asset}}})
+
+	re := regexp.MustCompile(`^Release (\d+) \(build (\d+)\)$`)
+	parser := func(text string) (semver.Version, error) {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			return semver.Version{}, fmt.Errorf("not a release name: %q", text)
+		}
+		return semver.Make(m[1] + ".0." + m[2])
+	}
+
+	up, _ := newTestUpdater(t, Config{VersionSource: VersionFromName, VersionParser: parser}, gh)
+	r, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || r.Version.String() != "3.0.1" {
+		t.Fatal("Version should be parsed with the parser but got", r)
+	}
+}
+
+func TestFindReleaseAndAssetForWindowsArm64(t *testing.T) {
+	release := func(tag string, names ...string) *github.RepositoryRelease {
+		rel := &github.RepositoryRelease{TagName: github.String(tag)}
+		for _, n := range names {
+			rel.Assets = append(rel.Assets, &github.ReleaseAsset{Name: github.String(n)})
+		}
+		return rel
+	}
+	native := release("v1.2.3", "foo_windows_amd64.zip", "foo_windows_arm64.zip", "foo_linux_arm64.zip")
+	amd64Only := release("v1.2.3", "foo_windows_amd64.exe.zip", "foo_linux_arm64.zip")
+
+	for _, tc := range []struct {
+		what      string
+		rel       *github.RepositoryRelease
+		emulation bool
+		want      string
+	}{
+		{"native", native, false, "foo_windows_arm64.zip"},
+		{"native preferred over emulation", native, true, "foo_windows_arm64.zip"},
+		{"no emulation by default", amd64Only, false, ""},
+		{"emulation", amd64Only, true, "foo_windows_amd64.exe.zip"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			opt := options{goos: "windows", goarch: "arm64", emulation: tc.emulation}
+			_, asset, _, found := findReleaseAndAsset([]*github.RepositoryRelease{tc.rel}, "", nil, opt)
+			if tc.want == "" {
+				if found {
+					t.Fatal("asset should not be found but got", asset.GetName())
+				}
+				return
+			}
+			if !found {
+				t.Fatal("asset was not found")
+			}
+			if asset.GetName() != tc.want {
+				t.Fatalf("wanted %s but got %s", tc.want, asset.GetName())
+			}
+		})
+	}
+
+	// Only Windows on ARM and macOS on Apple silicon can emulate amd64
+	opt := options{goos: "linux", goarch: "arm64", emulation: true}
+	if _, asset, _, found := findReleaseAndAsset([]*github.RepositoryRelease{release("v1.2.3", "foo_linux_amd64.zip")}, "", nil, opt); found {
+		t.Fatal("amd64 asset should not be selected on linux/arm64 but got", asset.GetName())
+	}
+}
+
+func TestFindReleaseAndAssetForBSDs(t *testing.T) {
+	for _, tc := range []struct {
+		goos  string
+		asset string
+	}{
+		{"freebsd", "foo_freebsd_amd64.tar.gz"},
+		{"freebsd", "foo-fbsd-amd64.tar.gz"},
+		{"openbsd", "foo_openbsd_amd64.tar.gz"},
+		{"openbsd", "foo_obsd_amd64.zip"},
+		{"netbsd", "foo_netbsd_amd64.tar.xz"},
+		{"netbsd", "foo_nbsd_amd64.tar.gz"},
+		{"dragonfly", "foo_dragonfly_amd64.tar.gz"},
+	} {
+		t.Run(tc.asset, func(t *testing.T) {
+			rel := &github.RepositoryRelease{TagName: github.String("v1.2.3")}
+			for _, n := range []string{"foo_linux_amd64.tar.gz", "foo_darwin_amd64.tar.gz", tc.asset} {
+				rel.Assets = append(rel.Assets, &github.ReleaseAsset{Name: github.String(n)})
+			}
+
+			_, asset, _, found := findReleaseAndAsset([]*github.RepositoryRelease{rel}, "", nil, options{goos: tc.goos, goarch: "amd64"})
+			if !found {
+				t.Fatal("asset was not found on", tc.goos)
+			}
+			if asset.GetName() != tc.asset {
+				t.Fatalf("wanted %s but got %s", tc.asset, asset.GetName())
+			}
+		})
+	}
+}
+
+func TestIsUpdateAvailable(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name}, {name: name + ".sha256"}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.1.0", assets: []fakeAsset{{name: name}, {name: name + ".sha256"}}})
+
+	up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}}, gh)
+
+	for current, want := range map[string]bool{"1.0.0": true, "1.1.0": false, "2.0.0": false} {
+		ok, rel, err := up.IsUpdateAvailable("owner/repo", semver.MustParse(current))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want {
+			t.Errorf("Update availability for %s should be %v", current, want)
+		}
+		if ok && (rel == nil || rel.Version.String() != "1.1.0") {
+			t.Error("Available release should be returned but got", rel)
+		}
+		if !ok && rel != nil {
+			t.Error("No release should be returned when update is not available:", rel)
+		}
+	}
+
+	if n := len(gh.requested()); n != 3 {
+		t.Fatal("Only one request should be made per check but got", n)
+	}
+
+	ok, rel, err := up.IsUpdateAvailable("owner/unknown", semver.MustParse("1.0.0"))
+	if err != nil || ok || rel != nil {
+		t.Fatal("Update should not be available for unknown repository:", ok, rel, err)
+	}
+}
+
+func TestIsUpdateAvailableDefersAssets(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	exe := fakeExecutableContent(t, "v1.1.0")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name, content: asset}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.1.0", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+	}})
+	gh.addRelease("owner/other", fakeRelease{tag: "v1.1.0", assets: []fakeAsset{{name: "foo_plan9_mips.tar.gz"}}})
+
+	for _, tc := range []struct {
+		what   string
+		slug   string
+		config Config
+		want   string
+	}{
+		{"validated", "owner/repo", Config{Validator: &SHA2Validator{}}, ""},
+		{"no validation file", "owner/repo", Config{Validator: &ECDSAValidator{}}, "failed finding validation file"},
+		{"no asset", "owner/other", Config{}, "no release of owner/other has an asset"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			up, _ := newTestUpdater(t, tc.config, gh)
+
+			ok, rel, err := up.IsUpdateAvailable(tc.slug, semver.MustParse("1.0.0"))
+			if err != nil || !ok {
+				t.Fatal("Update should be available without looking up assets:", ok, err)
+			}
+			if rel.Version.String() != "1.1.0" || rel.AssetURL != "" {
+				t.Fatalf("Asset should not be looked up: %+v", rel)
+			}
+
+			path := setupOldExecutable(t)
+			err = up.UpdateTo(rel, path)
+			if tc.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("Wanted error %q but got %v", tc.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.AssetName != name {
+				t.Error("Asset should be set to the release on update but got", rel.AssetName)
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+		})
+	}
+}
+
+func TestDetectLatestIncludingAssets(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_linux_amd64.tar.gz", content: []byte("linux")},
+		{name: "foo_darwin_arm64.tar.gz", content: []byte("darwin")},
+		{name: "foo_windows_amd64.zip", content: []byte("windows")},
+		{name: "checksums.txt", content: []byte("checksums")},
+	}})
+	up, _ := newTestUpdater(t, Config{OS: "linux", Arch: "amd64"}, gh)
+
+	rel, ok, err := up.DetectLatestIncludingAssets("owner/repo")
+	if err != nil || !ok {
+		t.Fatal("Release should be detected:", ok, err)
+	}
+	if rel.AssetName != "foo_linux_amd64.tar.gz" {
+		t.Error("Asset for the platform should be detected but got", rel.AssetName)
+	}
+	if len(rel.Assets) != 4 {
+		t.Fatal("All assets should be listed but got", rel.Assets)
+	}
+	a := rel.Assets[2]
+	if a.Name != "foo_windows_amd64.zip" || a.ByteSize != 7 || a.ID == 0 || a.ContentType != "application/octet-stream" ||
+		!strings.HasSuffix(a.URL, "/owner/repo/releases/download/v1.2.3/foo_windows_amd64.zip") {
+		t.Errorf("Unexpected asset %+v", a)
+	}
+	if n := len(gh.requested()); n != 1 {
+		t.Error("Assets should be read from the list of releases but requested", n, "times")
+	}
+
+	rel, _, err = up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Assets != nil {
+		t.Error("Assets should not be set by DetectLatest:", rel.Assets)
+	}
+}
+
+func TestDetectWithGitHubLatestFlag(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.5.0", assets: []fakeAsset{{name: name}}, latest: true})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v2.0.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v2.1.0", assets: []fakeAsset{{name: name}}, prerelease: true})
+	gh.addRelease("owner/noasset", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: "foo_plan9_mips.tar.gz"}}})
+	gh.addRelease("owner/nolatest", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name}}, draft: true})
+
+	up, _ := newTestUpdater(t, Config{UseGitHubLatestFlag: true, PreRelease: true}, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil || !ok {
+		t.Fatal("Release should be detected:", ok, err)
+	}
+	if rel.Version.String() != "1.5.0" {
+		t.Error("Release marked as latest should be detected but got", rel.Version)
+	}
+	if p := gh.requested()[0].URL.Path; !strings.HasSuffix(p, "/releases/latest") {
+		t.Error("Only the latest release should be fetched but requested", p)
+	}
+
+	rel, ok, err = up.DetectVersion("owner/repo", "v2.0.0")
+	if err != nil || !ok || rel.Version.String() != "2.0.0" {
+		t.Error("Specific version should be detected from all releases:", rel, ok, err)
+	}
+
+	for _, slug := range []string{"owner/noasset", "owner/nolatest"} {
+		if _, ok, err := up.DetectLatest(slug); err != nil || ok {
+			t.Errorf("No release should be detected for %s: %v", slug, err)
+		}
+	}
+
+	if _, err := up.FindRelease("owner/noasset", ""); !errors.Is(err, ErrAssetNotFound) {
+		t.Error("ErrAssetNotFound should be returned when the latest release has no asset for the platform:", err)
+	}
+}
+
+func TestDetectSkippingReleasesWithoutAssets(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.5.0", assets: []fakeAsset{{name: name}, {name: name + ".sha256"}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.4.0", latest: true})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.3.0", assets: []fakeAsset{{name: name}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.0", assets: []fakeAsset{{name: name}, {name: name + ".sha256"}}})
+	gh.addRelease("owner/source", fakeRelease{tag: "v1.0.0", latest: true})
+	gh.addRelease("owner/unsigned", fakeRelease{tag: "v1.0.0", assets: []fakeAsset{{name: name}}})
+
+	for _, tc := range []struct {
+		what   string
+		config Config
+		want   string
+	}{
+		{"latest flag", Config{UseGitHubLatestFlag: true, SkipReleasesWithoutAssets: true}, "1.3.0"},
+		{"latest flag without validation file", Config{UseGitHubLatestFlag: true, SkipReleasesWithoutAssets: true, Validator: &SHA2Validator{}}, "1.2.0"},
+		{"without validation file", Config{SkipReleasesWithoutAssets: true, Validator: &SHA2Validator{}}, "1.5.0"},
+		{"disabled", Config{UseGitHubLatestFlag: true}, ""},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			up, _ := newTestUpdater(t, tc.config, gh)
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == "" {
+				if ok {
+					t.Fatal("No release should be detected but got", rel.Version)
+				}
+				return
+			}
+			if !ok || rel.Version.String() != tc.want {
+				t.Fatalf("Wanted release %s but got %v (found: %v)", tc.want, rel, ok)
+			}
+		})
+	}
+
+	up, _ := newTestUpdater(t, Config{UseGitHubLatestFlag: true, SkipReleasesWithoutAssets: true, Validator: &SHA2Validator{}}, gh)
+	for _, slug := range []string{"owner/source", "owner/unsigned"} {
+		if _, err := up.FindRelease(slug, ""); !errors.Is(err, ErrAssetNotFound) {
+			t.Errorf("ErrAssetNotFound should be returned when no release of %s has a suitable asset: %v", slug, err)
+		}
+	}
+
+	// A specific version is detected as before
+	up, _ = newTestUpdater(t, Config{SkipReleasesWithoutAssets: true, Validator: &SHA2Validator{}}, gh)
+	if _, err := up.FindRelease("owner/repo", "v1.3.0"); !errors.Is(err, ErrValidationFailed) {
+		t.Error("Missing validation file of specific version should be an error:", err)
+	}
+}
+
+func TestDetectWithAssetPreference(t *testing.T) {
+	archive := platformAssetName("foo", ".tar.gz")
+	bare := platformAssetName("foo", "")
+	zip := platformAssetName("foo", ".zip")
+
+	for _, tc := range []struct {
+		what       string
+		assets     []string
+		preference AssetPreference
+		validator  Validator
+		want       string
+	}{
+		{"archive by default", []string{bare, archive}, PreferArchive, nil, archive},
+		{"archive by default in any order", []string{archive, bare}, PreferArchive, nil, archive},
+		{"bare", []string{archive, bare}, PreferBare, nil, bare},
+		{"bare in any order", []string{bare, archive}, PreferBare, nil, bare},
+		{"archives in any order", []string{archive, zip}, PreferArchive, nil, zip},
+		{"only bare", []string{bare}, PreferArchive, nil, bare},
+		{"auto with validation file of bare", []string{archive, bare, bare + ".sha256"}, PreferAuto, &SHA2Validator{}, bare},
+		{"auto with validation file of archive", []string{bare, archive, archive + ".sha256"}, PreferAuto, &SHA2Validator{}, archive},
+		{"auto with checksum file", []string{bare, archive, "checksums.txt"}, PreferAuto, &ChecksumValidator{}, archive},
+		{"auto without validator", []string{bare, archive}, PreferAuto, nil, archive},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			var assets []fakeAsset
+			for _, a := range tc.assets {
+				assets = append(assets, fakeAsset{name: a})
+			}
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: assets})
+			up, _ := newTestUpdater(t, Config{AssetPreference: tc.preference, Validator: tc.validator}, gh)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Release should be detected:", ok, err)
+			}
+			if rel.AssetName != tc.want {
+				t.Errorf("Wanted asset %s but got %s", tc.want, rel.AssetName)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	calver := func(s string) (semver.Version, error) {
+		var y, m int
+		if _, err := fmt.Sscanf(s, "release-%d.%d", &y, &m); err != nil {
+			return semver.Version{}, err
+		}
+		return semver.Version{Major: uint64(y), Minor: uint64(m)}, nil
+	}
+
+	for _, tc := range []struct {
+		config Config
+		a, b   string
+		want   int
+		ok     bool
+	}{
+		{Config{}, "v1.2.3", "1.2.3", 0, true},
+		{Config{}, "v1.2.3", "v1.10.0", -1, true},
+		{Config{}, "v1.2.3", "v1.2.3-beta.1", 1, true},
+		{Config{}, "v1.2.3-beta.2", "v1.2.3-beta.10", -1, true},
+		{Config{}, "Release v2.0.0 - Spring Update", "v1.9.9", 1, true},
+		{Config{TagPrefix: "agent/"}, "agent/v1.2.3", "agent/v1.2.4", -1, true},
+		{Config{VersionParser: calver}, "release-2024.10", "release-2024.9", 1, true},
+		{Config{}, "latest", "v1.2.3", 0, false},
+		{Config{}, "v1.2.3", "v1.2", 0, false},
+		{Config{VersionParser: calver}, "v1.2.3", "release-2024.9", 0, false},
+	} {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			up, err := NewUpdater(tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := up.CompareVersions(tc.a, tc.b)
+			if !tc.ok {
+				if !errors.Is(err, ErrInvalidVersion) {
+					t.Fatal("Error should match ErrInvalidVersion:", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.want {
+				t.Fatalf("Wanted %d but got %d", tc.want, have)
+			}
+		})
+	}
+}
+
+func TestStrictVersions(t *testing.T) {
+	asset := []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: []byte("foo")}}
+
+	for _, tc := range []struct {
+		what          string
+		tags          []string
+		noSecondAsset bool
+		strict        bool
+		want          string
+	}{
+		{"duplicate", []string{"v1.2.3", "1.2.3"}, false, true, `releases "v1.2.3" and "1.2.3" have the same version 1.2.3`},
+		{"duplicate with build metadata", []string{"v1.2.3+a", "v1.2.3+b"}, false, true, "have the same version 1.2.3"},
+		{"duplicate of old version", []string{"v1.2.2", "1.2.2", "v1.2.3"}, false, true, "have the same version 1.2.2"},
+		{"duplicate without asset", []string{"v1.2.3", "1.2.3"}, true, true, ""},
+		{"not strict", []string{"v1.2.3", "1.2.3"}, false, false, ""},
+		{"unique", []string{"v1.2.3", "v1.2.3-beta.1", "v1.2.2"}, false, true, ""},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			for i, tag := range tc.tags {
+				rel := fakeRelease{tag: tag, assets: asset}
+				if i == 1 && tc.noSecondAsset {
+					rel.assets = nil
+				}
+				gh.addRelease("owner/repo", rel)
+			}
+			up, _ := newTestUpdater(t, Config{StrictVersions: tc.strict, PreRelease: true}, gh)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if tc.want != "" {
+				if !errors.Is(err, ErrAmbiguousVersion) || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("Wanted ErrAmbiguousVersion with %q but got %v", tc.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || rel.Version.String() != "1.2.3" {
+				t.Fatal("Wanted version 1.2.3 but got", rel)
+			}
+		})
+	}
+}
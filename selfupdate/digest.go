@@ -0,0 +1,260 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// GitHubDigestValidator validates the release asset with the digest which GitHub computes on upload and returns in
+// the 'digest' field of the asset in GitHub API responses such as 'sha256:9f86d0...'. No validation file is
+// downloaded since the digest is read from the list of releases fetched on detection.
+//
+// The digest only proves that the asset was not corrupted or altered after it was uploaded. It does not prove who
+// uploaded the asset, so combine it with a signature when the release process itself must be trusted. The digest is of
+// the release asset as uploaded, so Config.ValidateTarget must be ValidateArchive, and split assets are not supported.
+type GitHubDigestValidator struct {
+	// RequireDigest fails the update when GitHub API does not return the digest of the asset, e.g. on older GitHub
+	// Enterprise Server. By default the validation is skipped with a warning in the log in that case.
+	RequireDigest bool
+}
+
+var githubDigestAlgorithms = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+// Validate validates the release with the digest in asset, which is in the form of '<algorithm>:<hex digest>'.
+// An empty asset means that GitHub API returned no digest.
+func (v *GitHubDigestValidator) Validate(release, asset []byte) error {
+	if len(asset) == 0 {
+		if v.RequireDigest {
+			return fmt.Errorf("github digest: GitHub API returned no digest of the asset")
+		}
+
+		log.Println("WARNING: GitHub API returned no digest of the asset. The asset is not validated")
+
+		return nil
+	}
+
+	h, expected, err := parseGitHubDigest(string(asset))
+	if err != nil {
+		return err
+	}
+
+	d := h.New()
+	d.Write(release)
+
+	if subtle.ConstantTimeCompare(d.Sum(nil), expected) != 1 {
+		return fmt.Errorf("github digest: %s digest mismatch: expected=%x, got=%x", h, expected, d.Sum(nil))
+	}
+
+	return nil
+}
+
+// Suffix is not used by GitHubDigestValidator since the digest is not a release asset.
+func (v *GitHubDigestValidator) Suffix() string {
+	return ""
+}
+
+// fetchValidationData returns the digest of the asset returned by GitHub API on detection.
+func (v *GitHubDigestValidator) fetchValidationData(ctx context.Context, api *github.Client, rel *Release, release []byte) ([]byte, error) {
+	return []byte(rel.AssetDigest), nil
+}
+
+func (v *GitHubDigestValidator) expectedDigest(filename string, asset []byte) (crypto.Hash, string, bool) {
+	h, expected, err := parseGitHubDigest(string(asset))
+	if err != nil {
+		return 0, "", false
+	}
+
+	return h, hex.EncodeToString(expected), true
+}
+
+// parseGitHubDigest parses the digest of an asset returned by GitHub API such as 'sha256:9f86d0...'.
+func parseGitHubDigest(digest string) (crypto.Hash, []byte, error) {
+	h, b, err := parseDigest(digest)
+	if err != nil {
+		return 0, nil, fmt.Errorf("github digest: %w", err)
+	}
+
+	return h, b, nil
+}
+
+// parseDigest parses a digest in the form of '<algorithm>:<hex digest>'.
+func parseDigest(digest string) (crypto.Hash, []byte, error) {
+	i := strings.IndexByte(digest, ':')
+	if i < 0 {
+		return 0, nil, fmt.Errorf("invalid digest %q. It should be '<algorithm>:<hex digest>'", digest)
+	}
+
+	h, ok := githubDigestAlgorithms[strings.ToLower(digest[:i])]
+	if !ok {
+		return 0, nil, fmt.Errorf("unsupported algorithm %q of digest", digest[:i])
+	}
+
+	b, err := hex.DecodeString(digest[i+1:])
+	if err != nil || len(b) != h.Size() {
+		return 0, nil, fmt.Errorf("invalid %s digest %q", h, digest[i+1:])
+	}
+
+	return h, b, nil
+}
+
+// assetDigests are the digests of release assets by their IDs, read from the responses of GitHub API. They are kept
+// aside since the GitHub API client does not decode the field.
+type assetDigests struct {
+	mu   sync.Mutex
+	byID map[int64]string
+}
+
+// get returns the digest of the asset, or an empty string when it is unknown.
+func (d *assetDigests) get(id int64) string {
+	if d == nil {
+		return ""
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.byID[id]
+}
+
+// record reads the digests of assets from the JSON of a release or a list of releases.
+func (d *assetDigests) record(body []byte) {
+	type release struct {
+		Assets []struct {
+			ID     int64  `json:"id"`
+			Digest string `json:"digest"`
+		} `json:"assets"`
+	}
+
+	var rels []release
+	if err := json.Unmarshal(body, &rels); err != nil {
+		var rel release
+		if err := json.Unmarshal(body, &rel); err != nil {
+			return
+		}
+
+		rels = []release{rel}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, rel := range rels {
+		for _, a := range rel.Assets {
+			if a.Digest == "" {
+				continue
+			}
+
+			if d.byID == nil {
+				d.byID = map[int64]string{}
+			}
+
+			d.byID[a.ID] = a.Digest
+		}
+	}
+}
+
+// assetDigestTransport records the digests of assets in the responses of GitHub API listing releases.
+type assetDigestTransport struct {
+	base    http.RoundTripper
+	digests *assetDigests
+}
+
+func (t *assetDigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK || !isReleasesRequest(req) {
+		return res, err //nolint:wrapcheck
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed reading response of %s: %w", req.URL, err)
+	}
+
+	t.digests.record(body)
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return res, nil
+}
+
+// isReleasesRequest returns true when the request fetches releases from GitHub API, which are small JSON documents.
+// Downloads of assets are not read.
+func isReleasesRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Accept") == "application/octet-stream" {
+		return false
+	}
+
+	p := req.URL.Path
+
+	return strings.Contains(p, "/releases") && !strings.Contains(p, "/releases/assets/") && !strings.Contains(p, "/releases/download/")
+}
+
+// withAssetDigests returns a copy of the client which records the digests of assets to digests.
+func withAssetDigests(c *http.Client, digests *assetDigests) *http.Client {
+	wrapped := *c
+	wrapped.Transport = &assetDigestTransport{base: c.Transport, digests: digests}
+
+	return &wrapped
+}
+
+// pinnedDigestValidator validates the release asset with Config.ExpectedDigest regardless of the files of the release.
+type pinnedDigestValidator struct {
+	digest string
+}
+
+// Validate validates the release with the pinned digest in asset, which is in the form of '<algorithm>:<hex digest>'.
+func (v *pinnedDigestValidator) Validate(release, asset []byte) error {
+	h, expected, err := parseDigest(string(asset))
+	if err != nil {
+		return fmt.Errorf("expected digest: %w", err)
+	}
+
+	d := h.New()
+	d.Write(release)
+
+	if subtle.ConstantTimeCompare(d.Sum(nil), expected) != 1 {
+		alg := strings.ToLower(string(asset[:bytes.IndexByte(asset, ':')]))
+
+		return fmt.Errorf("expected digest: digest of the asset %s:%x does not match the expected digest %s:%x", alg, d.Sum(nil), alg, expected)
+	}
+
+	return nil
+}
+
+// Suffix is not used by pinnedDigestValidator since the digest is not a release asset.
+func (v *pinnedDigestValidator) Suffix() string {
+	return ""
+}
+
+func (v *pinnedDigestValidator) fetchValidationData(ctx context.Context, api *github.Client, rel *Release, release []byte) ([]byte, error) {
+	return []byte(v.digest), nil
+}
+
+func (v *pinnedDigestValidator) expectedDigest(filename string, asset []byte) (crypto.Hash, string, bool) {
+	h, expected, err := parseDigest(string(asset))
+	if err != nil {
+		return 0, "", false
+	}
+
+	return h, hex.EncodeToString(expected), true
+}
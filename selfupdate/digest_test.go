@@ -0,0 +1,224 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withAssetDigest adds the 'digest' field to the assets in the responses of the fake GitHub API as newer GitHub does.
+// digests maps the names of assets to their digests.
+func withAssetDigest(gh http.Handler, digests map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		gh.ServeHTTP(rec, r)
+
+		var rels []map[string]interface{}
+		if !strings.HasSuffix(r.URL.Path, "/releases") || json.Unmarshal(rec.Body.Bytes(), &rels) != nil {
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			_, _ = w.Write(rec.Body.Bytes())
+			return
+		}
+
+		for _, rel := range rels {
+			assets, _ := rel["assets"].([]interface{})
+			for _, a := range assets {
+				a := a.(map[string]interface{})
+				if d, ok := digests[a["name"].(string)]; ok {
+					a["digest"] = d
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rels)
+	})
+}
+
+func TestGitHubDigestValidator(t *testing.T) {
+	content := []byte("release asset")
+	sum256 := sha256.Sum256(content)
+	sum512 := sha512.Sum512(content)
+
+	for _, digest := range []string{fmt.Sprintf("sha256:%x", sum256), fmt.Sprintf("SHA512:%X", sum512)} {
+		if err := (&GitHubDigestValidator{}).Validate(content, []byte(digest)); err != nil {
+			t.Errorf("Digest %s should be valid: %v", digest, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		digest string
+		want   string
+	}{
+		{fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other"))), "SHA-256 digest mismatch"},
+		{fmt.Sprintf("%x", sum256), "invalid digest"},
+		{fmt.Sprintf("md5:%x", sum256), "unsupported algorithm"},
+		{"sha256:abcd", "invalid SHA-256 digest"},
+	} {
+		err := (&GitHubDigestValidator{}).Validate(content, []byte(tc.digest))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Wanted error %q for %s but got %v", tc.want, tc.digest, err)
+		}
+	}
+
+	if err := (&GitHubDigestValidator{}).Validate(content, nil); err != nil {
+		t.Error("Validation should be skipped without digest:", err)
+	}
+	if err := (&GitHubDigestValidator{RequireDigest: true}).Validate(content, nil); err == nil {
+		t.Error("Missing digest should be rejected when it is required")
+	}
+}
+
+func TestUpdateWithGitHubDigestValidator(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+	sum := sha256.Sum256(asset)
+
+	for _, tc := range []struct {
+		what      string
+		digests   map[string]string
+		validator *GitHubDigestValidator
+		wantErr   bool
+	}{
+		{"digest", map[string]string{name: fmt.Sprintf("sha256:%x", sum)}, &GitHubDigestValidator{}, false},
+		{"other digest", map[string]string{name: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))}, &GitHubDigestValidator{}, true},
+		{"no digest", nil, &GitHubDigestValidator{}, false},
+		{"no digest but required", nil, &GitHubDigestValidator{RequireDigest: true}, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: asset}}})
+			up, _ := newTestUpdater(t, Config{Validator: tc.validator}, withAssetDigest(gh, tc.digests))
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Release should be detected:", ok, err)
+			}
+			if rel.AssetDigest != tc.digests[name] {
+				t.Fatalf("Wanted digest %q but got %q", tc.digests[name], rel.AssetDigest)
+			}
+
+			path := setupOldExecutable(t)
+			err = up.UpdateTo(rel, path)
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("error was not returned")
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+			for _, r := range gh.requested() {
+				if strings.Contains(r.URL.Path, ".sha256") {
+					t.Error("No validation file should be downloaded:", r.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectLatestIncludingAssetsWithDigest(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_linux_amd64.tar.gz", content: []byte("linux")},
+		{name: "foo_windows_amd64.zip", content: []byte("windows")},
+	}})
+	up, _ := newTestUpdater(t, Config{OS: "linux", Arch: "amd64"}, withAssetDigest(gh, map[string]string{"foo_windows_amd64.zip": "sha256:1234"}))
+
+	rel, ok, err := up.DetectLatestIncludingAssets("owner/repo")
+	if err != nil || !ok {
+		t.Fatal("Release should be detected:", ok, err)
+	}
+	if rel.Assets[0].Digest != "" || rel.Assets[1].Digest != "sha256:1234" {
+		t.Errorf("Digests should be set to assets: %+v", rel.Assets)
+	}
+}
+
+func TestUpdateWithExpectedDigest(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	sum256 := fmt.Sprintf("sha256:%x", sha256.Sum256(asset))
+	sum512 := fmt.Sprintf("sha512:%x", sha512.Sum512(asset))
+	other := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other build")))
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: "checksums.txt", content: []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("published build")), name))},
+	}})
+
+	for _, tc := range []struct {
+		what   string
+		config Config
+		err    string
+	}{
+		{"sha256", Config{ExpectedDigest: sum256}, ""},
+		{"sha512 in upper case", Config{ExpectedDigest: strings.ToUpper(sum512)}, ""},
+		{"overriding checksum file", Config{ExpectedDigest: sum256, Validator: &ChecksumValidator{}, ValidateTarget: ValidateBinary}, ""},
+		{"overriding missing validation file", Config{ExpectedDigest: sum256, Validator: &SHA2Validator{}}, ""},
+		{"mismatch", Config{ExpectedDigest: other}, "digest of the asset " + sum256 + " does not match the expected digest " + other},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			up, _ := newTestUpdater(t, tc.config, gh)
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := setupOldExecutable(t)
+			res, err := up.UpdateToWithResult(rel, path)
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.err != "" {
+				if !errors.Is(err, ErrValidationFailed) || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Wanted error %q but got %v", tc.err, err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+			if len(res.Verification.Digests) != 1 || res.Verification.ValidationAssets != nil {
+				t.Fatal("Expected digest should be reported without validation files:", res.Verification)
+			}
+		})
+	}
+
+	for _, digest := range []string{"9f86d081884c7d65", "md5:d41d8cd98f00b204e9800998ecf8427e", "sha256:xyz", "sha256:abcd"} {
+		if _, err := NewUpdater(Config{ExpectedDigest: digest}); err == nil || !strings.Contains(err.Error(), "invalid expected digest") {
+			t.Errorf("Invalid digest %q should be rejected: %v", digest, err)
+		}
+	}
+}
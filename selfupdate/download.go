@@ -0,0 +1,450 @@
+package selfupdate
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Downloader downloads release files. It can be set to Config.Downloader to fetch files via custom transports such
+// as mirrors, signed CDN URLs or IPFS gateways while reusing the rest of the update process.
+type Downloader interface {
+	// Download starts downloading the file at url, which is the browser download URL of the release asset.
+	// It returns the content and its size, which is -1 when unknown.
+	Download(ctx context.Context, url string) (io.ReadCloser, int64, error)
+}
+
+// HTTPDownloader is a Downloader fetching files with HTTP GET requests.
+type HTTPDownloader struct {
+	// Client is the HTTP client sending requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Download sends a GET request to url and returns the response body when the status is 200.
+func (d *HTTPDownloader) Download(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create HTTP request to %s: %w", url, err)
+	}
+
+	req.Header.Add("Accept", "application/octet-stream")
+	req.Header.Set("Accept-Encoding", "identity")
+	req = req.WithContext(ctx)
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download a release file from %s: %w", url, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err := rateLimitErrorFromResponse(res)
+		res.Body.Close()
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to download a release file from %s: %w", url, err)
+		}
+
+		return nil, 0, fmt.Errorf("failed to download a release file from %s: Not successful status %d", url, res.StatusCode)
+	}
+
+	if err := decodeContentEncoding(res); err != nil {
+		res.Body.Close()
+
+		return nil, 0, fmt.Errorf("failed to download a release file from %s: %w", url, err)
+	}
+
+	if info, ok := ctx.Value(downloadInfoKey{}).(*DownloadInfo); ok {
+		info.fill(res)
+	}
+
+	return res.Body, res.ContentLength, nil
+}
+
+// decodeContentEncoding removes the gzip Content-Encoding which some CDNs put on top of compressed assets such as
+// '.tar.gz' even though the request accepts only the identity encoding. Otherwise the asset would be decompressed
+// twice, or not at all when the transport did not decompress it. Responses already decompressed by the transport
+// are left as-is.
+func decodeContentEncoding(res *http.Response) error {
+	enc := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if res.Uncompressed || enc == "" || enc == "identity" {
+		return nil
+	}
+
+	if enc != "gzip" && enc != "x-gzip" {
+		return markError(ErrUnsupportedFormat, fmt.Errorf("unsupported Content-Encoding %q of release file", enc))
+	}
+
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to decode gzip Content-Encoding of release file: %w", err)
+	}
+
+	log.Println("Decoding gzip Content-Encoding of release file")
+
+	res.Body = &gzipBody{Reader: gz, body: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return nil
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+
+	return b.body.Close()
+}
+
+// identityEncodingTransport requests release files without transfer compression and strips the compression when
+// the server applied it anyway. See decodeContentEncoding.
+type identityEncodingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *identityEncodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeContentEncoding(res); err != nil {
+		res.Body.Close()
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// AssetURLMode specifies which URL release files are downloaded from.
+type AssetURLMode int
+
+const (
+	// AssetURLAuto downloads release files via GitHub API when an API token is set, which is required for private
+	// repositories, and from browser download URLs otherwise. This is the default.
+	AssetURLAuto AssetURLMode = iota
+	// AssetURLBrowser always downloads release files from their browser download URLs, which are served by the CDN of
+	// GitHub. It is not available for private repositories.
+	AssetURLBrowser
+	// AssetURLAPI always downloads release files from the asset endpoint of GitHub API.
+	AssetURLAPI
+)
+
+// useBrowserURL returns true when the release file should be downloaded from its browser download URL.
+func (up *Updater) useBrowserURL(f releaseFile) bool {
+	// The asset endpoint cannot be used without the ID of the asset
+	if f.id <= 0 {
+		return true
+	}
+
+	if f.url == "" {
+		return false
+	}
+
+	if up.downloader != nil {
+		return true
+	}
+
+	switch up.urlMode {
+	case AssetURLBrowser:
+		return true
+	case AssetURLAPI:
+		return false
+	default:
+		return !up.hasToken
+	}
+}
+
+// assetDownloader returns the downloader for files out of GitHub API such as redirect URLs.
+func (up *Updater) assetDownloader() Downloader {
+	if up.downloader != nil && up.rewriteURL != nil {
+		return &rewritingDownloader{base: up.downloader, rewrite: up.rewriteURL}
+	}
+
+	if up.downloader != nil {
+		return up.downloader
+	}
+
+	// OAuth HTTP client is not available to download blob from URL when the URL is a redirect URL
+	// returned from GitHub Releases API (response status 400).
+	// Use a plain HTTP client instead.
+	return &HTTPDownloader{Client: up.downloadClient()}
+}
+
+// DefaultMaxRedirects is the maximum number of redirects followed on downloading a file when Config.MaxRedirects
+// is zero.
+const DefaultMaxRedirects = 10
+
+// ErrTooManyRedirects is returned when downloading a file is redirected more than Config.MaxRedirects times.
+var ErrTooManyRedirects = errors.New("too many redirects on downloading a release file")
+
+// downloadClient returns the HTTP client to download release files. It does not send the API token since
+// files are served from URLs redirected from GitHub API.
+func (up *Updater) downloadClient() *http.Client {
+	maxRedirects := up.maxRedirects
+	api := up.api.BaseURL
+
+	// Headers are added after rewriting the URL so that the decorator sees the URL actually requested
+	var transport http.RoundTripper
+	if len(up.headers) > 0 || up.decorate != nil {
+		transport = &requestHeaderTransport{headers: up.headers, decorate: up.decorate}
+	}
+
+	// The token is also decided by the URL actually requested, so it is never sent to a mirror
+	if up.token != "" {
+		transport = &apiAuthTransport{base: transport, token: up.token, api: up.api.BaseURL}
+	}
+
+	if up.rewriteURL != nil {
+		transport = &urlRewriteTransport{base: transport, rewrite: up.rewriteURL}
+	}
+
+	transport = &identityEncodingTransport{base: transport}
+
+	return withDownloadInfoTransport(up.retry.client(&http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("%w: stopped after %d redirects at %s", ErrTooManyRedirects, maxRedirects, req.URL)
+			}
+
+			// net/http keeps the header on redirects to the same domain or its subdomains, but signed URLs of storage
+			// such as objects.githubusercontent.com reject any other authentication
+			if !isAPIURL(api, req.URL) {
+				req.Header.Del("Authorization")
+			}
+
+			return nil
+		},
+	}))
+}
+
+// apiAuthTransport sends the API token only with the requests to GitHub API, such as the asset endpoint of
+// a renamed repository redirected from the original one. Downloads redirected to other hosts, e.g. signed URLs of
+// objects.githubusercontent.com, are sent without it since they accept only the signature in the URL.
+type apiAuthTransport struct {
+	base  http.RoundTripper
+	token string
+	api   *url.URL
+}
+
+func (t *apiAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if !isAPIURL(t.api, req.URL) {
+		return base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	// The asset endpoint returns the metadata of the asset unless the binary is requested
+	if strings.Contains(req.URL.Path, "/releases/assets/") {
+		req.Header.Set("Accept", "application/octet-stream")
+	}
+
+	return base.RoundTrip(req)
+}
+
+// isAPIURL returns true when u is under the base URL of GitHub API, e.g. 'https://api.github.com/' or
+// 'https://ghe.example.com/api/v3/'.
+func isAPIURL(api, u *url.URL) bool {
+	return api != nil && strings.EqualFold(u.Scheme, api.Scheme) && strings.EqualFold(u.Host, api.Host) && strings.HasPrefix(u.Path, api.Path)
+}
+
+// urlRewriteTransport rewrites the URL of each request with Config.URLRewriter right before sending it, including
+// the requests following redirects and retries.
+type urlRewriteTransport struct {
+	base    http.RoundTripper
+	rewrite func(string) (string, error)
+}
+
+func (t *urlRewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rewritten, err := rewriteURL(t.rewrite, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if rewritten == req.URL.String() {
+		return base.RoundTrip(req)
+	}
+
+	u, err := url.Parse(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q rewritten from %s: %w", rewritten, req.URL, err)
+	}
+
+	log.Println("Rewrote URL", req.URL, "to", u)
+
+	req = req.Clone(req.Context())
+	req.URL = u
+	req.Host = ""
+
+	return base.RoundTrip(req)
+}
+
+// rewritingDownloader passes the rewritten URLs to Config.Downloader.
+type rewritingDownloader struct {
+	base    Downloader
+	rewrite func(string) (string, error)
+}
+
+func (d *rewritingDownloader) Download(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	rewritten, err := rewriteURL(d.rewrite, url)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return d.base.Download(ctx, rewritten)
+}
+
+func rewriteURL(rewrite func(string) (string, error), url string) (string, error) {
+	rewritten, err := rewrite(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to rewrite URL %s: %w", url, err)
+	}
+
+	return rewritten, nil
+}
+
+// DownloadInfo is the metadata of the HTTP response which served a file downloaded for an update. It can be recorded
+// to prove which bytes from which URL were installed.
+type DownloadInfo struct {
+	// Name is the name of the downloaded release asset
+	Name string
+	// URL is the URL which finally served the file after following redirects
+	URL string
+	// ContentLength is the value of the Content-Length header. It is -1 when unknown
+	ContentLength int64
+	// ETag is the value of the ETag header. It is empty when the server did not send it
+	ETag string
+	// Cached is true when the server responded that the file was not modified and the copy in Config.AssetCacheDir
+	// was used instead of downloading it again
+	Cached bool
+}
+
+func (info *DownloadInfo) fill(res *http.Response) {
+	info.URL = res.Request.URL.String()
+	info.ContentLength = res.ContentLength
+	info.ETag = res.Header.Get("ETag")
+}
+
+type downloadInfoKey struct{}
+
+// downloadInfoTransport fills the DownloadInfo in the context of the request with the successful response. Since
+// the response body returned from GitHub API does not expose its headers, the metadata is captured here.
+type downloadInfoTransport struct {
+	base http.RoundTripper
+}
+
+func (t *downloadInfoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, ok := req.Context().Value(downloadInfoKey{}).(*DownloadInfo); ok && res.StatusCode == http.StatusOK {
+		info.fill(res)
+	}
+
+	return res, nil
+}
+
+// withDownloadInfoTransport returns a copy of the client whose responses are recorded by downloadInfoTransport.
+// Release files are also cached by assetCacheTransport when the context of the request has a cache entry.
+func withDownloadInfoTransport(c *http.Client) *http.Client {
+	wrapped := *c
+	wrapped.Transport = &downloadInfoTransport{base: &assetCacheTransport{base: c.Transport}}
+
+	return &wrapped
+}
+
+type downloadRecorderKey struct{}
+
+// downloadRecorder collects the metadata of files downloaded with a context created by withDownloadRecorder.
+type downloadRecorder struct {
+	mu        sync.Mutex
+	downloads []DownloadInfo
+	// kept is the path of the release asset kept in Config.DownloadDir
+	kept string
+}
+
+func withDownloadRecorder(ctx context.Context) (context.Context, *downloadRecorder) {
+	rec := &downloadRecorder{}
+
+	return context.WithValue(ctx, downloadRecorderKey{}, rec), rec
+}
+
+// recordDownload adds the metadata to the recorder in the context if any.
+func recordDownload(ctx context.Context, info DownloadInfo) {
+	rec, ok := ctx.Value(downloadRecorderKey{}).(*downloadRecorder)
+	if !ok {
+		return
+	}
+
+	rec.mu.Lock()
+	rec.downloads = append(rec.downloads, info)
+	rec.mu.Unlock()
+}
+
+func (rec *downloadRecorder) result() []DownloadInfo {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.downloads
+}
+
+// contextReader stops reading when the context is done. Cancelling the context of a slow download aborts it
+// promptly even after the response headers arrived.
+type contextReader struct {
+	ctx context.Context //nolint:containedctx
+	src io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.src.Read(p)
+}
@@ -0,0 +1,693 @@
+package selfupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func TestUpdateResultDownloads(t *testing.T) {
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name, content: asset},
+			{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+		},
+	})
+	// Redirect API requests to the browser download URL like GitHub redirecting to its CDN
+	gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Redirect(w, r, "/owner/repo/releases/download/v1.2.3/"+a.name, http.StatusFound)
+			return true
+		}
+		w.Header().Set("ETag", `"etag-`+a.name+`"`)
+		return false
+	}
+	up, ts := newTestUpdater(t, Config{Validator: &SHA2Validator{}}, gh)
+
+	res, err := up.UpdateCommandWithResult(setupOldExecutable(t), semver.MustParse("1.2.0"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Downloads) != 2 {
+		t.Fatalf("Unexpected downloads: %+v", res.Downloads)
+	}
+	for _, tc := range []struct {
+		name string
+		size int
+	}{
+		{name + ".sha256", 64},
+		{name, len(asset)},
+	} {
+		found := false
+		for _, d := range res.Downloads {
+			if d.Name != tc.name {
+				continue
+			}
+			found = true
+			if want := ts.URL + "/owner/repo/releases/download/v1.2.3/" + tc.name; d.URL != want {
+				t.Errorf("Wanted URL %q but got %q", want, d.URL)
+			}
+			if d.ContentLength != int64(tc.size) {
+				t.Errorf("Wanted content length %d but got %d", tc.size, d.ContentLength)
+			}
+			if want := `"etag-` + tc.name + `"`; d.ETag != want {
+				t.Errorf("Wanted ETag %q but got %q", want, d.ETag)
+			}
+		}
+		if !found {
+			t.Errorf("Download of %s was not recorded: %+v", tc.name, res.Downloads)
+		}
+	}
+}
+
+func TestUpdateResultDownloadsWithoutRedirect(t *testing.T) {
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: asset}}})
+	up, ts := newTestUpdater(t, Config{}, gh)
+
+	res, err := up.UpdateCommandWithResult(setupOldExecutable(t), semver.MustParse("1.2.0"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Downloads) != 1 {
+		t.Fatalf("Unexpected downloads: %+v", res.Downloads)
+	}
+	d := res.Downloads[0]
+	if d.Name != res.AssetName || !strings.HasPrefix(d.URL, ts.URL+"/api/v3/repos/owner/repo/releases/assets/") || d.ContentLength != int64(len(asset)) {
+		t.Errorf("Unexpected download: %+v", d)
+	}
+}
+
+func TestMaxRedirects(t *testing.T) {
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+
+	for _, tc := range []struct {
+		max       int
+		redirects int
+		ok        bool
+	}{
+		{0, 3, true},
+		{0, DefaultMaxRedirects + 1, false},
+		{2, 2, true},
+		{2, 3, false},
+		{-1, 1, false},
+	} {
+		t.Run(fmt.Sprintf("max %d redirects %d", tc.max, tc.redirects), func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: asset}}})
+			// The redirect from the API is handled by the GitHub client. The following ones are counted
+			gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+				n := 0
+				_, _ = fmt.Sscanf(r.URL.Query().Get("n"), "%d", &n)
+				if strings.HasPrefix(r.URL.Path, "/api/") || n <= tc.redirects {
+					http.Redirect(w, r, fmt.Sprintf("/owner/repo/releases/download/v1.2.3/%s?n=%d", a.name, n+1), http.StatusFound)
+					return true
+				}
+				return false
+			}
+			up, _ := newTestUpdater(t, Config{MaxRedirects: tc.max}, gh)
+
+			_, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.0"), "owner/repo")
+			if tc.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.ok && !errors.Is(err, ErrTooManyRedirects) {
+				t.Fatal("ErrTooManyRedirects should be returned but got", err)
+			}
+		})
+	}
+}
+
+type mapDownloader struct {
+	files map[string][]byte
+	urls  []string
+}
+
+func (d *mapDownloader) Download(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	d.urls = append(d.urls, url)
+	for suffix, b := range d.files {
+		if strings.HasSuffix(url, suffix) {
+			return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+		}
+	}
+	return nil, 0, fmt.Errorf("not found: %s", url)
+}
+
+func TestUpdateWithDownloader(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+	hash := []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))
+
+	gh := newFakeGitHub()
+	// Contents served by GitHub are broken. Files must be fetched via the downloader
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name, content: []byte("broken")},
+			{name: name + ".sha256", content: []byte("broken")},
+		},
+	})
+	d := &mapDownloader{files: map[string][]byte{"/" + name: asset, "/" + name + ".sha256": hash}}
+	up, ts := newTestUpdater(t, Config{Validator: &SHA2Validator{}, Downloader: d}, gh)
+
+	path := setupOldExecutable(t)
+	res, err := up.UpdateCommandWithResult(path, semver.MustParse("1.2.0"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exe) {
+		t.Fatalf("Executable was not updated: %q", b)
+	}
+
+	base := ts.URL + "/owner/repo/releases/download/v1.2.3/"
+	if s := strings.Join(d.urls, ","); s != base+name+".sha256,"+base+name {
+		t.Error("Unexpected downloaded URLs:", s)
+	}
+	for _, info := range res.Downloads {
+		if info.URL != base+info.Name || info.ContentLength <= 0 {
+			t.Errorf("Unexpected download info: %+v", info)
+		}
+	}
+
+	for _, r := range gh.requested() {
+		if strings.Contains(r.URL.Path, "/releases/assets/") {
+			t.Error("GitHub API should not be used for downloading:", r.URL)
+		}
+	}
+}
+
+func TestHTTPDownloader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/foo.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("foo"))
+	}))
+	defer ts.Close()
+
+	src, size, err := (&HTTPDownloader{}).Download(context.Background(), ts.URL+"/foo.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foo" || size != 3 {
+		t.Errorf("Unexpected content %q (size %d)", b, size)
+	}
+
+	if _, _, err := (&HTTPDownloader{}).Download(context.Background(), ts.URL+"/bar.zip"); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Error("Error should occur for not found file:", err)
+	}
+}
+
+func TestUpdatePrivateRepository(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.private = true
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name, content: asset},
+			{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+		},
+	})
+	up, ts := newTestUpdater(t, Config{Validator: &SHA2Validator{}}, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("release was not found")
+	}
+
+	// Browser download URLs are not available for private repositories
+	res, err := http.Get(rel.AssetURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatal("browser download URL should not be found:", res.StatusCode)
+	}
+
+	path := setupOldExecutable(t)
+	result, err := up.UpdateToWithResult(rel, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exe) {
+		t.Fatal("executable was not updated")
+	}
+	for _, d := range result.Downloads {
+		if !strings.HasPrefix(d.URL, ts.URL+"/signed/") {
+			t.Errorf("%s was not downloaded from the signed URL redirected from the asset endpoint: %s", d.Name, d.URL)
+		}
+	}
+	for _, r := range gh.requested() {
+		if strings.Contains(r.URL.Path, "/releases/assets/") && r.Header.Get("Accept") != "application/octet-stream" {
+			t.Errorf("unexpected Accept header %q for %s", r.Header.Get("Accept"), r.URL.Path)
+		}
+	}
+}
+
+func TestUpdateWithoutAssetID(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: tarGz(t, map[string][]byte{"foo": exe})},
+	}})
+	up, ts := newTestUpdater(t, Config{}, gh)
+
+	// e.g. a release built from a stored asset URL
+	rel := &Release{
+		AssetURL:  fmt.Sprintf("%s/owner/repo/releases/download/v1.2.3/%s", ts.URL, name),
+		RepoOwner: "owner",
+		RepoName:  "repo",
+	}
+	path := setupOldExecutable(t)
+	if err := up.UpdateTo(rel, path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exe) {
+		t.Fatal("executable was not updated")
+	}
+	for _, r := range gh.requested() {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			t.Error("GitHub API should not be called without asset ID:", r.URL.Path)
+		}
+	}
+}
+
+func TestAssetURLMode(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+
+	for _, tc := range []struct {
+		what    string
+		mode    AssetURLMode
+		token   bool
+		browser bool
+	}{
+		{"auto with token", AssetURLAuto, true, false},
+		{"auto without token", AssetURLAuto, false, true},
+		{"browser", AssetURLBrowser, true, true},
+		{"API", AssetURLAPI, false, false},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: name, content: asset},
+				{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+			}})
+			up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}, AssetURLMode: tc.mode}, gh)
+			up.hasToken = tc.token
+
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := up.UpdateTo(rel, setupOldExecutable(t)); err != nil {
+				t.Fatal(err)
+			}
+
+			api, browser := 0, 0
+			for _, r := range gh.requested() {
+				switch {
+				case strings.Contains(r.URL.Path, "/releases/assets/"):
+					api++
+				case strings.Contains(r.URL.Path, "/releases/download/"):
+					browser++
+				}
+			}
+			if tc.browser && (api != 0 || browser != 2) {
+				t.Fatalf("files should be downloaded from browser URLs: API=%d, browser=%d", api, browser)
+			}
+			if !tc.browser && (api != 2 || browser != 0) {
+				t.Fatalf("files should be downloaded via API: API=%d, browser=%d", api, browser)
+			}
+		})
+	}
+}
+
+func TestCancelSlowDownload(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name, content: nil},
+			{name: name + ".sha256", content: []byte(strings.Repeat("0", 64))},
+		},
+	})
+	// Serve the asset slowly for about 10 seconds
+	gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+		if a.name != name {
+			return false
+		}
+		w.Header().Set("Content-Length", "100000")
+		for i := 0; i < 100; i++ {
+			if _, err := w.Write(make([]byte, 1000)); err != nil {
+				return true
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return true
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		return true
+	}
+	up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}}, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil || !ok {
+		t.Fatal("Release was not found:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := setupOldExecutable(t)
+	progress, errCh := up.UpdateToWithProgress(ctx, rel, path)
+
+	var start time.Time
+	for p := range progress {
+		if p.Downloaded > 0 && start.IsZero() {
+			start = time.Now()
+			cancel()
+		}
+	}
+
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatal("Cancellation error should be returned but got", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Error("Download was not aborted promptly:", d)
+	}
+
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Error("Temporary file was not removed:", e.Name())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Old executable should be kept but got %q", b)
+	}
+}
+
+func TestURLRewriter(t *testing.T) {
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what    string
+		mode    AssetURLMode
+		private bool
+	}{
+		{"browser URL", AssetURLBrowser, false},
+		{"redirect from API", AssetURLAPI, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.private = tc.private
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: name, content: asset},
+				{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+			}})
+
+			var proxied []string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxied = append(proxied, r.URL.Path)
+				r.URL.Path = strings.TrimPrefix(r.URL.Path, "/github")
+				gh.ServeHTTP(w, r)
+			}))
+			defer proxy.Close()
+
+			var origin string
+			up, ts := newTestUpdater(t, Config{
+				Validator:    &SHA2Validator{},
+				AssetURLMode: tc.mode,
+				URLRewriter: func(u string) (string, error) {
+					return strings.Replace(u, origin, proxy.URL+"/github", 1), nil
+				},
+			}, gh)
+			origin = ts.URL
+
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := up.UpdateToWithResult(rel, setupOldExecutable(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(proxied) != 2 {
+				t.Fatal("Asset and validation file should be downloaded via proxy:", proxied)
+			}
+			for _, p := range proxied {
+				if !strings.HasPrefix(p, "/github/") {
+					t.Error("Unexpected path requested to proxy:", p)
+				}
+			}
+			for _, d := range res.Downloads {
+				if !strings.HasPrefix(d.URL, proxy.URL) {
+					t.Error("Download should be recorded with rewritten URL:", d.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestURLRewriterError(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: []byte("foo")}}})
+
+	up, _ := newTestUpdater(t, Config{
+		AssetURLMode: AssetURLBrowser,
+		Downloader:   &HTTPDownloader{},
+		URLRewriter: func(u string) (string, error) {
+			return "", errors.New("no route")
+		},
+	}, gh)
+
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = up.UpdateTo(rel, setupOldExecutable(t))
+	if err == nil || !strings.Contains(err.Error(), "failed to rewrite URL") || !strings.Contains(err.Error(), "no route") {
+		t.Fatal("Error of rewriter should abort the download:", err)
+	}
+}
+
+func TestDownloadGzipContentEncoding(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what    string
+		mode    AssetURLMode
+		private bool
+	}{
+		{"browser URL", AssetURLBrowser, false},
+		{"redirect from API", AssetURLAPI, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.private = tc.private
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: name, content: asset},
+				{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+			}})
+
+			// The CDN compresses the gzip asset again regardless of Accept-Encoding
+			var accepted []string
+			gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+				accepted = append(accepted, r.Header.Get("Accept-Encoding"))
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				_, _ = gz.Write(a.content)
+				_ = gz.Close()
+				return true
+			}
+
+			up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}, AssetURLMode: tc.mode}, gh)
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := setupOldExecutable(t)
+			if err := up.UpdateTo(rel, path); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+
+			for _, a := range accepted {
+				if a != "identity" {
+					t.Error("Release files should be requested without transfer compression:", a)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeContentEncodingUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		_, _ = w.Write([]byte("compressed"))
+	}))
+	defer ts.Close()
+
+	_, _, err := (&HTTPDownloader{}).Download(context.Background(), ts.URL+"/foo.tar.gz")
+	if err == nil || !strings.Contains(err.Error(), `unsupported Content-Encoding "br"`) {
+		t.Fatal("Unsupported encoding should be rejected:", err)
+	}
+}
+
+func TestDownloadRedirectAuthorization(t *testing.T) {
+	var cdnAuth []string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = append(cdnAuth, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "Only one auth mechanism allowed", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("asset content"))
+	}))
+	defer cdn.Close()
+
+	apiAuth := map[string]string{}
+	up, _ := newTestUpdater(t, Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiAuth[r.URL.Path] = r.Header.Get("Authorization")
+		if r.Header.Get("Authorization") == "" || r.Header.Get("Accept") != "application/octet-stream" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/old/releases/assets/1":
+			// The repository was renamed
+			http.Redirect(w, r, "/api/v3/repositories/42/releases/assets/1", http.StatusMovedPermanently)
+		case "/api/v3/repositories/42/releases/assets/1":
+			http.Redirect(w, r, cdn.URL+"/objects/1?signature=abc", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	rel := &Release{RepoOwner: "owner", RepoName: "old", AssetID: 1, AssetName: "foo"}
+	src, err := up.downloadReleaseAsset(context.Background(), rel, releaseFile{id: 1, name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "asset content" {
+		t.Fatalf("Unexpected content %q", b)
+	}
+
+	for _, p := range []string{"/api/v3/repos/owner/old/releases/assets/1", "/api/v3/repositories/42/releases/assets/1"} {
+		if apiAuth[p] != "Bearer test-token" {
+			t.Errorf("Token should be sent to API %s but got %q", p, apiAuth[p])
+		}
+	}
+	if len(cdnAuth) != 1 || cdnAuth[0] != "" {
+		t.Fatal("Authorization header should not be leaked to other hosts:", cdnAuth)
+	}
+}
+
+func TestIsAPIURL(t *testing.T) {
+	mustParse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	for _, tc := range []struct {
+		api  string
+		u    string
+		want bool
+	}{
+		{"https://api.github.com/", "https://api.github.com/repos/o/r/releases/assets/1", true},
+		{"https://api.github.com/", "https://API.github.com/repositories/1/releases/assets/1", true},
+		{"https://api.github.com/", "https://objects.githubusercontent.com/github-production-release-asset/1", false},
+		{"https://api.github.com/", "https://codeload.github.com/o/r/tar.gz/v1.2.3", false},
+		{"https://api.github.com/", "http://api.github.com/repos/o/r/releases/assets/1", false},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com/api/v3/repos/o/r/releases/assets/1", true},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com/storage/releases/1", false},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com:8443/api/v3/repos/o/r/releases/assets/1", false},
+	} {
+		if have := isAPIURL(mustParse(tc.api), mustParse(tc.u)); have != tc.want {
+			t.Errorf("Wanted %v for %s with API %s but got %v", tc.want, tc.u, tc.api, have)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package selfupdate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+var (
+	// ErrNoReleaseFound is matched with errors.Is when the repository has no release matching the version and the
+	// configuration, e.g. the repository has no release yet.
+	ErrNoReleaseFound = errors.New("no release is found")
+	// ErrAssetNotFound is matched with errors.Is when a release exists but it has no asset for the platform, or the
+	// executable is not found in the asset.
+	ErrAssetNotFound = errors.New("asset is not found")
+	// ErrValidationFailed is matched with errors.Is when the release asset or the executable in it failed the
+	// validation by Config.Validator or Config.Provenance, the validation file is missing from the release, or no
+	// validator is configured while Config.RequireValidation is set.
+	ErrValidationFailed = errors.New("validation of release failed")
+	// ErrUnsupportedFormat is matched with errors.Is when the format of the release asset, or of a file or an entry in
+	// it, is not supported.
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrInvalidVersion is matched with errors.Is when a version given to CompareVersions or Config.SkipVersions
+	// cannot be parsed.
+	ErrInvalidVersion = errors.New("invalid version")
+	// ErrAmbiguousVersion is matched with errors.Is when Config.StrictVersions is set and multiple releases which can
+	// be detected have the same version, e.g. 'v1.2.3' and '1.2.3' tagged by mistake.
+	ErrAmbiguousVersion = errors.New("multiple releases have the same version")
+)
+
+// markedError is matched by its sentinel error with errors.Is in addition to the errors it wraps. The message of the
+// error is kept as-is.
+type markedError struct {
+	err      error
+	sentinel error
+}
+
+// markError marks err to be matched by the sentinel error with errors.Is.
+func markError(sentinel, err error) error {
+	return &markedError{err: err, sentinel: sentinel}
+}
+
+func (e *markedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the marked error.
+func (e *markedError) Unwrap() error {
+	return e.err
+}
+
+// Is returns true for the sentinel error.
+func (e *markedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// RateLimitError is an error returned when GitHub responded that the rate limit is exceeded.
+// Callers can retrieve it with errors.As and schedule a retry after Reset, or after RetryAfter for
+// secondary rate limits.
+type RateLimitError struct {
+	// Limit is the number of requests allowed per hour
+	Limit int
+	// Remaining is the number of requests remaining in the current rate limit window
+	Remaining int
+	// Reset is the time when the current rate limit window resets
+	Reset time.Time
+	// RetryAfter is the wait before retrying required by a secondary rate limit, which GitHub applies to bursty
+	// access regardless of the remaining requests. It is zero for the primary rate limit
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("GitHub secondary rate limit exceeded (retry after %s): %v", e.RetryAfter, e.err)
+	}
+
+	return fmt.Sprintf("GitHub rate limit exceeded (limit: %d, remaining: %d, reset at %s): %v", e.Limit, e.Remaining, e.Reset.Format(time.RFC3339), e.err)
+}
+
+// Unwrap returns the underlying error.
+func (e *RateLimitError) Unwrap() error {
+	return e.err
+}
+
+// asRateLimitError converts a rate limit error returned from GitHub API client into *RateLimitError.
+// Other errors are returned as-is.
+func asRateLimitError(err error) error {
+	var rerr *github.RateLimitError
+	if errors.As(err, &rerr) {
+		return &RateLimitError{
+			Limit:     rerr.Rate.Limit,
+			Remaining: rerr.Rate.Remaining,
+			Reset:     rerr.Rate.Reset.Time,
+			err:       err,
+		}
+	}
+
+	var aerr *github.AbuseRateLimitError
+	if errors.As(err, &aerr) {
+		retryAfter := defaultSecondaryRateLimitWait
+		if aerr.RetryAfter != nil && *aerr.RetryAfter > 0 {
+			retryAfter = *aerr.RetryAfter
+		}
+
+		return &RateLimitError{RetryAfter: retryAfter, err: err}
+	}
+
+	var eres *github.ErrorResponse
+	if errors.As(err, &eres) && eres.Response != nil {
+		if retryAfter, ok := secondaryRateLimitWait(eres.Response.StatusCode, eres.Response.Header, []byte(eres.Message)); ok {
+			return &RateLimitError{RetryAfter: retryAfter, err: err}
+		}
+	}
+
+	return err
+}
+
+// defaultSecondaryRateLimitWait is the wait for a secondary rate limit without Retry-After header. GitHub documents
+// to wait at least one minute in the case.
+const defaultSecondaryRateLimitWait = time.Minute
+
+// secondaryRateLimitWait returns the wait required by the response when it tells that a secondary rate limit is
+// exceeded. The signal is a 403 or 429 response with Retry-After header or the message of the secondary rate limit
+// while the primary rate limit still remains.
+func secondaryRateLimitWait(status int, header http.Header, body []byte) (time.Duration, bool) {
+	if status != http.StatusForbidden && status != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		return 0, false
+	}
+
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+
+		if t, err := http.ParseTime(v); err == nil && time.Until(t) > 0 {
+			return time.Until(t), true
+		}
+
+		return defaultSecondaryRateLimitWait, true
+	}
+
+	msg := strings.ToLower(string(body))
+	if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse detection") {
+		return defaultSecondaryRateLimitWait, true
+	}
+
+	return 0, false
+}
+
+// peekBody reads the body of the response without consuming it. At most 64KiB is read since only error messages
+// are inspected.
+func peekBody(res *http.Response) []byte {
+	if res.Body == nil {
+		return nil
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), res.Body), res.Body}
+
+	return b
+}
+
+// rateLimitErrorFromResponse returns *RateLimitError when the HTTP response tells that the primary or a secondary
+// rate limit is exceeded. Otherwise it returns nil.
+func rateLimitErrorFromResponse(res *http.Response) error {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	if retryAfter, ok := secondaryRateLimitWait(res.StatusCode, res.Header, peekBody(res)); ok {
+		return &RateLimitError{RetryAfter: retryAfter, err: fmt.Errorf("not successful status %d", res.StatusCode)}
+	}
+
+	if res.Header.Get("X-RateLimit-Remaining") != "0" {
+		return nil
+	}
+
+	e := &RateLimitError{err: fmt.Errorf("not successful status %d", res.StatusCode)}
+	e.Limit, _ = strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+
+	if reset, _ := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); reset != 0 {
+		e.Reset = time.Unix(reset, 0)
+	}
+
+	return e
+}
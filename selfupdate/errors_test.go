@@ -0,0 +1,251 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func rateLimitedHandler(reset time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded for 127.0.0.1."}`)
+	}
+}
+
+func TestRateLimitErrorOnDetect(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	up, _ := newTestUpdater(t, Config{}, rateLimitedHandler(reset))
+
+	_, _, err := up.DetectLatest("owner/repo")
+	if err == nil {
+		t.Fatal("Error should occur when rate limit is exceeded")
+	}
+
+	var rerr *RateLimitError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Error should be RateLimitError: %#v", err)
+	}
+	if rerr.Limit != 60 {
+		t.Error("Unexpected limit:", rerr.Limit)
+	}
+	if rerr.Remaining != 0 {
+		t.Error("Unexpected remaining:", rerr.Remaining)
+	}
+	if !rerr.Reset.Equal(reset) {
+		t.Error("Unexpected reset time:", rerr.Reset, "wanted", reset)
+	}
+}
+
+func TestRateLimitErrorOnDownload(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	ts := httptest.NewServer(rateLimitedHandler(reset))
+	defer ts.Close()
+
+	_, err := DefaultUpdater().downloadDirectlyFromURL(ts.URL + "/foo.zip")
+	if err == nil {
+		t.Fatal("Error should occur when rate limit is exceeded")
+	}
+
+	var rerr *RateLimitError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Error should be RateLimitError: %#v", err)
+	}
+	if rerr.Limit != 60 || !rerr.Reset.Equal(reset) {
+		t.Error("Unexpected rate limit error:", rerr)
+	}
+}
+
+func TestNotRateLimitError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	_, err := DefaultUpdater().downloadDirectlyFromURL(ts.URL + "/foo.zip")
+	if err == nil {
+		t.Fatal("Error should occur for not found asset")
+	}
+
+	var rerr *RateLimitError
+	if errors.As(err, &rerr) {
+		t.Fatal("Not found error should not be RateLimitError:", err)
+	}
+}
+
+func secondaryRateLimitedHandler(retryAfter string, h http.Handler) (http.Handler, *int) {
+	n := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n == 1 {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}), &n
+}
+
+func TestSecondaryRateLimitError(t *testing.T) {
+	for _, tc := range []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{"30", 30 * time.Second},
+		// Only the message tells the secondary rate limit
+		{"", time.Minute},
+	} {
+		h, _ := secondaryRateLimitedHandler(tc.retryAfter, http.NotFoundHandler())
+		up, ts := newTestUpdater(t, Config{}, h)
+
+		_, _, err := up.DetectLatest("owner/repo")
+		var rerr *RateLimitError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("Error should be RateLimitError with Retry-After %q: %#v", tc.retryAfter, err)
+		}
+		if rerr.RetryAfter != tc.want {
+			t.Errorf("Unexpected RetryAfter with Retry-After %q: %s", tc.retryAfter, rerr.RetryAfter)
+		}
+
+		h, _ = secondaryRateLimitedHandler(tc.retryAfter, http.NotFoundHandler())
+		ts.Config.Handler = h
+		_, err = up.downloadDirectlyFromURL(ts.URL + "/foo.zip")
+		if !errors.As(err, &rerr) || rerr.RetryAfter != tc.want {
+			t.Errorf("Error of download should be RateLimitError with RetryAfter %s: %v", tc.want, err)
+		}
+	}
+}
+
+func TestWaitForSecondaryRateLimit(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: platformAssetName("foo", ".zip"), content: []byte("foo")},
+	}})
+	h, n := secondaryRateLimitedHandler("1", gh)
+	up, _ := newTestUpdater(t, Config{WaitForRateLimit: true}, h)
+
+	start := time.Now()
+	_, found, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("Release should be detected after waiting")
+	}
+	if *n != 2 {
+		t.Fatal("Request should be retried once but sent", *n, "times")
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Fatal("Retry-After was not waited:", d)
+	}
+}
+
+func TestWaitForSecondaryRateLimitIsCancelled(t *testing.T) {
+	h, _ := secondaryRateLimitedHandler("3600", http.NotFoundHandler())
+	up, _ := newTestUpdater(t, Config{WaitForRateLimit: true}, h)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	up.apiCtx = ctx
+
+	start := time.Now()
+	if _, _, err := up.DetectLatest("owner/repo"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Wait should be aborted by the context:", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("Wait was not aborted promptly")
+	}
+}
+
+func TestFindReleaseErrors(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/empty", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: "foo_plan9_mips.zip"}}})
+	gh.addRelease("owner/empty", fakeRelease{tag: "v1.3.0", draft: true, assets: []fakeAsset{{name: platformAssetName("foo", ".zip")}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".zip")}}})
+	up, _ := newTestUpdater(t, Config{}, gh)
+
+	for _, tc := range []struct {
+		slug    string
+		version string
+		want    error
+	}{
+		{"owner/missing", "", ErrNoReleaseFound},
+		{"owner/repo", "v9.9.9", ErrNoReleaseFound},
+		{"owner/empty", "", ErrAssetNotFound},
+		{"owner/repo", "", nil},
+	} {
+		t.Run(tc.slug+"@"+tc.version, func(t *testing.T) {
+			rel, err := up.FindRelease(tc.slug, tc.version)
+			if tc.want == nil {
+				if err != nil || rel == nil || rel.Version.String() != "1.2.3" {
+					t.Fatal("Release should be found:", rel, err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Error should match %v but got %v", tc.want, err)
+			}
+			for _, other := range []error{ErrNoReleaseFound, ErrAssetNotFound} {
+				if other != tc.want && errors.Is(err, other) {
+					t.Fatalf("Error should not match %v: %v", other, err)
+				}
+			}
+
+			// Detect* keep reporting no release without an error
+			rel, found, err := up.DetectVersion(tc.slug, tc.version)
+			if err != nil || found || rel != nil {
+				t.Fatal("No release should be detected without an error:", rel, found, err)
+			}
+		})
+	}
+}
+
+func TestUpdateErrorsMatchSentinels(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what      string
+		asset     []byte
+		validator Validator
+		want      error
+	}{
+		{"executable not in archive", tarGz(t, map[string][]byte{"bar": exe}), nil, ErrAssetNotFound},
+		{"checksum mismatch", tarGz(t, map[string][]byte{"foo": exe}), &SHA2Validator{}, ErrValidationFailed},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: name, content: tc.asset},
+				{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256([]byte("other"))))},
+			}})
+			up, _ := newTestUpdater(t, Config{Validator: tc.validator}, gh)
+
+			_, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Error should match %v but got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestUncompressErrorsMatchSentinels(t *testing.T) {
+	if _, err := UncompressCommand(bytes.NewReader(tarGz(t, map[string][]byte{"bar": []byte("bar")})), "foo.tar.gz", "foo"); !errors.Is(err, ErrAssetNotFound) {
+		t.Fatal("Missing executable should match ErrAssetNotFound:", err)
+	}
+	if _, err := UncompressCommandWithFormat(bytes.NewReader(nil), ArchiveFormat(100), "foo"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatal("Unknown format should match ErrUnsupportedFormat:", err)
+	}
+}
@@ -0,0 +1,213 @@
+package selfupdate
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// elfMachine is the machine of ELF executables for a GOARCH.
+type elfMachine struct {
+	machine elf.Machine
+	// class and order are not checked when zero or nil
+	class elf.Class
+	order binary.ByteOrder
+}
+
+// elfMachines maps GOARCH to the machine of ELF executables.
+var elfMachines = map[string]elfMachine{
+	"386":      {elf.EM_386, elf.ELFCLASS32, nil},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, nil},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32, nil},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, nil},
+	"loong64":  {elf.EM_LOONGARCH, elf.ELFCLASS64, nil},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, binary.BigEndian},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, binary.LittleEndian},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64, binary.BigEndian},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, nil},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, nil},
+}
+
+// machoCPUs maps GOARCH to the CPU type of Mach-O executables.
+var machoCPUs = map[string]macho.Cpu{
+	"386":   macho.Cpu386,
+	"amd64": macho.CpuAmd64,
+	"arm":   macho.CpuArm,
+	"arm64": macho.CpuArm64,
+}
+
+// peMachines maps GOARCH to the machine of PE executables.
+var peMachines = map[string]uint16{
+	"386":   pe.IMAGE_FILE_MACHINE_I386,
+	"amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+	"arm":   pe.IMAGE_FILE_MACHINE_ARMNT,
+	"arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+}
+
+// executableArchs returns the GOARCHs of the executables accepted by Config.CheckExecutablePlatform, which are the
+// target arch and the arch running under emulation when Config.EmulationFallback is enabled. nil is returned when
+// the check is disabled.
+func (up *Updater) executableArchs() []string {
+	if !up.checkPlatform {
+		return nil
+	}
+
+	opt := up.options()
+	goos, goarch := opt.platform()
+	archs := []string{goarch}
+
+	if arch, ok := emulatedArchs[goos+"/"+goarch]; ok && opt.emulation {
+		archs = append(archs, arch)
+	}
+
+	return archs
+}
+
+// checkExecutablePlatform checks that the executable at path was built for any of the archs by reading the machine
+// in its header. The OS is not checked here since the format of the executable was already checked by
+// checkExecutable. The check is skipped when the format has no machine to check.
+func checkExecutablePlatform(path, goos string, archs []string) error {
+	built, err := executableArchsOf(path, goos)
+	if err != nil {
+		return fmt.Errorf("failed to read the platform of new executable %s: %w", path, err)
+	}
+
+	if built == nil || !knownArch(goos, archs[0]) {
+		log.Println("Arch of executables for", goos+"/"+archs[0], "cannot be checked. Skip checking the platform of", path)
+
+		return nil
+	}
+
+	// A universal binary of macOS is accepted when any of the executables in it is for the archs
+	for _, b := range built {
+		for _, a := range archs {
+			if a == b {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("new executable %s was built for %s/%s, expected %s/%s. The release asset may be mislabeled", path, goos, strings.Join(built, "+"), goos, strings.Join(archs, " or "))
+}
+
+// executableArchsOf returns the GOARCHs of the executable at path, which has several archs when it is a universal
+// binary of macOS. nil is returned when the format of the OS has no machine to check, such as WebAssembly.
+func executableArchsOf(path, goos string) ([]string, error) {
+	if isScript(path) {
+		return nil, nil
+	}
+
+	switch goos {
+	case windows:
+		f, err := pe.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		for arch, m := range peMachines {
+			if m == f.Machine {
+				return []string{arch}, nil
+			}
+		}
+
+		return []string{fmt.Sprintf("unknown (PE machine 0x%x)", f.Machine)}, nil
+	case "darwin", "ios":
+		return machoArchs(path)
+	case "js", "wasip1", "plan9":
+		return nil, nil
+	default:
+		f, err := elf.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		for arch, m := range elfMachines {
+			if m.machine == f.Machine && (m.class == elf.ELFCLASSNONE || m.class == f.Class) && (m.order == nil || m.order == f.ByteOrder) {
+				return []string{arch}, nil
+			}
+		}
+
+		return []string{fmt.Sprintf("unknown (ELF machine %s, %s)", f.Machine, f.Class)}, nil
+	}
+}
+
+// isScript returns true when the file at path starts with '#!', which has no machine to check.
+func isScript(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(magicShebang))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+
+	return bytes.Equal(header, magicShebang)
+}
+
+// machoArchs returns the GOARCHs of a Mach-O executable or of all the executables in a universal binary.
+func machoArchs(path string) ([]string, error) {
+	fat, err := macho.OpenFat(path)
+	if err == nil {
+		defer fat.Close()
+
+		archs := make([]string, 0, len(fat.Arches))
+		for _, a := range fat.Arches {
+			archs = append(archs, machoCPUArch(a.Cpu))
+		}
+
+		return archs, nil
+	}
+
+	if !errors.Is(err, macho.ErrNotFat) {
+		return nil, err
+	}
+
+	f, err := macho.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return []string{machoCPUArch(f.Cpu)}, nil
+}
+
+// knownArch returns true when the machine of executables for the platform is known.
+func knownArch(goos, goarch string) bool {
+	var ok bool
+
+	switch goos {
+	case windows:
+		_, ok = peMachines[goarch]
+	case "darwin", "ios":
+		_, ok = machoCPUs[goarch]
+	default:
+		_, ok = elfMachines[goarch]
+	}
+
+	return ok
+}
+
+func machoCPUArch(cpu macho.Cpu) string {
+	for arch, c := range machoCPUs {
+		if c == cpu {
+			return arch
+		}
+	}
+
+	return fmt.Sprintf("unknown (Mach-O CPU %s)", cpu)
+}
@@ -0,0 +1,183 @@
+package selfupdate
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+// elfHeader returns the header of an ELF executable without sections for the machine.
+func elfHeader(t *testing.T, machine elf.Machine, class elf.Class, order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	ident := [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(class), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)}
+	if order == binary.BigEndian {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	}
+	var h interface{}
+	if class == elf.ELFCLASS64 {
+		h = &elf.Header64{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 64}
+	} else {
+		h = &elf.Header32{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 52}
+	}
+	if err := binary.Write(&buf, order, h); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// machoHeader returns the header of a 64-bit Mach-O executable without load commands for the CPU.
+func machoHeader(t *testing.T, cpu macho.Cpu) []byte {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec}); err != nil {
+		t.Fatal(err)
+	}
+	// Reserved field of the 64-bit header
+	buf.Write(make([]byte, 4))
+	return buf.Bytes()
+}
+
+// machoFat returns a universal binary containing the executables for the CPUs.
+func machoFat(t *testing.T, cpus ...macho.Cpu) []byte {
+	var buf bytes.Buffer
+	header := []uint32{macho.MagicFat, uint32(len(cpus))}
+	offset := uint32(8 + 20*len(cpus))
+	var files []byte
+	for _, cpu := range cpus {
+		f := machoHeader(t, cpu)
+		header = append(header, uint32(cpu), 0, offset, uint32(len(f)), 0)
+		offset += uint32(len(f))
+		files = append(files, f...)
+	}
+	if err := binary.Write(&buf, binary.BigEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(files)
+	return buf.Bytes()
+}
+
+// peHeader returns the headers of a PE executable without sections for the machine.
+func peHeader(t *testing.T, machine uint16) []byte {
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	if err := binary.Write(&buf, binary.LittleEndian, &pe.FileHeader{Machine: machine}); err != nil {
+		t.Fatal(err)
+	}
+	// debug/pe reads past the headers
+	buf.Write(make([]byte, 512))
+	return buf.Bytes()
+}
+
+func TestCheckExecutablePlatform(t *testing.T) {
+	for _, tc := range []struct {
+		what    string
+		goos    string
+		archs   []string
+		content []byte
+		err     string
+	}{
+		{"linux/amd64", "linux", []string{"amd64"}, elfHeader(t, elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian), ""},
+		{"linux/386", "linux", []string{"386"}, elfHeader(t, elf.EM_386, elf.ELFCLASS32, binary.LittleEndian), ""},
+		{"linux/arm64 for amd64", "linux", []string{"amd64"}, elfHeader(t, elf.EM_AARCH64, elf.ELFCLASS64, binary.LittleEndian), "was built for linux/arm64, expected linux/amd64"},
+		{"linux/mips64le", "linux", []string{"mips64le"}, elfHeader(t, elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian), ""},
+		{"linux/mips64 for mips64le", "linux", []string{"mips64le"}, elfHeader(t, elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian), "was built for linux/mips64, expected"},
+		{"freebsd/arm", "freebsd", []string{"arm"}, elfHeader(t, elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian), ""},
+		{"unknown machine", "linux", []string{"amd64"}, elfHeader(t, elf.EM_SPARCV9, elf.ELFCLASS64, binary.BigEndian), "was built for linux/unknown (ELF machine EM_SPARCV9, ELFCLASS64)"},
+		{"darwin/arm64", "darwin", []string{"arm64"}, machoHeader(t, macho.CpuArm64), ""},
+		{"darwin/amd64 for arm64", "darwin", []string{"arm64"}, machoHeader(t, macho.CpuAmd64), "was built for darwin/amd64, expected darwin/arm64"},
+		{"darwin/amd64 under emulation", "darwin", []string{"arm64", "amd64"}, machoHeader(t, macho.CpuAmd64), ""},
+		{"universal binary", "darwin", []string{"arm64"}, machoFat(t, macho.CpuAmd64, macho.CpuArm64), ""},
+		{"universal binary without arch", "darwin", []string{"arm64"}, machoFat(t, macho.CpuAmd64, macho.Cpu386), "was built for darwin/amd64+386"},
+		{"windows/arm64", "windows", []string{"arm64"}, peHeader(t, pe.IMAGE_FILE_MACHINE_ARM64), ""},
+		{"windows/386 for amd64", "windows", []string{"amd64"}, peHeader(t, pe.IMAGE_FILE_MACHINE_I386), "was built for windows/386, expected windows/amd64"},
+		{"wasm", "wasip1", []string{"wasm"}, []byte("\x00asm\x01\x00\x00\x00"), ""},
+		{"unknown target arch", "linux", []string{"sparc64"}, elfHeader(t, elf.EM_SPARCV9, elf.ELFCLASS64, binary.BigEndian), ""},
+		{"broken header", "linux", []string{"amd64"}, []byte("\x7fELF"), "failed to read the platform of new executable"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "foo")
+			if err := ioutil.WriteFile(path, tc.content, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := checkExecutablePlatform(path, tc.goos, tc.archs)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Wanted error %q but got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestUpdateCheckExecutablePlatform(t *testing.T) {
+	amd64 := elfHeader(t, elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian)
+	gh := newFakeGitHub()
+	// The asset for arm64 mistakenly contains the executable for amd64
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_linux_amd64", content: amd64},
+		{name: "foo_linux_arm64", content: amd64},
+	}})
+
+	for _, tc := range []struct {
+		arch  string
+		check bool
+		err   bool
+	}{
+		{"amd64", true, false},
+		{"arm64", true, true},
+		{"arm64", false, false},
+	} {
+		path := setupOldExecutable(t)
+		up, _ := newTestUpdater(t, Config{OS: "linux", Arch: tc.arch, CheckExecutablePlatform: tc.check}, gh)
+
+		_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+		if !tc.err {
+			if err != nil {
+				t.Fatal(tc.arch, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), "was built for linux/amd64, expected linux/arm64") {
+			t.Fatal("Mislabeled asset should be rejected:", err)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "old executable" {
+			t.Fatalf("Old executable should be kept but got %q", b)
+		}
+	}
+}
+
+func TestApplyFromReaderCheckExecutablePlatform(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH == "s390x" {
+		t.Skip("ELF executable for another arch is only prepared on Linux")
+	}
+	content := elfHeader(t, elf.EM_S390, elf.ELFCLASS64, binary.BigEndian)
+
+	if err := ApplyFromReader(bytes.NewReader(content), setupOldExecutable(t), ApplyOptions{CheckExecutablePlatform: true}); err == nil || !strings.Contains(err.Error(), "was built for") {
+		t.Fatal("Executable for another platform should be rejected:", err)
+	}
+	if err := ApplyFromReader(bytes.NewReader(content), setupOldExecutable(t), ApplyOptions{}); err != nil {
+		t.Fatal("Platform should not be checked by default:", err)
+	}
+}
@@ -0,0 +1,216 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// ExtractArchive extracts all files in the archive read from src into destDir, and returns the paths of the written
+// files. The archive format is detected from the extension of url as UncompressCommand does. A file compressed with
+// gzip, xz or lzma alone is written with the name in its gzip header or the name of url without the extension, and a file
+// with another extension is written as-is.
+//
+// Entries are not allowed to be written outside destDir, e.g. with '../' or absolute paths. Symbolic links and other
+// special entries are rejected. The permissions of the entries are preserved.
+func ExtractArchive(src io.Reader, url, destDir string) ([]string, error) {
+	base := url[strings.LastIndex(url, "/")+1:]
+
+	switch {
+	case strings.HasSuffix(url, ".zip"):
+		return extractZip(src, destDir)
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress .tar.gz file: %w", err)
+		}
+
+		return extractTar(gz, destDir)
+	case strings.HasSuffix(url, ".tar.lzma"), strings.HasSuffix(url, ".tlz"):
+		lz, err := lzma.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress .tar.lzma file: %w", err)
+		}
+
+		return extractTar(lz, destDir)
+	case strings.HasSuffix(url, ".tar.xz"):
+		xzip, err := xz.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress .tar.xz file: %w", err)
+		}
+
+		return extractTar(xzip, destDir)
+	case strings.HasSuffix(url, ".gzip"), strings.HasSuffix(url, ".gz"):
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress gzip file downloaded from %s: %w", url, err)
+		}
+
+		name := gz.Header.Name
+		if name == "" {
+			name = strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), ".gzip")
+		}
+
+		return extractSingleFile(gz, destDir, filepath.Base(name))
+	case strings.HasSuffix(url, ".xz"):
+		xzip, err := xz.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress xzip file downloaded from %s: %w", url, err)
+		}
+
+		return extractSingleFile(xzip, destDir, strings.TrimSuffix(base, ".xz"))
+	case strings.HasSuffix(url, ".lzma"):
+		lz, err := lzma.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress lzma file downloaded from %s: %w", url, err)
+		}
+
+		return extractSingleFile(lz, destDir, strings.TrimSuffix(base, ".lzma"))
+	default:
+		log.Println("Uncompression is not needed", url)
+
+		return extractSingleFile(src, destDir, base)
+	}
+}
+
+// extractPath returns the path of the archive entry in destDir. It fails when the entry would be written outside.
+func extractPath(destDir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("illegal path %q in archive", name)
+	}
+
+	path := filepath.Join(destDir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(destDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path %q in archive: it is outside of %s", name, destDir)
+	}
+
+	return path, nil
+}
+
+func writeExtractedFile(src io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	_, err = io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	// The mode given to OpenFile is masked by umask and is not applied to existing files
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set mode %s to %s: %w", mode, path, err)
+	}
+
+	return nil
+}
+
+func extractSingleFile(src io.Reader, destDir, name string) ([]string, error) {
+	path, err := extractPath(destDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeExtractedFile(src, path, 0o755); err != nil {
+		return nil, err
+	}
+
+	return []string{path}, nil
+}
+
+func extractZip(src io.Reader, destDir string) ([]string, error) {
+	z, err := newZipReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to uncompress zip file: %w", err)
+	}
+
+	paths := make([]string, 0, len(z.File))
+
+	for _, file := range z.File {
+		path, err := extractPath(destDir, file.Name)
+		if err != nil {
+			return paths, err
+		}
+
+		mode := file.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return paths, fmt.Errorf("failed to create directory %s: %w", path, err)
+			}
+
+			continue
+		case !mode.IsRegular():
+			return paths, markError(ErrUnsupportedFormat, fmt.Errorf("unsupported entry %q of type %s in zip file", file.Name, mode.Type()))
+		}
+
+		r, err := openZipFile(file, "")
+		if err != nil {
+			return paths, err
+		}
+
+		if err := writeExtractedFile(r, path, mode.Perm()); err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func extractTar(src io.Reader, destDir string) ([]string, error) {
+	t := tar.NewReader(src)
+	paths := []string{}
+
+	for {
+		h, err := t.Next()
+		if errors.Is(err, io.EOF) {
+			return paths, nil
+		}
+
+		if err != nil {
+			return paths, fmt.Errorf("failed to unarchive .tar file: %w", err)
+		}
+
+		path, err := extractPath(destDir, h.Name)
+		if err != nil {
+			return paths, err
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return paths, fmt.Errorf("failed to create directory %s: %w", path, err)
+			}
+		case tar.TypeReg, tar.TypeRegA: //nolint:staticcheck // TypeRegA is written by old archivers
+			if err := writeExtractedFile(t, path, h.FileInfo().Mode().Perm()); err != nil {
+				return paths, err
+			}
+
+			paths = append(paths, path)
+		default:
+			return paths, markError(ErrUnsupportedFormat, fmt.Errorf("unsupported entry %q of type %q in tar file", h.Name, h.Typeflag))
+		}
+	}
+}
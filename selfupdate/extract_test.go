@@ -0,0 +1,155 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func testTarGz(t *testing.T, entries []archiveEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: int64(e.mode.Perm()), Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		switch {
+		case e.mode.IsDir():
+			h.Typeflag = tar.TypeDir
+		case e.link != "":
+			h.Typeflag, h.Linkname = tar.TypeSymlink, e.link
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "foo", mode: 0755, content: "executable"},
+		{name: "plugins/", mode: os.ModeDir | 0755},
+		{name: "plugins/bar.so", mode: 0644, content: "plugin"},
+		{name: "share/data/config.json", mode: 0600, content: "{}"},
+	}
+
+	for name, archive := range map[string][]byte{
+		"foo.tar.gz":   testTarGz(t, entries),
+		"foo.tar.lzma": tarLzma(t, testTarGz(t, entries)),
+		"foo.tlz":      tarLzma(t, testTarGz(t, entries)),
+		"foo.zip":      testZip(t, entries),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			paths, err := ExtractArchive(bytes.NewReader(archive), "https://github.com/owner/repo/releases/download/v1.2.3/"+name, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{filepath.Join(dir, "foo"), filepath.Join(dir, "plugins", "bar.so"), filepath.Join(dir, "share", "data", "config.json")}
+			if strings.Join(paths, ",") != strings.Join(want, ",") {
+				t.Fatalf("wanted %v but got %v", want, paths)
+			}
+
+			for _, e := range entries {
+				if e.mode.IsDir() {
+					continue
+				}
+				path := filepath.Join(dir, filepath.FromSlash(e.name))
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != e.content {
+					t.Errorf("unexpected content of %s: %q", e.name, b)
+				}
+				st, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if runtime.GOOS != windows && st.Mode().Perm() != e.mode.Perm() {
+					t.Errorf("mode of %s should be preserved: wanted %s but got %s", e.name, e.mode.Perm(), st.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArchiveSingleFile(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte("executable")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for url, content := range map[string][]byte{
+		"https://example.com/foo_linux_amd64.gz":   buf.Bytes(),
+		"https://example.com/foo_linux_amd64.lzma": lzmaFile(t, []byte("executable")),
+		"https://example.com/foo_linux_amd64":      []byte("executable"),
+	} {
+		dir := t.TempDir()
+		paths, err := ExtractArchive(bytes.NewReader(content), url, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 1 || paths[0] != filepath.Join(dir, "foo_linux_amd64") {
+			t.Fatal("unexpected paths:", paths)
+		}
+		b, err := ioutil.ReadFile(paths[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "executable" {
+			t.Fatalf("unexpected content of %s: %q", url, b)
+		}
+	}
+}
+
+func TestExtractArchiveIllegalEntry(t *testing.T) {
+	for _, tc := range []struct {
+		what  string
+		entry archiveEntry
+		want  string
+	}{
+		{"parent directory", archiveEntry{name: "../evil", mode: 0755, content: "evil"}, "outside of"},
+		{"nested parent directory", archiveEntry{name: "plugins/../../evil", mode: 0755, content: "evil"}, "outside of"},
+		{"absolute path", archiveEntry{name: "/tmp/evil", mode: 0755, content: "evil"}, "illegal path"},
+		{"symbolic link", archiveEntry{name: "link", mode: 0755, link: "/etc/passwd"}, "unsupported entry"},
+	} {
+		for name, archive := range map[string][]byte{
+			"foo.tar.gz": testTarGz(t, []archiveEntry{tc.entry}),
+			"foo.zip":    testZip(t, []archiveEntry{tc.entry}),
+		} {
+			t.Run(tc.what+" in "+name, func(t *testing.T) {
+				parent := t.TempDir()
+				dir := filepath.Join(parent, "dest")
+
+				_, err := ExtractArchive(bytes.NewReader(archive), name, dir)
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("wanted %q in error but got %v", tc.want, err)
+				}
+				if _, err := os.Stat(filepath.Join(parent, "evil")); err == nil {
+					t.Fatal("file was written outside of the destination directory")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package selfupdate
+
+import (
+	"net/http"
+)
+
+// requestHeaderTransport adds Config.RequestHeaders to each request and passes it to Config.RequestDecorator right
+// before it is sent, including the requests following redirects and retries.
+type requestHeaderTransport struct {
+	base     http.RoundTripper
+	headers  map[string]string
+	decorate func(*http.Request)
+}
+
+func (t *requestHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	if t.decorate != nil {
+		t.decorate(req)
+	}
+
+	return base.RoundTrip(req)
+}
+
+// withRequestHeaders returns the copy of the client sending the headers and decorated by the function. The client is
+// returned as-is when there is nothing to add.
+func withRequestHeaders(c *http.Client, headers map[string]string, decorate func(*http.Request)) *http.Client {
+	if len(headers) == 0 && decorate == nil {
+		return c
+	}
+
+	wrapped := *c
+	wrapped.Transport = &requestHeaderTransport{base: c.Transport, headers: headers, decorate: decorate}
+
+	return &wrapped
+}
@@ -0,0 +1,99 @@
+package selfupdate
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.private = true
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+	}})
+
+	var mu sync.Mutex
+	decorated := []string{}
+	up, _ := newTestUpdater(t, Config{
+		Validator:      &SHA2Validator{},
+		RequestHeaders: map[string]string{"X-Org-Token": "secret"},
+		RequestDecorator: func(req *http.Request) {
+			mu.Lock()
+			decorated = append(decorated, req.URL.Path)
+			mu.Unlock()
+			if strings.HasPrefix(req.URL.Path, "/signed/") {
+				req.Header.Set("X-Route", "assets")
+			}
+		},
+	}, gh)
+
+	if _, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := gh.requested()
+	signed := 0
+	for _, r := range reqs {
+		if h := r.Header.Get("X-Org-Token"); h != "secret" {
+			t.Errorf("Header should be sent to %s but got %q", r.URL.Path, h)
+		}
+		if strings.HasPrefix(r.URL.Path, "/signed/") {
+			signed++
+			if h := r.Header.Get("X-Route"); h != "assets" {
+				t.Errorf("Decorator should add header to %s but got %q", r.URL.Path, h)
+			}
+		} else if h := r.Header.Get("X-Route"); h != "" {
+			t.Errorf("Decorator should not add header to %s but got %q", r.URL.Path, h)
+		}
+	}
+	if signed != 2 {
+		t.Fatal("Asset and validation file should be downloaded via redirects:", signed)
+	}
+	if len(decorated) != len(reqs) {
+		t.Fatalf("Decorator should be called for all %d requests but called for %v", len(reqs), decorated)
+	}
+}
+
+func TestRequestHeadersNotModifyRequest(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c := withRequestHeaders(&http.Client{}, map[string]string{"X-Org-Token": "secret"}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got.Get("X-Org-Token") != "secret" {
+		t.Fatal("Header was not sent:", got)
+	}
+	if req.Header.Get("X-Org-Token") != "" {
+		t.Fatal("Original request should not be modified:", req.Header)
+	}
+
+	if withRequestHeaders(http.DefaultClient, nil, nil) != http.DefaultClient {
+		t.Fatal("Client should be returned as-is without headers")
+	}
+}
@@ -0,0 +1,437 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// newTestUpdater creates an updater which calls the GitHub API served by the given handler.
+// Paths requested to the handler are prefixed with "/api/v3/" as GitHub Enterprise API.
+func newTestUpdater(t *testing.T, config Config, handler http.Handler) (*Updater, *httptest.Server) {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	config.EnterpriseBaseURL = ts.URL + "/api/v3/"
+	if config.APIToken == "" {
+		config.APIToken = "test-token"
+	}
+
+	up, err := NewUpdater(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return up, ts
+}
+
+type fakeAsset struct {
+	name    string
+	content []byte
+}
+
+type fakeRelease struct {
+	tag         string
+	name        string
+	body        string
+	prerelease  bool
+	draft       bool
+	publishedAt time.Time
+	assets      []fakeAsset
+	// latest marks the release as latest on GitHub. The last published release which is neither a draft nor
+	// a pre-release is the latest when no release is marked
+	latest bool
+	// tarball and zipball are the source archives of the release. Their URLs are not set when nil
+	tarball []byte
+	zipball []byte
+}
+
+// fakeGitHub is a fake GitHub API server which hosts releases of repositories.
+// Release assets are downloadable via both the API endpoint and the browser download URL.
+type fakeGitHub struct {
+	mu       sync.Mutex
+	releases map[string][]fakeRelease
+	requests []*http.Request
+	// handleAsset can intercept asset downloads. It returns true when it wrote the response
+	handleAsset func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool
+	// private makes repositories behave as private ones: API requests without a token and browser downloads are
+	// not found, and the asset endpoint redirects to a signed URL which rejects tokens
+	private bool
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{releases: map[string][]fakeRelease{}}
+}
+
+func (f *fakeGitHub) addRelease(slug string, rel fakeRelease) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rel.publishedAt.IsZero() {
+		rel.publishedAt = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(len(f.releases[slug])) * time.Hour)
+	}
+	f.releases[slug] = append(f.releases[slug], rel)
+}
+
+func (f *fakeGitHub) requested() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request{}, f.requests...)
+}
+
+func fakeAssetID(slug string, rel, asset int) int64 {
+	var h int64
+	for _, c := range slug {
+		h = (h*31 + int64(c)) % 100000
+	}
+	return h*1000000 + int64(rel)*1000 + int64(asset) + 1
+}
+
+func (f *fakeGitHub) findAsset(id int64) (fakeAsset, bool) {
+	for slug, rels := range f.releases {
+		for i, rel := range rels {
+			for j, a := range rel.assets {
+				if fakeAssetID(slug, i, j) == id {
+					return a, true
+				}
+			}
+		}
+	}
+	return fakeAsset{}, false
+}
+
+func (f *fakeGitHub) apiReleases(base, slug string) []*github.RepositoryRelease {
+	rels := make([]*github.RepositoryRelease, 0, len(f.releases[slug]))
+	for i, rel := range f.releases[slug] {
+		r := &github.RepositoryRelease{
+			ID:          github.Int64(int64(i + 1)),
+			TagName:     github.String(rel.tag),
+			Name:        github.String(rel.name),
+			Body:        github.String(rel.body),
+			Draft:       github.Bool(rel.draft),
+			Prerelease:  github.Bool(rel.prerelease),
+			PublishedAt: &github.Timestamp{Time: rel.publishedAt},
+			HTMLURL:     github.String(fmt.Sprintf("%s/%s/releases/tag/%s", base, slug, rel.tag)),
+		}
+		if rel.tarball != nil {
+			r.TarballURL = github.String(fmt.Sprintf("%s/api/v3/repos/%s/tarball/%s", base, slug, rel.tag))
+		}
+		if rel.zipball != nil {
+			r.ZipballURL = github.String(fmt.Sprintf("%s/api/v3/repos/%s/zipball/%s", base, slug, rel.tag))
+		}
+		for j, a := range rel.assets {
+			id := fakeAssetID(slug, i, j)
+			r.Assets = append(r.Assets, &github.ReleaseAsset{
+				ID:                 github.Int64(id),
+				Name:               github.String(a.name),
+				Size:               github.Int(len(a.content)),
+				ContentType:        github.String("application/octet-stream"),
+				URL:                github.String(fmt.Sprintf("%s/api/v3/repos/%s/releases/assets/%d", base, slug, id)),
+				BrowserDownloadURL: github.String(fmt.Sprintf("%s/%s/releases/download/%s/%s", base, slug, rel.tag, a.name)),
+			})
+		}
+		rels = append(rels, r)
+	}
+	return rels
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.mu.Unlock()
+
+	base := "http://" + r.Host
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if f.private && !f.authorized(w, r, p) {
+		return
+	}
+
+	// /api/v3/repos/{owner}/{repo}/releases
+	if len(p) == 6 && p[0] == "api" && p[5] == "releases" {
+		f.mu.Lock()
+		_, ok := f.releases[p[3]+"/"+p[4]]
+		body := f.apiReleases(base, p[3]+"/"+p[4])
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	// /api/v3/repos/{owner}/{repo}/releases/latest
+	if len(p) == 7 && p[0] == "api" && p[5] == "releases" && p[6] == "latest" {
+		f.mu.Lock()
+		var latest *github.RepositoryRelease
+		for i, rel := range f.apiReleases(base, p[3]+"/"+p[4]) {
+			fake := f.releases[p[3]+"/"+p[4]][i]
+			if fake.latest {
+				latest = rel
+				break
+			}
+			if !fake.draft && !fake.prerelease {
+				latest = rel
+			}
+		}
+		f.mu.Unlock()
+		if latest == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(latest)
+		return
+	}
+
+	// /api/v3/repos/{owner}/{repo}/releases/{id}
+	if id, err := strconv.ParseInt(p[len(p)-1], 10, 64); err == nil && len(p) == 7 && p[0] == "api" && p[5] == "releases" {
+		f.mu.Lock()
+		var found *github.RepositoryRelease
+		for _, rel := range f.apiReleases(base, p[3]+"/"+p[4]) {
+			if rel.GetID() == id {
+				found = rel
+			}
+		}
+		f.mu.Unlock()
+		if found == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(found)
+		return
+	}
+
+	// /api/v3/repos/{owner}/{repo}/releases/tags/{tag}
+	if len(p) == 8 && p[0] == "api" && p[5] == "releases" && p[6] == "tags" {
+		f.mu.Lock()
+		var found *github.RepositoryRelease
+		for _, rel := range f.apiReleases(base, p[3]+"/"+p[4]) {
+			if rel.GetTagName() == p[7] {
+				found = rel
+			}
+		}
+		f.mu.Unlock()
+		if found == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(found)
+		return
+	}
+
+	// /api/v3/repos/{owner}/{repo}/releases/assets/{id}
+	if len(p) == 8 && p[0] == "api" && p[5] == "releases" && p[6] == "assets" {
+		id, _ := strconv.ParseInt(p[7], 10, 64)
+		f.mu.Lock()
+		a, ok := f.findAsset(id)
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			// The asset endpoint returns the metadata of the asset unless the binary is requested
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(&github.ReleaseAsset{ID: github.Int64(id), Name: github.String(a.name)})
+			return
+		}
+		if f.private {
+			http.Redirect(w, r, fmt.Sprintf("%s/signed/%d", base, id), http.StatusFound)
+			return
+		}
+		f.serveAsset(w, r, a)
+		return
+	}
+
+	// /signed/{id}
+	if len(p) == 2 && p[0] == "signed" {
+		id, _ := strconv.ParseInt(p[1], 10, 64)
+		f.mu.Lock()
+		a, ok := f.findAsset(id)
+		f.mu.Unlock()
+		if ok {
+			f.serveAsset(w, r, a)
+			return
+		}
+	}
+
+	// /api/v3/repos/{owner}/{repo}/{tarball,zipball}/{tag}
+	if len(p) == 7 && p[0] == "api" && (p[5] == "tarball" || p[5] == "zipball") {
+		f.mu.Lock()
+		var content []byte
+		for _, rel := range f.releases[p[3]+"/"+p[4]] {
+			if rel.tag == p[6] {
+				content = rel.tarball
+				if p[5] == "zipball" {
+					content = rel.zipball
+				}
+			}
+		}
+		f.mu.Unlock()
+		if content != nil {
+			f.serveAsset(w, r, fakeAsset{name: p[5], content: content})
+			return
+		}
+	}
+
+	// /{owner}/{repo}/releases/download/{tag}/{name}
+	if len(p) == 6 && p[2] == "releases" && p[3] == "download" {
+		f.mu.Lock()
+		a, ok := f.findDownload(p[0]+"/"+p[1], p[4], p[5])
+		f.mu.Unlock()
+		if ok {
+			f.serveAsset(w, r, a)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// authorized responds as a private repository does and returns false when the request is not allowed.
+func (f *fakeGitHub) authorized(w http.ResponseWriter, r *http.Request, p []string) bool {
+	switch {
+	case p[0] == "api" && r.Header.Get("Authorization") == "":
+		http.NotFound(w, r)
+		return false
+	case p[0] == "signed" && r.Header.Get("Authorization") != "":
+		// Signed URLs of storage do not accept other authentications
+		http.Error(w, "Only one auth mechanism allowed", http.StatusBadRequest)
+		return false
+	case p[0] != "api" && p[0] != "signed":
+		// Browser download URLs of private repositories need a browser session
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+func (f *fakeGitHub) findDownload(slug, tag, name string) (fakeAsset, bool) {
+	for _, rel := range f.releases[slug] {
+		if rel.tag != tag {
+			continue
+		}
+		for _, a := range rel.assets {
+			if a.name == name {
+				return a, true
+			}
+		}
+	}
+	return fakeAsset{}, false
+}
+
+func (f *fakeGitHub) serveAsset(w http.ResponseWriter, r *http.Request, a fakeAsset) {
+	if f.handleAsset != nil && f.handleAsset(w, r, a) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.content)))
+	_, _ = w.Write(a.content)
+}
+
+// platformAssetName returns the asset name for the running platform such as 'foo_linux_amd64.tar.gz'.
+func platformAssetName(cmd, ext string) string {
+	return fmt.Sprintf("%s_%s_%s%s", cmd, runtime.GOOS, runtime.GOARCH, ext)
+}
+
+// archiveEntry is a file, a directory or a symbolic link in the archives created by testZip and testTarGz.
+type archiveEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+	link    string
+}
+
+// testZip creates a zip archive containing the entries.
+func testZip(t *testing.T, entries []archiveEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		h.SetMode(e.mode)
+		if e.link != "" {
+			h.SetMode(os.ModeSymlink | 0777)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.content + e.link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarGz creates a .tar.gz archive containing the given files.
+func tarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// lzmaFile compresses the content with the legacy LZMA format.
+func lzmaFile(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	lz, err := lzma.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lz.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := lz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarLzma recompresses the .tar.gz archive with lzma.
+func tarLzma(t *testing.T, tarball []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarball, err = ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lzmaFile(t, tarball)
+}
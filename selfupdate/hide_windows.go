@@ -0,0 +1,24 @@
+package selfupdate
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func hideFile(path string) error {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	setFileAttributes := kernel32.NewProc("SetFileAttributesW")
+
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	// 2 is FILE_ATTRIBUTE_HIDDEN
+	r, _, err := setFileAttributes.Call(uintptr(unsafe.Pointer(p)), 2)
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
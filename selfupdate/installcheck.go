@@ -0,0 +1,109 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrInstalledMismatch is matched with errors.Is when the executable read back after the update does not match the
+// validated one written by it, e.g. due to a partial write or another process replacing it. See Config.VerifyInstalled.
+var ErrInstalledMismatch = errors.New("installed executable does not match the validated one")
+
+// backupExecutable copies the current executable at cmdPath to '.<name>.backup' next to it so that it can be restored
+// after the new one was put in place by any commit function. An empty path is returned when there is no current
+// executable.
+func backupExecutable(cmdPath string) (string, error) {
+	src, err := os.Open(cmdPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to open current executable %s to back it up: %w", cmdPath, err)
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat current executable %s to back it up: %w", cmdPath, err)
+	}
+
+	dir, name := filepath.Split(cmdPath)
+	backup := filepath.Join(dir, fmt.Sprintf(".%s.backup", name))
+
+	dst, err := os.OpenFile(backup, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup %s of current executable: %w", backup, err)
+	}
+
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(backup)
+
+		return "", fmt.Errorf("failed to write backup %s of current executable: %w", backup, err)
+	}
+
+	return backup, nil
+}
+
+// verifyInstalled reads the executable at cmdPath back and checks that its SHA-256 digest is the one of the validated
+// executable written by the update. When it does not match, the backup of the previous executable is restored, or the
+// installed one is removed when there was no previous one. The backup is removed in both cases.
+func verifyInstalled(cmdPath, backup string, digest []byte) error {
+	installed, err := fileDigest(cmdPath)
+	if err == nil && bytes.Equal(installed, digest) {
+		if backup != "" {
+			os.Remove(backup)
+		}
+
+		log.Println("Verified installed executable", cmdPath, "with SHA256", fmt.Sprintf("%x", digest))
+
+		return nil
+	}
+
+	if err == nil {
+		err = markError(ErrInstalledMismatch, fmt.Errorf("SHA256 of installed executable %s is %x but the validated one is %x", cmdPath, installed, digest))
+	} else {
+		err = fmt.Errorf("failed to read installed executable %s to verify it: %w", cmdPath, err)
+	}
+
+	if backup == "" {
+		if rerr := os.Remove(cmdPath); rerr != nil && !os.IsNotExist(rerr) {
+			return fmt.Errorf("%w, and failed to remove it: %v", err, rerr)
+		}
+
+		return err
+	}
+
+	if rerr := os.Rename(backup, cmdPath); rerr != nil {
+		return fmt.Errorf("%w, and failed to roll back from %s: %v", err, backup, rerr)
+	}
+
+	log.Println("Rolled back", cmdPath, "to the previous executable since the installed one was not verified")
+
+	return err
+}
+
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,104 @@
+package selfupdate
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendingCommit puts the new executable in place and then appends garbage to it as a racing process would.
+func appendingCommit(newBinaryPath, targetPath string) error {
+	if err := os.Rename(newBinaryPath, targetPath); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write([]byte("garbage"))
+	return err
+}
+
+func TestUpdateWithVerifyInstalled(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": exe})}}})
+
+	for _, tc := range []struct {
+		what    string
+		commit  func(string, string) error
+		current bool
+		want    []byte
+		wantErr bool
+	}{
+		{"verified", nil, true, exe, false},
+		{"verified with custom commit", CommitByRename, true, exe, false},
+		{"verified without current", os.Rename, false, exe, false},
+		{"rolled back", appendingCommit, true, []byte("old executable"), true},
+		{"removed without current", appendingCommit, false, nil, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			path := setupOldExecutable(t)
+			if !tc.current {
+				os.Remove(path)
+			}
+
+			up, _ := newTestUpdater(t, Config{VerifyInstalled: true, CommitFunc: tc.commit}, gh)
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Release was not detected:", err)
+			}
+
+			err = up.UpdateTo(rel, path)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInstalledMismatch) {
+					t.Fatal("Wanted ErrInstalledMismatch but got", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if tc.want == nil {
+				if !os.IsNotExist(err) {
+					t.Fatal("Unverified executable should be removed:", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(b, tc.want) {
+				t.Fatalf("Wanted executable %q but got %q", tc.want, b)
+			}
+
+			files, err := ioutil.ReadDir(filepath.Dir(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range files {
+				if f.Name() != "foo" {
+					t.Error("Temporary file should be removed:", f.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestApplyFromReaderWithVerifyInstalled(t *testing.T) {
+	path := setupOldExecutable(t)
+	exe := fakeExecutableContent(t, "new executable")
+
+	err := ApplyFromReader(bytes.NewReader(exe), path, ApplyOptions{VerifyInstalled: true, CommitFunc: appendingCommit})
+	if !errors.Is(err, ErrInstalledMismatch) {
+		t.Fatal("Wanted ErrInstalledMismatch but got", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Old executable should be restored but got %q", b)
+	}
+}
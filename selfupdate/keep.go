@@ -0,0 +1,123 @@
+package selfupdate
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keptAssetPath returns the path where the release asset is kept in Config.DownloadDir, which is
+// '<dir>/<tag>/<asset name>'. Slashes in the tag such as 'cli/v1.2.3' are replaced with '_'.
+func keptAssetPath(dir string, rel *Release) string {
+	tag := rel.tagName
+	if tag == "" {
+		tag = rel.Version.String()
+	}
+
+	return filepath.Join(dir, strings.ReplaceAll(tag, "/", "_"), filepath.Base(rel.assetName()))
+}
+
+// keepReader writes the release asset into a temporary file in the download directory while it is read, and moves
+// the file to its path when the asset was read until EOF. An incomplete download is removed on Close. Failing to keep
+// the asset does not fail the update since the file is only for inspection and re-applying.
+type keepReader struct {
+	src  io.ReadCloser
+	ctx  context.Context //nolint:containedctx
+	path string
+	tmp  *os.File
+}
+
+// newKeepReader returns src as-is when the directory for the asset cannot be prepared.
+func newKeepReader(ctx context.Context, src io.ReadCloser, path string) io.ReadCloser {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Println("Could not keep downloaded asset:", err)
+
+		return src
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		log.Println("Could not keep downloaded asset:", err)
+
+		return src
+	}
+
+	return &keepReader{src: src, ctx: ctx, path: path, tmp: tmp}
+}
+
+func (r *keepReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+
+	if r.tmp != nil && n > 0 {
+		if _, werr := r.tmp.Write(p[:n]); werr != nil {
+			log.Println("Could not keep downloaded asset:", werr)
+			r.discard()
+		}
+	}
+
+	if err == io.EOF && r.tmp != nil {
+		r.finish()
+	}
+
+	return n, err //nolint:wrapcheck
+}
+
+func (r *keepReader) finish() {
+	tmp := r.tmp
+	r.tmp = nil
+
+	if err := tmp.Close(); err != nil {
+		log.Println("Could not keep downloaded asset:", err)
+		os.Remove(tmp.Name())
+
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		log.Println("Could not keep downloaded asset:", err)
+		os.Remove(tmp.Name())
+
+		return
+	}
+
+	log.Println("Downloaded asset was kept at", r.path)
+	recordKeptAsset(r.ctx, r.path)
+}
+
+func (r *keepReader) discard() {
+	if r.tmp == nil {
+		return
+	}
+
+	r.tmp.Close()
+	os.Remove(r.tmp.Name())
+	r.tmp = nil
+}
+
+func (r *keepReader) Close() error {
+	r.discard()
+
+	return r.src.Close()
+}
+
+// recordKeptAsset records the path of the kept asset to the recorder in the context if any.
+func recordKeptAsset(ctx context.Context, path string) {
+	rec, ok := ctx.Value(downloadRecorderKey{}).(*downloadRecorder)
+	if !ok {
+		return
+	}
+
+	rec.mu.Lock()
+	rec.kept = path
+	rec.mu.Unlock()
+}
+
+func (rec *downloadRecorder) keptAsset() string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.kept
+}
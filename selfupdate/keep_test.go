@@ -0,0 +1,103 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestUpdateWithDownloadDir(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+	sum := fmt.Sprintf("%x  %s\n", sha256.Sum256(asset), name)
+
+	for _, tc := range []struct {
+		what      string
+		tag       string
+		validator Validator
+		checksums string
+		ok        bool
+		dir       string
+	}{
+		{"no validation", "v1.2.3", nil, sum, true, "v1.2.3"},
+		{"streaming validation", "v1.2.3", &ChecksumValidator{}, sum, true, "v1.2.3"},
+		{"tag with slash", "cli/v1.2.3", nil, sum, true, "cli_v1.2.3"},
+		{"validation failure", "v1.2.3", &ChecksumValidator{}, fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("other")), name), false, "v1.2.3"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: tc.tag, assets: []fakeAsset{
+				{name: name, content: asset},
+				{name: "checksums.txt", content: []byte(tc.checksums)},
+			}})
+
+			dir := t.TempDir()
+			config := Config{Validator: tc.validator, DownloadDir: dir}
+			if tc.tag != "v1.2.3" {
+				config.TagPrefix = "cli/"
+			}
+			up, _ := newTestUpdater(t, config, gh)
+
+			res, err := up.UpdateCommandWithResult(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo")
+			want := filepath.Join(dir, tc.dir, name)
+			if tc.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.DownloadPath != want {
+					t.Errorf("Wanted download path %q but got %q", want, res.DownloadPath)
+				}
+			} else if err == nil {
+				t.Fatal("Validation should fail")
+			}
+
+			// The asset is kept even when the update failed after downloading it
+			b, err := ioutil.ReadFile(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, asset) {
+				t.Fatal("Kept asset does not match the downloaded one")
+			}
+			files, err := ioutil.ReadDir(filepath.Dir(want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 {
+				t.Fatal("Only the asset should be kept:", files)
+			}
+		})
+	}
+}
+
+func TestKeepReaderIncomplete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v1.2.3", "foo.tar.gz")
+	r := newKeepReader(context.Background(), ioutil.NopCloser(bytes.NewReader([]byte("partial content"))), path)
+
+	buf := make([]byte, 4)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatal("Incomplete download should not be kept:", files)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Incomplete download should not be kept:", err)
+	}
+}
@@ -0,0 +1,115 @@
+package selfupdate
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // weak by design for legacy artifact systems
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// MD5Validator validates a release asset against its MD5 digest in an additional '.md5' or '.md5sum' file.
+//
+// WEAK: MD5 is broken and does not protect against a tampered asset. It only detects corrupted downloads. This
+// validator exists for interoperability with legacy artifact systems publishing only MD5 digests. Prefer SHA2Validator,
+// ChecksumValidator or a signature validator.
+type MD5Validator struct {
+}
+
+// Validate validates the MD5 digest of the release against the contents of an additional asset file.
+func (v *MD5Validator) Validate(release, asset []byte) error {
+	return v.ValidateStream(bytes.NewReader(release), asset)
+}
+
+// ValidateStream is the same as Validate, but the release is read from the reader.
+func (v *MD5Validator) ValidateStream(release io.Reader, asset []byte) error {
+	h := md5.New() //nolint:gosec
+	if _, err := io.Copy(h, release); err != nil {
+		return fmt.Errorf("md5: failed to read release: %w", err)
+	}
+
+	calculated := hex.EncodeToString(h.Sum(nil))
+
+	// The file may contain only the digest or the output of md5sum
+	fields := strings.Fields(string(asset))
+	if len(fields) == 0 {
+		return fmt.Errorf("md5: validation failed: MD5 file is empty")
+	}
+
+	if expected := strings.ToLower(fields[0]); calculated != expected {
+		return fmt.Errorf("md5: validation failed: hash mismatch: expected=%q, got=%q", expected, calculated)
+	}
+
+	return nil
+}
+
+// Suffix returns the suffix for MD5 validation.
+func (v *MD5Validator) Suffix() string {
+	return ".md5"
+}
+
+// GetValidationAssetNames returns the names of the MD5 file. '.md5sum' is also tried after the suffix.
+func (v *MD5Validator) GetValidationAssetNames(filename string) []string {
+	return []string{filename + v.Suffix(), filename + ".md5sum"}
+}
+
+// ZipCRC32Validator validates that every entry of a zip asset matches the CRC-32 checksum recorded in the zip
+// header. No validation file is needed since the checksums are contained in the asset itself.
+//
+// WEAK: CRC-32 is not a cryptographic hash and the checksums travel with the data, so anyone who can modify
+// the asset can update them as well. It only detects corrupted downloads of zip assets. Entries encrypted with
+// Config.ZipPassword are skipped here and are checked on decryption instead.
+type ZipCRC32Validator struct {
+}
+
+// Validate reads all entries of the zip release and fails when any of them does not match its CRC-32 checksum.
+// asset is not used.
+func (v *ZipCRC32Validator) Validate(release, asset []byte) error {
+	r, err := zip.NewReader(bytes.NewReader(release), int64(len(release)))
+	if err != nil {
+		return fmt.Errorf("crc32: release is not a zip archive: %w", err)
+	}
+
+	for _, f := range r.File {
+		// Bit 0 of the general purpose flags means encrypted
+		if f.Flags&0x1 != 0 || f.FileInfo().IsDir() {
+			continue
+		}
+
+		if err := checkZipEntry(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkZipEntry reads the entry to the end, where archive/zip verifies its CRC-32 checksum.
+func checkZipEntry(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("crc32: failed to open %q in zip archive: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		return fmt.Errorf("crc32: validation failed for %q (expected CRC-32 %08x): %w", f.Name, f.CRC32, err)
+	}
+
+	return nil
+}
+
+// Suffix is not used by ZipCRC32Validator since the checksums are in the asset itself.
+func (v *ZipCRC32Validator) Suffix() string {
+	return ""
+}
+
+func (v *ZipCRC32Validator) fetchValidationData(ctx context.Context, api *github.Client, rel *Release, release []byte) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+package selfupdate
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMD5Validator(t *testing.T) {
+	data := []byte("foo")
+	sum := "acbd18db4cc2f85cedef654fccc4a4d8"
+
+	v := &MD5Validator{}
+	for _, asset := range []string{sum, sum + "\n", strings.ToUpper(sum), sum + "  foo.zip\n"} {
+		if err := v.Validate(data, []byte(asset)); err != nil {
+			t.Errorf("Validation failed for MD5 file %q: %s", asset, err)
+		}
+	}
+	if err := v.Validate([]byte("tampered"), []byte(sum)); err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Error("Validation should fail for tampered data:", err)
+	}
+	if err := v.Validate(data, []byte("\n")); err == nil {
+		t.Error("Validation should fail for empty MD5 file")
+	}
+	if n := validationAssetNames(v, "foo.zip"); len(n) != 2 || n[0] != "foo.zip.md5" || n[1] != "foo.zip.md5sum" {
+		t.Error("Unexpected validation asset names:", n)
+	}
+}
+
+func TestZipCRC32Validator(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	// Stored without compression so that the content can be corrupted in place
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "foo", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("executable content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	v := &ZipCRC32Validator{}
+	if err := v.Validate(data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := bytes.Replace(data, []byte("executable content"), []byte("executable c0ntent"), 1)
+	if err := v.Validate(corrupted, nil); err == nil || !strings.Contains(err.Error(), "validation failed") {
+		t.Fatal("Validation should fail for corrupted entry:", err)
+	}
+	if err := v.Validate([]byte("not a zip"), nil); err == nil {
+		t.Fatal("Validation should fail for non-zip release")
+	}
+	if !isRemoteValidator(v) {
+		t.Fatal("ZipCRC32Validator should not require a validation asset")
+	}
+}
@@ -0,0 +1,88 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// listReleasesPageSize is the number of releases fetched per request by ListReleases.
+const listReleasesPageSize = 100
+
+// ListReleases lists the releases of the slug (owner/repo) page by page, from the most recently created one, and
+// calls fn with the releases of each page until fn returns false or all pages are listed. Releases are selected as
+// DetectLatest does: drafts and pre-releases are listed only when Config.Draft and Config.PreRelease are set,
+// Config.TagPrefix, Config.TagFilter and Config.SkipVersions apply, and a release without an asset for the platform or
+// without its validation file is skipped. fn may be called with no release when none on the page is selected.
+//
+// Each page is a request of 100 releases to GitHub API sent with ctx, so the requests wait for Config.RateLimiter and
+// listing stops when ctx is done. When a request fails, the error is returned after fn was called with the pages
+// listed so far, so that the caller can use the partial results. Nothing is listed when the repository is not found.
+func (up *Updater) ListReleases(ctx context.Context, slug string, fn func(releases []*Release) bool) error {
+	repo, err := parseSlug(slug)
+	if err != nil {
+		return err
+	}
+
+	opt := up.options()
+	suffixes := opt.platformSuffixes()
+	list := &github.ListOptions{Page: 1, PerPage: listReleasesPageSize}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("listing releases of %s was stopped: %w", slug, err)
+		}
+
+		rels, res, err := up.api.Repositories.ListReleases(ctx, repo[0], repo[1], list)
+		if err != nil {
+			if res != nil && res.StatusCode == 404 {
+				log.Println("API returned 404. Repository or release not found")
+
+				return nil
+			}
+
+			return fmt.Errorf("failed to list releases of %s on page %d: %w", slug, list.Page, asRateLimitError(err))
+		}
+
+		if !fn(up.selectReleases(rels, repo, suffixes, opt)) || res.NextPage == 0 {
+			return nil
+		}
+
+		list.Page = res.NextPage
+	}
+}
+
+// selectReleases returns the releases which have an asset for the platform among rels.
+func (up *Updater) selectReleases(rels []*github.RepositoryRelease, repo, suffixes []string, opt options) []*Release {
+	selected := make([]*Release, 0, len(rels))
+
+	for _, rel := range rels {
+		var parts map[*github.ReleaseAsset][]AssetPart
+		if up.split != nil {
+			rel, parts = joinSplitAssets(rel, up.split)
+		}
+
+		asset, ver, ok := findAssetFromRelease(rel, suffixes, "", up.filters, opt)
+		if !ok {
+			continue
+		}
+
+		r, err := up.newRelease(rel, asset, ver, repo, parts[asset])
+		if err != nil {
+			log.Println("Skipping release", rel.GetTagName(), ":", err)
+
+			continue
+		}
+
+		selected = append(selected, r)
+	}
+
+	return selected
+}
+
+// ListReleases lists the releases of the slug (owner/repo) page by page.
+// This function is a shortcut version of updater.ListReleases() method.
+func ListReleases(ctx context.Context, slug string, fn func(releases []*Release) bool) error {
+	return DefaultUpdater().ListReleases(ctx, slug, fn)
+}
@@ -0,0 +1,115 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v30/github"
+)
+
+func TestListReleases(t *testing.T) {
+	release := func(tag string, assets ...string) *github.RepositoryRelease {
+		rel := &github.RepositoryRelease{TagName: github.String(tag)}
+		for _, a := range assets {
+			rel.Assets = append(rel.Assets, &github.ReleaseAsset{Name: github.String(a)})
+		}
+		return rel
+	}
+	name := platformAssetName("foo", ".tar.gz")
+	pages := [][]*github.RepositoryRelease{
+		{release("v1.5.0", name), release("v1.4.0", "foo_plan9_mips.tar.gz")},
+		{release("v1.3.0", name), release("nightly", name)},
+		{release("v1.2.0", name)},
+	}
+
+	list := func(ctx context.Context, up *Updater, pages int) ([]string, error) {
+		var tags []string
+		err := up.ListReleases(ctx, "owner/repo", func(rels []*Release) bool {
+			for _, r := range rels {
+				tags = append(tags, r.Version.String())
+			}
+			pages--
+			return pages > 0
+		})
+		return tags, err
+	}
+
+	t.Run("all pages", func(t *testing.T) {
+		h, requested := pagedReleasesHandler(pages)
+		up, _ := newTestUpdater(t, Config{}, h)
+
+		tags, err := list(context.Background(), up, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := fmt.Sprint(tags), "[1.5.0 1.3.0 1.2.0]"; have != want {
+			t.Errorf("Wanted releases %s but got %s", want, have)
+		}
+		if have := fmt.Sprint(requested()); have != "[1 2 3]" {
+			t.Error("All pages should be requested but got", have)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		h, requested := pagedReleasesHandler(pages)
+		up, _ := newTestUpdater(t, Config{}, h)
+
+		tags, err := list(context.Background(), up, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(tags) != "[1.5.0]" || fmt.Sprint(requested()) != "[1]" {
+			t.Error("Listing should stop when the callback returns false:", tags, requested())
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		h, requested := pagedReleasesHandler(pages)
+		up, _ := newTestUpdater(t, Config{}, h)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err := up.ListReleases(ctx, "owner/repo", func(rels []*Release) bool {
+			cancel()
+			return true
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("Listing should stop when the context is cancelled:", err)
+		}
+		if have := fmt.Sprint(requested()); have != "[1]" {
+			t.Error("No page should be requested after cancel but got", have)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		h, _ := pagedReleasesHandler(pages)
+		failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "3" {
+				http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+		up, _ := newTestUpdater(t, Config{}, failing)
+
+		tags, err := list(context.Background(), up, 10)
+		if err == nil || !strings.Contains(err.Error(), "on page 3") {
+			t.Fatal("Error of the failed page should be returned:", err)
+		}
+		if fmt.Sprint(tags) != "[1.5.0 1.3.0]" {
+			t.Error("Releases of the listed pages should be passed before the error but got", tags)
+		}
+	})
+
+	t.Run("no repository", func(t *testing.T) {
+		up, _ := newTestUpdater(t, Config{}, newFakeGitHub())
+		called := false
+		if err := up.ListReleases(context.Background(), "owner/missing", func([]*Release) bool { called = true; return true }); err != nil || called {
+			t.Fatal("Missing repository should have no release:", called, err)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package selfupdate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// assetMagicSize is the size of the head of a release asset checked by Config.CheckAssetMagic.
+const assetMagicSize = 1024
+
+// assetFormat is the format of a release asset inferred from its file extension.
+type assetFormat struct {
+	name   string
+	magics [][]byte
+}
+
+// assetFormatOf returns the expected format of the asset at url. false is returned when the format is not known.
+func assetFormatOf(url, goos string) (assetFormat, bool) {
+	switch {
+	case strings.HasSuffix(url, ".zip"):
+		// Local file header, or the end of central directory of an empty archive
+		return assetFormat{"zip", [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}}, true
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"), strings.HasSuffix(url, ".gzip"), strings.HasSuffix(url, ".gz"):
+		return assetFormat{"gzip", [][]byte{gzipMagic}}, true
+	case strings.HasSuffix(url, ".tar.xz"), strings.HasSuffix(url, ".xz"):
+		return assetFormat{"xz", [][]byte{{0xfd, '7', 'z', 'X', 'Z', 0x00}}}, true
+	}
+
+	// Uncompressed executables have no extension except '.exe' on Windows and '.wasm' for WebAssembly
+	base := url[strings.LastIndex(url, "/")+1:]
+	if ext := executableExt(goos); strings.Contains(base, ".") && (ext == "" || !strings.HasSuffix(base, ext)) {
+		return assetFormat{}, false
+	}
+
+	magics := executableMagics(goos)
+	if magics == nil {
+		return assetFormat{}, false
+	}
+
+	// Executables may be served as gzip streams. See uncompressFormat
+	return assetFormat{"executable for " + goos, append(magics, gzipMagic)}, true
+}
+
+// describeContent describes the content sniffed from its head for error messages, e.g. "HTML".
+func describeContent(head []byte) string {
+	if len(head) == 0 {
+		return "empty content"
+	}
+
+	t := http.DetectContentType(head)
+
+	switch {
+	case strings.HasPrefix(t, "text/html"):
+		return "HTML"
+	case strings.HasPrefix(t, "text/xml"):
+		return "XML"
+	case strings.HasPrefix(t, "text/plain"):
+		if bytes.HasPrefix(bytes.TrimSpace(head), []byte("{")) {
+			return "JSON"
+		}
+
+		return "text"
+	default:
+		return t
+	}
+}
+
+// magicCheckReader checks that the head of the release asset matches the magic number of its format before the rest
+// is read, so that a wrong content such as an HTML error page is rejected without downloading all of it.
+type magicCheckReader struct {
+	src     io.ReadCloser
+	url     string
+	format  assetFormat
+	head    []byte
+	checked bool
+}
+
+// newMagicCheckReader returns src as-is when the format of the asset at url for the OS is not known.
+func newMagicCheckReader(src io.ReadCloser, url, goos string) io.ReadCloser {
+	format, ok := assetFormatOf(url, goos)
+	if !ok {
+		log.Println("Format of asset", url, "is unknown. Skip checking its magic number")
+
+		return src
+	}
+
+	return &magicCheckReader{src: src, url: url, format: format}
+}
+
+func (r *magicCheckReader) check() error {
+	head := make([]byte, assetMagicSize)
+
+	n, err := io.ReadFull(r.src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	r.head = head[:n]
+
+	for _, m := range r.format.magics {
+		if bytes.HasPrefix(r.head, m) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected content of asset %s: got %s, expected %s", r.url, describeContent(r.head), r.format.name)
+}
+
+func (r *magicCheckReader) Read(p []byte) (int, error) {
+	if !r.checked {
+		if err := r.check(); err != nil {
+			return 0, err
+		}
+
+		r.checked = true
+	}
+
+	if len(r.head) > 0 {
+		n := copy(p, r.head)
+		r.head = r.head[n:]
+
+		return n, nil
+	}
+
+	return r.src.Read(p)
+}
+
+func (r *magicCheckReader) Close() error {
+	return r.src.Close()
+}
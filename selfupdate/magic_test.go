@@ -0,0 +1,83 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type countingReader struct {
+	src io.Reader
+	n   int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestMagicCheckReader(t *testing.T) {
+	tarball := tarGz(t, map[string][]byte{"foo": []byte("foo")})
+	html := "<!DOCTYPE html><html><body>Sign in to GitHub</body></html>" + strings.Repeat(" ", 10*1024*1024)
+
+	for _, tc := range []struct {
+		what    string
+		url     string
+		content []byte
+		want    string
+	}{
+		{"gzip", "foo.tar.gz", tarball, ""},
+		{"zip", "foo.zip", []byte("PK\x03\x04rest of zip"), ""},
+		{"xz", "foo.tar.xz", []byte("\xfd7zXZ\x00rest of xz"), ""},
+		{"executable", "foo", fakeExecutableContent(t, "foo"), ""},
+		{"gzip for executable", "foo", []byte("\x1f\x8brest of gzip"), ""},
+		{"unknown format", "foo.rpm", []byte("anything"), ""},
+		{"HTML for gzip", "foo.tar.gz", []byte(html), "got HTML, expected gzip"},
+		{"HTML for zip", "https://example.com/foo.zip", []byte(html), "got HTML, expected zip"},
+		{"JSON for xz", "foo.xz", []byte(`{"message": "Not Found"}`), "got JSON, expected xz"},
+		{"empty for zip", "foo.zip", []byte{}, "got empty content, expected zip"},
+		{"text for executable", "foo", []byte("Not Found"), "got text, expected executable for"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			src := &countingReader{src: bytes.NewReader(tc.content)}
+			r := newMagicCheckReader(ioutil.NopCloser(src), tc.url, runtime.GOOS)
+			b, err := ioutil.ReadAll(r)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, tc.content) {
+					t.Fatal("content was changed")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("wanted %q in error but got %v", tc.want, err)
+			}
+			if src.n > assetMagicSize {
+				t.Fatalf("only the first %d bytes should be read but %d bytes were read", assetMagicSize, src.n)
+			}
+		})
+	}
+}
+
+func TestUpdateWithCheckAssetMagic(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: platformAssetName("foo", ".tar.gz"), content: []byte("<html><body>Error</body></html>")},
+	}})
+
+	up, _ := newTestUpdater(t, Config{CheckAssetMagic: true}, gh)
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = up.UpdateTo(rel, setupOldExecutable(t))
+	if err == nil || !strings.Contains(err.Error(), "got HTML, expected gzip") {
+		t.Fatal("wrong content should be rejected by its magic number:", err)
+	}
+}
@@ -0,0 +1,108 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultManagedPrefixes are the locations managed by package managers which are detected when
+// Config.ManagedPrefixes is nil: the Cellar of Homebrew on macOS (Intel and Apple silicon) and Linux, the alternatives
+// of update-alternatives and the Nix store.
+var DefaultManagedPrefixes = []string{
+	"/usr/local/Cellar",
+	"/opt/homebrew/Cellar",
+	"/home/linuxbrew/.linuxbrew/Cellar",
+	"/etc/alternatives",
+	"/nix/store",
+}
+
+// ErrManagedInstall is the error matched by *ManagedInstallError with errors.Is.
+var ErrManagedInstall = errors.New("executable is managed by a package manager")
+
+// ManagedInstallError is returned when the executable to update is installed by a package manager, i.e. it or any
+// symlink leading to it is under one of Config.ManagedPrefixes. Replacing it would break the installation managed by
+// the package manager, so the executable should be updated via the package manager instead.
+type ManagedInstallError struct {
+	// Path is the path of the executable to update
+	Path string
+	// Managed is the path under the managed location, which may be a symlink leading to the executable
+	Managed string
+	// Prefix is the managed location which Managed is under
+	Prefix string
+}
+
+func (e *ManagedInstallError) Error() string {
+	return fmt.Sprintf("%s is managed by a package manager since %s is under %s. Please update it via the package manager instead", e.Path, e.Managed, e.Prefix)
+}
+
+// Is returns true for ErrManagedInstall.
+func (e *ManagedInstallError) Is(target error) bool {
+	return target == ErrManagedInstall
+}
+
+// maxSymlinkHops is the maximum number of symlinks followed by checkManagedInstall.
+const maxSymlinkHops = 40
+
+// checkManagedInstall returns *ManagedInstallError when cmdPath or any symlink in the chain from it to the real file
+// is under any of the prefixes.
+func checkManagedInstall(cmdPath string, prefixes []string) error {
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	p, err := filepath.Abs(cmdPath)
+	if err != nil {
+		return nil
+	}
+
+	chain := []string{p}
+
+	for i := 0; i < maxSymlinkHops; i++ {
+		target, err := os.Readlink(p)
+		if err != nil {
+			break
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(p), target)
+		}
+
+		p = filepath.Clean(target)
+		chain = append(chain, p)
+	}
+
+	// Directories in the chain may be symlinks as well, e.g. /usr/local/opt/foo -> ../Cellar/foo/1.2.3
+	if real, err := filepath.EvalSymlinks(cmdPath); err == nil {
+		if real, err = filepath.Abs(real); err == nil {
+			chain = append(chain, real)
+		}
+	}
+
+	for _, c := range chain {
+		if prefix, ok := underPrefix(c, prefixes); ok {
+			return &ManagedInstallError{Path: cmdPath, Managed: c, Prefix: prefix}
+		}
+	}
+
+	return nil
+}
+
+func underPrefix(path string, prefixes []string) (string, bool) {
+	path = filepath.ToSlash(path)
+
+	for _, prefix := range prefixes {
+		p := strings.TrimSuffix(filepath.ToSlash(prefix), "/")
+		if p == "" {
+			continue
+		}
+
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return prefix, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,115 @@
+package selfupdate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestCheckManagedInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping because creating symlink on windows requires the root privilege")
+	}
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkfile := func(p string) string {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("old executable"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	symlink := func(target, p string) string {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	cellar := filepath.Join(dir, "Cellar")
+	alternatives := filepath.Join(dir, "alternatives")
+	prefixes := []string{cellar, alternatives + "/"}
+
+	mkfile("Cellar/foo/1.2.3/bin/foo")
+	mkfile("lib/bar/bar")
+	plain := mkfile("bin/plain")
+	brew := symlink("../Cellar/foo/1.2.3/bin/foo", "bin/foo")
+	symlink(filepath.Join(dir, "lib/bar/bar"), "alternatives/bar")
+	alt := symlink("../alternatives/bar", "bin/bar")
+	symlink("../Cellar/foo/1.2.3", "opt/foo")
+	opt := symlink("../opt/foo/bin/foo", "bin/foo-opt")
+
+	for _, tc := range []struct {
+		what   string
+		path   string
+		prefix string
+	}{
+		{"Homebrew", brew, cellar},
+		{"alternatives", alt, alternatives + "/"},
+		{"symlinked directory", opt, cellar},
+		{"not managed", plain, ""},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := checkManagedInstall(tc.path, prefixes)
+			if tc.prefix == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var merr *ManagedInstallError
+			if !errors.As(err, &merr) || !errors.Is(err, ErrManagedInstall) {
+				t.Fatal("ManagedInstallError should be returned:", err)
+			}
+			if merr.Path != tc.path || merr.Prefix != tc.prefix {
+				t.Fatal("Unexpected error:", merr)
+			}
+		})
+	}
+
+	if err := checkManagedInstall(brew, []string{}); err != nil {
+		t.Fatal("Check should be disabled with no prefix:", err)
+	}
+}
+
+func TestUpdateCommandManagedInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping because creating symlink on windows requires the root privilege")
+	}
+
+	real := setupOldExecutable(t)
+	link := filepath.Join(t.TempDir(), "foo")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	gh := newFakeGitHub()
+	up, _ := newTestUpdater(t, Config{ManagedPrefixes: []string{filepath.Dir(real)}}, gh)
+
+	_, err := up.UpdateCommand(link, semver.MustParse("1.2.2"), "owner/repo")
+	if !errors.Is(err, ErrManagedInstall) {
+		t.Fatal("Update of managed executable should fail:", err)
+	}
+	if n := len(gh.requested()); n != 0 {
+		t.Fatal("No request should be sent for managed executable:", n)
+	}
+	if b, _ := ioutil.ReadFile(real); string(b) != "old executable" {
+		t.Fatalf("Managed executable should be kept: %q", b)
+	}
+}
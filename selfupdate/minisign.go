@@ -0,0 +1,165 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrMinisignKeyIDMismatch is returned when a minisign signature was not made with the configured public key.
+var ErrMinisignKeyIDMismatch = errors.New("minisign: key ID of signature does not match public key")
+
+const (
+	minisignAlgEd25519   = "Ed"
+	minisignAlgPrehashed = "ED"
+	minisignCommentLine  = "untrusted comment:"
+	minisignTrustedLine  = "trusted comment:"
+)
+
+// MinisignPublicKey is a public key of minisign (https://jedisct1.github.io/minisign/).
+type MinisignPublicKey struct {
+	// KeyID is the ID of the key, which is also embedded in signatures
+	KeyID [8]byte
+	// PublicKey is the Ed25519 public key
+	PublicKey ed25519.PublicKey
+}
+
+// String returns the key ID formatted as minisign shows it.
+func (k *MinisignPublicKey) String() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.KeyID[:]))
+}
+
+// MinisignPublicKeyFromString parses a minisign public key. s is the base64-encoded public key line such as
+// 'RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3'. The whole content of a public key file
+// (minisign.pub) including the untrusted comment line is also accepted.
+func MinisignPublicKeyFromString(s string) (*MinisignPublicKey, error) {
+	line := ""
+
+	for _, l := range strings.Split(strings.TrimSpace(s), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, minisignCommentLine) {
+			line = l
+
+			break
+		}
+	}
+
+	b, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("minisign: failed to decode public key: %w", err)
+	}
+
+	if len(b) != 2+8+ed25519.PublicKeySize {
+		return nil, fmt.Errorf("minisign: invalid public key size %d", len(b))
+	}
+
+	if string(b[:2]) != minisignAlgEd25519 {
+		return nil, fmt.Errorf("minisign: unsupported public key algorithm %q", b[:2])
+	}
+
+	k := &MinisignPublicKey{PublicKey: ed25519.PublicKey(b[10:])}
+	copy(k.KeyID[:], b[2:10])
+
+	return k, nil
+}
+
+type minisignSignature struct {
+	algorithm       string
+	keyID           [8]byte
+	signature       []byte
+	trustedComment  string
+	globalSignature []byte
+}
+
+func parseMinisignSignature(data []byte) (*minisignSignature, error) {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n")), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], minisignCommentLine) || !strings.HasPrefix(lines[2], minisignTrustedLine) {
+		return nil, fmt.Errorf("minisign: invalid signature file format")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("minisign: failed to decode signature: %w", err)
+	}
+
+	if len(b) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("minisign: invalid signature size %d", len(b))
+	}
+
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return nil, fmt.Errorf("minisign: failed to decode global signature: %w", err)
+	}
+
+	sig := &minisignSignature{
+		algorithm:       string(b[:2]),
+		signature:       b[10:],
+		trustedComment:  strings.TrimPrefix(strings.TrimPrefix(lines[2], minisignTrustedLine), " "),
+		globalSignature: global,
+	}
+	copy(sig.keyID[:], b[2:10])
+
+	return sig, nil
+}
+
+// MinisignValidator specifies a minisign validator for additional file validation
+// before updating. Both legacy and pre-hashed signatures are supported.
+type MinisignValidator struct {
+	PublicKey *MinisignPublicKey
+}
+
+// Validate validates the release against the minisign signature contained in an additional asset file.
+// ErrMinisignKeyIDMismatch is returned when the signature was made with another key.
+func (v *MinisignValidator) Validate(release, asset []byte) error {
+	if v.PublicKey == nil {
+		return fmt.Errorf("minisign: public key is not set")
+	}
+
+	sig, err := parseMinisignSignature(asset)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(sig.keyID[:], v.PublicKey.KeyID[:]) {
+		return fmt.Errorf("%w: signature key ID is %016X but public key ID is %s", ErrMinisignKeyIDMismatch, binary.LittleEndian.Uint64(sig.keyID[:]), v.PublicKey)
+	}
+
+	message := release
+
+	switch sig.algorithm {
+	case minisignAlgEd25519:
+	case minisignAlgPrehashed:
+		h := blake2b.Sum512(release)
+		message = h[:]
+	default:
+		return fmt.Errorf("minisign: unsupported signature algorithm %q", sig.algorithm)
+	}
+
+	if !ed25519.Verify(v.PublicKey.PublicKey, message, sig.signature) {
+		return fmt.Errorf("minisign: signature verification failed")
+	}
+
+	global := append(append([]byte{}, sig.signature...), sig.trustedComment...)
+	if !ed25519.Verify(v.PublicKey.PublicKey, global, sig.globalSignature) {
+		return fmt.Errorf("minisign: trusted comment verification failed")
+	}
+
+	return nil
+}
+
+// Suffix returns the suffix for minisign validation.
+func (v *MinisignValidator) Suffix() string {
+	return ".minisig"
+}
+
+// GetValidationAssetNames returns the names of the signature file. In addition to the suffix, '.sig' is also tried
+// since some release tools rename minisign signatures so.
+func (v *MinisignValidator) GetValidationAssetNames(filename string) []string {
+	return []string{filename + v.Suffix(), filename + ".sig"}
+}
@@ -0,0 +1,135 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestMinisignPublicKeyFromString(t *testing.T) {
+	// Public key of minisign itself
+	line := "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"
+
+	for _, s := range []string{
+		line,
+		"untrusted comment: minisign public key E7620F1842B4E81F\n" + line + "\n",
+	} {
+		k, err := MinisignPublicKeyFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.String() != "E7620F1842B4E81F" {
+			t.Error("Unexpected key ID:", k)
+		}
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			t.Error("Unexpected public key size:", len(k.PublicKey))
+		}
+	}
+}
+
+func TestMinisignPublicKeyFromStringError(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"not base64!",
+		base64.StdEncoding.EncodeToString([]byte("Ed too short")),
+		base64.StdEncoding.EncodeToString(append([]byte("XX"), make([]byte, 40)...)),
+	} {
+		if _, err := MinisignPublicKeyFromString(s); err == nil {
+			t.Errorf("Error should occur for %q", s)
+		}
+	}
+}
+
+type testMinisignKey struct {
+	priv ed25519.PrivateKey
+	id   [8]byte
+}
+
+func newTestMinisignKey(t *testing.T) *testMinisignKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &testMinisignKey{priv: priv}
+	if _, err := rand.Read(k.id[:]); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func (k *testMinisignKey) publicKey() string {
+	b := append([]byte("Ed"), k.id[:]...)
+	b = append(b, k.priv.Public().(ed25519.PublicKey)...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(b) + "\n"
+}
+
+func (k *testMinisignKey) sign(data []byte, alg string) []byte {
+	msg := data
+	if alg == "ED" {
+		h := blake2b.Sum512(data)
+		msg = h[:]
+	}
+	sig := ed25519.Sign(k.priv, msg)
+	comment := "timestamp:1600000000\tfile:foo.tar.gz"
+	global := ed25519.Sign(k.priv, append(append([]byte{}, sig...), comment...))
+	b := append(append([]byte(alg), k.id[:]...), sig...)
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(b), comment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func TestMinisignValidator(t *testing.T) {
+	key := newTestMinisignKey(t)
+	pub, err := MinisignPublicKeyFromString(key.publicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &MinisignValidator{PublicKey: pub}
+	data := []byte("this is test\n")
+
+	for _, alg := range []string{"Ed", "ED"} {
+		sig := key.sign(data, alg)
+		if err := v.Validate(data, sig); err != nil {
+			t.Errorf("Validation failed for algorithm %s: %s", alg, err)
+		}
+		if err := v.Validate([]byte("tampered"), sig); err == nil {
+			t.Errorf("Validation should fail for tampered data with algorithm %s", alg)
+		}
+	}
+
+	tampered := strings.Replace(string(key.sign(data, "ED")), "file:foo", "file:bar", 1)
+	if err := v.Validate(data, []byte(tampered)); err == nil || !strings.Contains(err.Error(), "trusted comment") {
+		t.Error("Validation should fail for tampered trusted comment:", err)
+	}
+
+	if err := v.Validate(data, []byte("broken signature")); err == nil {
+		t.Error("Validation should fail for broken signature file")
+	}
+
+	if s := v.Suffix(); s != ".minisig" {
+		t.Error("Unexpected suffix:", s)
+	}
+}
+
+func TestMinisignValidatorKeyIDMismatch(t *testing.T) {
+	key := newTestMinisignKey(t)
+	other := newTestMinisignKey(t)
+	pub, err := MinisignPublicKeyFromString(key.publicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("this is test\n")
+	err = (&MinisignValidator{PublicKey: pub}).Validate(data, other.sign(data, "ED"))
+	if !errors.Is(err, ErrMinisignKeyIDMismatch) {
+		t.Fatal("ErrMinisignKeyIDMismatch should be returned but got", err)
+	}
+	if !strings.Contains(err.Error(), pub.String()) {
+		t.Error("Error message should contain the key ID:", err)
+	}
+}
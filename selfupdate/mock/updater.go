@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	io "io"
 	reflect "reflect"
 
@@ -36,6 +37,36 @@ func (m *MockUpdaterIn) EXPECT() *MockUpdaterInMockRecorder {
 	return m.recorder
 }
 
+// CompareVersions mocks base method.
+func (m *MockUpdaterIn) CompareVersions(a, b string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareVersions", a, b)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareVersions indicates an expected call of CompareVersions.
+func (mr *MockUpdaterInMockRecorder) CompareVersions(a, b interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareVersions", reflect.TypeOf((*MockUpdaterIn)(nil).CompareVersions), a, b)
+}
+
+// DetectChannels mocks base method.
+func (m *MockUpdaterIn) DetectChannels(slug string) (map[string]*selfupdate.Release, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetectChannels", slug)
+	ret0, _ := ret[0].(map[string]*selfupdate.Release)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DetectChannels indicates an expected call of DetectChannels.
+func (mr *MockUpdaterInMockRecorder) DetectChannels(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectChannels", reflect.TypeOf((*MockUpdaterIn)(nil).DetectChannels), slug)
+}
+
 // DetectLatest mocks base method.
 func (m *MockUpdaterIn) DetectLatest(slug string) (*selfupdate.Release, bool, error) {
 	m.ctrl.T.Helper()
@@ -52,6 +83,53 @@ func (mr *MockUpdaterInMockRecorder) DetectLatest(slug interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectLatest", reflect.TypeOf((*MockUpdaterIn)(nil).DetectLatest), slug)
 }
 
+// DetectLatestBatch mocks base method.
+func (m *MockUpdaterIn) DetectLatestBatch(ctx context.Context, slugs []string) (map[string]*selfupdate.Release, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetectLatestBatch", ctx, slugs)
+	ret0, _ := ret[0].(map[string]*selfupdate.Release)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DetectLatestBatch indicates an expected call of DetectLatestBatch.
+func (mr *MockUpdaterInMockRecorder) DetectLatestBatch(ctx, slugs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectLatestBatch", reflect.TypeOf((*MockUpdaterIn)(nil).DetectLatestBatch), ctx, slugs)
+}
+
+// DetectLatestIncludingAssets mocks base method.
+func (m *MockUpdaterIn) DetectLatestIncludingAssets(slug string) (*selfupdate.Release, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetectLatestIncludingAssets", slug)
+	ret0, _ := ret[0].(*selfupdate.Release)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DetectLatestIncludingAssets indicates an expected call of DetectLatestIncludingAssets.
+func (mr *MockUpdaterInMockRecorder) DetectLatestIncludingAssets(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectLatestIncludingAssets", reflect.TypeOf((*MockUpdaterIn)(nil).DetectLatestIncludingAssets), slug)
+}
+
+// DetectStable mocks base method.
+func (m *MockUpdaterIn) DetectStable(slug string) (*selfupdate.Release, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetectStable", slug)
+	ret0, _ := ret[0].(*selfupdate.Release)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DetectStable indicates an expected call of DetectStable.
+func (mr *MockUpdaterInMockRecorder) DetectStable(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectStable", reflect.TypeOf((*MockUpdaterIn)(nil).DetectStable), slug)
+}
+
 // DetectVersion mocks base method.
 func (m *MockUpdaterIn) DetectVersion(slug, version string) (*selfupdate.Release, bool, error) {
 	m.ctrl.T.Helper()
@@ -68,6 +146,66 @@ func (mr *MockUpdaterInMockRecorder) DetectVersion(slug, version interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectVersion", reflect.TypeOf((*MockUpdaterIn)(nil).DetectVersion), slug, version)
 }
 
+// ExtractRelease mocks base method.
+func (m *MockUpdaterIn) ExtractRelease(ctx context.Context, rel *selfupdate.Release, destDir string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtractRelease", ctx, rel, destDir)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtractRelease indicates an expected call of ExtractRelease.
+func (mr *MockUpdaterInMockRecorder) ExtractRelease(ctx, rel, destDir interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtractRelease", reflect.TypeOf((*MockUpdaterIn)(nil).ExtractRelease), ctx, rel, destDir)
+}
+
+// FindRelease mocks base method.
+func (m *MockUpdaterIn) FindRelease(slug, version string) (*selfupdate.Release, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindRelease", slug, version)
+	ret0, _ := ret[0].(*selfupdate.Release)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindRelease indicates an expected call of FindRelease.
+func (mr *MockUpdaterInMockRecorder) FindRelease(slug, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRelease", reflect.TypeOf((*MockUpdaterIn)(nil).FindRelease), slug, version)
+}
+
+// IsUpdateAvailable mocks base method.
+func (m *MockUpdaterIn) IsUpdateAvailable(slug string, current semver.Version) (bool, *selfupdate.Release, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsUpdateAvailable", slug, current)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(*selfupdate.Release)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IsUpdateAvailable indicates an expected call of IsUpdateAvailable.
+func (mr *MockUpdaterInMockRecorder) IsUpdateAvailable(slug, current interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsUpdateAvailable", reflect.TypeOf((*MockUpdaterIn)(nil).IsUpdateAvailable), slug, current)
+}
+
+// ListReleases mocks base method.
+func (m *MockUpdaterIn) ListReleases(ctx context.Context, slug string, fn func([]*selfupdate.Release) bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListReleases", ctx, slug, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ListReleases indicates an expected call of ListReleases.
+func (mr *MockUpdaterInMockRecorder) ListReleases(ctx, slug, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListReleases", reflect.TypeOf((*MockUpdaterIn)(nil).ListReleases), ctx, slug, fn)
+}
+
 // UpdateCommand mocks base method.
 func (m *MockUpdaterIn) UpdateCommand(cmdPath string, current semver.Version, slug string) (*selfupdate.Release, error) {
 	m.ctrl.T.Helper()
@@ -112,6 +250,50 @@ func (mr *MockUpdaterInMockRecorder) UpdateTo(rel, cmdPath interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTo", reflect.TypeOf((*MockUpdaterIn)(nil).UpdateTo), rel, cmdPath)
 }
 
+// UpdateToAsset mocks base method.
+func (m *MockUpdaterIn) UpdateToAsset(rel *selfupdate.Release, assetName, targetPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateToAsset", rel, assetName, targetPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateToAsset indicates an expected call of UpdateToAsset.
+func (mr *MockUpdaterInMockRecorder) UpdateToAsset(rel, assetName, targetPath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateToAsset", reflect.TypeOf((*MockUpdaterIn)(nil).UpdateToAsset), rel, assetName, targetPath)
+}
+
+// VersionsBehind mocks base method.
+func (m *MockUpdaterIn) VersionsBehind(slug string, current semver.Version) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VersionsBehind", slug, current)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VersionsBehind indicates an expected call of VersionsBehind.
+func (mr *MockUpdaterInMockRecorder) VersionsBehind(slug, current interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VersionsBehind", reflect.TypeOf((*MockUpdaterIn)(nil).VersionsBehind), slug, current)
+}
+
+// WriteUpdateTo mocks base method.
+func (m *MockUpdaterIn) WriteUpdateTo(ctx context.Context, rel *selfupdate.Release, w io.Writer) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteUpdateTo", ctx, rel, w)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteUpdateTo indicates an expected call of WriteUpdateTo.
+func (mr *MockUpdaterInMockRecorder) WriteUpdateTo(ctx, rel, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteUpdateTo", reflect.TypeOf((*MockUpdaterIn)(nil).WriteUpdateTo), ctx, rel, w)
+}
+
 // downloadDirectlyFromURL mocks base method.
 func (m *MockUpdaterIn) downloadDirectlyFromURL(assetURL string) (io.ReadCloser, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,216 @@
+package selfupdate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"                  //nolint:staticcheck // no maintained replacement is available in dependencies
+	"golang.org/x/crypto/openpgp/armor"            //nolint:staticcheck
+	pgperrors "golang.org/x/crypto/openpgp/errors" //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet"           //nolint:staticcheck
+)
+
+const pgpArmorBegin = "-----BEGIN PGP "
+
+// PGPValidator specifies an OpenPGP validator for additional file validation before updating.
+// Both ASCII-armored ('.asc') and binary ('.sig') detached signatures are supported.
+type PGPValidator struct {
+	// KeyRing is the set of trusted public keys. A signature made by any of them is accepted so that signing keys
+	// can be rotated by trusting both the old and the new keys for a while.
+	KeyRing openpgp.EntityList
+}
+
+// PGPValidatorFromKeyRing creates a PGPValidator from public keys. data can be an ASCII-armored or binary keyring
+// and can contain multiple keys. Multiple armored key blocks concatenated in one file are also accepted.
+func PGPValidatorFromKeyRing(data []byte) (*PGPValidator, error) {
+	keys, err := readPGPKeyRing(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("pgp: no public key is found in keyring")
+	}
+
+	return &PGPValidator{KeyRing: keys}, nil
+}
+
+// PGPValidatorFromKeyRingFile creates a PGPValidator from public keys in the file at path. When path is a directory,
+// keys in all files in the directory are trusted.
+func PGPValidatorFromKeyRingFile(path string) (*PGPValidator, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("pgp: failed to read keyring: %w", err)
+	}
+
+	files := []string{path}
+
+	if stat.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("pgp: failed to read keyring directory: %w", err)
+		}
+
+		files = files[:0]
+
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+
+		sort.Strings(files)
+	}
+
+	var keys openpgp.EntityList
+
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("pgp: failed to read keyring: %w", err)
+		}
+
+		ks, err := readPGPKeyRing(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w in %s", err, f)
+		}
+
+		keys = append(keys, ks...)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("pgp: no public key is found in %s", path)
+	}
+
+	return &PGPValidator{KeyRing: keys}, nil
+}
+
+func readPGPKeyRing(data []byte) (openpgp.EntityList, error) {
+	if !bytes.Contains(data, []byte(pgpArmorBegin)) {
+		keys, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("pgp: failed to read keyring: %w", err)
+		}
+
+		return keys, nil
+	}
+
+	var keys openpgp.EntityList
+
+	// Decode each armored block separately since armor.Decode reads only the first one
+	blocks := strings.Split(string(data), pgpArmorBegin)
+	for _, b := range blocks[1:] {
+		block, err := armor.Decode(strings.NewReader(pgpArmorBegin + b))
+		if err != nil {
+			return nil, fmt.Errorf("pgp: failed to decode armored keyring: %w", err)
+		}
+
+		if block.Type != openpgp.PublicKeyType {
+			return nil, fmt.Errorf("pgp: unexpected block type %q in keyring", block.Type)
+		}
+
+		ks, err := openpgp.ReadKeyRing(block.Body)
+		if err != nil {
+			return nil, fmt.Errorf("pgp: failed to read keyring: %w", err)
+		}
+
+		keys = append(keys, ks...)
+	}
+
+	return keys, nil
+}
+
+// Validate validates the release against the detached signature contained in an additional asset file.
+// The error tells the ID of the key which made the signature when it is not trusted.
+func (v *PGPValidator) Validate(release, asset []byte) error {
+	return v.ValidateStream(bytes.NewReader(release), asset)
+}
+
+// ValidateStream is the same as Validate, but the release is read from the reader.
+func (v *PGPValidator) ValidateStream(release io.Reader, asset []byte) error {
+	sig, err := pgpSignature(asset)
+	if err != nil {
+		return err
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(v.KeyRing, release, bytes.NewReader(sig))
+	if err == nil {
+		log.Printf("Signature was verified with PGP key %s\n", signer.PrimaryKey.KeyIdString())
+
+		return nil
+	}
+
+	trusted := make([]string, 0, len(v.KeyRing))
+	for _, e := range v.KeyRing {
+		trusted = append(trusted, e.PrimaryKey.KeyIdString())
+	}
+
+	if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+		return fmt.Errorf("pgp: signature was made by key %s which is not any of trusted keys [%s]: %w", pgpIssuer(sig), strings.Join(trusted, ", "), err)
+	}
+
+	return fmt.Errorf("pgp: signature verification failed with trusted keys [%s]: %w", strings.Join(trusted, ", "), err)
+}
+
+// pgpSignature returns the binary signature in the asset, decoding it when it is armored.
+func pgpSignature(asset []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(asset), []byte(pgpArmorBegin)) {
+		return asset, nil
+	}
+
+	block, err := armor.Decode(bytes.NewReader(asset))
+	if err != nil {
+		return nil, fmt.Errorf("pgp: failed to decode armored signature: %w", err)
+	}
+
+	if block.Type != openpgp.SignatureType {
+		return nil, fmt.Errorf("pgp: unexpected block type %q in signature", block.Type)
+	}
+
+	sig, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("pgp: failed to decode armored signature: %w", err)
+	}
+
+	return sig, nil
+}
+
+func (v *PGPValidator) signer(asset []byte) string {
+	sig, err := pgpSignature(asset)
+	if err != nil {
+		return ""
+	}
+
+	return "PGP key " + pgpIssuer(sig)
+}
+
+// Suffix returns the suffix for PGP validation.
+func (v *PGPValidator) Suffix() string {
+	return ".asc"
+}
+
+// GetValidationAssetNames returns the names of the signature file. Both armored '.asc' and binary '.sig' are tried.
+func (v *PGPValidator) GetValidationAssetNames(filename string) []string {
+	return []string{filename + v.Suffix(), filename + ".sig"}
+}
+
+// pgpIssuer returns the ID of the key which made the signature, or "unknown" when it cannot be parsed.
+func pgpIssuer(sig []byte) string {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return "unknown"
+	}
+
+	if s, ok := p.(*packet.Signature); ok && s.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *s.IssuerKeyId)
+	}
+
+	return "unknown"
+}
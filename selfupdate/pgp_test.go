@@ -0,0 +1,144 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newTestPGPEntity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func armoredPublicKey(t *testing.T, e *openpgp.Entity) []byte {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func TestPGPValidatorKeyRotation(t *testing.T) {
+	oldKey := newTestPGPEntity(t, "old")
+	newKey := newTestPGPEntity(t, "new")
+	otherKey := newTestPGPEntity(t, "other")
+
+	// Two armored key blocks concatenated in one file
+	keyring := append(armoredPublicKey(t, oldKey), armoredPublicKey(t, newKey)...)
+	v, err := PGPValidatorFromKeyRing(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.KeyRing) != 2 {
+		t.Fatal("Unexpected number of keys:", len(v.KeyRing))
+	}
+
+	data := []byte("this is test\n")
+	for _, signer := range []*openpgp.Entity{oldKey, newKey} {
+		var armored, binary bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&armored, signer, bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := openpgp.DetachSign(&binary, signer, bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Validate(data, armored.Bytes()); err != nil {
+			t.Error("Armored signature should be verified:", err)
+		}
+		if err := v.Validate(data, binary.Bytes()); err != nil {
+			t.Error("Binary signature should be verified:", err)
+		}
+		if err := v.Validate([]byte("tampered"), binary.Bytes()); err == nil || !strings.Contains(err.Error(), "verification failed") {
+			t.Error("Validation should fail for tampered data:", err)
+		}
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, otherKey, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	err = v.Validate(data, sig.Bytes())
+	if err == nil {
+		t.Fatal("Signature with untrusted key should not be verified")
+	}
+	for _, id := range []string{otherKey.PrimaryKey.KeyIdString(), oldKey.PrimaryKey.KeyIdString(), newKey.PrimaryKey.KeyIdString()} {
+		if !strings.Contains(err.Error(), id) {
+			t.Errorf("Error should contain key ID %s: %s", id, err)
+		}
+	}
+}
+
+func TestPGPValidatorFromKeyRingFile(t *testing.T) {
+	dir := t.TempDir()
+	keys := []*openpgp.Entity{newTestPGPEntity(t, "first"), newTestPGPEntity(t, "second")}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "first.asc"), armoredPublicKey(t, keys[0]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var binary bytes.Buffer
+	if err := keys[1].Serialize(&binary); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "second.gpg"), binary.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := PGPValidatorFromKeyRingFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.KeyRing) != 2 {
+		t.Fatal("Unexpected number of keys:", len(v.KeyRing))
+	}
+
+	v, err = PGPValidatorFromKeyRingFile(filepath.Join(dir, "second.gpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.KeyRing) != 1 || v.KeyRing[0].PrimaryKey.KeyId != keys[1].PrimaryKey.KeyId {
+		t.Fatal("Unexpected keys:", v.KeyRing)
+	}
+}
+
+func TestPGPValidatorFromKeyRingError(t *testing.T) {
+	if _, err := PGPValidatorFromKeyRing([]byte("not a key")); err == nil {
+		t.Error("Error should occur for broken keyring")
+	}
+	if _, err := PGPValidatorFromKeyRing(nil); err == nil {
+		t.Error("Error should occur for empty keyring")
+	}
+	if _, err := PGPValidatorFromKeyRingFile(t.TempDir()); err == nil {
+		t.Error("Error should occur for empty directory")
+	}
+	if _, err := PGPValidatorFromKeyRingFile("not-existing.asc"); err == nil {
+		t.Error("Error should occur for not existing file")
+	}
+}
+
+func TestPGPValidatorSuffix(t *testing.T) {
+	v := &PGPValidator{}
+	if s := v.Suffix(); s != ".asc" {
+		t.Error("Unexpected suffix:", s)
+	}
+	if s := strings.Join(validationAssetNames(v, "foo.zip"), ","); s != "foo.zip.asc,foo.zip.sig" {
+		t.Error("Unexpected validation asset names:", s)
+	}
+}
@@ -0,0 +1,128 @@
+package selfupdate
+
+import (
+	"io"
+	"time"
+)
+
+// ProgressPhase represents a phase of updating a binary.
+type ProgressPhase int
+
+const (
+	// ProgressDownloading is the phase downloading the release asset.
+	ProgressDownloading ProgressPhase = iota
+	// ProgressValidating is the phase downloading the validation asset and validating the release asset with it.
+	// It is skipped when the validator implements StreamValidator since the release asset is validated while downloading.
+	ProgressValidating
+	// ProgressApplying is the phase uncompressing the release asset and replacing the executable.
+	ProgressApplying
+	// ProgressDone means the update finished successfully.
+	ProgressDone
+)
+
+// String returns the name of the phase.
+func (p ProgressPhase) String() string {
+	switch p {
+	case ProgressDownloading:
+		return "downloading"
+	case ProgressValidating:
+		return "validating"
+	case ProgressApplying:
+		return "applying"
+	case ProgressDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// Progress represents the progress of updating a binary.
+type Progress struct {
+	// Phase is the current phase of the update
+	Phase ProgressPhase
+	// Downloaded is the number of bytes of the release asset downloaded so far
+	Downloaded int64
+	// Total is the size of the release asset in bytes. It is zero when the size is unknown
+	Total int64
+	// BytesPerSecond is the smoothed transfer rate of the download. It is zero until the rate is measured
+	BytesPerSecond float64
+	// ETA is the estimated time until the download finishes. It is zero when Total is unknown or the rate is not
+	// measured yet
+	ETA time.Duration
+}
+
+const (
+	// progressSampleInterval is the minimum interval between samples of the transfer rate
+	progressSampleInterval = 200 * time.Millisecond
+	// progressSmoothing is the weight of the latest sample in the exponential moving average of the transfer rate
+	progressSmoothing = 0.3
+)
+
+type progressReader struct {
+	src      io.Reader
+	current  Progress
+	progress func(Progress)
+	// now returns the current time. It is replaced in tests
+	now         func() time.Time
+	sampledAt   time.Time
+	sampledSize int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if n > 0 {
+		r.current.Downloaded += int64(n)
+		r.sample()
+		r.progress(r.current)
+	}
+
+	return n, err
+}
+
+// sample updates the transfer rate when enough time passed since the last sample, and the ETA with it.
+func (r *progressReader) sample() {
+	if r.now == nil {
+		r.now = time.Now
+	}
+
+	now := r.now()
+
+	switch elapsed := now.Sub(r.sampledAt); {
+	case r.sampledAt.IsZero():
+		// The first read only starts the measurement since the time spent before it is unknown
+		r.sampledAt, r.sampledSize = now, r.current.Downloaded
+	case elapsed >= progressSampleInterval:
+		rate := float64(r.current.Downloaded-r.sampledSize) / elapsed.Seconds()
+		if r.current.BytesPerSecond == 0 {
+			r.current.BytesPerSecond = rate
+		} else {
+			r.current.BytesPerSecond = progressSmoothing*rate + (1-progressSmoothing)*r.current.BytesPerSecond
+		}
+
+		r.sampledAt, r.sampledSize = now, r.current.Downloaded
+	}
+
+	r.current.ETA = 0
+
+	remaining := r.current.Total - r.current.Downloaded
+	if r.current.Total > 0 && remaining > 0 && r.current.BytesPerSecond > 0 {
+		r.current.ETA = time.Duration(float64(remaining) / r.current.BytesPerSecond * float64(time.Second))
+	}
+}
+
+// sendProgress sends p to ch without blocking. When the buffer of ch is full because the receiver is slow,
+// the oldest progress is dropped so that the receiver always gets the latest one.
+func sendProgress(ch chan Progress, p Progress) {
+	for {
+		select {
+		case ch <- p:
+			return
+		default:
+		}
+
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
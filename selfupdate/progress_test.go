@@ -0,0 +1,167 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestSendProgressDropsOldest(t *testing.T) {
+	ch := make(chan Progress, 1)
+	for i := 1; i <= 3; i++ {
+		sendProgress(ch, Progress{Downloaded: int64(i)})
+	}
+
+	if p := <-ch; p.Downloaded != 3 {
+		t.Fatal("Latest progress should be kept but got", p)
+	}
+}
+
+func TestProgressRateAndETA(t *testing.T) {
+	for _, total := range []int64{1000, 0} {
+		clock := time.Unix(0, 0)
+		var reported []Progress
+		r := &progressReader{
+			// 100 bytes per 100ms
+			src:      iotest.HalfReader(bytes.NewReader(make([]byte, 1000))),
+			current:  Progress{Total: total},
+			progress: func(p Progress) { reported = append(reported, p) },
+			now: func() time.Time {
+				clock = clock.Add(100 * time.Millisecond)
+				return clock
+			},
+		}
+		buf := make([]byte, 200)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				break
+			}
+		}
+
+		if len(reported) != 10 {
+			t.Fatal("Unexpected number of progress:", len(reported))
+		}
+		if p := reported[0]; p.BytesPerSecond != 0 || p.ETA != 0 {
+			t.Errorf("Rate should not be measured at first: %+v", p)
+		}
+		p := reported[2]
+		if p.BytesPerSecond != 1000 {
+			t.Errorf("Unexpected rate: %+v", p)
+		}
+		want := 700 * time.Millisecond
+		if total == 0 {
+			want = 0 // Unknown without total
+		}
+		if p.ETA != want {
+			t.Errorf("Wanted ETA %s but got %+v", want, p)
+		}
+		if p := reported[9]; p.ETA != 0 || p.BytesPerSecond != 1000 {
+			t.Errorf("Unexpected last progress: %+v", p)
+		}
+	}
+}
+
+func TestProgressPhaseString(t *testing.T) {
+	for p, want := range map[ProgressPhase]string{
+		ProgressDownloading: "downloading",
+		ProgressValidating:  "validating",
+		ProgressApplying:    "applying",
+		ProgressDone:        "done",
+		ProgressPhase(-1):   "unknown",
+	} {
+		if s := p.String(); s != want {
+			t.Errorf("Wanted %q but got %q", want, s)
+		}
+	}
+}
+
+func detectFakeRelease(t *testing.T, config Config, content []byte) (*Updater, *Release) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: content}}})
+	up, _ := newTestUpdater(t, config, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Release was not found")
+	}
+	return up, rel
+}
+
+func TestUpdateToWithProgress(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	up, rel := detectFakeRelease(t, Config{}, asset)
+	path := setupOldExecutable(t)
+
+	progress, errCh := up.UpdateToWithProgress(context.Background(), rel, path)
+
+	var last Progress
+	phases := 0
+	for p := range progress {
+		if p.Phase < last.Phase || p.Downloaded < last.Downloaded {
+			t.Errorf("Progress went backward: %+v -> %+v", last, p)
+		}
+		if p.Phase != last.Phase {
+			phases++
+		}
+		last = p
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-errCh; ok {
+		t.Error("Error channel should be closed")
+	}
+
+	if last.Phase != ProgressDone {
+		t.Error("Last phase should be done but got", last.Phase)
+	}
+	if last.Downloaded != int64(len(asset)) || last.Total != int64(len(asset)) {
+		t.Errorf("Unexpected bytes in last progress: %+v (asset size: %d)", last, len(asset))
+	}
+	if phases == 0 {
+		t.Error("No phase change was reported")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exe) {
+		t.Fatalf("Executable was not updated: %q", b)
+	}
+}
+
+func TestUpdateToWithProgressCanceled(t *testing.T) {
+	up, rel := detectFakeRelease(t, Config{}, tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")}))
+	path := setupOldExecutable(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	progress, errCh := up.UpdateToWithProgress(ctx, rel, path)
+	for range progress {
+	}
+
+	err := <-errCh
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("Cancellation error should be returned but got", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Old executable should be kept but got %q", b)
+	}
+}
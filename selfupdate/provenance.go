@@ -0,0 +1,292 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SLSAProvenanceVerifier verifies the SLSA provenance of a release asset, such as the '*.intoto.jsonl' file generated
+// by slsa-github-generator, before the update is applied. The update fails when no provenance asset is found in the
+// release unless Optional is set, so that removing the provenance does not bypass it. Set it to Config.Provenance to
+// enable it.
+//
+// Each line of the provenance asset is a DSSE envelope containing an in-toto statement, or a sigstore bundle of such
+// an envelope. The statement whose subject has the SHA-256 digest of the downloaded asset is verified against
+// BuilderID and SourceURI. Both SLSA provenance v0.2 and v1 predicates are supported.
+//
+// The envelope must be signed by one of PublicKeys, or be a sigstore bundle verified with Sigstore. The verification
+// fails when neither of them is set since anyone who can upload a release asset can forge the provenance.
+type SLSAProvenanceVerifier struct {
+	// BuilderID is the expected ID of the builder, e.g.
+	// "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml".
+	// The '@ref' suffix of the builder ID is ignored unless BuilderID contains '@'. If empty, any builder is accepted.
+	BuilderID string
+	// SourceURI is the expected repository the asset was built from, e.g. "github.com/owner/repo". The scheme, 'git+'
+	// prefix and '@ref' suffix are ignored on comparison. If empty, any source is accepted.
+	SourceURI string
+	// PublicKeys are the ECDSA public keys trusted for signing DSSE envelopes.
+	PublicKeys []crypto.PublicKey
+	// Sigstore verifies keyless signatures: lines which are sigstore bundles are verified as artifact attestations, so
+	// its CertificateIdentity must match the builder, e.g.
+	// `^https://github\.com/slsa-framework/slsa-github-generator/\.github/workflows/generator_generic_slsa3\.yml@`.
+	Sigstore *AttestationValidator
+	// AssetNames are the file names of the provenance asset looked up in the release in order. If empty,
+	// '{asset}.intoto.jsonl', 'multiple.intoto.jsonl' and 'provenance.intoto.jsonl' are looked up.
+	AssetNames []string
+	// Optional updates releases without a provenance asset as usual instead of failing. Releases with a provenance
+	// asset are still verified.
+	Optional bool
+}
+
+const (
+	slsaProvenanceV02 = "https://slsa.dev/provenance/v0.2"
+	slsaProvenanceV1  = "https://slsa.dev/provenance/v1"
+)
+
+// ProvenanceError is returned when the SLSA provenance of a release asset does not satisfy SLSAProvenanceVerifier.
+// Predicate tells which part of the provenance failed such as "subject", "builder.id" or "source".
+type ProvenanceError struct {
+	// Predicate is the name of the failed predicate
+	Predicate string
+	// Expected is the expected value of the predicate
+	Expected string
+	// Actual is the value in the provenance. It is empty when the provenance has no value
+	Actual string
+}
+
+func (e *ProvenanceError) Error() string {
+	return fmt.Sprintf("SLSA provenance: %s mismatch: expected=%q, got=%q", e.Predicate, e.Expected, e.Actual)
+}
+
+func (v *SLSAProvenanceVerifier) assetNames(asset string) []string {
+	if len(v.AssetNames) > 0 {
+		return v.AssetNames
+	}
+
+	return []string{asset + ".intoto.jsonl", "multiple.intoto.jsonl", "provenance.intoto.jsonl"}
+}
+
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     []byte `json:"payload"`
+	Signatures  []struct {
+		Sig []byte `json:"sig"`
+	} `json:"signatures"`
+}
+
+// provenanceEntry is a line of the provenance asset: either a DSSE envelope or a sigstore bundle containing it.
+type provenanceEntry struct {
+	dsseEnvelope
+	sigstoreBundle
+}
+
+// envelope returns the DSSE envelope of the line and whether the line is a sigstore bundle.
+func (l *provenanceEntry) envelope() (*dsseEnvelope, bool) {
+	b := l.DSSEEnvelope
+	if b == nil {
+		return &l.dsseEnvelope, false
+	}
+
+	env := &dsseEnvelope{PayloadType: b.PayloadType, Payload: b.Payload}
+	for _, s := range b.Signatures {
+		env.Signatures = append(env.Signatures, struct {
+			Sig []byte `json:"sig"`
+		}{s.Sig})
+	}
+
+	return env, true
+}
+
+type slsaStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+	Predicate     struct {
+		// v0.2
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource struct {
+				URI string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+		// v1
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Workflow struct {
+					Repository string `json:"repository"`
+				} `json:"workflow"`
+			} `json:"externalParameters"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// Verify verifies the provenance read from r for the asset whose SHA-256 digest is digest.
+func (v *SLSAProvenanceVerifier) Verify(r io.Reader, digest []byte) error {
+	if len(v.PublicKeys) == 0 && v.Sigstore == nil {
+		return fmt.Errorf("SLSA provenance: no trust material is configured. Set PublicKeys or Sigstore to verify the signature")
+	}
+
+	want := hex.EncodeToString(digest)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var l provenanceEntry
+		if err := json.Unmarshal(line, &l); err != nil {
+			return fmt.Errorf("SLSA provenance: failed to parse DSSE envelope: %w", err)
+		}
+
+		env, bundled := l.envelope()
+
+		var st slsaStatement
+		if err := json.Unmarshal(env.Payload, &st); err != nil {
+			return fmt.Errorf("SLSA provenance: failed to parse in-toto statement: %w", err)
+		}
+
+		for _, sub := range st.Subject {
+			if strings.EqualFold(sub.Digest["sha256"], want) {
+				if err := v.verifySignature(env, &l.sigstoreBundle, bundled, digest); err != nil {
+					return err
+				}
+
+				return v.verifyStatement(&st)
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("SLSA provenance: failed to read provenance: %w", err)
+	}
+
+	return &ProvenanceError{Predicate: "subject", Expected: "sha256:" + want}
+}
+
+// verifySignature verifies the envelope with Sigstore when it is in a sigstore bundle, or with PublicKeys otherwise.
+func (v *SLSAProvenanceVerifier) verifySignature(env *dsseEnvelope, b *sigstoreBundle, bundled bool, digest []byte) error {
+	if bundled && v.Sigstore != nil {
+		if err := v.Sigstore.verifyBundle(b, digest); err != nil {
+			return &ProvenanceError{Predicate: "signature", Expected: "sigstore bundle verified", Actual: err.Error()}
+		}
+
+		return nil
+	}
+
+	pae := dssePAE(env.PayloadType, env.Payload)
+
+	for _, sig := range env.Signatures {
+		for _, key := range v.PublicKeys {
+			if verifyWithPublicKey(key, pae, sig.Sig) == nil {
+				return nil
+			}
+		}
+	}
+
+	return &ProvenanceError{Predicate: "signature", Expected: "signed by trusted key", Actual: fmt.Sprintf("%d untrusted signature(s)", len(env.Signatures))}
+}
+
+func (v *SLSAProvenanceVerifier) verifyStatement(st *slsaStatement) error {
+	var builder, source string
+
+	switch st.PredicateType {
+	case slsaProvenanceV02:
+		builder, source = st.Predicate.Builder.ID, st.Predicate.Invocation.ConfigSource.URI
+	case slsaProvenanceV1:
+		builder, source = st.Predicate.RunDetails.Builder.ID, st.Predicate.BuildDefinition.ExternalParameters.Workflow.Repository
+	default:
+		return &ProvenanceError{Predicate: "predicateType", Expected: slsaProvenanceV02 + " or " + slsaProvenanceV1, Actual: st.PredicateType}
+	}
+
+	if v.BuilderID != "" {
+		id := builder
+		if !strings.Contains(v.BuilderID, "@") {
+			id = strings.SplitN(id, "@", 2)[0]
+		}
+
+		if id != v.BuilderID {
+			return &ProvenanceError{Predicate: "builder.id", Expected: v.BuilderID, Actual: builder}
+		}
+	}
+
+	if v.SourceURI != "" && normalizeSourceURI(source) != normalizeSourceURI(v.SourceURI) {
+		return &ProvenanceError{Predicate: "source", Expected: v.SourceURI, Actual: source}
+	}
+
+	return nil
+}
+
+// normalizeSourceURI strips the scheme and the ref from the URI of a repository such as
+// 'git+https://github.com/owner/repo@refs/tags/v1.0.0'.
+func normalizeSourceURI(uri string) string {
+	uri = strings.TrimPrefix(uri, "git+")
+	if i := strings.Index(uri, "://"); i >= 0 {
+		uri = uri[i+3:]
+	}
+
+	uri = strings.SplitN(uri, "@", 2)[0]
+
+	return strings.TrimSuffix(strings.TrimSuffix(uri, "/"), ".git")
+}
+
+// verifyProvenance downloads the provenance asset of the release and verifies it for the asset whose SHA-256 digest
+// is digest. It does nothing when no provenance verifier is configured. When the release has no provenance asset, it
+// fails with ProvenanceError unless the provenance is optional.
+func (up *Updater) verifyProvenance(ctx context.Context, rel *Release, digest []byte) error {
+	if up.provenance == nil {
+		return nil
+	}
+
+	if rel.ProvenanceAssetID <= 0 && rel.provenanceAssetURL == "" {
+		if up.provenance.Optional {
+			return nil
+		}
+
+		names := strings.Join(up.provenance.assetNames(rel.assetName()), " or ")
+
+		return markError(ErrValidationFailed, fmt.Errorf("release %s has no provenance of asset %s: %w", rel.Version, rel.assetName(), &ProvenanceError{Predicate: "provenance", Expected: names}))
+	}
+
+	src, err := up.downloadReleaseAsset(ctx, rel, releaseFile{
+		id:   rel.ProvenanceAssetID,
+		name: rel.provenanceAssetName,
+		url:  rel.provenanceAssetURL,
+		kind: "provenance ",
+	})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := up.provenance.Verify(src, digest); err != nil {
+		return markError(ErrValidationFailed, fmt.Errorf("failed verifying provenance %s of asset %s: %w", rel.provenanceAssetName, rel.assetName(), err))
+	}
+
+	log.Println("SLSA provenance", rel.provenanceAssetName, "of asset", rel.assetName(), "was verified")
+
+	if r := verificationReport(ctx); r != nil {
+		r.Provenance = rel.provenanceAssetName
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package selfupdate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testBuilderID = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"
+
+// provenanceLine returns a line of '*.intoto.jsonl' containing the statement signed by key, if any.
+func provenanceLine(t *testing.T, statement string, key *ecdsa.PrivateKey) string {
+	env := map[string]interface{}{
+		"payloadType": inTotoPayloadType,
+		"payload":     []byte(statement),
+		"signatures":  []map[string][]byte{},
+	}
+	if key != nil {
+		env["signatures"] = []map[string][]byte{{"sig": signTest(t, key, dssePAE(inTotoPayloadType, []byte(statement)))}}
+	}
+	b, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b) + "\n"
+}
+
+func provenanceV02(content []byte, builder, source string) string {
+	return fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"foo","digest":{"sha256":"%x"}}],"predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"builder":{"id":%q},"invocation":{"configSource":{"uri":%q}}}}`, sha256.Sum256(content), builder, source)
+}
+
+func provenanceV1(content []byte, builder, source string) string {
+	return fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"foo","digest":{"sha256":"%x"}}],"predicateType":"https://slsa.dev/provenance/v1","predicate":{"buildDefinition":{"externalParameters":{"workflow":{"repository":%q}}},"runDetails":{"builder":{"id":%q}}}}`, sha256.Sum256(content), source, builder)
+}
+
+func TestSLSAProvenanceVerifier(t *testing.T) {
+	content := []byte("release asset")
+	digest := sha256.Sum256(content)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []crypto.PublicKey{&key.PublicKey}
+	v := &SLSAProvenanceVerifier{BuilderID: testBuilderID, SourceURI: "github.com/owner/repo", PublicKeys: keys}
+	signed := &SLSAProvenanceVerifier{BuilderID: testBuilderID, PublicKeys: keys}
+
+	s := newFakeSigstore(t)
+	sigstore := s.validator()
+	sigstore.CertificateIdentity = `^https://github\.com/slsa-framework/slsa-github-generator/\.github/workflows/generator_generic_slsa3\.yml@`
+	keyless := &SLSAProvenanceVerifier{BuilderID: testBuilderID, SourceURI: "github.com/owner/repo", Sigstore: sigstore}
+
+	v02 := provenanceV02(content, testBuilderID+"@refs/tags/v1.9.0", "git+https://github.com/owner/repo@refs/tags/v1.2.3")
+	v1 := provenanceV1(content, testBuilderID+"@refs/tags/v2.0.0", "https://github.com/owner/repo")
+	bundle := string(s.attestStatement(t, v1, testBuilderID+"@refs/tags/v2.0.0", GitHubActionsOIDCIssuer)) + "\n"
+
+	for _, tc := range []struct {
+		what       string
+		verifier   *SLSAProvenanceVerifier
+		provenance string
+		predicate  string
+	}{
+		{"v0.2", v, provenanceLine(t, v02, key), ""},
+		{"v1", v, provenanceLine(t, v1, key), ""},
+		{"multiple statements", v, provenanceLine(t, provenanceV1([]byte("other"), "evil", "evil"), nil) + provenanceLine(t, v1, key), ""},
+		{"signed", signed, provenanceLine(t, v1, key), ""},
+		{"builder with ref", &SLSAProvenanceVerifier{BuilderID: testBuilderID + "@refs/tags/v2.0.0", PublicKeys: keys}, provenanceLine(t, v1, key), ""},
+		{"keyless", keyless, bundle, ""},
+		{"other subject", v, provenanceLine(t, provenanceV1([]byte("other"), testBuilderID, "github.com/owner/repo"), key), "subject"},
+		{"other builder", v, provenanceLine(t, provenanceV1(content, "https://github.com/evil/builder", "github.com/owner/repo"), key), "builder.id"},
+		{"other builder ref", &SLSAProvenanceVerifier{BuilderID: testBuilderID + "@refs/tags/v1.0.0", PublicKeys: keys}, provenanceLine(t, v1, key), "builder.id"},
+		{"other source", v, provenanceLine(t, provenanceV02(content, testBuilderID, "git+https://github.com/evil/repo@refs/heads/main"), key), "source"},
+		{"unsigned", signed, provenanceLine(t, v1, nil), "signature"},
+		{"untrusted key", signed, provenanceLine(t, v1, other), "signature"},
+		{"keyless without sigstore", signed, bundle, "signature"},
+		{"keyless other identity", keyless, string(s.attestStatement(t, v1, "https://github.com/evil/repo/.github/workflows/release.yml@refs/heads/main", GitHubActionsOIDCIssuer)) + "\n", "signature"},
+		{"unsigned with sigstore", keyless, provenanceLine(t, v1, nil), "signature"},
+		{"other predicate type", v, provenanceLine(t, strings.Replace(v1, slsaProvenanceV1, "https://spdx.dev/Document", 1), key), "predicateType"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := tc.verifier.Verify(strings.NewReader(tc.provenance), digest[:])
+			if tc.predicate == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var perr *ProvenanceError
+			if !errors.As(err, &perr) {
+				t.Fatalf("wanted ProvenanceError but got %v", err)
+			}
+			if perr.Predicate != tc.predicate {
+				t.Fatalf("wanted failure of %q but got %q: %s", tc.predicate, perr.Predicate, perr)
+			}
+		})
+	}
+
+	if err := v.Verify(strings.NewReader("{"), digest[:]); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Fatal("broken provenance was not rejected:", err)
+	}
+
+	noTrust := &SLSAProvenanceVerifier{BuilderID: testBuilderID}
+	if err := noTrust.Verify(strings.NewReader(provenanceLine(t, v1, key)), digest[:]); err == nil || !strings.Contains(err.Error(), "no trust material") {
+		t.Fatal("provenance should not be verified without trust material:", err)
+	}
+}
+
+func TestUpdateWithProvenance(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe := fakeExecutableContent(t, "new executable")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what       string
+		provenance string
+		optional   bool
+		wantErr    string
+	}{
+		{"no provenance", "", false, "provenance"},
+		{"optional provenance", "", true, ""},
+		{"verified", provenanceLine(t, provenanceV1(asset, testBuilderID+"@refs/tags/v2.0.0", "https://github.com/owner/repo"), key), false, ""},
+		{"other builder", provenanceLine(t, provenanceV1(asset, "https://github.com/evil/builder", "https://github.com/owner/repo"), key), true, "builder.id"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			assets := []fakeAsset{{name: name, content: asset}}
+			if tc.provenance != "" {
+				assets = append(assets, fakeAsset{name: name + ".intoto.jsonl", content: []byte(tc.provenance)})
+			}
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: assets})
+			up, _ := newTestUpdater(t, Config{Provenance: &SLSAProvenanceVerifier{BuilderID: testBuilderID, SourceURI: "github.com/owner/repo", PublicKeys: []crypto.PublicKey{&key.PublicKey}, Optional: tc.optional}}, gh)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("release was not found")
+			}
+			if (rel.ProvenanceAssetID > 0) != (tc.provenance != "") {
+				t.Fatal("unexpected provenance asset ID:", rel.ProvenanceAssetID)
+			}
+
+			path := setupOldExecutable(t)
+			err = up.UpdateTo(rel, path)
+			if tc.wantErr != "" {
+				var perr *ProvenanceError
+				if !errors.As(err, &perr) || perr.Predicate != tc.wantErr || !errors.Is(err, ErrValidationFailed) {
+					t.Fatalf("wanted ProvenanceError for %s but got %v", tc.wantErr, err)
+				}
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != "old executable" {
+					t.Fatal("executable was replaced:", string(b))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package selfupdate
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// GitHubAuthenticatedRateLimit is the number of requests per hour which GitHub allows for authenticated requests to
+// its API.
+const GitHubAuthenticatedRateLimit = 5000
+
+// RateLimiter gates the requests sent to GitHub. Wait blocks until a request is allowed or the context is done. A
+// limiter shared by multiple updaters via Config.RateLimiter coordinates their request budget. *rate.Limiter of
+// golang.org/x/time/rate satisfies this interface.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// tokenBucket is a RateLimiter allowing bursts of requests up to its capacity, refilled at a constant rate.
+type tokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing requestsPerHour requests per hour on average. Up to burst requests are
+// allowed at once, and the following requests wait their turn.
+func NewRateLimiter(requestsPerHour, burst int) RateLimiter {
+	if requestsPerHour <= 0 {
+		requestsPerHour = 1
+	}
+
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		interval: time.Hour / time.Duration(requestsPerHour),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+	}
+}
+
+// NewGitHubRateLimiter returns a RateLimiter sized to the quota of authenticated requests to GitHub API, which allows
+// bursts of 100 requests.
+func NewGitHubRateLimiter() RateLimiter {
+	return NewRateLimiter(GitHubAuthenticatedRateLimit, 100)
+}
+
+// Wait takes a token, waiting for it to be refilled when the bucket is empty. The token is given back when the
+// context is done while waiting.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+
+	b.last = now
+	b.tokens--
+	wait := time.Duration(-b.tokens * float64(b.interval))
+
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	log.Println("Waiting", wait, "for rate limiter before sending request")
+
+	if err := sleepContext(ctx, wait); err != nil {
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// rateLimitTransport waits for the limiter before sending each request.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter RateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	return base.RoundTrip(req)
+}
+
+// withRateLimiter returns a copy of the client gating its requests with the limiter. The client is returned as-is when
+// the limiter is nil.
+func withRateLimiter(c *http.Client, l RateLimiter) *http.Client {
+	if l == nil {
+		return c
+	}
+
+	wrapped := *c
+	wrapped.Transport = &rateLimitTransport{base: c.Transport, limiter: l}
+
+	return &wrapped
+}
@@ -0,0 +1,88 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func TestRateLimiter(t *testing.T) {
+	// 10ms per request
+	l := NewRateLimiter(360000, 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 5*time.Millisecond {
+		t.Fatal("requests within the burst should not wait but waited", d)
+	}
+
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 5*time.Millisecond {
+		t.Fatal("request exceeding the burst should wait but waited only", d)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(1, 1).(*tokenBucket)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("waiting should be aborted by the context:", err)
+	}
+	if l.tokens < -0.01 {
+		t.Fatal("token of the cancelled request should be given back:", l.tokens)
+	}
+}
+
+type countingLimiter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.n++
+	return nil
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	gh := newFakeGitHub()
+	for _, slug := range []string{"owner/foo", "owner/bar"} {
+		gh.addRelease(slug, fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+			{name: platformAssetName("foo", ""), content: fakeExecutableContent(t, "new executable")},
+		}})
+	}
+
+	l := &countingLimiter{}
+	foo, _ := newTestUpdater(t, Config{RateLimiter: l}, gh)
+	bar, _ := newTestUpdater(t, Config{RateLimiter: l}, gh)
+
+	if _, err := foo.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bar.DetectLatest("owner/bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listing releases and downloading the asset of foo, and listing releases of bar
+	if n := len(gh.requested()); l.n != n || n < 3 {
+		t.Fatalf("all %d requests should wait for the limiter but it was called %d times", n, l.n)
+	}
+}
@@ -0,0 +1,259 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// ReleaseCache stores the releases detected by an updater so that they can be served when GitHub API is unreachable.
+// See Config.ReleaseCache. The data is opaque and its keys are not file names.
+type ReleaseCache interface {
+	// Get returns the data stored with the key. False is returned when nothing is stored
+	Get(key string) ([]byte, bool, error)
+	// Set stores the data with the key, replacing the previous one
+	Set(key string, data []byte) error
+}
+
+// fileReleaseCache is a ReleaseCache storing each entry as a file in the directory.
+type fileReleaseCache struct {
+	dir string
+}
+
+// NewFileReleaseCache returns a ReleaseCache storing the detected releases as files in dir, which persists them across
+// restarts. The directory is created on the first store.
+func NewFileReleaseCache(dir string) ReleaseCache {
+	return &fileReleaseCache{dir: dir}
+}
+
+func (c *fileReleaseCache) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+
+	return filepath.Join(c.dir, hex.EncodeToString(h[:])+".json")
+}
+
+func (c *fileReleaseCache) Get(key string) ([]byte, bool, error) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cached release: %w", err)
+	}
+
+	return b, true, nil
+}
+
+func (c *fileReleaseCache) Set(key string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory of release cache: %w", err)
+	}
+
+	// The entry is replaced atomically so that a crash never leaves a broken entry
+	tmp, err := ioutil.TempFile(c.dir, ".release-")
+	if err != nil {
+		return fmt.Errorf("failed to create cached release: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	tmp.Close()
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to write cached release: %w", err)
+	}
+
+	return nil
+}
+
+// cachedRelease is the entry of a release in ReleaseCache. The unexported fields of Release are kept so that the
+// release can be applied as the detected one.
+type cachedRelease struct {
+	Release                      *Release
+	ReleaseID                    int64
+	TagName                      string
+	AssetNames                   []string
+	ValidationAssetName          string
+	ValidationAssetURL           string
+	ValidationSignatureAssetName string
+	ValidationSignatureAssetURL  string
+	ProvenanceAssetName          string
+	ProvenanceAssetURL           string
+	DetectedAt                   time.Time
+}
+
+// releaseCacheKey returns the key of the releases detected with the version, the filters and the options. Detections
+// returning different releases have different keys, so updaters selecting releases differently can share a cache.
+// Options which are not set are omitted so that the keys of the plain detections are stable. Config.VersionParser
+// and Config.Validator cannot be part of the key.
+func releaseCacheKey(slug, version string, filters []*regexp.Regexp, opt options) string {
+	if version == "" {
+		version = "latest"
+	}
+
+	goos, goarch := opt.platform()
+
+	key := fmt.Sprintf("%s@%s %s/%s pre=%t draft=%t assets=%t", slug, version, goos, goarch, opt.pre, opt.draft, opt.allAssets)
+	if opt.source != SourceArchiveNone {
+		key += fmt.Sprintf(" source=%d", opt.source)
+	}
+
+	if opt.tagPrefix != "" {
+		key += fmt.Sprintf(" prefix=%q", opt.tagPrefix)
+	}
+
+	if opt.tagFilter != nil {
+		key += fmt.Sprintf(" tags=%q", opt.tagFilter.String())
+	}
+
+	for _, f := range filters {
+		key += fmt.Sprintf(" filter=%q", f.String())
+	}
+
+	if opt.strategy != HighestVersion {
+		key += fmt.Sprintf(" strategy=%d", opt.strategy)
+	}
+
+	for _, v := range opt.skipVersions {
+		key += " skip=" + v.String()
+	}
+
+	return key
+}
+
+// isUnreachableError returns true when the detection failed since GitHub API did not serve the releases, such as
+// network errors, server errors and exceeded rate limits, rather than the request being wrong or cancelled.
+func isUnreachableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return true
+	}
+
+	var res *github.ErrorResponse
+	if errors.As(err, &res) {
+		return res.Response != nil && res.Response.StatusCode >= 500
+	}
+
+	var ne net.Error
+
+	return errors.As(err, &ne)
+}
+
+// detectOrCached detects the release as detectRelease does and stores it in Config.ReleaseCache. When GitHub API is
+// unreachable and Config.UseStaleRelease is set, the release detected last time is returned as a stale one instead
+// of the error.
+func (up *Updater) detectOrCached(ctx context.Context, slug, version string, opt options) (*Release, error) {
+	rel, err := up.detectRelease(ctx, slug, version, opt)
+	if up.relCache == nil {
+		return rel, err
+	}
+
+	key := releaseCacheKey(slug, version, up.filters, opt)
+
+	if err == nil {
+		up.storeRelease(key, rel)
+
+		return rel, nil
+	}
+
+	if !up.useStale || !isUnreachableError(err) {
+		return nil, err
+	}
+
+	cached, ok := up.loadRelease(key)
+	if !ok {
+		return nil, err
+	}
+
+	log.Println("WARNING: GitHub API is unreachable. Use stale release", cached.Version, "detected before:", err)
+
+	return cached, nil
+}
+
+func (up *Updater) storeRelease(key string, rel *Release) {
+	entry := cachedRelease{
+		Release:                      rel,
+		TagName:                      rel.tagName,
+		AssetNames:                   rel.assetNames,
+		ValidationAssetName:          rel.validationAssetName,
+		ValidationAssetURL:           rel.validationAssetURL,
+		ValidationSignatureAssetName: rel.validationSignatureAssetName,
+		ValidationSignatureAssetURL:  rel.validationSignatureAssetURL,
+		ProvenanceAssetName:          rel.provenanceAssetName,
+		ProvenanceAssetURL:           rel.provenanceAssetURL,
+		DetectedAt:                   time.Now(),
+	}
+
+	if rel.raw != nil {
+		entry.ReleaseID = rel.raw.id
+	}
+
+	b, err := json.Marshal(&entry)
+	if err == nil {
+		err = up.relCache.Set(key, b)
+	}
+
+	if err != nil {
+		log.Println("Could not store release", rel.Version, "in release cache:", err)
+	}
+}
+
+func (up *Updater) loadRelease(key string) (*Release, bool) {
+	b, ok, err := up.relCache.Get(key)
+	if err != nil {
+		log.Println("Could not load release from release cache:", err)
+
+		return nil, false
+	}
+
+	if !ok {
+		log.Println("No release is in release cache for", key)
+
+		return nil, false
+	}
+
+	var entry cachedRelease
+	if err := json.Unmarshal(b, &entry); err != nil || entry.Release == nil {
+		log.Println("Ignore broken release in release cache for", key, err)
+
+		return nil, false
+	}
+
+	rel := entry.Release
+	rel.Stale = true
+	rel.updater = up
+	rel.tagName = entry.TagName
+	rel.assetNames = entry.AssetNames
+	rel.validationAssetName = entry.ValidationAssetName
+	rel.validationAssetURL = entry.ValidationAssetURL
+	rel.validationSignatureAssetName = entry.ValidationSignatureAssetName
+	rel.validationSignatureAssetURL = entry.ValidationSignatureAssetURL
+	rel.provenanceAssetName = entry.ProvenanceAssetName
+	rel.provenanceAssetURL = entry.ProvenanceAssetURL
+	rel.raw = &rawRelease{id: entry.ReleaseID}
+
+	log.Println("Loaded release", rel.Version, "detected at", entry.DetectedAt.Format(time.RFC3339), "from release cache")
+
+	return rel, true
+}
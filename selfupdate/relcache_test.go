@@ -0,0 +1,200 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileReleaseCache(t *testing.T) {
+	c := NewFileReleaseCache(t.TempDir() + "/releases")
+
+	if _, ok, err := c.Get("owner/repo@latest"); ok || err != nil {
+		t.Fatal("Nothing should be stored:", ok, err)
+	}
+	if err := c.Set("owner/repo@latest", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("owner/repo@latest", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok, err := c.Get("owner/repo@latest"); !ok || err != nil || string(b) != "v2" {
+		t.Fatalf("Stored data should be replaced but got %q (%v, %v)", b, ok, err)
+	}
+	if _, ok, _ := c.Get("owner/repo@1.2.3"); ok {
+		t.Fatal("Other key should not be stored")
+	}
+}
+
+func TestDetectWithStaleRelease(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+	}})
+
+	var mu sync.Mutex
+	var outage func(w http.ResponseWriter)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := outage
+		mu.Unlock()
+		if fail != nil {
+			fail(w)
+			return
+		}
+		gh.ServeHTTP(w, r)
+	})
+	setOutage := func(f func(w http.ResponseWriter)) {
+		mu.Lock()
+		outage = f
+		mu.Unlock()
+	}
+
+	cacheDir := t.TempDir()
+	config := Config{
+		Validator:              &SHA2Validator{},
+		ReleaseCache:           NewFileReleaseCache(cacheDir),
+		UseStaleRelease:        true,
+		ValidatedAssetCacheDir: t.TempDir(),
+		RetryWait:              time.Millisecond,
+	}
+	up, _ := newTestUpdater(t, config, handler)
+
+	detected, ok, err := up.DetectLatest("owner/repo")
+	if err != nil || !ok {
+		t.Fatal("Release should be detected:", ok, err)
+	}
+	if detected.Stale {
+		t.Fatal("Detected release should not be stale")
+	}
+	if err := up.UpdateTo(detected, setupOldExecutable(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		what string
+		fail func(w http.ResponseWriter)
+	}{
+		{"network error", resetConnection},
+		{"server error", func(w http.ResponseWriter) { http.Error(w, "unavailable", http.StatusServiceUnavailable) }},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			setOutage(tc.fail)
+			defer setOutage(nil)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Stale release should be returned:", ok, err)
+			}
+			if !rel.Stale || rel.Version.String() != "1.2.3" || rel.AssetURL != detected.AssetURL || rel.AssetID != detected.AssetID {
+				t.Fatalf("Cached release should be returned as stale: %+v", rel)
+			}
+
+			if _, _, err := up.DetectVersion("owner/repo", "v1.2.3"); err == nil {
+				t.Fatal("Error should be returned when no release is cached for the detection")
+			}
+
+			// The validated asset cache serves the asset while offline
+			path := setupOldExecutable(t)
+			if err := up.UpdateTo(rel, path); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, exe) {
+				t.Fatalf("Stale release should be applied but got %q: %v", b, err)
+			}
+		})
+	}
+
+	t.Run("without stale release", func(t *testing.T) {
+		config := config
+		config.UseStaleRelease = false
+		up, _ := newTestUpdater(t, config, handler)
+
+		setOutage(resetConnection)
+		defer setOutage(nil)
+
+		if _, _, err := up.DetectLatest("owner/repo"); err == nil {
+			t.Fatal("Error should be returned without UseStaleRelease")
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		setOutage(func(w http.ResponseWriter) { http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized) })
+		defer setOutage(nil)
+
+		if _, _, err := up.DetectLatest("owner/repo"); err == nil {
+			t.Fatal("Error should be returned when GitHub API rejected the request")
+		}
+	})
+}
+
+func TestReleaseCacheSharedByConfigs(t *testing.T) {
+	gh := newFakeGitHub()
+	for _, tag := range []string{"v1.2.3", "v1.3.0"} {
+		gh.addRelease("owner/repo", fakeRelease{tag: tag, assets: []fakeAsset{
+			{name: platformAssetName("foo", ".tar.gz"), content: []byte("foo")},
+			{name: platformAssetName("bar", ".tar.gz"), content: []byte("bar")},
+		}})
+	}
+
+	outage := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if outage {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		gh.ServeHTTP(w, r)
+	})
+
+	cache := NewFileReleaseCache(t.TempDir())
+	configs := []struct {
+		config    Config
+		wantVer   string
+		wantAsset string
+	}{
+		{Config{}, "1.3.0", platformAssetName("bar", ".tar.gz")},
+		{Config{Filters: []string{"^foo"}}, "1.3.0", platformAssetName("foo", ".tar.gz")},
+		{Config{SkipVersions: []string{"1.3.0"}}, "1.2.3", platformAssetName("bar", ".tar.gz")},
+		{Config{TagFilter: regexp.MustCompile(`^v1\.2\.`)}, "1.2.3", platformAssetName("bar", ".tar.gz")},
+		{Config{TagPrefix: "v1.2."}, "", ""},
+	}
+
+	detect := func(t *testing.T) {
+		for i, c := range configs {
+			config := c.config
+			config.ReleaseCache = cache
+			config.UseStaleRelease = true
+			config.RetryWait = time.Millisecond
+			up, _ := newTestUpdater(t, config, handler)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if c.wantVer == "" {
+				if err == nil && ok {
+					t.Errorf("config %d: No release should be detected but got %s", i, rel.Version)
+				}
+				continue
+			}
+			if err != nil || !ok {
+				t.Fatalf("config %d: Release should be detected: %v, %v", i, ok, err)
+			}
+			if rel.Version.String() != c.wantVer || rel.AssetName != c.wantAsset {
+				t.Errorf("config %d: Wanted %s %s but got %s %s", i, c.wantVer, c.wantAsset, rel.Version, rel.AssetName)
+			}
+		}
+	}
+
+	detect(t)
+	outage = true
+	detect(t)
+}
@@ -1,9 +1,17 @@
 package selfupdate
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
 )
 
 // Release represents a release asset for current OS and arch.
@@ -16,12 +24,30 @@ type Release struct {
 	Draft bool
 	// AssetURL is a URL to the uploaded file for the release
 	AssetURL string
+	// AssetName is the file name of the asset
+	AssetName string
 	// AssetSize represents the size of asset in bytes
 	AssetByteSize int
 	// AssetID is the ID of the asset on GitHub
 	AssetID int64
+	// AssetDigest is the digest of the asset computed by GitHub such as 'sha256:9f86d0...'. It is empty when GitHub
+	// API does not return it or the asset is split. See GitHubDigestValidator
+	AssetDigest string
+	// AssetParts are the parts of the asset when the asset is split into multiple release assets. They are ordered
+	// by the part number. AssetURL and AssetID then refer to the first part and AssetByteSize is the total size
+	// of all parts. See Config.SplitAssetPattern
+	AssetParts []AssetPart
+	// Assets are all assets of the release including the ones for other platforms and the validation files. They are
+	// only set by DetectLatestIncludingAssets
+	Assets []Asset
 	// ValidationAssetID is the ID of additional validaton asset on GitHub
 	ValidationAssetID int64
+	// ValidationSignatureAssetID is the ID of the asset containing the signature of the validation asset on GitHub.
+	// It is set when the validator verifies the validation asset itself. See ChecksumValidator.Signature
+	ValidationSignatureAssetID int64
+	// ProvenanceAssetID is the ID of the asset containing the SLSA provenance of the asset on GitHub. It is -1 when
+	// the release has no provenance asset. See Config.Provenance
+	ProvenanceAssetID int64
 	// URL is a URL to release page for browsing
 	URL string
 	// ReleaseNotes is a release notes of the release
@@ -34,4 +60,264 @@ type Release struct {
 	RepoOwner string
 	// RepoName is the name of the repository of the release
 	RepoName string
+	// Stale is true when the release was not detected from GitHub API but loaded from Config.ReleaseCache since the
+	// API was unreachable. It is the release detected last time, so newer releases may exist
+	Stale bool
+	// updater is the updater which detected the release. It is used for calling GitHub API
+	updater *Updater
+	// validationAssetName is the file name of the validation asset
+	validationAssetName string
+	// validationAssetURL is the browser download URL of the validation asset
+	validationAssetURL string
+	// validationSignatureAssetName is the file name of the signature of the validation asset
+	validationSignatureAssetName string
+	// validationSignatureAssetURL is the browser download URL of the signature of the validation asset
+	validationSignatureAssetURL string
+	// provenanceAssetName is the file name of the SLSA provenance asset
+	provenanceAssetName string
+	// provenanceAssetURL is the browser download URL of the SLSA provenance asset
+	provenanceAssetURL string
+	// assetNames are the file names of all assets of the release
+	assetNames []string
+	// tagName is the name of the tag of the release including Config.TagPrefix
+	tagName string
+	// raw is the release object of GitHub API fetched by Raw
+	raw *rawRelease
+	// unresolved is true when the asset of the release is not looked up yet. See Updater.IsUpdateAvailable
+	unresolved bool
+}
+
+// rawRelease caches the release object of GitHub API fetched by Release.Raw. It is shared by the copies of a Release.
+type rawRelease struct {
+	mu  sync.Mutex
+	id  int64
+	rel *github.RepositoryRelease
+}
+
+// AssetPart represents one part of a release asset split into multiple release assets.
+type AssetPart struct {
+	// Name is the file name of the part such as 'foo_linux_amd64.tar.gz.part01'
+	Name string
+	// URL is a URL to the uploaded file for the part
+	URL string
+	// ID is the ID of the part on GitHub
+	ID int64
+	// ByteSize is the size of the part in bytes
+	ByteSize int
+}
+
+// Asset represents one asset uploaded to a release. See Release.Assets.
+type Asset struct {
+	// Name is the file name of the asset such as 'foo_linux_amd64.tar.gz'
+	Name string
+	// URL is a URL to the uploaded file for the asset
+	URL string
+	// ID is the ID of the asset on GitHub
+	ID int64
+	// ByteSize is the size of the asset in bytes
+	ByteSize int
+	// ContentType is the content type of the asset set on upload such as 'application/gzip'
+	ContentType string
+	// Digest is the digest of the asset computed by GitHub such as 'sha256:9f86d0...'. It is empty when GitHub API
+	// does not return it
+	Digest string
+}
+
+// assetName returns the file name of the asset. It falls back to the last element of the asset URL
+// when AssetName is not set.
+func (r *Release) assetName() string {
+	if r.AssetName != "" {
+		return r.AssetName
+	}
+
+	u, err := url.Parse(r.AssetURL)
+	if err != nil {
+		return path.Base(r.AssetURL)
+	}
+
+	return path.Base(u.Path)
+}
+
+// ReleaseAssetNames returns the file names of all assets of the release, including the assets for other platforms
+// and the validation assets. It returns nil when the release was not detected by an Updater.
+func (r *Release) ReleaseAssetNames() []string {
+	if r.assetNames == nil {
+		return nil
+	}
+
+	names := make([]string, len(r.assetNames))
+	copy(names, r.assetNames)
+
+	return names
+}
+
+// findAssetName returns the first of the names which is an asset of the release.
+func (r *Release) findAssetName(names []string) (string, bool) {
+	for _, name := range names {
+		for _, n := range r.assetNames {
+			if n == name {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// ValidationAssetName returns the file name of the asset used by the validator for validating the release asset.
+// false is returned when the release contains none of the candidate names of the validator. The signature of the
+// validation asset is looked up as well when the validator verifies it, such as ChecksumValidator.Signature.
+//
+// Validators whose validation data is not a release asset, such as AttestationValidator, have no validation asset.
+// An empty name and true are returned for them since the release cannot tell whether the data exists.
+func (r *Release) ValidationAssetName(v Validator) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+
+	if isRemoteValidator(v) {
+		return "", true
+	}
+
+	name, ok := r.findAssetName(validationAssetNames(v, r.assetName()))
+	if !ok {
+		return "", false
+	}
+
+	if sig := signatureValidator(v); sig != nil {
+		if _, ok := r.findAssetName(validationAssetNames(sig, name)); !ok {
+			return "", false
+		}
+	}
+
+	return name, true
+}
+
+// HasValidationAsset returns whether the release contains the asset used by the validator for validating the
+// release asset. It allows to detect unsigned releases before updating with the validator, which would fail. See
+// ValidationAssetName for the details.
+func (r *Release) HasValidationAsset(v Validator) bool {
+	_, ok := r.ValidationAssetName(v)
+
+	return ok
+}
+
+var (
+	reMarkdownImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	reMarkdownLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	reMarkdownAutoLink   = regexp.MustCompile(`<((?:https?|mailto):[^>]+)>`)
+	reMarkdownHTMLTag    = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	reMarkdownStrong     = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	reMarkdownEmphasis   = regexp.MustCompile(`(^|[^\w*])\*(\S(?:[^*]*?\S)?)\*`)
+	reMarkdownStrike     = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	reMarkdownCode       = regexp.MustCompile("`+([^`]+)`+")
+	reMarkdownHeading    = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)(?:\s+#+)?\s*$`)
+	reMarkdownQuote      = regexp.MustCompile(`^\s{0,3}>\s?`)
+	reMarkdownBullet     = regexp.MustCompile(`^(\s*)[*+-]\s+`)
+	reMarkdownRule       = regexp.MustCompile(`^\s{0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,}|(?:=\s*){3,})$`)
+	reMarkdownCodeFence  = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	reMarkdownBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+func stripMarkdownInline(line string) string {
+	line = reMarkdownImage.ReplaceAllString(line, "$1")
+	line = reMarkdownLink.ReplaceAllString(line, "$1 ($2)")
+	line = reMarkdownAutoLink.ReplaceAllString(line, "$1")
+	line = reMarkdownHTMLTag.ReplaceAllString(line, "")
+	line = reMarkdownCode.ReplaceAllString(line, "$1")
+	line = reMarkdownStrong.ReplaceAllString(line, "$1$2")
+	line = reMarkdownEmphasis.ReplaceAllString(line, "$1$2")
+	line = reMarkdownStrike.ReplaceAllString(line, "$1")
+
+	return line
+}
+
+// ReleaseNotesText returns the release notes with Markdown syntax stripped, which is suitable for
+// displaying in a terminal. Headings, emphasis, links, inline markups and code fences are converted to plain text.
+// List items are normalized to start with '- '.
+func (r *Release) ReleaseNotesText() string {
+	lines := strings.Split(strings.ReplaceAll(r.ReleaseNotes, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	inCode := false
+
+	for _, line := range lines {
+		if reMarkdownCodeFence.MatchString(line) {
+			inCode = !inCode
+
+			continue
+		}
+
+		if inCode {
+			out = append(out, line)
+
+			continue
+		}
+
+		if reMarkdownRule.MatchString(line) {
+			continue
+		}
+
+		for reMarkdownQuote.MatchString(line) {
+			line = reMarkdownQuote.ReplaceAllString(line, "")
+		}
+
+		line = reMarkdownHeading.ReplaceAllString(line, "$1")
+		line = reMarkdownBullet.ReplaceAllString(line, "$1- ")
+		out = append(out, strings.TrimRight(stripMarkdownInline(line), " \t"))
+	}
+
+	text := reMarkdownBlankLines.ReplaceAllString(strings.Join(out, "\n"), "\n\n")
+
+	return strings.TrimSpace(text)
+}
+
+// ReleaseNotesHTML renders the release notes into HTML via GitHub Markdown API. The notes are rendered as
+// GitHub Flavored Markdown in the context of the release's repository, so references such as issue numbers
+// are linked as on the release page. The API is called with the updater which detected the release, so its
+// API token and GitHub Enterprise settings are used.
+func (r *Release) ReleaseNotesHTML() (string, error) {
+	up := r.updater
+	if up == nil {
+		up = DefaultUpdater()
+	}
+
+	opts := &github.MarkdownOptions{Mode: "gfm"}
+	if r.RepoOwner != "" && r.RepoName != "" {
+		opts.Context = r.RepoOwner + "/" + r.RepoName
+	}
+
+	html, _, err := up.api.Markdown(up.apiCtx, r.ReleaseNotes, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to render release notes via GitHub Markdown API: %w", asRateLimitError(err))
+	}
+
+	return html, nil
+}
+
+// Raw returns the release object of GitHub API with all fields of the release which Release does not expose, such as
+// the author, the reactions, the target commitish and the download counts of the assets. It is not kept on detection
+// to save memory, so the first call fetches it from GitHub API with the updater which detected the release and the
+// result is cached for later calls. An error is returned when the release was not detected by an Updater.
+//
+// The returned object is shared by the calls, so it should not be modified.
+func (r *Release) Raw(ctx context.Context) (*github.RepositoryRelease, error) {
+	if r.updater == nil || r.raw == nil {
+		return nil, fmt.Errorf("raw release object of %s is not available since the release was not detected by an updater", r.Version)
+	}
+
+	r.raw.mu.Lock()
+	defer r.raw.mu.Unlock()
+
+	if r.raw.rel != nil {
+		return r.raw.rel, nil
+	}
+
+	rel, _, err := r.updater.api.Repositories.GetRelease(ctx, r.RepoOwner, r.RepoName, r.raw.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release %s of %s/%s: %w", r.tagName, r.RepoOwner, r.RepoName, asRateLimitError(err))
+	}
+
+	r.raw.rel = rel
+
+	return rel, nil
 }
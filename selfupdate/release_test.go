@@ -0,0 +1,180 @@
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReleaseNotesText(t *testing.T) {
+	notes := strings.Join([]string{
+		"## What's Changed",
+		"",
+		"* **New** feature by @foo in [#12](https://github.com/owner/repo/pull/12)",
+		"- Fix `--version` flag with _underscored_ and *emphasized* words",
+		"  + nested ~~item~~",
+		"",
+		"---",
+		"",
+		"> Note: see <https://example.com/docs>",
+		"",
+		"```sh",
+		"$ foo **not stripped**",
+		"```",
+		"",
+		"![screenshot](https://example.com/image.png)",
+		"Full Changelog: <b>v1.0.0...v1.1.0</b>",
+	}, "\r\n")
+
+	want := strings.Join([]string{
+		"What's Changed",
+		"",
+		"- New feature by @foo in #12 (https://github.com/owner/repo/pull/12)",
+		"- Fix --version flag with _underscored_ and emphasized words",
+		"  - nested item",
+		"",
+		"Note: see https://example.com/docs",
+		"",
+		"$ foo **not stripped**",
+		"",
+		"screenshot",
+		"Full Changelog: v1.0.0...v1.1.0",
+	}, "\n")
+
+	r := &Release{ReleaseNotes: notes}
+	if have := r.ReleaseNotesText(); have != want {
+		t.Errorf("Unexpected plain text.\nwant:\n%s\n\nhave:\n%s", want, have)
+	}
+}
+
+func TestReleaseNotesTextEmpty(t *testing.T) {
+	r := &Release{}
+	if have := r.ReleaseNotesText(); have != "" {
+		t.Errorf("Empty release notes should be empty text but got %q", have)
+	}
+}
+
+func TestReleaseNotesHTML(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/markdown", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text    string `json:"text"`
+			Mode    string `json:"mode"`
+			Context string `json:"context"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Mode != "gfm" || req.Context != "owner/repo" {
+			t.Errorf("Unexpected request to Markdown API: %+v", req)
+		}
+		fmt.Fprintf(w, "<p>%s</p>", strings.Trim(req.Text, "*"))
+	})
+	up, _ := newTestUpdater(t, Config{}, mux)
+
+	r := &Release{ReleaseNotes: "**hello**", RepoOwner: "owner", RepoName: "repo", updater: up}
+	html, err := r.ReleaseNotesHTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != "<p>hello</p>" {
+		t.Error("Unexpected HTML:", html)
+	}
+}
+
+func TestReleaseNotesHTMLError(t *testing.T) {
+	up, _ := newTestUpdater(t, Config{}, http.NotFoundHandler())
+
+	r := &Release{ReleaseNotes: "hello", updater: up}
+	if _, err := r.ReleaseNotesHTML(); err == nil {
+		t.Fatal("Error should occur when Markdown API fails")
+	}
+}
+
+func TestReleaseHasValidationAsset(t *testing.T) {
+	name := platformAssetName("foo", ".zip")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: []byte("foo")},
+		{name: name + ".sha256", content: []byte("hash")},
+		{name: "checksums.txt", content: []byte("hash  " + name)},
+	}})
+
+	up, _ := newTestUpdater(t, Config{}, gh)
+	rel, found, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("release was not found")
+	}
+
+	names := rel.ReleaseAssetNames()
+	if len(names) != 3 || names[0] != name || names[1] != name+".sha256" || names[2] != "checksums.txt" {
+		t.Fatal("unexpected asset names:", names)
+	}
+
+	for _, tc := range []struct {
+		what      string
+		validator Validator
+		want      string
+		ok        bool
+	}{
+		{"SHA256", &SHA2Validator{}, name + ".sha256", true},
+		{"checksum file", &ChecksumValidator{}, "checksums.txt", true},
+		{"signed checksum file", &ChecksumValidator{Signature: &Ed25519Validator{}}, "", false},
+		{"ECDSA", &ECDSAValidator{}, "", false},
+		{"attestation", &AttestationValidator{}, "", true},
+		{"nil", nil, "", false},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			n, ok := rel.ValidationAssetName(tc.validator)
+			if n != tc.want || ok != tc.ok {
+				t.Fatalf("wanted (%q, %v) but got (%q, %v)", tc.want, tc.ok, n, ok)
+			}
+			if rel.HasValidationAsset(tc.validator) != tc.ok {
+				t.Fatal("HasValidationAsset does not match ValidationAssetName")
+			}
+		})
+	}
+
+	if (&Release{AssetName: name}).HasValidationAsset(&SHA2Validator{}) {
+		t.Fatal("release which was not detected should have no validation asset")
+	}
+}
+
+func TestReleaseRaw(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.2", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: []byte("old")}}})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", name: "Release 1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: []byte("foo")}}})
+	up, _ := newTestUpdater(t, Config{}, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil || !ok {
+		t.Fatal("Release should be detected:", ok, err)
+	}
+	listed := len(gh.requested())
+
+	raw, err := rel.Raw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.GetTagName() != "v1.2.3" || raw.GetName() != "Release 1.2.3" || len(raw.Assets) != 1 {
+		t.Fatalf("Raw release object is not of the detected release: %+v", raw)
+	}
+
+	copied := *rel
+	if again, err := copied.Raw(context.Background()); err != nil || again != raw {
+		t.Fatal("Raw release object should be cached:", err)
+	}
+	if n := len(gh.requested()) - listed; n != 1 {
+		t.Errorf("Raw release object should be fetched once on first access but %d requests were sent", n)
+	}
+
+	if _, err := (&Release{}).Raw(context.Background()); err == nil || !strings.Contains(err.Error(), "not detected by an updater") {
+		t.Error("Release not detected by an updater should have no raw release object:", err)
+	}
+}
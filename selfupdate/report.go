@@ -0,0 +1,268 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// VerificationReport records what was checked to validate the release asset of an update, so that the validation
+// can be audited later. It is set to UpdateResult.Verification when Config.Validator, Config.Provenance or
+// Config.VerifyTagSignature or Config.ExpectedCommit is set.
+type VerificationReport struct {
+	// Validator is the type of the validator such as "*selfupdate.ChecksumValidator". NamedValidator is unwrapped.
+	// It is empty when only the provenance was verified
+	Validator string
+	// Target is whether the validator validated the release asset or the executable in it
+	Target ValidationTarget
+	// ValidationAssets are the names of the validation files downloaded for the validation in order, e.g. the
+	// checksum file and its signature
+	ValidationAssets []string
+	// Digests are the digests compared by the validator. The computed digest is calculated again from the validated
+	// content for the report. It is empty when the validator does not compare digests, e.g. for signatures
+	Digests []DigestCheck
+	// Signer identifies the signer of a verified signature, e.g. 'PGP key 1A2B3C4D5E6F7081' or the workflow identity
+	// of the signing certificate of an attestation. It is empty when no signature was verified
+	Signer string
+	// Provenance is the name of the verified SLSA provenance file. It is empty when no provenance was verified
+	Provenance string
+	// TagSigner is the email of the tagger of the release tag whose signature was verified by GitHub. It is empty
+	// unless Config.VerifyTagSignature is set
+	TagSigner string
+	// Commit is the SHA of the commit the release tag points at. It is empty unless Config.ExpectedCommit is set
+	Commit string
+	// SHA256 is the hex-encoded SHA-256 digest of the release asset as downloaded
+	SHA256 string
+	// Cached is true when the asset was validated on a previous update and applied from
+	// Config.ValidatedAssetCacheDir. Only the digest of the cached copy was checked then
+	Cached bool
+}
+
+// DigestCheck is a digest of a file compared on validation.
+type DigestCheck struct {
+	// Algorithm is the hash function such as "SHA-256"
+	Algorithm string
+	// Subject is the name of the file whose digest was compared
+	Subject string
+	// Expected is the hex-encoded digest found in the validation file
+	Expected string
+	// Computed is the hex-encoded digest calculated from the content
+	Computed string
+}
+
+// digestDescriber is implemented by validators comparing the digest of the release with the one in the validation
+// asset. It returns the hash function and the expected digest of the release named filename.
+type digestDescriber interface {
+	expectedDigest(filename string, asset []byte) (crypto.Hash, string, bool)
+}
+
+// signerDescriber is implemented by validators verifying signatures. It returns the signer of the signature in
+// the validation asset.
+type signerDescriber interface {
+	signer(asset []byte) string
+}
+
+type verificationReportKey struct{}
+
+func withVerificationReport(ctx context.Context) (context.Context, *VerificationReport) {
+	rep := &VerificationReport{}
+
+	return context.WithValue(ctx, verificationReportKey{}, rep), rep
+}
+
+// verificationReport returns the report in the context, or nil when the context has no report.
+func verificationReport(ctx context.Context) *VerificationReport {
+	rep, _ := ctx.Value(verificationReportKey{}).(*VerificationReport)
+
+	return rep
+}
+
+// innerValidator unwraps NamedValidator.
+func innerValidator(v Validator) Validator {
+	if nv, ok := v.(*NamedValidator); ok {
+		return innerValidator(nv.Validator)
+	}
+
+	return v
+}
+
+// reportValidation records the validation of content, which passed the validator, to the report in the context.
+// content is read only when the validator compares digests and the report exists.
+func (up *Updater) reportValidation(ctx context.Context, filename string, content io.Reader, asset []byte) error {
+	rep := verificationReport(ctx)
+	if rep == nil {
+		return nil
+	}
+
+	v := innerValidator(up.validator)
+	rep.Validator = fmt.Sprintf("%T", v)
+	rep.Target = up.target
+
+	if d, ok := v.(signerDescriber); ok && rep.Signer == "" {
+		rep.Signer = d.signer(asset)
+	}
+
+	d, ok := v.(digestDescriber)
+	if !ok {
+		return nil
+	}
+
+	h, expected, ok := d.expectedDigest(filename, asset)
+	if !ok || !h.Available() {
+		return nil
+	}
+
+	w := h.New()
+	if _, err := io.Copy(w, content); err != nil {
+		return fmt.Errorf("failed to read %s for verification report: %w", filename, err)
+	}
+
+	rep.Digests = append(rep.Digests, DigestCheck{
+		Algorithm: h.String(),
+		Subject:   filename,
+		Expected:  expected,
+		Computed:  hex.EncodeToString(w.Sum(nil)),
+	})
+
+	return nil
+}
+
+// reportAssetDigest records the SHA-256 digest of the downloaded release asset to the report in the context.
+func reportAssetDigest(ctx context.Context, digest []byte) {
+	if rep := verificationReport(ctx); rep != nil {
+		rep.SHA256 = hex.EncodeToString(digest)
+	}
+}
+
+// reportValidationAsset records the name of the downloaded validation file to the report in the context.
+func reportValidationAsset(ctx context.Context, name string) {
+	if rep := verificationReport(ctx); rep != nil {
+		rep.ValidationAssets = append(rep.ValidationAssets, name)
+	}
+}
+
+func (v *SHA2Validator) expectedDigest(filename string, asset []byte) (crypto.Hash, string, bool) {
+	if len(asset) < sha256.BlockSize {
+		return 0, "", false
+	}
+
+	return crypto.SHA256, string(asset[:sha256.BlockSize]), true
+}
+
+func (v *ChecksumValidator) expectedDigest(filename string, asset []byte) (crypto.Hash, string, bool) {
+	checksums, err := parseChecksums(asset)
+	if err != nil {
+		return 0, "", false
+	}
+
+	sum, ok := checksums[filename]
+
+	return v.hash(), sum, ok
+}
+
+func (v *MD5Validator) expectedDigest(filename string, asset []byte) (crypto.Hash, string, bool) {
+	fields := strings.Fields(string(asset))
+	if len(fields) == 0 {
+		return 0, "", false
+	}
+
+	return crypto.MD5, strings.ToLower(fields[0]), true
+}
+
+// publicKeySigner describes the signer of a key by the SHA-256 fingerprint of the public key in PKIX form.
+func publicKeySigner(kind string, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return kind + " key"
+	}
+
+	digest := sha256.Sum256(der)
+
+	return fmt.Sprintf("%s key SHA256:%x", kind, digest)
+}
+
+func (v *ECDSAValidator) signer(asset []byte) string {
+	return publicKeySigner("ECDSA", v.PublicKey)
+}
+
+func (v *Ed25519Validator) signer(asset []byte) string {
+	return publicKeySigner("Ed25519", v.PublicKey)
+}
+
+func (v *MinisignValidator) signer(asset []byte) string {
+	if v.PublicKey == nil {
+		return ""
+	}
+
+	return "minisign key " + v.PublicKey.String()
+}
+
+// signer returns the identity of the signing certificate of the first attestation matching CertificateIdentity.
+func (v *AttestationValidator) signer(asset []byte) string {
+	var res struct {
+		Attestations []struct {
+			Bundle sigstoreBundle `json:"bundle"`
+		} `json:"attestations"`
+	}
+
+	if err := json.Unmarshal(asset, &res); err != nil {
+		return ""
+	}
+
+	bundles := make([]sigstoreBundle, 0, len(res.Attestations))
+	for _, a := range res.Attestations {
+		bundles = append(bundles, a.Bundle)
+	}
+
+	// The asset may be a single bundle as accepted by Validate
+	var single sigstoreBundle
+	if res.Attestations == nil && json.Unmarshal(asset, &single) == nil {
+		bundles = append(bundles, single)
+	}
+
+	re, err := regexp.Compile(v.CertificateIdentity)
+	if err != nil {
+		return ""
+	}
+
+	for _, b := range bundles {
+		m := b.VerificationMaterial
+
+		var raw []byte
+
+		switch {
+		case m.Certificate != nil:
+			raw = m.Certificate.RawBytes
+		case m.X509CertificateChain != nil && len(m.X509CertificateChain.Certificates) > 0:
+			raw = m.X509CertificateChain.Certificates[0].RawBytes
+		default:
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			continue
+		}
+
+		for _, u := range cert.URIs {
+			if re.MatchString(u.String()) {
+				return u.String()
+			}
+		}
+
+		for _, e := range cert.EmailAddresses {
+			if re.MatchString(e) {
+				return e
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,118 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestUpdateResultVerification(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+	sum := fmt.Sprintf("%x", sha256.Sum256(asset))
+
+	checksums, err := GenerateChecksums(map[string]io.Reader{name: bytes.NewReader(asset)}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := fmt.Sprintf("Ed25519 key SHA256:%x", sha256.Sum256(der))
+
+	for _, tc := range []struct {
+		what      string
+		validator Validator
+		assets    []fakeAsset
+		want      VerificationReport
+	}{
+		{
+			"sha256",
+			&SHA2Validator{},
+			[]fakeAsset{{name: name + ".sha256", content: []byte(sum)}},
+			VerificationReport{
+				Validator:        "*selfupdate.SHA2Validator",
+				ValidationAssets: []string{name + ".sha256"},
+				Digests:          []DigestCheck{{"SHA-256", name, sum, sum}},
+			},
+		},
+		{
+			"signed checksums",
+			&ChecksumValidator{Signature: &Ed25519Validator{PublicKey: pub}},
+			[]fakeAsset{
+				{name: "checksums.txt", content: checksums},
+				{name: "checksums.txt.sig", content: ed25519.Sign(priv, checksums)},
+			},
+			VerificationReport{
+				Validator:        "*selfupdate.ChecksumValidator",
+				ValidationAssets: []string{"checksums.txt", "checksums.txt.sig"},
+				Digests:          []DigestCheck{{"SHA-256", name, sum, sum}},
+				Signer:           signer,
+			},
+		},
+		{
+			"signature",
+			&NamedValidator{Validator: &Ed25519Validator{PublicKey: pub}, Template: "{{asset}}.sig"},
+			[]fakeAsset{{name: name + ".sig", content: ed25519.Sign(priv, asset)}},
+			VerificationReport{
+				Validator:        "*selfupdate.Ed25519Validator",
+				ValidationAssets: []string{name + ".sig"},
+				Signer:           signer,
+			},
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: append([]fakeAsset{{name: name, content: asset}}, tc.assets...)})
+			up, _ := newTestUpdater(t, Config{Validator: tc.validator}, gh)
+
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := up.UpdateToWithResult(rel, setupOldExecutable(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.want.SHA256 = sum
+			have, want := fmt.Sprintf("%+v", res.Verification), fmt.Sprintf("%+v", &tc.want)
+			if have != want {
+				t.Fatalf("Unexpected report:\nwant: %s\nhave: %s", want, have)
+			}
+		})
+	}
+}
+
+func TestUpdateResultWithoutVerification(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})},
+	}})
+	up, _ := newTestUpdater(t, Config{}, gh)
+
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := up.UpdateToWithResult(rel, setupOldExecutable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Verification != nil {
+		t.Fatal("Report should not be set without validation:", res.Verification)
+	}
+}
@@ -0,0 +1,54 @@
+package selfupdate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// UpdateResult is a summary of an update operation.
+type UpdateResult struct {
+	// PreviousVersion is the version of the executable before the update
+	PreviousVersion semver.Version
+	// NewVersion is the version of the executable after the update. It is the same as PreviousVersion when
+	// the executable was not updated
+	NewVersion semver.Version
+	// Release is the detected release. It is nil when no release was detected
+	Release *Release
+	// Updated is true when the executable was replaced
+	Updated bool
+	// TargetPath is the path to the executable. Symbolic links are resolved
+	TargetPath string
+	// AssetName is the file name of the release asset used for the update
+	AssetName string
+	// Validated is true when the release asset was validated with a Validator before the update
+	Validated bool
+	// Duration is the time taken by the update operation
+	Duration time.Duration
+	// Downloads is the metadata of the files downloaded for the update in order, i.e. the release asset (or its parts
+	// when it is split) and the validation assets
+	Downloads []DownloadInfo
+	// DownloadPath is the path of the release asset kept in Config.DownloadDir. It is empty when the asset was not
+	// kept, e.g. when DownloadDir is not set or the asset was not downloaded since it was found in
+	// Config.ValidatedAssetCacheDir
+	DownloadPath string
+	// Verification describes what was checked to validate the release asset. It is nil when none of Config.Validator,
+	// Config.Provenance, Config.VerifyTagSignature and Config.ExpectedCommit is set
+	Verification *VerificationReport
+}
+
+// String returns a human-readable summary of the update such as
+// 'updated from 1.2.0 to 1.3.0 at /usr/local/bin/foo using asset foo_linux_amd64.tar.gz'.
+func (r *UpdateResult) String() string {
+	if !r.Updated {
+		return fmt.Sprintf("%s at %s is up-to-date", r.PreviousVersion, r.TargetPath)
+	}
+
+	s := fmt.Sprintf("updated from %s to %s at %s using asset %s", r.PreviousVersion, r.NewVersion, r.TargetPath, r.AssetName)
+	if r.Validated {
+		s += " (validated)"
+	}
+
+	return s
+}
@@ -0,0 +1,67 @@
+package selfupdate
+
+import (
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestUpdateCommandWithResult(t *testing.T) {
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+	up, _ := detectFakeRelease(t, Config{}, asset)
+	path := setupOldExecutable(t)
+
+	res, err := up.UpdateCommandWithResult(path, semver.MustParse("1.2.0"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Updated || res.Validated {
+		t.Errorf("Unexpected flags: %+v", res)
+	}
+	if res.PreviousVersion.String() != "1.2.0" || res.NewVersion.String() != "1.2.3" {
+		t.Error("Unexpected versions:", res.PreviousVersion, res.NewVersion)
+	}
+	if res.TargetPath != path {
+		t.Error("Unexpected target path:", res.TargetPath)
+	}
+	if name := platformAssetName("foo", ".tar.gz"); res.AssetName != name || res.Release == nil || res.Release.AssetName != name {
+		t.Error("Unexpected asset name:", res.AssetName)
+	}
+	if res.Duration <= 0 {
+		t.Error("Duration should be measured:", res.Duration)
+	}
+
+	want := "updated from 1.2.0 to 1.2.3 at " + path + " using asset " + res.AssetName
+	if s := res.String(); s != want {
+		t.Errorf("Wanted %q but got %q", want, s)
+	}
+}
+
+func TestUpdateCommandWithResultUpToDate(t *testing.T) {
+	up, _ := detectFakeRelease(t, Config{}, nil)
+	path := setupOldExecutable(t)
+
+	res, err := up.UpdateCommandWithResult(path, semver.MustParse("1.2.3"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Updated {
+		t.Error("Executable should not be updated")
+	}
+	if !res.PreviousVersion.Equals(res.NewVersion) {
+		t.Error("Versions should be the same:", res.PreviousVersion, res.NewVersion)
+	}
+	if s := res.String(); s != "1.2.3 at "+path+" is up-to-date" {
+		t.Error("Unexpected summary:", s)
+	}
+
+	rel, err := up.UpdateCommand(path, semver.MustParse("1.2.3"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version.String() != "1.2.3" {
+		t.Error("UpdateCommand should return the latest release:", rel.Version)
+	}
+}
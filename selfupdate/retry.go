@@ -0,0 +1,143 @@
+package selfupdate
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries on retriable status codes when Config.MaxRetries is zero.
+	DefaultMaxRetries = 3
+	// DefaultRetryWait is the wait before the first retry when Config.RetryWait is zero. It is doubled on each retry.
+	DefaultRetryWait = time.Second
+)
+
+// DefaultRetryStatusCodes are the HTTP status codes of responses retried when Config.RetryStatusCodes is nil.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// maxRateLimitWaits is the maximum number of waits for secondary rate limits per request.
+const maxRateLimitWaits = 3
+
+// retryTransport retries requests whose responses have retriable status codes, with exponential backoff. Network
+// errors are returned as-is. Responses telling that the rate limit is exceeded are not retried since retrying does
+// not help until the rate limit is reset, except that secondary rate limits are waited for when waitRateLimit is set.
+type retryTransport struct {
+	base          http.RoundTripper
+	statuses      map[int]bool
+	maxRetries    int
+	wait          time.Duration
+	waitRateLimit bool
+}
+
+func newRetryTransport(base http.RoundTripper, c retryConfig) *retryTransport {
+	m := make(map[int]bool, len(c.statuses))
+	for _, s := range c.statuses {
+		m[s] = true
+	}
+
+	return &retryTransport{base: base, statuses: m, maxRetries: c.maxRetries, wait: c.wait, waitRateLimit: c.waitRateLimit}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	backoff := t.wait
+	retries, waits := 0, 0
+
+	for {
+		res, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var wait time.Duration
+
+		switch {
+		case t.waitRateLimit && waits < maxRateLimitWaits && t.secondaryRateLimited(res, &wait):
+			waits++
+			log.Printf("Waiting %s for secondary rate limit of GitHub before retrying %s %s\n", wait, req.Method, req.URL)
+		case retries < t.maxRetries && t.retriable(res):
+			wait = backoff
+			backoff *= 2
+			retries++
+			log.Printf("Retrying %s %s in %s since it responded with status %d (retry %d/%d)\n", req.Method, req.URL, wait, res.StatusCode, retries, t.maxRetries)
+		default:
+			return res, nil
+		}
+
+		// The request body was consumed by the previous attempt
+		if req.Body != nil && req.GetBody == nil {
+			return res, nil
+		}
+
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func (t *retryTransport) retriable(res *http.Response) bool {
+	return t.statuses[res.StatusCode] && rateLimitErrorFromResponse(res) == nil
+}
+
+func (t *retryTransport) secondaryRateLimited(res *http.Response, wait *time.Duration) bool {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+
+	d, ok := secondaryRateLimitWait(res.StatusCode, res.Header, peekBody(res))
+	*wait = d
+
+	return ok
+}
+
+// sleepContext waits for d. It returns the error of the context when the context is done before that.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// withRetryTransport returns a copy of the client retrying responses with the retriable status codes and waiting for
+// secondary rate limits. The client is returned as-is when neither is enabled.
+func withRetryTransport(c *http.Client, rc retryConfig) *http.Client {
+	if (rc.maxRetries <= 0 || len(rc.statuses) == 0) && !rc.waitRateLimit {
+		return c
+	}
+
+	wrapped := *c
+	wrapped.Transport = newRetryTransport(c.Transport, rc)
+
+	return &wrapped
+}
@@ -0,0 +1,116 @@
+package selfupdate
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingFirst responds with the statuses in order before delegating to the handler.
+func failingFirst(h http.Handler, statuses ...int) (http.Handler, *int32) {
+	var n int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		if i < len(statuses) {
+			if statuses[i] == http.StatusTooManyRequests {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+			}
+			w.WriteHeader(statuses[i])
+			return
+		}
+		h.ServeHTTP(w, r)
+	}), &n
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: platformAssetName("foo", ".zip"), content: []byte("foo")},
+	}})
+
+	for _, tc := range []struct {
+		what     string
+		config   Config
+		statuses []int
+		requests int32
+		wantErr  bool
+	}{
+		{"502 then 200", Config{}, []int{http.StatusBadGateway}, 2, false},
+		{"5xx until success", Config{}, []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusGatewayTimeout}, 4, false},
+		{"404 is not retried", Config{}, []int{http.StatusNotFound}, 1, true},
+		{"401 is not retried", Config{}, []int{http.StatusUnauthorized}, 1, true},
+		{"too many failures", Config{MaxRetries: 2}, []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, 3, true},
+		{"retries disabled", Config{MaxRetries: -1}, []int{http.StatusBadGateway}, 1, true},
+		{"custom status codes", Config{RetryStatusCodes: []int{http.StatusNotFound}}, []int{http.StatusNotFound}, 2, false},
+		{"custom status codes exclude 502", Config{RetryStatusCodes: []int{}}, []int{http.StatusBadGateway}, 1, true},
+		{"exhausted rate limit is not retried", Config{}, []int{http.StatusTooManyRequests}, 1, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			h, n := failingFirst(gh, tc.statuses...)
+			tc.config.RetryWait = time.Millisecond
+			up, _ := newTestUpdater(t, tc.config, h)
+
+			_, found, err := up.DetectLatest("owner/repo")
+			// The repository is not found on 404
+			if tc.wantErr && err == nil && found {
+				t.Fatal("error was not returned")
+			}
+			if !tc.wantErr && (err != nil || !found) {
+				t.Fatal("release was not detected:", err)
+			}
+			if got := atomic.LoadInt32(n); got != tc.requests {
+				t.Fatalf("wanted %d requests but got %d", tc.requests, got)
+			}
+		})
+	}
+}
+
+func TestRetryDownload(t *testing.T) {
+	exe := fakeExecutableContent(t, "new executable")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": exe})},
+	}})
+
+	var failed int32
+	gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+		if atomic.AddInt32(&failed, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return true
+		}
+		return false
+	}
+	up, _ := newTestUpdater(t, Config{RetryWait: time.Millisecond}, gh)
+
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := up.UpdateTo(rel, setupOldExecutable(t)); err != nil {
+		t.Fatal(err)
+	}
+	if failed != 2 {
+		t.Fatalf("asset should be downloaded twice but %d times", failed)
+	}
+}
+
+func TestRetryWaitIsCancelled(t *testing.T) {
+	h, _ := failingFirst(newFakeGitHub(), http.StatusBadGateway)
+	up, _ := newTestUpdater(t, Config{RetryWait: time.Hour}, h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	up.apiCtx = ctx
+
+	start := time.Now()
+	_, _, err := up.DetectLatest("owner/repo")
+	if err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Fatal("retry should be aborted by the context:", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("retry was not aborted promptly")
+	}
+}
@@ -0,0 +1,139 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// Scheduler checks periodically whether a release newer than the current version is available, with random jitter so
+// that many instances started at once do not check at the same time. Call Run in a goroutine to start it.
+type Scheduler struct {
+	// Updater detects the latest release as DetectLatest does. Its Config.RateLimiter gates the checks. DefaultUpdater()
+	// is used when it is nil
+	Updater *Updater
+	// Slug is the repository (owner/repo) to check
+	Slug string
+	// Current is the current version. OnUpdate is called with releases newer than it
+	Current semver.Version
+	// Interval is the average interval between checks. It must be positive
+	Interval time.Duration
+	// Jitter is the maximum random deviation of each interval. The first check is also delayed randomly up to Jitter
+	// instead of running at start. A tenth of Interval is used when it is zero, and it is disabled when it is negative
+	Jitter time.Duration
+	// OnUpdate is called with the latest release each time a version newer than Current and the versions already
+	// passed to it is detected
+	OnUpdate func(rel *Release)
+	// OnError is called with the error of each failed check. Optional. Failed checks are logged and retried at the
+	// next interval, or after the reset of the rate limit when GitHub responded that it is exceeded
+	OnError func(err error)
+}
+
+// jitter returns the maximum deviation of each interval. It is zero when Jitter is negative.
+func (s *Scheduler) jitter() time.Duration {
+	switch {
+	case s.Jitter == 0:
+		return s.Interval / 10
+	case s.Jitter < 0:
+		return 0
+	default:
+		return s.Jitter
+	}
+}
+
+// nextWait returns the interval until the next check, deviated from interval within jitter with random, which returns
+// a duration in [0, max).
+func nextWait(interval, jitter time.Duration, random func(max time.Duration) time.Duration) time.Duration {
+	wait := interval + random(2*jitter) - jitter
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+// Run checks updates until ctx is done, and then returns the error of ctx. An error is returned immediately when the
+// scheduler is not configured properly. Checks are run one by one in the calling goroutine.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.Interval <= 0 {
+		return fmt.Errorf("interval of scheduler must be positive but got %s", s.Interval)
+	}
+
+	if s.OnUpdate == nil {
+		return errors.New("OnUpdate of scheduler is not set")
+	}
+
+	if _, err := parseSlug(s.Slug); err != nil {
+		return err
+	}
+
+	up := s.Updater
+	if up == nil {
+		up = DefaultUpdater()
+	}
+
+	jitter := s.jitter()
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec // Jitter is not security sensitive
+	random := func(max time.Duration) time.Duration {
+		if max <= 0 {
+			return 0
+		}
+
+		return time.Duration(rnd.Int63n(int64(max)))
+	}
+
+	latest := s.Current
+	wait := random(jitter)
+
+	for {
+		log.Println("Next update check of", s.Slug, "in", wait)
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+
+		wait = nextWait(s.Interval, jitter, random)
+
+		rel, found, err := up.detectVersion(ctx, s.Slug, "", up.options())
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			log.Println("Update check of", s.Slug, "failed:", err)
+
+			var rl *RateLimitError
+			if errors.As(err, &rl) {
+				if until := time.Until(rl.Reset); until > wait {
+					wait = until + random(jitter)
+				}
+
+				if rl.RetryAfter > wait {
+					wait = rl.RetryAfter + random(jitter)
+				}
+			}
+
+			if s.OnError != nil {
+				s.OnError(err)
+			}
+
+			continue
+		}
+
+		if !found || !rel.Version.GT(latest) {
+			log.Println("No update of", s.Slug, "newer than", latest, "was found")
+
+			continue
+		}
+
+		log.Println("Update of", s.Slug, "was found:", rel.Version)
+
+		latest = rel.Version
+		s.OnUpdate(rel)
+	}
+}
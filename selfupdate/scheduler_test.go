@@ -0,0 +1,135 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func TestScheduler(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: []byte("foo")}}})
+
+	var mu sync.Mutex
+	fail := true
+	checks := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		checks++
+		f := fail
+		fail = false
+		mu.Unlock()
+		if f {
+			http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		gh.ServeHTTP(w, r)
+	})
+	up, _ := newTestUpdater(t, Config{}, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var updates []string
+	var errs []error
+	s := &Scheduler{
+		Updater:  up,
+		Slug:     "owner/repo",
+		Current:  semver.MustParse("1.2.2"),
+		Interval: 10 * time.Millisecond,
+		OnUpdate: func(rel *Release) {
+			updates = append(updates, rel.Version.String())
+		},
+		OnError: func(err error) {
+			errs = append(errs, err)
+		},
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := checks
+		mu.Unlock()
+		if n >= 4 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatal("Scheduler should stop when the context is cancelled:", err)
+	}
+	if len(errs) != 1 {
+		t.Error("Failed check should be reported once and retried:", errs)
+	}
+	if len(updates) != 1 || updates[0] != "1.2.3" {
+		t.Error("Update should be reported once per new version:", updates)
+	}
+}
+
+func TestSchedulerInvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		what  string
+		sched Scheduler
+		want  string
+	}{
+		{"no interval", Scheduler{Slug: "owner/repo", OnUpdate: func(*Release) {}}, "interval of scheduler must be positive"},
+		{"no callback", Scheduler{Slug: "owner/repo", Interval: time.Hour}, "OnUpdate of scheduler is not set"},
+		{"invalid slug", Scheduler{Slug: "repo", Interval: time.Hour, OnUpdate: func(*Release) {}}, "invalid slug"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := tc.sched.Run(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Wanted error %q but got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	lowest := func(max time.Duration) time.Duration { return 0 }
+	highest := func(max time.Duration) time.Duration {
+		if max <= 0 {
+			return 0
+		}
+		return max - 1
+	}
+
+	for _, tc := range []struct {
+		what       string
+		interval   time.Duration
+		jitter     time.Duration
+		wantJitter time.Duration
+		wantMin    time.Duration
+		wantMax    time.Duration
+	}{
+		{"zero", time.Minute, 0, 6 * time.Second, 54 * time.Second, 66*time.Second - 1},
+		{"negative", time.Minute, -10 * time.Second, 0, time.Minute, time.Minute},
+		{"positive", time.Minute, 10 * time.Second, 10 * time.Second, 50 * time.Second, 70*time.Second - 1},
+		{"larger than interval", time.Second, time.Minute, time.Minute, 0, 61*time.Second - 1},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			s := &Scheduler{Interval: tc.interval, Jitter: tc.jitter}
+			jitter := s.jitter()
+			if jitter != tc.wantJitter {
+				t.Fatal("Wanted jitter", tc.wantJitter, "but got", jitter)
+			}
+			if wait := nextWait(tc.interval, jitter, lowest); wait != tc.wantMin {
+				t.Error("Wanted shortest wait", tc.wantMin, "but got", wait)
+			}
+			if wait := nextWait(tc.interval, jitter, highest); wait != tc.wantMax {
+				t.Error("Wanted longest wait", tc.wantMax, "but got", wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+// Package selfupdatetest provides a fake GitHub serving releases from memory, so that update flows built on package
+// selfupdate can be unit-tested without the network or GitHub. The updater under test calls the fake as a GitHub
+// Enterprise API on the loopback interface, so all of detection, download and validation run as they do in
+// production. Failures such as missing repositories, exceeded rate limits and mismatched checksums can be simulated
+// to exercise the error paths.
+package selfupdatetest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ankorstore/go-selfupdate/selfupdate"
+	"github.com/google/go-github/v30/github"
+)
+
+// Asset is a file uploaded to a fake release.
+type Asset struct {
+	// Name is the file name of the asset such as 'foo_linux_amd64.tar.gz'
+	Name string
+	// Content is the content served on download
+	Content []byte
+}
+
+// Release is a fake release of a repository.
+type Release struct {
+	// Tag is the tag name of the release such as 'v1.2.3'
+	Tag string
+	// Name is the name of the release. It is empty when not set
+	Name string
+	// Body is the release notes of the release
+	Body string
+	// PreRelease marks the release as a pre-release
+	PreRelease bool
+	// Draft marks the release as a draft
+	Draft bool
+	// PublishedAt is the time when the release was published. An hour after the previous release of the repository
+	// is used when zero, so that releases added later are newer
+	PublishedAt time.Time
+	// Assets are the files uploaded to the release
+	Assets []Asset
+}
+
+// Server is a fake GitHub serving the releases added to it. Create it with NewServer and close it with Close.
+type Server struct {
+	// URL is the base URL of the server such as 'http://127.0.0.1:1234'
+	URL string
+
+	ts        *httptest.Server
+	mu        sync.Mutex
+	releases  map[string][]Release
+	requests  []string
+	status    int
+	rateReset time.Time
+}
+
+// NewServer starts a fake GitHub with no repository.
+func NewServer() *Server {
+	s := &Server{releases: map[string][]Release{}}
+	s.ts = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.ts.URL
+
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// AddRelease adds the release to the repository 'owner/name', which is created on the first release added to it.
+// Repositories without releases are not found.
+func (s *Server) AddRelease(slug string, rel Release) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rel.PublishedAt.IsZero() {
+		rel.PublishedAt = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(len(s.releases[slug])) * time.Hour)
+	}
+
+	s.releases[slug] = append(s.releases[slug], rel)
+}
+
+// Config returns the configuration of an updater calling the server, based on config. EnterpriseBaseURL is set to the
+// server, and APIToken and RetryWait are set when empty so that releases are downloaded via the API and simulated
+// server errors are retried without waiting.
+func (s *Server) Config(config selfupdate.Config) selfupdate.Config {
+	config.EnterpriseBaseURL = s.URL + "/api/v3/"
+	config.EnterpriseUploadURL = ""
+
+	if config.APIToken == "" {
+		config.APIToken = "selfupdatetest-token"
+	}
+
+	if config.RetryWait == 0 {
+		config.RetryWait = time.Millisecond
+	}
+
+	return config
+}
+
+// NewUpdater creates an updater calling the server with config. See Config.
+func (s *Server) NewUpdater(config selfupdate.Config) (*selfupdate.Updater, error) {
+	return selfupdate.NewUpdater(s.Config(config))
+}
+
+// FailWithStatus makes the server respond to all requests with the status such as http.StatusNotFound or
+// http.StatusInternalServerError until ClearFailure is called.
+func (s *Server) FailWithStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status, s.rateReset = status, time.Time{}
+}
+
+// FailWithRateLimit makes the server respond to all requests that the rate limit is exceeded until reset, or until
+// ClearFailure is called. The error of the updater matches *selfupdate.RateLimitError. Note that updaters do not send
+// requests until reset once they got the response, so create a new one to see the server recovered.
+func (s *Server) FailWithRateLimit(reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status, s.rateReset = 0, reset
+}
+
+// ClearFailure makes the server respond normally again.
+func (s *Server) ClearFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status, s.rateReset = 0, time.Time{}
+}
+
+// Requests returns the requests received by the server as their methods and paths such as
+// 'GET /api/v3/repos/owner/repo/releases'.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+// SHA256Asset returns the validation file of the asset for selfupdate.SHA2Validator, named '<name>.sha256'.
+func SHA256Asset(asset Asset) Asset {
+	return Asset{Name: asset.Name + ".sha256", Content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset.Content)))}
+}
+
+// MismatchedSHA256Asset returns the validation file of the asset for selfupdate.SHA2Validator with the hash of other
+// content, so that the validation of the asset fails.
+func MismatchedSHA256Asset(asset Asset) Asset {
+	other := append([]byte("mismatched "), asset.Content...)
+
+	return Asset{Name: asset.Name + ".sha256", Content: []byte(fmt.Sprintf("%x", sha256.Sum256(other)))}
+}
+
+// Executable returns content which updaters accept as an executable for goos such as runtime.GOOS: body following the
+// magic number of the executable format of the OS. It cannot be run, and Config.CheckExecutablePlatform and smoke tests
+// reject it.
+func Executable(goos string, body []byte) []byte {
+	var magic []byte
+
+	switch goos {
+	case "windows":
+		magic = []byte{'M', 'Z'}
+	case "darwin", "ios":
+		magic = []byte{0xcf, 0xfa, 0xed, 0xfe}
+	case "js", "wasip1":
+		magic = []byte{0x00, 'a', 's', 'm'}
+	default:
+		magic = []byte{0x7f, 'E', 'L', 'F'}
+	}
+
+	return append(magic, body...)
+}
+
+// AssetName returns the name of the asset of the command for the platform such as 'foo_linux_amd64.tar.gz', which
+// updaters detect for the platform.
+func AssetName(cmd, goos, goarch, ext string) string {
+	return fmt.Sprintf("%s_%s_%s%s", cmd, goos, goarch, ext)
+}
+
+// assetID returns the ID of the asset. IDs are unique across repositories.
+func assetID(slug string, rel, asset int) int64 {
+	var h int64
+	for _, c := range slug {
+		h = (h*31 + int64(c)) % 100000
+	}
+
+	return h*1000000 + int64(rel)*1000 + int64(asset) + 1
+}
+
+// apiReleases returns the releases of the repository as GitHub API does, the newest release first.
+func (s *Server) apiReleases(slug string) []*github.RepositoryRelease {
+	rels := s.releases[slug]
+	apiRels := make([]*github.RepositoryRelease, 0, len(rels))
+
+	for i := len(rels) - 1; i >= 0; i-- {
+		rel := rels[i]
+		r := &github.RepositoryRelease{
+			ID:          github.Int64(int64(i + 1)),
+			TagName:     github.String(rel.Tag),
+			Name:        github.String(rel.Name),
+			Body:        github.String(rel.Body),
+			Draft:       github.Bool(rel.Draft),
+			Prerelease:  github.Bool(rel.PreRelease),
+			PublishedAt: &github.Timestamp{Time: rel.PublishedAt},
+			HTMLURL:     github.String(fmt.Sprintf("%s/%s/releases/tag/%s", s.URL, slug, rel.Tag)),
+		}
+
+		for j, a := range rel.Assets {
+			id := assetID(slug, i, j)
+			r.Assets = append(r.Assets, &github.ReleaseAsset{
+				ID:                 github.Int64(id),
+				Name:               github.String(a.Name),
+				Size:               github.Int(len(a.Content)),
+				ContentType:        github.String("application/octet-stream"),
+				URL:                github.String(fmt.Sprintf("%s/api/v3/repos/%s/releases/assets/%d", s.URL, slug, id)),
+				BrowserDownloadURL: github.String(fmt.Sprintf("%s/%s/releases/download/%s/%s", s.URL, slug, rel.Tag, a.Name)),
+			})
+		}
+
+		apiRels = append(apiRels, r)
+	}
+
+	return apiRels
+}
+
+func (s *Server) findAsset(slug string, match func(rel Release, id int64, a Asset) bool) (Asset, bool) {
+	for i, rel := range s.releases[slug] {
+		for j, a := range rel.Assets {
+			if match(rel, assetID(slug, i, j), a) {
+				return a, true
+			}
+		}
+	}
+
+	return Asset{}, false
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if !s.rateReset.IsZero() && time.Now().Before(s.rateReset) {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(selfupdate.GitHubAuthenticatedRateLimit))
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(s.rateReset.Unix(), 10))
+		writeError(w, http.StatusForbidden, "API rate limit exceeded for selfupdatetest")
+
+		return
+	}
+
+	if s.status != 0 {
+		writeError(w, s.status, http.StatusText(s.status))
+
+		return
+	}
+
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// /{owner}/{repo}/releases/download/{tag}/{name}
+	if len(p) == 6 && p[2] == "releases" && p[3] == "download" {
+		a, ok := s.findAsset(p[0]+"/"+p[1], func(rel Release, _ int64, a Asset) bool { return rel.Tag == p[4] && a.Name == p[5] })
+		if ok {
+			writeAsset(w, a)
+
+			return
+		}
+	}
+
+	// /api/v3/repos/{owner}/{repo}/releases...
+	if len(p) < 6 || p[0] != "api" || p[1] != "v3" || p[2] != "repos" || p[5] != "releases" {
+		writeError(w, http.StatusNotFound, "Not Found")
+
+		return
+	}
+
+	slug := p[3] + "/" + p[4]
+	if _, ok := s.releases[slug]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+
+		return
+	}
+
+	s.serveReleases(w, r, slug, p[6:])
+}
+
+// serveReleases serves the endpoints under /repos/{owner}/{repo}/releases of the repository.
+func (s *Server) serveReleases(w http.ResponseWriter, r *http.Request, slug string, p []string) {
+	rels := s.apiReleases(slug)
+
+	switch {
+	case len(p) == 0:
+		// All releases are in the first page
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			rels = nil
+		}
+
+		writeJSON(w, rels)
+
+		return
+	case len(p) == 1 && p[0] == "latest":
+		for _, rel := range rels {
+			if !rel.GetDraft() && !rel.GetPrerelease() {
+				writeJSON(w, rel)
+
+				return
+			}
+		}
+	case len(p) == 2 && p[0] == "tags":
+		for _, rel := range rels {
+			if rel.GetTagName() == p[1] {
+				writeJSON(w, rel)
+
+				return
+			}
+		}
+	case len(p) == 2 && p[0] == "assets":
+		id, _ := strconv.ParseInt(p[1], 10, 64)
+
+		a, ok := s.findAsset(slug, func(_ Release, aid int64, _ Asset) bool { return aid == id })
+		if !ok {
+			break
+		}
+
+		// The asset endpoint returns the metadata of the asset unless the binary is requested
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			writeJSON(w, &github.ReleaseAsset{ID: github.Int64(id), Name: github.String(a.Name), Size: github.Int(len(a.Content))})
+
+			return
+		}
+
+		writeAsset(w, a)
+
+		return
+	case len(p) == 1:
+		id, _ := strconv.ParseInt(p[0], 10, 64)
+		for _, rel := range rels {
+			if rel.GetID() == id {
+				writeJSON(w, rel)
+
+				return
+			}
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func writeAsset(w http.ResponseWriter, a Asset) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Content)))
+	_, _ = w.Write(a.Content)
+}
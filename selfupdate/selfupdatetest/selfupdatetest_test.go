@@ -0,0 +1,169 @@
+package selfupdatetest
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ankorstore/go-selfupdate/selfupdate"
+	"github.com/blang/semver"
+)
+
+func setupServer(t *testing.T) (*Server, Asset) {
+	s := NewServer()
+	t.Cleanup(s.Close)
+
+	exe := Asset{Name: AssetName("foo", runtime.GOOS, runtime.GOARCH, ""), Content: Executable(runtime.GOOS, []byte("v1.2.3"))}
+	old := Asset{Name: exe.Name, Content: Executable(runtime.GOOS, []byte("v1.2.2"))}
+	s.AddRelease("owner/repo", Release{Tag: "v1.2.2", Assets: []Asset{old, SHA256Asset(old)}})
+	s.AddRelease("owner/repo", Release{Tag: "v1.2.3", Body: "Bug fixes", Assets: []Asset{exe, SHA256Asset(exe)}})
+	s.AddRelease("owner/repo", Release{Tag: "v1.3.0-beta.1", PreRelease: true})
+
+	return s, exe
+}
+
+func setupExecutable(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "foo")
+	if err := ioutil.WriteFile(path, []byte("old executable"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServerUpdate(t *testing.T) {
+	s, exe := setupServer(t)
+	up, err := s.NewUpdater(selfupdate.Config{Validator: &selfupdate.SHA2Validator{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || rel.Version.String() != "1.2.3" || rel.ReleaseNotes != "Bug fixes" {
+		t.Fatal("Latest release was not detected:", rel)
+	}
+
+	rel, ok, err = up.DetectVersion("owner/repo", "v1.2.2")
+	if err != nil || !ok || rel.Version.String() != "1.2.2" {
+		t.Fatal("Specified release was not detected:", rel, err)
+	}
+
+	path := setupExecutable(t)
+	res, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version.String() != "1.2.3" {
+		t.Fatal("Wanted update to 1.2.3 but got", res.Version)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exe.Content) {
+		t.Fatalf("Executable was not updated: %q", b)
+	}
+
+	for _, r := range s.Requests() {
+		if !strings.HasPrefix(r, "GET /api/v3/repos/owner/repo/releases") {
+			t.Error("Unexpected request:", r)
+		}
+	}
+}
+
+func TestServerFailures(t *testing.T) {
+	for _, tc := range []struct {
+		what  string
+		setup func(s *Server)
+		slug  string
+		check func(err error) bool
+	}{
+		{
+			"repository not found",
+			func(s *Server) {},
+			"owner/unknown",
+			func(err error) bool { return errors.Is(err, selfupdate.ErrNoReleaseFound) },
+		},
+		{
+			"status",
+			func(s *Server) { s.FailWithStatus(http.StatusNotFound) },
+			"owner/repo",
+			func(err error) bool { return errors.Is(err, selfupdate.ErrNoReleaseFound) },
+		},
+		{
+			"server error",
+			func(s *Server) { s.FailWithStatus(http.StatusBadGateway) },
+			"owner/repo",
+			func(err error) bool { return err != nil && strings.Contains(err.Error(), "502") },
+		},
+		{
+			"rate limited",
+			func(s *Server) { s.FailWithRateLimit(time.Now().Add(time.Hour)) },
+			"owner/repo",
+			func(err error) bool {
+				var rl *selfupdate.RateLimitError
+				return errors.As(err, &rl) && rl.Remaining == 0 && rl.Limit == selfupdate.GitHubAuthenticatedRateLimit
+			},
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			s, _ := setupServer(t)
+			tc.setup(s)
+			up, err := s.NewUpdater(selfupdate.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = up.FindRelease(tc.slug, "")
+			if !tc.check(err) {
+				t.Fatal("Unexpected error:", err)
+			}
+
+			s.ClearFailure()
+			if tc.slug != "owner/repo" {
+				return
+			}
+			up, err = s.NewUpdater(selfupdate.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := up.FindRelease(tc.slug, ""); err != nil {
+				t.Fatal("Server did not recover from the failure:", err)
+			}
+		})
+	}
+}
+
+func TestServerChecksumMismatch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	exe := Asset{Name: AssetName("foo", runtime.GOOS, runtime.GOARCH, ""), Content: Executable(runtime.GOOS, []byte("v1.2.3"))}
+	s.AddRelease("owner/repo", Release{Tag: "v1.2.3", Assets: []Asset{exe, MismatchedSHA256Asset(exe)}})
+
+	up, err := s.NewUpdater(selfupdate.Config{Validator: &selfupdate.SHA2Validator{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := setupExecutable(t)
+	_, err = up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+	if !errors.Is(err, selfupdate.ErrValidationFailed) {
+		t.Fatal("Wanted ErrValidationFailed but got", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Executable should not be updated: %q", b)
+	}
+}
@@ -0,0 +1,231 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// SigstoreValidator validates a release asset with the sigstore bundle uploaded along with it, such as the one created
+// by `cosign sign-blob --bundle foo.zip.sigstore foo.zip` in CI. The bundle contains the signing certificate,
+// the signature of the asset and the entry of the transparency log. It is verified offline without querying Rekor:
+//
+// - The signing certificate chains to Roots and was valid when the entry was integrated in the transparency log, as
+// the signed entry timestamp of any of RekorPublicKeys promises
+// - The certificate was issued to CertificateIdentity by OIDCIssuer unless AllowAnyIdentity is set
+// - The asset is signed by the certificate
+// - The entry of the transparency log matches the signature and is included in the log of any of RekorPublicKeys
+type SigstoreValidator struct {
+	// Roots are the trusted root certificates of the certificate authority (Fulcio) issuing signing certificates.
+	Roots *x509.CertPool
+	// Intermediates are the intermediate certificates of the certificate authority. Certificates in bundles are
+	// also used.
+	Intermediates *x509.CertPool
+	// RekorPublicKeys are the public keys of the transparency logs (Rekor) which sign their checkpoints. A checkpoint
+	// signed by any of them is accepted since the log is sharded with a key per shard.
+	RekorPublicKeys []crypto.PublicKey
+	// CertificateIdentity is a regular expression matched with the subject alternative name of the signing
+	// certificate, e.g. `^https://github\.com/owner/repo/\.github/workflows/release\.yml@refs/tags/`. It must be set
+	// unless AllowAnyIdentity is set.
+	CertificateIdentity string
+	// OIDCIssuer is the expected issuer of the identity such as GitHubActionsOIDCIssuer. It must be set unless
+	// AllowAnyIdentity is set.
+	OIDCIssuer string
+	// AllowAnyIdentity accepts certificates issued to any identity by any issuer when CertificateIdentity and
+	// OIDCIssuer are empty. This is only safe with a private certificate authority since the public one issues
+	// certificates to anyone.
+	AllowAnyIdentity bool
+}
+
+// SigstoreValidatorFromTrustedRoot creates a SigstoreValidator trusting the certificate authorities and
+// the transparency logs in the trusted root of sigstore. data is in the format of 'trusted_root.json' published in
+// https://github.com/sigstore/root-signing and accepted by `cosign verify-blob --trusted-root`. Set
+// CertificateIdentity and OIDCIssuer of the returned validator to restrict the signer, which is required.
+func SigstoreValidatorFromTrustedRoot(data []byte) (*SigstoreValidator, error) {
+	var root struct {
+		Tlogs []struct {
+			PublicKey sigstoreRawBytes `json:"publicKey"`
+		} `json:"tlogs"`
+		CertificateAuthorities []struct {
+			CertChain struct {
+				Certificates []sigstoreRawBytes `json:"certificates"`
+			} `json:"certChain"`
+		} `json:"certificateAuthorities"`
+	}
+
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("sigstore: failed to parse trusted root: %w", err)
+	}
+
+	v := &SigstoreValidator{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool()}
+	roots := 0
+
+	for _, ca := range root.CertificateAuthorities {
+		// The chain is ordered from the intermediates to the root
+		certs := ca.CertChain.Certificates
+		for i, c := range certs {
+			cert, err := x509.ParseCertificate(c.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("sigstore: failed to parse certificate of certificate authority in trusted root: %w", err)
+			}
+
+			if i == len(certs)-1 {
+				v.Roots.AddCert(cert)
+				roots++
+			} else {
+				v.Intermediates.AddCert(cert)
+			}
+		}
+	}
+
+	for _, tlog := range root.Tlogs {
+		key, err := x509.ParsePKIXPublicKey(tlog.PublicKey.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("sigstore: failed to parse public key of transparency log in trusted root: %w", err)
+		}
+
+		v.RekorPublicKeys = append(v.RekorPublicKeys, key)
+	}
+
+	if roots == 0 {
+		return nil, fmt.Errorf("sigstore: no certificate authority is found in trusted root")
+	}
+
+	if len(v.RekorPublicKeys) == 0 {
+		return nil, fmt.Errorf("sigstore: no transparency log is found in trusted root")
+	}
+
+	return v, nil
+}
+
+// SigstoreValidatorFromTrustedRootFile creates a SigstoreValidator from the trusted root of sigstore in the file at
+// path. See SigstoreValidatorFromTrustedRoot.
+func SigstoreValidatorFromTrustedRootFile(path string) (*SigstoreValidator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("sigstore: failed to read trusted root: %w", err)
+	}
+
+	return SigstoreValidatorFromTrustedRoot(data)
+}
+
+// Suffix returns the suffix of the sigstore bundle file.
+func (v *SigstoreValidator) Suffix() string {
+	return ".sigstore"
+}
+
+// GetValidationAssetNames returns the names of the sigstore bundle file. '.sigstore.json', which newer versions of
+// cosign recommend, is also tried after the suffix.
+func (v *SigstoreValidator) GetValidationAssetNames(filename string) []string {
+	return []string{filename + v.Suffix(), filename + ".sigstore.json"}
+}
+
+// Validate validates the release with the sigstore bundle in asset. Only bundles which sign the asset directly
+// (messageSignature) are accepted. Use AttestationValidator for bundles with a DSSE envelope.
+func (v *SigstoreValidator) Validate(release, asset []byte) error {
+	var bundle sigstoreBundle
+	if err := json.Unmarshal(asset, &bundle); err != nil {
+		return fmt.Errorf("sigstore: failed to parse bundle: %w", err)
+	}
+
+	if err := v.verifyBundle(&bundle, release); err != nil {
+		return fmt.Errorf("sigstore: validation failed: %w", err)
+	}
+
+	return nil
+}
+
+func (v *SigstoreValidator) verifyBundle(b *sigstoreBundle, release []byte) error {
+	msg := b.MessageSignature
+	if msg == nil || len(msg.Signature) == 0 {
+		if b.DSSEEnvelope != nil {
+			return fmt.Errorf("bundle with DSSE envelope is not supported. Use AttestationValidator to verify it")
+		}
+
+		return fmt.Errorf("bundle has no message signature")
+	}
+
+	digest := sha256.Sum256(release)
+
+	// The digest is optional in the bundle, but it must be of the asset when present
+	if len(msg.MessageDigest.Digest) > 0 {
+		if msg.MessageDigest.Algorithm != "SHA2_256" {
+			return fmt.Errorf("unsupported algorithm %q of message digest", msg.MessageDigest.Algorithm)
+		}
+
+		if !bytes.Equal(msg.MessageDigest.Digest, digest[:]) {
+			return fmt.Errorf("message digest %x of bundle does not match sha256 digest %x of asset", msg.MessageDigest.Digest, digest)
+		}
+	}
+
+	if !v.AllowAnyIdentity && (v.CertificateIdentity == "" || v.OIDCIssuer == "") {
+		return fmt.Errorf("CertificateIdentity and OIDCIssuer must be set unless AllowAnyIdentity is set")
+	}
+
+	leaf, entry, err := verifyBundleCertificate(b, v.Roots, v.Intermediates, v.RekorPublicKeys)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyCertificateIdentity(leaf, v.CertificateIdentity, v.OIDCIssuer); err != nil {
+		return err
+	}
+
+	if err := verifyWithCertificate(leaf, release, msg.Signature); err != nil {
+		return fmt.Errorf("failed to verify signature of asset: %w", err)
+	}
+
+	if err := verifyHashedRekord(entry, digest[:], msg.Signature, leaf); err != nil {
+		return err
+	}
+
+	return verifyTlogInclusion(entry, v.RekorPublicKeys)
+}
+
+// verifyHashedRekord verifies that the 'hashedrekord' entry of the transparency log is the one for the signature of
+// the digest made by the certificate.
+func verifyHashedRekord(entry *sigstoreTlogEntry, digest, sig []byte, cert *x509.Certificate) error {
+	if entry.KindVersion.Kind != "hashedrekord" {
+		return fmt.Errorf("unsupported kind %q of transparency log entry", entry.KindVersion.Kind)
+	}
+
+	var body struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+		} `json:"spec"`
+	}
+
+	if err := json.Unmarshal(entry.CanonicalizedBody, &body); err != nil {
+		return fmt.Errorf("failed to parse transparency log entry: %w", err)
+	}
+
+	hash := body.Spec.Data.Hash
+	if body.Kind != "hashedrekord" || hash.Algorithm != "sha256" || hash.Value != hex.EncodeToString(digest) {
+		return fmt.Errorf("transparency log entry does not match the digest of asset")
+	}
+
+	block, _ := pem.Decode(body.Spec.Signature.PublicKey.Content)
+	if !bytes.Equal(body.Spec.Signature.Content, sig) || block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+		return fmt.Errorf("transparency log entry does not match the signature of bundle")
+	}
+
+	return nil
+}
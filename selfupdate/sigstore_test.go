@@ -0,0 +1,246 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+func (s *fakeSigstore) sigstoreValidator() *SigstoreValidator {
+	return &SigstoreValidator{
+		Roots:               s.roots,
+		RekorPublicKeys:     []crypto.PublicKey{&s.rekorKey.PublicKey},
+		CertificateIdentity: `^https://github\.com/owner/repo/\.github/workflows/release\.yml@`,
+		OIDCIssuer:          GitHubActionsOIDCIssuer,
+	}
+}
+
+// sign returns a sigstore bundle with the signature of the content as created by `cosign sign-blob --bundle`.
+func (s *fakeSigstore) sign(t *testing.T, content []byte, identity, issuer string) []byte {
+	key, der := s.issue(t, identity, issuer)
+	sig := signTest(t, key, content)
+	digest := sha256.Sum256(content)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"data": map[string]interface{}{
+				"hash": map[string]string{"algorithm": "sha256", "value": fmt.Sprintf("%x", digest)},
+			},
+			"signature": map[string]interface{}{
+				"content":   sig,
+				"publicKey": map[string][]byte{"content": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{
+			"certificate": map[string][]byte{"rawBytes": der},
+			"tlogEntries": []map[string]interface{}{s.logEntry(t, "hashedrekord", body)},
+		},
+		"messageSignature": map[string]interface{}{
+			"messageDigest": map[string]interface{}{"algorithm": "SHA2_256", "digest": digest[:]},
+			"signature":     sig,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSigstoreValidator(t *testing.T) {
+	s := newFakeSigstore(t)
+	content := []byte("release asset")
+	bundle := s.sign(t, content, testAttestationIdentity, GitHubActionsOIDCIssuer)
+
+	if err := s.sigstoreValidator().Validate(content, bundle); err != nil {
+		t.Fatal("bundle was not verified:", err)
+	}
+
+	v := s.sigstoreValidator()
+	v.CertificateIdentity = ""
+	v.OIDCIssuer = ""
+	v.AllowAnyIdentity = true
+	if err := v.Validate(content, s.sign(t, content, "https://example.com/ci", "https://issuer.example.com")); err != nil {
+		t.Fatal("identity should not be checked with AllowAnyIdentity:", err)
+	}
+
+	if names := v.GetValidationAssetNames("foo.zip"); names[0] != "foo.zip.sigstore" {
+		t.Fatal("unexpected validation asset names:", names)
+	}
+}
+
+func TestSigstoreValidatorFail(t *testing.T) {
+	s := newFakeSigstore(t)
+	content := []byte("release asset")
+	bundle := s.sign(t, content, testAttestationIdentity, GitHubActionsOIDCIssuer)
+
+	otherIssuer := s.sigstoreValidator()
+	otherIssuer.OIDCIssuer = "https://issuer.example.com"
+	otherRekor := s.sigstoreValidator()
+	otherRekor.RekorPublicKeys = []crypto.PublicKey{&s.caKey.PublicKey}
+	untrusted := s.sigstoreValidator()
+	untrusted.Roots = x509.NewCertPool()
+	noIdentity := s.sigstoreValidator()
+	noIdentity.CertificateIdentity = ""
+	noIssuer := s.sigstoreValidator()
+	noIssuer.OIDCIssuer = ""
+
+	// The signature of other content is put in the bundle for the content
+	var tampered map[string]interface{}
+	if err := json.Unmarshal(bundle, &tampered); err != nil {
+		t.Fatal(err)
+	}
+	var other map[string]interface{}
+	if err := json.Unmarshal(s.sign(t, []byte("malicious"), testAttestationIdentity, GitHubActionsOIDCIssuer), &other); err != nil {
+		t.Fatal(err)
+	}
+	tampered["messageSignature"].(map[string]interface{})["signature"] = other["messageSignature"].(map[string]interface{})["signature"]
+	tamperedSig, err := json.Marshal(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedTime := tamperTlogEntry(t, bundle, func(entry map[string]interface{}) {
+		entry["integratedTime"] = fmt.Sprint(time.Now().Add(-30 * time.Second).Unix())
+	})
+	noPromise := tamperTlogEntry(t, bundle, func(entry map[string]interface{}) { delete(entry, "inclusionPromise") })
+
+	for _, tc := range []struct {
+		what      string
+		validator *SigstoreValidator
+		content   []byte
+		asset     []byte
+		want      string
+	}{
+		{"other content", s.sigstoreValidator(), []byte("malicious"), bundle, "does not match sha256 digest"},
+		{"other identity", s.sigstoreValidator(), content, s.sign(t, content, "https://github.com/evil/repo/.github/workflows/release.yml@refs/tags/v1.2.3", GitHubActionsOIDCIssuer), "does not match"},
+		{"other issuer", otherIssuer, content, bundle, "OIDC issuer"},
+		{"no identity", noIdentity, content, bundle, "must be set unless AllowAnyIdentity"},
+		{"no issuer", noIssuer, content, bundle, "must be set unless AllowAnyIdentity"},
+		{"other transparency log", otherRekor, content, bundle, "signed entry timestamp"},
+		{"untrusted certificate", untrusted, content, bundle, "failed to verify signing certificate"},
+		{"tampered signature", s.sigstoreValidator(), content, tamperedSig, "failed to verify signature of asset"},
+		{"tampered integrated time", s.sigstoreValidator(), content, tamperedTime, "signed entry timestamp of transparency log entry cannot be verified"},
+		{"no signed entry timestamp", s.sigstoreValidator(), content, noPromise, "has no signed entry timestamp"},
+		{"DSSE envelope", s.sigstoreValidator(), content, s.attest(t, content, testAttestationIdentity, GitHubActionsOIDCIssuer), "Use AttestationValidator"},
+		{"broken bundle", s.sigstoreValidator(), content, []byte("{"), "failed to parse bundle"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := tc.validator.Validate(tc.content, tc.asset)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Wanted error %q but got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestSigstoreValidatorFromTrustedRoot(t *testing.T) {
+	s := newFakeSigstore(t)
+	rekor, err := x509.MarshalPKIXPublicKey(&s.rekorKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := json.Marshal(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		"tlogs": []map[string]interface{}{{
+			"baseUrl":   "https://rekor.example.com",
+			"publicKey": map[string]interface{}{"rawBytes": rekor, "keyDetails": "PKIX_ECDSA_P256_SHA_256"},
+		}},
+		"certificateAuthorities": []map[string]interface{}{{
+			"uri":       "https://fulcio.example.com",
+			"certChain": map[string]interface{}{"certificates": []map[string][]byte{{"rawBytes": s.ca.Raw}}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trusted_root.json")
+	if err := ioutil.WriteFile(path, root, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := SigstoreValidatorFromTrustedRootFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.CertificateIdentity = `^https://github\.com/owner/repo/`
+	v.OIDCIssuer = GitHubActionsOIDCIssuer
+	content := []byte("release asset")
+	if err := v.Validate(content, s.sign(t, content, testAttestationIdentity, GitHubActionsOIDCIssuer)); err != nil {
+		t.Fatal("bundle was not verified with trusted root:", err)
+	}
+
+	for _, data := range []string{"{", `{"tlogs":[]}`, `{"certificateAuthorities":[{"certChain":{"certificates":[{"rawBytes":"AAAA"}]}}]}`} {
+		if _, err := SigstoreValidatorFromTrustedRoot([]byte(data)); err == nil {
+			t.Errorf("invalid trusted root %s should be rejected", data)
+		}
+	}
+}
+
+func TestUpdateWithSigstoreValidator(t *testing.T) {
+	s := newFakeSigstore(t)
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what    string
+		bundle  string
+		signed  []byte
+		wantErr bool
+	}{
+		{"signed", name + ".sigstore", asset, false},
+		{"signed with .sigstore.json", name + ".sigstore.json", asset, false},
+		{"signature of other asset", name + ".sigstore", []byte("other asset"), true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+				{name: name, content: asset},
+				{name: tc.bundle, content: s.sign(t, tc.signed, testAttestationIdentity, GitHubActionsOIDCIssuer)},
+			}})
+			up, _ := newTestUpdater(t, Config{Validator: s.sigstoreValidator()}, gh)
+
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("error was not returned")
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// smokeTestTimeout is how long the new executable may run on SmokeTestVersion.
+const smokeTestTimeout = 30 * time.Second
+
+// SmokeTestVersion runs the new executable at newBinaryPath with args, or '--version' when no argument is given, and
+// checks that it exits with 0 and prints the expected version to its standard output or error, e.g. 'foo 1.2.3' or
+// 'foo version v1.2.3 (abcdef)'. The executable is killed when it does not exit within 30 seconds. See
+// Config.SmokeTestArgs to run it on updates.
+func SmokeTestVersion(newBinaryPath string, expected semver.Version, args ...string) error {
+	out, err := runVersionCommand(newBinaryPath, args)
+	if err != nil {
+		return err
+	}
+
+	if !outputHasVersion(out, expected) {
+		return fmt.Errorf("output of %s %s does not report version %s: %q", newBinaryPath, strings.Join(versionArgs(args), " "), expected, out)
+	}
+
+	log.Println("Smoke test of new executable", newBinaryPath, "passed with version", expected)
+
+	return nil
+}
+
+// CommandVersion returns a function for Config.CurrentVersionFunc which runs the executable with args, or '--version'
+// when no argument is given, and reads the first version in its standard output or error, e.g. '1.2.3' of
+// 'foo version v1.2.3 (abcdef)'. The function fails when the executable does not exit with 0 within 30 seconds or
+// prints no version.
+func CommandVersion(args ...string) func(binaryPath string) (semver.Version, error) {
+	return func(binaryPath string) (semver.Version, error) {
+		out, err := runVersionCommand(binaryPath, args)
+		if err != nil {
+			return semver.Version{}, err
+		}
+
+		for _, w := range outputWords(out) {
+			if v, err := semver.Parse(strings.TrimPrefix(w, "v")); err == nil {
+				return v, nil
+			}
+		}
+
+		return semver.Version{}, fmt.Errorf("output of %s %s does not report any version: %q", binaryPath, strings.Join(versionArgs(args), " "), out)
+	}
+}
+
+func versionArgs(args []string) []string {
+	if len(args) == 0 {
+		return []string{"--version"}
+	}
+
+	return args
+}
+
+// runVersionCommand runs the executable with args or '--version', and returns its standard output and error.
+func runVersionCommand(path string, args []string) (string, error) {
+	args = versionArgs(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), smokeTestTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run %s %s: %w: %q", path, strings.Join(args, " "), err, out.Bytes())
+	}
+
+	return out.String(), nil
+}
+
+func outputWords(out string) []string {
+	return strings.FieldsFunc(out, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ',' || r == '(' || r == ')' || r == '"' || r == '\''
+	})
+}
+
+// outputHasVersion returns true when any word of the output is the version with or without 'v' prefix.
+func outputHasVersion(out string, expected semver.Version) bool {
+	for _, w := range outputWords(out) {
+		v, err := semver.Parse(strings.TrimPrefix(w, "v"))
+		if err == nil && v.Equals(expected) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyHooks returns the hooks applying the executable of the release with Config.SmokeTest, Config.SmokeTestArgs,
+// Config.CommitFunc, Config.FileMode, Config.VerifyInstalled and Config.SkipExecutableCheck.
+func (up *Updater) applyHooks(rel *Release) applyHooks {
+	hooks := applyHooks{commit: up.commit, mode: up.fileMode, verify: up.verifyInst, skipCheck: up.skipExeCheck}
+
+	if up.smokeTest == nil && up.smokeArgs == nil {
+		return hooks
+	}
+
+	hooks.smokeTest = func(newBinaryPath string) error {
+		if up.smokeArgs != nil {
+			if err := SmokeTestVersion(newBinaryPath, rel.Version, up.smokeArgs...); err != nil {
+				return err
+			}
+		}
+
+		if up.smokeTest != nil {
+			return up.smokeTest(newBinaryPath)
+		}
+
+		return nil
+	}
+
+	return hooks
+}
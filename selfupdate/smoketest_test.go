@@ -0,0 +1,234 @@
+package selfupdate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+// TestSmokeTestHelperProcess is run as the new executable by smoke tests. It prints $SMOKE_TEST_OUTPUT and exits with
+// $SMOKE_TEST_EXIT.
+func TestSmokeTestHelperProcess(t *testing.T) {
+	out, ok := os.LookupEnv("SMOKE_TEST_OUTPUT")
+	if !ok {
+		return
+	}
+	fmt.Println(out)
+	if os.Getenv("SMOKE_TEST_EXIT") != "" {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// smokeTestHelperArgs are the arguments running only TestSmokeTestHelperProcess in the test executable.
+var smokeTestHelperArgs = []string{"-test.run=^TestSmokeTestHelperProcess$", "--", "--version"}
+
+func setSmokeTestOutput(t *testing.T, out string, fail bool) {
+	os.Setenv("SMOKE_TEST_OUTPUT", out)
+	if fail {
+		os.Setenv("SMOKE_TEST_EXIT", "1")
+	}
+	t.Cleanup(func() {
+		os.Unsetenv("SMOKE_TEST_OUTPUT")
+		os.Unsetenv("SMOKE_TEST_EXIT")
+	})
+}
+
+func TestSmokeTestVersion(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip("test executable is not found:", err)
+	}
+
+	for _, tc := range []struct {
+		out  string
+		fail bool
+		want string
+	}{
+		{"foo 1.2.3", false, ""},
+		{"foo version v1.2.3 (abcdef, built at 2021-01-01)", false, ""},
+		{"foo 1.2.2", false, "does not report version 1.2.3"},
+		{"foo 1.2.3-beta.1", false, "does not report version 1.2.3"},
+		{"foo 1.2.3", true, "failed to run"},
+	} {
+		t.Run(tc.out, func(t *testing.T) {
+			setSmokeTestOutput(t, tc.out, tc.fail)
+			err := SmokeTestVersion(exe, semver.MustParse("1.2.3"), smokeTestHelperArgs...)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Wanted error %q but got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestUpdateWithSmokeTest(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip("test executable is not found:", err)
+	}
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExecutableHeader(content, runtime.GOOS); err != nil {
+		t.Skip("test executable is not checked as an executable:", err)
+	}
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: content}}})
+	errSandbox := errors.New("sandbox rejected the executable")
+
+	for _, tc := range []struct {
+		what    string
+		config  Config
+		out     string
+		wantErr error
+	}{
+		{"version", Config{SmokeTestArgs: smokeTestHelperArgs}, "foo v1.2.3", nil},
+		{"other version", Config{SmokeTestArgs: smokeTestHelperArgs}, "foo v1.2.2", errors.New("does not report version 1.2.3")},
+		{"custom", Config{SmokeTest: func(string) error { return errSandbox }}, "", errSandbox},
+		{"both", Config{SmokeTestArgs: smokeTestHelperArgs, SmokeTest: func(string) error { return errSandbox }}, "foo v1.2.3", errSandbox},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			setSmokeTestOutput(t, tc.out, false)
+			up, _ := newTestUpdater(t, tc.config, gh)
+			path := setupOldExecutable(t)
+
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, content) {
+					t.Fatal("Executable was not updated")
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr.Error()) || !strings.Contains(err.Error(), "smoke test") {
+				t.Fatalf("Wanted error %q but got %v", tc.wantErr, err)
+			}
+			if string(b) != "old executable" {
+				t.Fatal("Old executable should be kept")
+			}
+			if files, _ := ioutil.ReadDir(filepath.Dir(path)); len(files) != 1 {
+				t.Error("New executable should be removed:", files)
+			}
+		})
+	}
+}
+
+func TestCommandVersion(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip("test executable is not found:", err)
+	}
+
+	for _, tc := range []struct {
+		out  string
+		fail bool
+		want string
+		err  string
+	}{
+		{"foo 1.2.3", false, "1.2.3", ""},
+		{"foo version v1.2.3-beta.1 (abcdef, built at 2021-01-01)", false, "1.2.3-beta.1", ""},
+		{"foo development build", false, "", "does not report any version"},
+		{"foo 1.2.3", true, "", "failed to run"},
+	} {
+		t.Run(tc.out, func(t *testing.T) {
+			setSmokeTestOutput(t, tc.out, tc.fail)
+			v, err := CommandVersion(smokeTestHelperArgs...)(exe)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Wanted error %q but got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.String() != tc.want {
+				t.Fatal("Wanted version", tc.want, "but got", v)
+			}
+		})
+	}
+}
+
+func TestUpdateWithCurrentVersionFunc(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: fakeExecutableContent(t, "new executable")}}})
+	errVersion := errors.New("version is unknown")
+
+	for _, tc := range []struct {
+		what    string
+		current string
+		found   string
+		err     error
+		updated bool
+	}{
+		{"older", "", "1.2.2", nil, true},
+		{"latest", "", "1.2.3", nil, false},
+		{"passed", "1.2.3", "1.2.2", nil, false},
+		{"error", "", "", errVersion, false},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			path := setupOldExecutable(t)
+			called := ""
+			up, _ := newTestUpdater(t, Config{CurrentVersionFunc: func(p string) (semver.Version, error) {
+				called = p
+				if tc.err != nil {
+					return semver.Version{}, tc.err
+				}
+				return semver.MustParse(tc.found), nil
+			}}, gh)
+
+			current := semver.Version{}
+			if tc.current != "" {
+				current = semver.MustParse(tc.current)
+			}
+
+			res, err := up.UpdateCommandWithResult(path, current, "owner/repo")
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Wanted error %q but got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.current != "" {
+				if called != "" {
+					t.Fatal("CurrentVersionFunc should not be called when current version is passed")
+				}
+			} else if called == "" {
+				t.Fatal("CurrentVersionFunc was not called")
+			}
+			if res.Updated != tc.updated {
+				t.Fatal("Wanted updated", tc.updated, "but got", res.Updated)
+			}
+			if want := tc.found; tc.current == "" && res.PreviousVersion.String() != want {
+				t.Fatal("Wanted previous version", want, "but got", res.PreviousVersion)
+			}
+		})
+	}
+}
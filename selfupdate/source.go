@@ -0,0 +1,123 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// SourceArchive selects the source archive which GitHub generates for the tag of each release as the asset of the
+// release. See Config.SourceArchive.
+type SourceArchive int
+
+const (
+	// SourceArchiveNone selects the asset built for the platform. This is the default.
+	SourceArchiveNone SourceArchive = iota
+	// SourceArchiveTarball selects the gzipped tarball of the sources (tarball_url of the release).
+	SourceArchiveTarball
+	// SourceArchiveZipball selects the zip archive of the sources (zipball_url of the release).
+	SourceArchiveZipball
+)
+
+// sourceArchiveAsset returns the source archive of the release as an asset. Its name is '<repo>-<tag>.tar.gz' or
+// '<repo>-<tag>.zip' so that its format is detected from the extension and validation files can be named after it.
+// The asset has no ID since it is not uploaded, so it is downloaded from its URL.
+func sourceArchiveAsset(rel *github.RepositoryRelease, source SourceArchive) (*github.ReleaseAsset, bool) {
+	u, kind, ext := rel.GetTarballURL(), "tarball", ".tar.gz"
+	if source == SourceArchiveZipball {
+		u, kind, ext = rel.GetZipballURL(), "zipball", ".zip"
+	}
+
+	if u == "" {
+		return nil, false
+	}
+
+	// The URL is '.../repos/{owner}/{repo}/{kind}/{tag}'
+	repo := ""
+	if parsed, err := url.Parse(u); err == nil {
+		p := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+		for i := 1; i < len(p); i++ {
+			if p[i] == kind {
+				repo = p[i-1] + "-"
+
+				break
+			}
+		}
+	}
+
+	name := repo + strings.ReplaceAll(rel.GetTagName(), "/", "-") + ext
+
+	return &github.ReleaseAsset{Name: github.String(name), BrowserDownloadURL: github.String(u)}, true
+}
+
+// ExtractRelease downloads the asset of the release, validates it as UpdateTo does and extracts all files in it into
+// destDir with ExtractArchive, instead of replacing an executable. It returns the paths of the written files. This is
+// useful with Config.SourceArchive for tools built or interpreted from their sources on update. Note that the source
+// archives of GitHub put all files under a top-level directory named after the repository and the commit. Assets
+// validated with ValidateBinary cannot be extracted since no single executable is validated.
+func (up *Updater) ExtractRelease(ctx context.Context, rel *Release, destDir string) ([]string, error) {
+	if up.validator != nil && up.target == ValidateBinary {
+		return nil, errors.New("asset validated with ValidateBinary cannot be extracted into a directory. Validate the asset with ValidateArchive instead")
+	}
+
+	if err := up.checkValidatorConfigured(rel); err != nil {
+		return nil, err
+	}
+
+	if err := up.resolveRelease(ctx, rel); err != nil {
+		return nil, err
+	}
+
+	if err := up.verifyTag(ctx, rel); err != nil {
+		return nil, err
+	}
+
+	src, _, err := up.openAsset(ctx, rel)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(&contextReader{ctx: ctx, src: src})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading asset body: %w", err)
+	}
+
+	if err := checkAssetSize(rel, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	if up.validator != nil {
+		validationData, err := up.fetchValidationData(ctx, rel, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateAsset(up.validator, rel.assetName(), data, validationData); err != nil {
+			return nil, markError(ErrValidationFailed, fmt.Errorf("failed validating asset content: %w", err))
+		}
+	}
+
+	digest := sha256.Sum256(data)
+	if err := up.verifyProvenance(ctx, rel, digest[:]); err != nil {
+		return nil, err
+	}
+
+	log.Println("Will extract", rel.assetName(), "of release", rel.Version, "into", destDir)
+
+	// The URL of a source archive has no extension, so the format is detected from the name of the asset
+	return ExtractArchive(bytes.NewReader(data), rel.assetName(), destDir)
+}
+
+// ExtractRelease downloads the asset of the release and extracts all files in it into destDir with the default
+// updater. See Updater.ExtractRelease.
+func ExtractRelease(ctx context.Context, rel *Release, destDir string) ([]string, error) {
+	return DefaultUpdater().ExtractRelease(ctx, rel, destDir)
+}
@@ -0,0 +1,122 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDetectSourceArchive(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: []byte("foo")}}, tarball: []byte("tarball"), zipball: []byte("zipball")})
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.4", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: []byte("foo")}}})
+
+	for _, tc := range []struct {
+		source   SourceArchive
+		wantName string
+		wantURL  string
+	}{
+		{SourceArchiveNone, platformAssetName("foo", ".tar.gz"), "/owner/repo/releases/download/v1.2.4/" + platformAssetName("foo", ".tar.gz")},
+		{SourceArchiveTarball, "repo-v1.2.3.tar.gz", "/api/v3/repos/owner/repo/tarball/v1.2.3"},
+		{SourceArchiveZipball, "repo-v1.2.3.zip", "/api/v3/repos/owner/repo/zipball/v1.2.3"},
+	} {
+		t.Run(tc.wantName, func(t *testing.T) {
+			up, ts := newTestUpdater(t, Config{SourceArchive: tc.source}, gh)
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("Release was not detected")
+			}
+			if rel.AssetName != tc.wantName {
+				t.Error("Wanted asset", tc.wantName, "but got", rel.AssetName)
+			}
+			if rel.AssetURL != ts.URL+tc.wantURL {
+				t.Error("Wanted asset URL", ts.URL+tc.wantURL, "but got", rel.AssetURL)
+			}
+		})
+	}
+}
+
+func TestExtractRelease(t *testing.T) {
+	files := map[string][]byte{"owner-repo-abcdef/foo.sh": []byte("echo foo"), "owner-repo-abcdef/lib/bar.sh": []byte("echo bar")}
+	tarball := tarGz(t, files)
+	zipball := testZip(t, []archiveEntry{{name: "owner-repo-abcdef/foo.sh", content: "echo foo"}, {name: "owner-repo-abcdef/lib/bar.sh", content: "echo bar"}})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag:     "v1.2.3",
+		tarball: tarball,
+		zipball: zipball,
+		assets: []fakeAsset{
+			{name: "repo-v1.2.3.tar.gz.sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(tarball)))},
+			{name: "repo-v1.2.3.zip.sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256([]byte("other"))))},
+		},
+	})
+
+	for _, tc := range []struct {
+		what   string
+		config Config
+		want   string
+	}{
+		{"tarball", Config{SourceArchive: SourceArchiveTarball}, ""},
+		{"zipball", Config{SourceArchive: SourceArchiveZipball}, ""},
+		{"validated tarball", Config{SourceArchive: SourceArchiveTarball, Validator: &SHA2Validator{}}, ""},
+		{"invalid zipball", Config{SourceArchive: SourceArchiveZipball, Validator: &SHA2Validator{}}, "failed validating asset content"},
+		{"validate binary", Config{SourceArchive: SourceArchiveTarball, Validator: &SHA2Validator{}, ValidateTarget: ValidateBinary}, "cannot be extracted"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			up, _ := newTestUpdater(t, tc.config, gh)
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Release was not detected:", err)
+			}
+
+			dir := t.TempDir()
+			paths, err := up.ExtractRelease(context.Background(), rel, dir)
+			if tc.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("Wanted error %q but got %v", tc.want, err)
+				}
+				if strings.Contains(tc.want, "validating") && !errors.Is(err, ErrValidationFailed) {
+					t.Error("Error should match ErrValidationFailed:", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(paths)
+			want := []string{filepath.Join(dir, "owner-repo-abcdef", "foo.sh"), filepath.Join(dir, "owner-repo-abcdef", "lib", "bar.sh")}
+			if strings.Join(paths, ",") != strings.Join(want, ",") {
+				t.Fatal("Wanted", want, "but got", paths)
+			}
+			b, err := ioutil.ReadFile(want[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "echo bar" {
+				t.Fatalf("Wanted extracted content %q but got %q", "echo bar", b)
+			}
+		})
+	}
+}
+
+func TestDetectSourceArchiveMissing(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: []byte("foo")}}})
+
+	up, _ := newTestUpdater(t, Config{SourceArchive: SourceArchiveTarball}, gh)
+	_, err := up.FindRelease("owner/repo", "")
+	if !errors.Is(err, ErrAssetNotFound) {
+		t.Fatal("Wanted ErrAssetNotFound but got", err)
+	}
+}
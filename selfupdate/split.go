@@ -0,0 +1,177 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// DefaultSplitAssetPattern matches the suffix of split assets such as 'foo_linux_amd64.tar.gz.part01'.
+// Set it to Config.SplitAssetPattern to enable split assets.
+const DefaultSplitAssetPattern = `\.part(\d+)$`
+
+type splitAsset struct {
+	number int
+	asset  *github.ReleaseAsset
+}
+
+// joinSplitAssets returns a copy of the release where the parts of each split asset are replaced with one asset
+// named after the original file. The returned map associates the joined assets with their parts.
+// Parts are skipped when part numbers are not consecutive or when the original file is also uploaded.
+func joinSplitAssets(rel *github.RepositoryRelease, re *regexp.Regexp) (*github.RepositoryRelease, map[*github.ReleaseAsset][]AssetPart) {
+	groups := map[string][]splitAsset{}
+	names := map[string]bool{}
+	assets := make([]*github.ReleaseAsset, 0, len(rel.Assets))
+
+	for _, asset := range rel.Assets {
+		name := asset.GetName()
+		names[name] = true
+
+		m := re.FindStringSubmatchIndex(name)
+		if m == nil || m[2] < 0 {
+			assets = append(assets, asset)
+
+			continue
+		}
+
+		n, err := strconv.Atoi(name[m[2]:m[3]])
+		if err != nil {
+			assets = append(assets, asset)
+
+			continue
+		}
+
+		base := name[:m[0]]
+		groups[base] = append(groups[base], splitAsset{number: n, asset: asset})
+	}
+
+	if len(groups) == 0 {
+		return rel, nil
+	}
+
+	bases := make([]string, 0, len(groups))
+	for base := range groups {
+		bases = append(bases, base)
+	}
+
+	sort.Strings(bases)
+
+	joined := map[*github.ReleaseAsset][]AssetPart{}
+
+	for _, base := range bases {
+		if names[base] {
+			log.Println("Skip parts of", base, "since the asset itself is also uploaded")
+
+			continue
+		}
+
+		asset, parts, ok := joinParts(base, groups[base])
+		if !ok {
+			continue
+		}
+
+		assets = append(assets, asset)
+		joined[asset] = parts
+	}
+
+	r := *rel
+	r.Assets = assets
+
+	return &r, joined
+}
+
+func joinParts(base string, group []splitAsset) (*github.ReleaseAsset, []AssetPart, bool) {
+	sort.Slice(group, func(i, j int) bool { return group[i].number < group[j].number })
+
+	parts := make([]AssetPart, 0, len(group))
+	size := 0
+
+	for i, p := range group {
+		if i > 0 && p.number != group[i-1].number+1 {
+			log.Println("Skip parts of", base, "since part", group[i-1].number+1, "is missing")
+
+			return nil, nil, false
+		}
+
+		parts = append(parts, AssetPart{
+			Name:     p.asset.GetName(),
+			URL:      p.asset.GetBrowserDownloadURL(),
+			ID:       p.asset.GetID(),
+			ByteSize: p.asset.GetSize(),
+		})
+		size += p.asset.GetSize()
+	}
+
+	log.Println("Found", len(parts), "parts of split asset", base)
+
+	first := group[0].asset
+	asset := &github.ReleaseAsset{
+		ID:                 first.ID,
+		Name:               github.String(base),
+		Size:               github.Int(size),
+		URL:                first.URL,
+		BrowserDownloadURL: first.BrowserDownloadURL,
+	}
+
+	return asset, parts, true
+}
+
+// assetPartsReader reads the parts of a split asset in order as one stream. Parts are opened lazily and the size of
+// each part is verified.
+type assetPartsReader struct {
+	parts   []AssetPart
+	open    func(AssetPart) (io.ReadCloser, error)
+	current io.ReadCloser
+	read    int64
+}
+
+func (r *assetPartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+
+			src, err := r.open(r.parts[0])
+			if err != nil {
+				return 0, err
+			}
+
+			r.current = src
+			r.read = 0
+		}
+
+		n, err := r.current.Read(p)
+		r.read += int64(n)
+
+		if !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		part := r.parts[0]
+		r.current.Close()
+		r.current = nil
+		r.parts = r.parts[1:]
+
+		if r.read != int64(part.ByteSize) {
+			return n, fmt.Errorf("size of part %s mismatch: expected=%d, got=%d", part.Name, part.ByteSize, r.read)
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *assetPartsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+
+	return r.current.Close()
+}
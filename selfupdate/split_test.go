@@ -0,0 +1,174 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
+)
+
+func TestJoinSplitAssets(t *testing.T) {
+	asset := func(id int64, name string, size int) *github.ReleaseAsset {
+		return &github.ReleaseAsset{
+			ID:                 github.Int64(id),
+			Name:               github.String(name),
+			Size:               github.Int(size),
+			BrowserDownloadURL: github.String("https://example.com/" + name),
+		}
+	}
+	rel := &github.RepositoryRelease{
+		TagName: github.String("v1.0.0"),
+		Assets: []*github.ReleaseAsset{
+			asset(1, "foo_linux_amd64.tar.gz.part02", 20),
+			asset(2, "foo_linux_amd64.tar.gz.part01", 10),
+			asset(3, "foo_linux_amd64.tar.gz.part03", 5),
+			asset(4, "foo_darwin_amd64.tar.gz.part01", 1),
+			asset(5, "foo_darwin_amd64.tar.gz.part03", 1),
+			asset(6, "foo_windows_amd64.zip.part01", 1),
+			asset(7, "foo_windows_amd64.zip", 1),
+			asset(8, "checksums.txt", 1),
+		},
+	}
+
+	joined, parts := joinSplitAssets(rel, regexp.MustCompile(DefaultSplitAssetPattern))
+
+	names := []string{}
+	for _, a := range joined.Assets {
+		names = append(names, a.GetName())
+	}
+	if s := strings.Join(names, ","); s != "foo_windows_amd64.zip,checksums.txt,foo_linux_amd64.tar.gz" {
+		t.Fatal("Unexpected assets:", s)
+	}
+	if len(rel.Assets) != 8 {
+		t.Fatal("Original release should not be modified")
+	}
+
+	a := joined.Assets[2]
+	if a.GetSize() != 35 || a.GetID() != 2 || a.GetBrowserDownloadURL() != "https://example.com/foo_linux_amd64.tar.gz.part01" {
+		t.Errorf("Unexpected joined asset: %v", a)
+	}
+
+	ps := parts[a]
+	if len(ps) != 3 {
+		t.Fatal("Unexpected parts:", ps)
+	}
+	for i, p := range ps {
+		if want := fmt.Sprintf("foo_linux_amd64.tar.gz.part%02d", i+1); p.Name != want {
+			t.Errorf("Wanted part %q but got %q", want, p.Name)
+		}
+	}
+}
+
+func TestJoinSplitAssetsNoParts(t *testing.T) {
+	rel := &github.RepositoryRelease{Assets: []*github.ReleaseAsset{{Name: github.String("foo_linux_amd64.tar.gz")}}}
+	joined, parts := joinSplitAssets(rel, regexp.MustCompile(DefaultSplitAssetPattern))
+	if joined != rel || parts != nil {
+		t.Fatal("Release without parts should be returned as-is")
+	}
+}
+
+func TestAssetPartsReaderSizeMismatch(t *testing.T) {
+	r := &assetPartsReader{
+		parts: []AssetPart{{Name: "foo.part1", ByteSize: 3}, {Name: "foo.part2", ByteSize: 10}},
+		open: func(p AssetPart) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("foo")), nil
+		},
+	}
+	_, err := ioutil.ReadAll(r)
+	if err == nil || !strings.Contains(err.Error(), "size of part foo.part2 mismatch") {
+		t.Fatal("Size mismatch should be detected:", err)
+	}
+}
+
+func TestInvalidSplitAssetPattern(t *testing.T) {
+	for _, p := range []string{`\.part\d+$`, `(`} {
+		if _, err := NewUpdater(Config{SplitAssetPattern: p}); err == nil {
+			t.Errorf("Error should occur for pattern %q", p)
+		}
+	}
+}
+
+func TestUpdateWithSplitAsset(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	checksums, err := GenerateChecksums(map[string]io.Reader{name: bytes.NewReader(asset)}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	third := len(asset) / 3
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name + ".part3", content: asset[2*third:]},
+			{name: name + ".part1", content: asset[:third]},
+			{name: name + ".part2", content: asset[third : 2*third]},
+			{name: "checksums.txt", content: checksums},
+		},
+	})
+	up, _ := newTestUpdater(t, Config{
+		Validator:         &ChecksumValidator{},
+		SplitAssetPattern: DefaultSplitAssetPattern,
+	}, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Split asset was not detected")
+	}
+	if rel.AssetName != name || rel.AssetByteSize != len(asset) || len(rel.AssetParts) != 3 {
+		t.Fatalf("Unexpected release: %+v", rel)
+	}
+
+	path := setupOldExecutable(t)
+	if err := up.UpdateTo(rel, path); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, exe) {
+		t.Fatalf("Executable was not updated: %q", b)
+	}
+
+	up, _ = newTestUpdater(t, Config{}, gh)
+	if _, ok, _ := up.DetectLatest("owner/repo"); ok {
+		t.Error("Split asset should not be detected without SplitAssetPattern")
+	}
+}
+
+func TestUpdateWithSplitAssetMissingPart(t *testing.T) {
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name + ".part1", content: asset[:10]},
+			{name: name + ".part3", content: asset[10:]},
+		},
+	})
+	up, _ := newTestUpdater(t, Config{SplitAssetPattern: DefaultSplitAssetPattern}, gh)
+
+	if _, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := up.DetectLatest("owner/repo"); ok {
+		t.Error("Split asset with missing part should not be detected")
+	}
+}
@@ -0,0 +1,113 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// commitSHAPattern matches a full or abbreviated SHA of a commit.
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+// ErrTagNotVerified is matched with errors.Is when Config.VerifyTagSignature is set and the tag of the release is not
+// a signed tag verified by GitHub, or it was signed by none of Config.TagSigners.
+var ErrTagNotVerified = errors.New("release tag is not a verified signed tag")
+
+// ErrCommitMismatch is matched with errors.Is when Config.ExpectedCommit is set and the tag of the release does not
+// point at the commit.
+var ErrCommitMismatch = errors.New("release tag does not point at the expected commit")
+
+// verifyTag checks that the tag of the release is an annotated tag whose signature was verified by GitHub. GitHub
+// verifies a signature only when the signing key belongs to the account with the email of the tagger, so the email
+// is matched with Config.TagSigners. It also checks that the tag points at Config.ExpectedCommit.
+func (up *Updater) verifyTag(ctx context.Context, rel *Release) error { //nolint:cyclop
+	if !up.signedTag && up.expectCommit == "" {
+		return nil
+	}
+
+	name := rel.tagName
+	if name == "" {
+		if up.signedTag {
+			return fmt.Errorf("%w: tag of release %s is unknown", ErrTagNotVerified, rel.Version)
+		}
+
+		return fmt.Errorf("%w: tag of release %s is unknown", ErrCommitMismatch, rel.Version)
+	}
+
+	ref, _, err := up.api.Git.GetRef(ctx, rel.RepoOwner, rel.RepoName, "tags/"+name)
+	if err != nil {
+		return fmt.Errorf("failed to get tag %q of repository '%s/%s': %w", name, rel.RepoOwner, rel.RepoName, asRateLimitError(err))
+	}
+
+	obj := ref.GetObject()
+	if obj.GetType() != "tag" {
+		if up.signedTag {
+			return fmt.Errorf("%w: tag %q is a lightweight tag pointing at %s %s, which cannot be signed", ErrTagNotVerified, name, obj.GetType(), obj.GetSHA())
+		}
+
+		return up.verifyCommit(ctx, name, obj.GetType(), obj.GetSHA())
+	}
+
+	tag, _, err := up.api.Git.GetTag(ctx, rel.RepoOwner, rel.RepoName, obj.GetSHA())
+	if err != nil {
+		return fmt.Errorf("failed to get tag object %s of tag %q of repository '%s/%s': %w", obj.GetSHA(), name, rel.RepoOwner, rel.RepoName, asRateLimitError(err))
+	}
+
+	if up.signedTag {
+		v := tag.GetVerification()
+		if !v.GetVerified() {
+			return fmt.Errorf("%w: signature of tag %q is not verified by GitHub (reason: %s)", ErrTagNotVerified, name, v.GetReason())
+		}
+
+		email := tag.GetTagger().GetEmail()
+		if len(up.tagSigners) > 0 && !containsFold(up.tagSigners, email) {
+			return fmt.Errorf("%w: tag %q was signed by %q who is not any of allowed signers [%s]", ErrTagNotVerified, name, email, strings.Join(up.tagSigners, ", "))
+		}
+
+		log.Println("Signature of tag", name, "by", email, "was verified by GitHub")
+
+		if r := verificationReport(ctx); r != nil {
+			r.TagSigner = email
+		}
+	}
+
+	if up.expectCommit == "" {
+		return nil
+	}
+
+	target := tag.GetObject()
+
+	return up.verifyCommit(ctx, name, target.GetType(), target.GetSHA())
+}
+
+// verifyCommit checks that the object the tag points at is the commit of Config.ExpectedCommit. The expected SHA may
+// be abbreviated.
+func (up *Updater) verifyCommit(ctx context.Context, name, kind, sha string) error {
+	if kind != "commit" {
+		return fmt.Errorf("%w: tag %q points at %s %s instead of a commit", ErrCommitMismatch, name, kind, sha)
+	}
+
+	if !strings.HasPrefix(strings.ToLower(sha), strings.ToLower(up.expectCommit)) {
+		return fmt.Errorf("%w: tag %q points at commit %s but %s is expected", ErrCommitMismatch, name, sha, up.expectCommit)
+	}
+
+	log.Println("Tag", name, "points at expected commit", sha)
+
+	if r := verificationReport(ctx); r != nil {
+		r.Commit = sha
+	}
+
+	return nil
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, e := range ss {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+
+	return false
+}
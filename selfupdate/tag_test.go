@@ -0,0 +1,190 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v30/github"
+)
+
+func TestVerifyTagSignature(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	exe := fakeExecutableContent(t, "v1.2.3")
+
+	for _, tc := range []struct {
+		what     string
+		kind     string
+		verified bool
+		signers  []string
+		err      string
+	}{
+		{"verified", "tag", true, nil, ""},
+		{"allowed signer", "tag", true, []string{"Maintainer@Example.com"}, ""},
+		{"not allowed signer", "tag", true, []string{"other@example.com"}, `signed by "maintainer@example.com" who is not any of allowed signers`},
+		{"not verified", "tag", false, nil, "is not verified by GitHub (reason: unsigned)"},
+		{"lightweight", "commit", true, nil, "is a lightweight tag"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: tarGz(t, map[string][]byte{"foo": exe})}}})
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/owner/repo/git/refs/tags/v1.2.3":
+					_ = json.NewEncoder(w).Encode(&github.Reference{
+						Ref:    github.String("refs/tags/v1.2.3"),
+						Object: &github.GitObject{Type: github.String(tc.kind), SHA: github.String("deadbeef")},
+					})
+				case "/api/v3/repos/owner/repo/git/tags/deadbeef":
+					reason := "valid"
+					if !tc.verified {
+						reason = "unsigned"
+					}
+					_ = json.NewEncoder(w).Encode(&github.Tag{
+						Tag:          github.String("v1.2.3"),
+						Tagger:       &github.CommitAuthor{Email: github.String("maintainer@example.com")},
+						Verification: &github.SignatureVerification{Verified: github.Bool(tc.verified), Reason: github.String(reason)},
+					})
+				default:
+					gh.ServeHTTP(w, r)
+				}
+			})
+
+			up, _ := newTestUpdater(t, Config{VerifyTagSignature: true, TagSigners: tc.signers}, handler)
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := setupOldExecutable(t)
+			res, err := up.UpdateToWithResult(rel, path)
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Verification == nil || res.Verification.TagSigner != "maintainer@example.com" {
+					t.Fatal("Tag signer should be reported:", res.Verification)
+				}
+				if string(b) == "old executable" {
+					t.Fatal("Executable was not updated")
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrTagNotVerified) || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Error should contain %q but got %v", tc.err, err)
+			}
+			if string(b) != "old executable" {
+				t.Fatalf("Old executable should be kept but got %q", b)
+			}
+			for _, r := range gh.requested() {
+				if strings.Contains(r.URL.Path, "/releases/assets/") || strings.Contains(r.URL.Path, "/releases/download/") {
+					t.Fatal("Asset should not be downloaded for unverified tag:", r.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyExpectedCommit(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	exe := fakeExecutableContent(t, "v1.2.3")
+	commit := "0123456789abcdef0123456789abcdef01234567"
+
+	for _, tc := range []struct {
+		what     string
+		kind     string
+		target   string
+		expected string
+		err      string
+	}{
+		{"lightweight", "commit", "commit", commit, ""},
+		{"annotated", "tag", "commit", commit, ""},
+		{"abbreviated", "tag", "commit", "0123456", ""},
+		{"upper case", "commit", "commit", "0123456789ABCDEF", ""},
+		{"re-pointed lightweight", "commit", "commit", "fedcba9876543210", "points at commit " + commit},
+		{"re-pointed annotated", "tag", "commit", "fedcba9876543210", "points at commit " + commit},
+		{"not commit", "tag", "tree", commit, "points at tree"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: tarGz(t, map[string][]byte{"foo": exe})}}})
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/owner/repo/git/refs/tags/v1.2.3":
+					sha := "deadbeef"
+					if tc.kind == "commit" {
+						sha = commit
+					}
+					_ = json.NewEncoder(w).Encode(&github.Reference{
+						Ref:    github.String("refs/tags/v1.2.3"),
+						Object: &github.GitObject{Type: github.String(tc.kind), SHA: github.String(sha)},
+					})
+				case "/api/v3/repos/owner/repo/git/tags/deadbeef":
+					_ = json.NewEncoder(w).Encode(&github.Tag{
+						Tag:    github.String("v1.2.3"),
+						Object: &github.GitObject{Type: github.String(tc.target), SHA: github.String(commit)},
+					})
+				default:
+					gh.ServeHTTP(w, r)
+				}
+			})
+
+			up, _ := newTestUpdater(t, Config{ExpectedCommit: tc.expected}, handler)
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := setupOldExecutable(t)
+			res, err := up.UpdateToWithResult(rel, path)
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Verification == nil || res.Verification.Commit != commit {
+					t.Fatal("Commit should be reported:", res.Verification)
+				}
+				if string(b) == "old executable" {
+					t.Fatal("Executable was not updated")
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrCommitMismatch) || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Error should contain %q but got %v", tc.err, err)
+			}
+			if string(b) != "old executable" {
+				t.Fatalf("Old executable should be kept but got %q", b)
+			}
+			for _, r := range gh.requested() {
+				if strings.Contains(r.URL.Path, "/releases/assets/") || strings.Contains(r.URL.Path, "/releases/download/") {
+					t.Fatal("Asset should not be downloaded for unexpected commit:", r.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidExpectedCommit(t *testing.T) {
+	for _, sha := range []string{"012345", "main", "v1.2.3", "0123456789abcdefg"} {
+		if _, err := NewUpdater(Config{ExpectedCommit: sha}); err == nil || !strings.Contains(err.Error(), "is not a SHA") {
+			t.Errorf("Invalid commit %q should be rejected: %v", sha, err)
+		}
+	}
+}
@@ -3,34 +3,79 @@ package selfupdate
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
-	"path/filepath"
+	"os"
+	"path"
 	"runtime"
 	"strings"
 
 	"github.com/go-errors/errors"
 	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 func matchExecutableName(cmd, target string) bool {
+	return matchExecutableNameFor(cmd, target, runtime.GOOS, runtime.GOARCH)
+}
+
+// platform is the OS and the arch which an executable is for.
+type platform struct {
+	goos   string
+	goarch string
+}
+
+func runtimePlatform() platform {
+	return platform{runtime.GOOS, runtime.GOARCH}
+}
+
+// matchExecutableNameFor returns true when the target is the executable of cmd for the platform.
+func matchExecutableNameFor(cmd, target, goos, goarch string) bool {
 	if cmd == target {
 		return true
 	}
 
-	o, a := runtime.GOOS, runtime.GOARCH
+	// The command name has '.exe' on Windows (or '.wasm' for WebAssembly), which is put after the platform in
+	// the full name
+	ext := executableExt(goos)
+	base := strings.TrimSuffix(cmd, ext)
 
 	// When the contained executable name is full name (e.g. foo_darwin_amd64),
 	// it is also regarded as a target executable file. (#19)
-	for _, d := range []rune{'_', '-'} {
-		c := fmt.Sprintf("%s%c%s%c%s", cmd, d, o, d, a)
-		if o == "windows" {
-			c += ".exe"
+	for _, o := range platformOSNames(goos) {
+		for _, d := range []rune{'_', '-'} {
+			c := fmt.Sprintf("%s%c%s%c%s%s", base, d, o, d, goarch, ext)
+
+			if c == target {
+				return true
+			}
 		}
+	}
 
-		if c == target {
+	return false
+}
+
+// matchExecutableNames returns true when the file at the path in an archive matches any of the names of the
+// executable for the platform. A name with glob metacharacters is a pattern matched against the whole path by
+// matchPathPattern, and other names are matched against the base name of the path.
+func matchExecutableNames(cmds []string, filePath string, p platform) bool {
+	// Backslashes written by some Windows tools are regarded as separators
+	rel := cleanArchivePath(strings.ReplaceAll(filePath, "\\", "/"))
+	_, target := path.Split(rel)
+
+	for _, cmd := range cmds {
+		if isPathPattern(cmd) {
+			if matchPathPattern(cleanArchivePath(cmd), rel) {
+				return true
+			}
+
+			continue
+		}
+
+		if matchExecutableNameFor(cmd, target, p.goos, p.goarch) {
 			return true
 		}
 	}
@@ -38,8 +83,85 @@ func matchExecutableName(cmd, target string) bool {
 	return false
 }
 
-func unarchiveTar(src io.Reader, url, cmd string) (io.Reader, error) {
+// isPathPattern returns true when the name of the executable has any glob metacharacter.
+func isPathPattern(cmd string) bool {
+	return strings.ContainsAny(cmd, "*?[")
+}
+
+// cleanArchivePath returns the slash-separated path relative to the root of an archive, such as 'bin/foo' for
+// './bin/foo' or '/bin/foo'.
+func cleanArchivePath(p string) string {
+	p = strings.TrimLeft(path.Clean(p), "/")
+	if p == "." {
+		return ""
+	}
+
+	return p
+}
+
+// matchPathPattern reports whether the slash-separated path matches the pattern. Each element of the pattern is
+// matched by path.Match against an element of the path, except '**' which matches zero or more elements, e.g.
+// '**/bin/foo' matches 'bin/foo' and 'foo-1.2.3/bin/foo' but not 'foo-1.2.3/sbin/foo'.
+func matchPathPattern(pattern, p string) bool {
+	return matchPathElems(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchPathElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchPathElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(pattern[0], elems[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, elems = pattern[1:], elems[1:]
+	}
+
+	return len(elems) == 0
+}
+
+// checkPathPatterns returns an error when any of the names of the executable is a malformed glob pattern.
+func checkPathPatterns(cmds []string) error {
+	for _, cmd := range cmds {
+		if !isPathPattern(cmd) {
+			continue
+		}
+
+		for _, e := range strings.Split(cmd, "/") {
+			if _, err := path.Match(e, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q of the executable in archive: %w", cmd, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// commandNames formats the names of the executable for error messages.
+func commandNames(cmds []string) string {
+	return strings.Join(cmds, "' or '")
+}
+
+// MaxNestedArchiveDepth is the maximum number of archives nested in a release asset which are searched for
+// the executable, e.g. 1 for 'payload.tar.gz' in 'release.zip'. Archives nested deeper are skipped so that a malicious
+// asset cannot make the updater uncompress archives endlessly.
+const MaxNestedArchiveDepth = 2
+
+func unarchiveTar(src io.Reader, url string, cmds []string, password string, p platform, depth int) (io.Reader, error) {
 	t := tar.NewReader(src)
+	nested := false
 
 	for {
 		h, err := t.Next()
@@ -51,51 +173,355 @@ func unarchiveTar(src io.Reader, url, cmd string) (io.Reader, error) {
 			return nil, fmt.Errorf("failed to unarchive .tar file: %w", err)
 		}
 
-		_, name := filepath.Split(h.Name)
-		if matchExecutableName(cmd, name) {
+		if h.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		// Long names in GNU or PAX extended headers are already resolved into h.Name by archive/tar, which never returns
+		// the stub entries of the extended headers. They must not be matched with the name truncated in the header.
+		if matchExecutableNames(cmds, h.Name, p) {
 			log.Println("Executable file", h.Name, "was found in tar archive")
 
 			return t, nil
 		}
+
+		if isNestedArchive(h.Name) {
+			nested = true
+
+			open := func() (io.Reader, error) { return t, nil }
+			if r, ok := unarchiveNested(open, h.Name, url, cmds, password, p, depth); ok {
+				return r, nil
+			}
+		}
+	}
+
+	return nil, executableNotFound(cmds, url, nested)
+}
+
+// unarchiveZip finds the executable in the zip archive read from src.
+func unarchiveZip(src io.Reader, url string, cmds []string, password string, p platform, depth int) (io.Reader, error) {
+	z, err := newZipReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to uncompress zip file: %w", err)
+	}
+
+	nested := false
+
+	for _, file := range z.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		if matchExecutableNames(cmds, file.Name, p) {
+			log.Println("Executable file", file.Name, "was found in zip archive")
+
+			return openZipFile(file, password)
+		}
+
+		if isNestedArchive(file.Name) {
+			nested = true
+
+			file := file
+			open := func() (io.Reader, error) { return openZipFile(file, password) }
+			if r, ok := unarchiveNested(open, file.Name, url, cmds, password, p, depth); ok {
+				return r, nil
+			}
+		}
 	}
 
-	return nil, fmt.Errorf("file '%s' for the command is not found in %s", cmd, url)
+	return nil, executableNotFound(cmds, url, nested)
+}
+
+// isNestedArchive returns true when the file in an archive is an archive which may contain the executable. Files
+// compressed without archiving such as 'foo.1.gz' are not searched since they have no name to match in general.
+func isNestedArchive(name string) bool {
+	switch archiveFormatOf(name) {
+	case FormatZip, FormatTarGz, FormatTarXz, FormatTarLzma:
+		return true
+	default:
+		return false
+	}
+}
+
+// unarchiveNested finds the executable in the archive at name nested in the archive at url, which is nested at
+// the depth in the release asset. It returns false when the executable is not found in it or the archive is nested
+// deeper than MaxNestedArchiveDepth.
+func unarchiveNested(open func() (io.Reader, error), name, url string, cmds []string, password string, p platform, depth int) (io.Reader, bool) {
+	if depth >= MaxNestedArchiveDepth {
+		log.Println("Skipping archive", name, "in", url, "since it is nested deeper than", MaxNestedArchiveDepth, "levels")
+
+		return nil, false
+	}
+
+	src, err := open()
+	if err != nil {
+		log.Println("Could not open archive", name, "in", url, ":", err)
+
+		return nil, false
+	}
+
+	log.Println("Searching archive", name, "nested in", url)
+
+	nestedURL := url + "/" + name
+
+	var r io.Reader
+
+	switch archiveFormatOf(name) {
+	case FormatZip:
+		r, err = unarchiveZip(src, nestedURL, cmds, password, p, depth+1)
+	case FormatTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(src); err == nil {
+			r, err = unarchiveTar(gz, nestedURL, cmds, password, p, depth+1)
+		}
+	case FormatTarLzma:
+		var lz *lzma.Reader
+		if lz, err = lzma.NewReader(src); err == nil {
+			r, err = unarchiveTar(lz, nestedURL, cmds, password, p, depth+1)
+		}
+	default:
+		var xzip *xz.Reader
+		if xzip, err = xz.NewReader(src); err == nil {
+			r, err = unarchiveTar(xzip, nestedURL, cmds, password, p, depth+1)
+		}
+	}
+
+	if err != nil {
+		log.Println("Executable was not found in nested archive", name, ":", err)
+
+		return nil, false
+	}
+
+	return r, true
+}
+
+// executableNotFound returns the error matching ErrAssetNotFound for the archive at url without the executable.
+func executableNotFound(cmds []string, url string, nested bool) error {
+	if nested {
+		return markError(ErrAssetNotFound, fmt.Errorf("file '%s' for the command is not found in %s nor in the archives nested in it up to %d levels", commandNames(cmds), url, MaxNestedArchiveDepth))
+	}
+
+	return markError(ErrAssetNotFound, fmt.Errorf("file '%s' for the command is not found in %s", commandNames(cmds), url))
 }
 
 // UncompressCommand uncompresses the given source. Archive and compression format is
 // automatically detected from 'url' parameter, which represents the URL of asset.
-// This returns a reader for the uncompressed command given by 'cmd'. '.zip',
-// '.tar.gz', '.tar.xz', '.tgz', '.gz' and '.xz' are supported.
-func UncompressCommand(src io.Reader, url, cmd string) (io.Reader, error) { //nolint:cyclop
-	//nolint:gocritic,nestif
-	if strings.HasSuffix(url, ".zip") {
-		log.Println("Uncompressing zip file", url)
+// This returns a reader for the uncompressed command given by 'cmd', which is the name of the executable
+// in the archive and can differ from the name of the installed command. When the executable may have other names,
+// e.g. 'foo-cli' depending on the build, they can be given as alternatives. The first file in the archive matching any
+// of the names is returned. A name with glob metacharacters such as '**/bin/foo' is matched against the path of files
+// relative to the root of the archive ('**' matches zero or more directories) instead of their base names. '.zip', '.tar.gz', '.tar.xz', '.tar.lzma', '.tgz', '.tlz', '.gz', '.xz' and '.lzma' are supported. An asset without
+// an extension or with any of DefaultPlainBinaryExtensions is returned as-is, and ErrUnsupportedFormat is returned
+// for other extensions such as '.dmg'. Zip and tar archives in the archive such as 'payload.tar.gz' in 'release.zip'
+// are also searched for the executable in order, up to MaxNestedArchiveDepth levels.
+func UncompressCommand(src io.Reader, url, cmd string, alternatives ...string) (io.Reader, error) {
+	return uncompressCommand(src, url, append([]string{cmd}, alternatives...), "", nil, runtimePlatform())
+}
 
-		// Zip format requires its file size for uncompressing.
-		// So we need to read the HTTP response into a buffer at first.
-		buf, err := io.ReadAll(src)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create buffer for zip file: %w", err)
+// newZipReader reads a zip archive from src. Zip format requires its file size for uncompressing, so
+// the HTTP response is read into a buffer at first unless src is a file such as a downloaded temporary file.
+func newZipReader(src io.Reader) (*zip.Reader, error) {
+	if f, ok := src.(*os.File); ok {
+		if stat, err := f.Stat(); err == nil {
+			return zip.NewReader(f, stat.Size())
 		}
+	}
 
-		r := bytes.NewReader(buf)
+	buf, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buffer for zip file: %w", err)
+	}
 
-		z, err := zip.NewReader(r, r.Size())
-		if err != nil {
-			return nil, fmt.Errorf("failed to uncompress zip file: %w", err)
+	r := bytes.NewReader(buf)
+
+	return zip.NewReader(r, r.Size())
+}
+
+// ArchiveFormat is the archive or compression format of a release asset given to UncompressCommandWithFormat.
+type ArchiveFormat int
+
+const (
+	// FormatAuto detects the format from the file extension of the URL of the asset. This is the default.
+	FormatAuto ArchiveFormat = iota
+	// FormatZip is a zip archive.
+	FormatZip
+	// FormatTarGz is a tar archive compressed with gzip.
+	FormatTarGz
+	// FormatTarXz is a tar archive compressed with xz.
+	FormatTarXz
+	// FormatGz is a single executable compressed with gzip.
+	FormatGz
+	// FormatXz is a single executable compressed with xz.
+	FormatXz
+	// FormatRaw is an uncompressed executable.
+	FormatRaw
+	// FormatTarLzma is a tar archive compressed with the legacy LZMA format (lzma-alone).
+	FormatTarLzma
+	// FormatLzma is a single executable compressed with the legacy LZMA format (lzma-alone).
+	FormatLzma
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatZip:
+		return "zip"
+	case FormatTarGz:
+		return "tar.gz"
+	case FormatTarXz:
+		return "tar.xz"
+	case FormatGz:
+		return "gzip"
+	case FormatXz:
+		return "xz"
+	case FormatRaw:
+		return "raw"
+	case FormatTarLzma:
+		return "tar.lzma"
+	case FormatLzma:
+		return "lzma"
+	default:
+		return fmt.Sprintf("ArchiveFormat(%d)", int(f))
+	}
+}
+
+// archiveFormatOf returns the format of the asset at url from its file extension.
+func archiveFormatOf(url string) ArchiveFormat {
+	switch {
+	case strings.HasSuffix(url, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		return FormatTarGz
+	case strings.HasSuffix(url, ".gzip"), strings.HasSuffix(url, ".gz"):
+		return FormatGz
+	case strings.HasSuffix(url, ".tar.lzma"), strings.HasSuffix(url, ".tlz"):
+		return FormatTarLzma
+	case strings.HasSuffix(url, ".lzma"):
+		return FormatLzma
+	case strings.HasSuffix(url, ".tar.xz"):
+		return FormatTarXz
+	case strings.HasSuffix(url, ".xz"):
+		return FormatXz
+	default:
+		return FormatRaw
+	}
+}
+
+// DefaultPlainBinaryExtensions are the file extensions of release assets applied as uncompressed executables when
+// Config.PlainBinaryExtensions is nil. Assets without an extension are always applied as uncompressed executables.
+var DefaultPlainBinaryExtensions = []string{".exe", ".wasm", ".bin", ".AppImage"}
+
+// fileExtension returns the file extension of the asset at url such as '.dmg'. Dots in version numbers or names, as
+// in 'foo_1.2.3_linux_amd64', do not start an extension, so an extension consists of ASCII letters and digits
+// including at least one letter.
+func fileExtension(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+
+	ext := path.Ext(url)
+	if len(ext) < 2 {
+		return ""
+	}
+
+	letter := false
+
+	for _, c := range ext[1:] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+			letter = true
+		case '0' <= c && c <= '9':
+		default:
+			return ""
+		}
+	}
+
+	if !letter {
+		return ""
+	}
+
+	return ext
+}
+
+// checkPlainBinary returns an error matching ErrUnsupportedFormat unless the asset at url has no file extension, the
+// extension of executables for the OS such as '.exe' on Windows or any of the plain extensions.
+// DefaultPlainBinaryExtensions are used when plain is nil.
+func checkPlainBinary(url string, plain []string, goos string) error {
+	ext := fileExtension(url)
+	if ext == "" || (executableExt(goos) != "" && strings.EqualFold(ext, executableExt(goos))) {
+		return nil
+	}
+
+	if plain == nil {
+		plain = DefaultPlainBinaryExtensions
+	}
+
+	for _, e := range plain {
+		if strings.EqualFold(ext, "."+strings.TrimPrefix(e, ".")) {
+			return nil
 		}
+	}
+
+	return markError(ErrUnsupportedFormat, fmt.Errorf("unsupported file extension %q of %s. Add it to Config.PlainBinaryExtensions if the asset is an uncompressed executable", ext, url))
+}
+
+// gzipMagic is the magic number at the head of gzip streams.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// sniffGzip returns a reader of the whole content of src, and true when the content starts with the magic number of gzip.
+func sniffGzip(src io.Reader) (io.Reader, bool) {
+	r := bufio.NewReader(src)
+	head, _ := r.Peek(len(gzipMagic))
+
+	return r, bytes.Equal(head, gzipMagic)
+}
+
+// UncompressCommandWithFormat is the same as UncompressCommand, but the asset is uncompressed in the given format
+// instead of the format detected from its URL. This is useful when the URL of the asset has no file extension.
+func UncompressCommandWithFormat(src io.Reader, format ArchiveFormat, cmd string, alternatives ...string) (io.Reader, error) {
+	return uncompressFormat(src, format, format.String()+" asset", append([]string{cmd}, alternatives...), "", nil, runtimePlatform())
+}
+
+// uncompressCommand is the same as UncompressCommand, but encrypted files in zip archives are decrypted with
+// the password, assets with the plain extensions are applied as-is, and full names of the executable are matched for
+// the platform p. DefaultPlainBinaryExtensions are used when plain is nil.
+func uncompressCommand(src io.Reader, url string, cmds []string, password string, plain []string, p platform) (io.Reader, error) {
+	return uncompressFormat(src, FormatAuto, url, cmds, password, plain, p)
+}
+
+// uncompressFormat uncompresses the asset at url in the format. The format is detected from url when it is
+// FormatAuto, and then an asset in no known format must have no extension or any of the plain extensions.
+func uncompressFormat(src io.Reader, format ArchiveFormat, url string, cmds []string, password string, plain []string, p platform) (io.Reader, error) { //nolint:cyclop
+	if err := checkPathPatterns(cmds); err != nil {
+		return nil, err
+	}
 
-		for _, file := range z.File {
-			_, name := filepath.Split(file.Name)
-			if !file.FileInfo().IsDir() && matchExecutableName(cmd, name) {
-				log.Println("Executable file", file.Name, "was found in zip archive")
+	if format == FormatAuto {
+		format = archiveFormatOf(url)
 
-				return file.Open()
+		if format == FormatRaw {
+			if err := checkPlainBinary(url, plain, p.goos); err != nil {
+				return nil, err
+			}
+
+			// CDNs may serve a gzip stream at the URL of a plain executable when they apply Content-Encoding
+			// inconsistently. An executable never starts with the magic number of gzip
+			var gzipped bool
+			if src, gzipped = sniffGzip(src); gzipped {
+				log.Println("Asset", url, "without gzip file extension is a gzip stream")
+
+				format = FormatGz
 			}
 		}
+	}
 
-		return nil, fmt.Errorf("file '%s' for the command is not found in %s", cmd, url)
-	} else if strings.HasSuffix(url, ".tar.gz") || strings.HasSuffix(url, ".tgz") {
+	switch format {
+	case FormatZip:
+		log.Println("Uncompressing zip file", url)
+
+		return unarchiveZip(src, url, cmds, password, p, 0)
+	case FormatTarGz:
 		log.Println("Uncompressing tar.gz file", url)
 
 		gz, err := gzip.NewReader(src)
@@ -103,8 +529,8 @@ func UncompressCommand(src io.Reader, url, cmd string) (io.Reader, error) { //no
 			return nil, fmt.Errorf("failed to uncompress .tar.gz file: %w", err)
 		}
 
-		return unarchiveTar(gz, url, cmd)
-	} else if strings.HasSuffix(url, ".gzip") || strings.HasSuffix(url, ".gz") {
+		return unarchiveTar(gz, url, cmds, password, p, 0)
+	case FormatGz:
 		log.Println("Uncompressed gzip file", url)
 
 		r, err := gzip.NewReader(src)
@@ -113,14 +539,21 @@ func UncompressCommand(src io.Reader, url, cmd string) (io.Reader, error) { //no
 		}
 
 		name := r.Header.Name
-		if !matchExecutableName(cmd, name) {
-			return nil, fmt.Errorf("file name '%s' does not match to command '%s' found in %s", name, cmd, url)
+		if name == "" {
+			// e.g. 'gzip -c foo > foo.gz' or 'gzip -n' does not record the file name
+			log.Println("Uncompressed file from gzip has no file name and is assumed to be an executable", cmds[0])
+
+			return r, nil
+		}
+
+		if !matchExecutableNames(cmds, name, p) {
+			return nil, fmt.Errorf("file name '%s' does not match to command '%s' found in %s", name, commandNames(cmds), url)
 		}
 
 		log.Println("Executable file", name, "was found in gzip file")
 
 		return r, nil
-	} else if strings.HasSuffix(url, ".tar.xz") {
+	case FormatTarXz:
 		log.Println("Uncompressing tar.xz file", url)
 
 		xzip, err := xz.NewReader(src)
@@ -128,8 +561,17 @@ func UncompressCommand(src io.Reader, url, cmd string) (io.Reader, error) { //no
 			return nil, fmt.Errorf("failed to uncompress .tar.xz file: %w", err)
 		}
 
-		return unarchiveTar(xzip, url, cmd)
-	} else if strings.HasSuffix(url, ".xz") {
+		return unarchiveTar(xzip, url, cmds, password, p, 0)
+	case FormatTarLzma:
+		log.Println("Uncompressing tar.lzma file", url)
+
+		lz, err := lzma.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress .tar.lzma file: %w", err)
+		}
+
+		return unarchiveTar(lz, url, cmds, password, p, 0)
+	case FormatXz:
 		log.Println("Uncompressing xzip file", url)
 
 		xzip, err := xz.NewReader(src)
@@ -137,12 +579,25 @@ func UncompressCommand(src io.Reader, url, cmd string) (io.Reader, error) { //no
 			return nil, fmt.Errorf("failed to uncompress xzip file downloaded from %s: %w", url, err)
 		}
 
-		log.Println("Uncompressed file from xzip is assumed to be an executable", cmd)
+		log.Println("Uncompressed file from xzip is assumed to be an executable", cmds[0])
 
 		return xzip, nil
-	}
+	case FormatLzma:
+		log.Println("Uncompressing lzma file", url)
 
-	log.Println("Uncompression is not needed", url)
+		lz, err := lzma.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress lzma file downloaded from %s: %w", url, err)
+		}
+
+		log.Println("Uncompressed file from lzma is assumed to be an executable", cmds[0])
 
-	return src, nil
+		return lz, nil
+	case FormatRaw:
+		log.Println("Uncompression is not needed", url)
+
+		return src, nil
+	default:
+		return nil, markError(ErrUnsupportedFormat, fmt.Errorf("unknown archive format %s of %s", format, url))
+	}
 }
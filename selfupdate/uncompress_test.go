@@ -1,7 +1,10 @@
 package selfupdate
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -34,6 +37,9 @@ func getArchiveFileExt(file string) string {
 	if strings.HasSuffix(file, ".tar.xz") {
 		return ".tar.xz"
 	}
+	if strings.HasSuffix(file, ".tar.lzma") {
+		return ".tar.lzma"
+	}
 	return filepath.Ext(file)
 }
 
@@ -41,12 +47,16 @@ func TestUncompress(t *testing.T) {
 	for _, n := range []string{
 		"testdata/foo.zip",
 		"testdata/single-file.zip",
+		"testdata/streaming.zip",
 		"testdata/single-file.gz",
 		"testdata/single-file.gzip",
 		"testdata/foo.tar.gz",
 		"testdata/foo.tgz",
 		"testdata/foo.tar.xz",
 		"testdata/single-file.xz",
+		"testdata/foo.tar.lzma",
+		"testdata/foo.tlz",
+		"testdata/single-file.lzma",
 	} {
 		t.Run(n, func(t *testing.T) {
 			f, err := os.Open(n)
@@ -103,6 +113,27 @@ func TestUncompressInvalidArchive(t *testing.T) {
 	}
 }
 
+func TestUncompressInvalidTarLzma(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  string
+	}{
+		{"testdata/invalid-lzma.tar.lzma", "failed to uncompress .tar.lzma file"},
+		{"testdata/invalid-tar.tar.lzma", "failed to unarchive .tar file"},
+	} {
+		f, err := os.Open(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		_, err = UncompressCommand(f, "https://github.com/foo/bar/releases/download/v1.2.3/bar.tar.lzma", "bar")
+		if err == nil || !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("Wanted error %q for %s but got %v", tc.msg, tc.name, err)
+		}
+	}
+}
+
 func TestTargetNotFound(t *testing.T) {
 	for _, tc := range []struct {
 		name string
@@ -131,3 +162,409 @@ func TestTargetNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestUncompressGzipWithoutFileName(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte("this is test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := UncompressCommand(&buf, "https://github.com/foo/bar/releases/download/v1.2.3/bar.gz", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "this is test" {
+		t.Fatal("Uncompressed content should be the executable but got", string(b))
+	}
+}
+
+func TestUncompressCommandAlternatives(t *testing.T) {
+	for _, name := range []string{"foo", "foo-cli"} {
+		archive := tarGz(t, map[string][]byte{"README.md": []byte("readme"), name: []byte("this is test")})
+
+		r, err := UncompressCommand(bytes.NewReader(archive), "https://github.com/foo/bar/releases/download/v1.2.3/bar.tar.gz", "foo", "foo-cli")
+		if err != nil {
+			t.Fatal(name, "should be found:", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "this is test" {
+			t.Fatalf("Unexpected content of %s: %q", name, b)
+		}
+	}
+
+	archive := tarGz(t, map[string][]byte{"bar": []byte("this is test")})
+	_, err := UncompressCommand(bytes.NewReader(archive), "https://github.com/foo/bar/releases/download/v1.2.3/bar.tar.gz", "foo", "foo-cli")
+	if err == nil || !strings.Contains(err.Error(), "'foo' or 'foo-cli' for the command is not found") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestMatchExecutableNameForWindowsArm64(t *testing.T) {
+	for _, tc := range []struct {
+		cmd    string
+		target string
+		want   bool
+	}{
+		{"foo.exe", "foo.exe", true},
+		{"foo.exe", "foo_windows_arm64.exe", true},
+		{"foo.exe", "foo-windows-arm64.exe", true},
+		{"foo", "foo_windows_arm64.exe", true},
+		{"foo.exe", "foo_windows_amd64.exe", false},
+		{"foo.exe", "foo_windows_arm64", false},
+	} {
+		if have := matchExecutableNameFor(tc.cmd, tc.target, "windows", "arm64"); have != tc.want {
+			t.Errorf("matching %q with command %q on windows/arm64: wanted %v but got %v", tc.target, tc.cmd, tc.want, have)
+		}
+	}
+}
+
+func TestMatchExecutableNameForBSDs(t *testing.T) {
+	for _, tc := range []struct {
+		goos   string
+		target string
+		want   bool
+	}{
+		{"freebsd", "foo_freebsd_amd64", true},
+		{"freebsd", "foo-fbsd-amd64", true},
+		{"openbsd", "foo_obsd_amd64", true},
+		{"netbsd", "foo_nbsd_amd64", true},
+		{"dragonfly", "foo_dragonfly_amd64", true},
+		{"freebsd", "foo_obsd_amd64", false},
+		{"freebsd", "foo_linux_amd64", false},
+	} {
+		if have := matchExecutableNameFor("foo", tc.target, tc.goos, "amd64"); have != tc.want {
+			t.Errorf("matching %q on %s/amd64: wanted %v but got %v", tc.target, tc.goos, tc.want, have)
+		}
+	}
+}
+
+func TestUncompressCommandWithFormat(t *testing.T) {
+	for _, tc := range []struct {
+		file   string
+		format ArchiveFormat
+	}{
+		{"testdata/foo.zip", FormatZip},
+		{"testdata/foo.tar.gz", FormatTarGz},
+		{"testdata/foo.tar.xz", FormatTarXz},
+		{"testdata/single-file.gz", FormatGz},
+		{"testdata/single-file.xz", FormatXz},
+		{"testdata/foo.tar.lzma", FormatTarLzma},
+		{"testdata/single-file.lzma", FormatLzma},
+	} {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			f, err := os.Open(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			r, err := UncompressCommandWithFormat(f, tc.format, "bar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "this is test\n" {
+				t.Fatal("Uncompressing failed into unexpected content", string(b))
+			}
+		})
+	}
+
+	r, err := UncompressCommandWithFormat(strings.NewReader("raw"), FormatRaw, "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(r); string(b) != "raw" {
+		t.Fatal("Raw asset should be returned as-is:", string(b))
+	}
+
+	if _, err := UncompressCommandWithFormat(strings.NewReader("raw"), ArchiveFormat(42), "bar"); err == nil || !strings.Contains(err.Error(), "unknown archive format") {
+		t.Fatal("Unknown format should be rejected:", err)
+	}
+}
+
+func TestUncompressPlainBinaryExtensions(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		plain []string
+		goos  string
+		ok    bool
+	}{
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_linux_amd64", nil, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_1.2.3_linux_amd64", nil, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo.cli-linux-amd64", nil, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_windows_amd64.exe", nil, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_windows_amd64.EXE?sig=abc", nil, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_linux_amd64.AppImage", nil, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_darwin_amd64.dmg", nil, "linux", false},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_windows_amd64.msi", nil, "linux", false},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_linux_amd64.run", nil, "linux", false},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_linux_amd64.run", []string{"run"}, "linux", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_windows_amd64.exe", []string{".run"}, "linux", false},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo_windows_amd64.exe", []string{".run"}, "windows", true},
+		{"https://github.com/foo/bar/releases/download/v1.2.3/foo.exe", []string{}, "windows", true},
+	} {
+		t.Run(tc.goos+" "+tc.url, func(t *testing.T) {
+			r, err := uncompressCommand(strings.NewReader("raw"), tc.url, []string{"foo"}, "", tc.plain, platform{tc.goos, "amd64"})
+			if !tc.ok {
+				if !errors.Is(err, ErrUnsupportedFormat) {
+					t.Fatal("Unsupported format should be rejected:", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := ioutil.ReadAll(r); string(b) != "raw" {
+				t.Fatal("Plain binary should be returned as-is:", string(b))
+			}
+		})
+	}
+}
+
+func TestMatchPathPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/bin/foo", "bin/foo", true},
+		{"**/bin/foo", "foo-1.2.3/bin/foo", true},
+		{"**/bin/foo", "a/b/c/bin/foo", true},
+		{"**/bin/foo", "foo-1.2.3/sbin/foo", false},
+		{"**/bin/foo", "foo-1.2.3/bin/foo/bar", false},
+		{"foo-*/bin/foo", "foo-1.2.3/bin/foo", true},
+		{"foo-*/bin/foo", "x/foo-1.2.3/bin/foo", false},
+		{"*/foo", "bin/foo", true},
+		{"*/foo", "foo", false},
+		{"bin/**", "bin/a/b", true},
+		{"bin/**/foo", "bin/foo", true},
+		{"bin/fo?", "bin/foo", true},
+		{"[sb]in/foo", "bin/foo", true},
+		{"**", "foo", true},
+	} {
+		if have := matchPathPattern(tc.pattern, tc.path); have != tc.want {
+			t.Errorf("Wanted %v for pattern %q and path %q but got %v", tc.want, tc.pattern, tc.path, have)
+		}
+	}
+}
+
+func TestUncompressCommandPathPattern(t *testing.T) {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for _, f := range []struct{ name, content string }{
+		{"foo-1.2.3/foo", "wrapper script"},
+		{"foo-1.2.3/sbin/foo", "daemon"},
+		{"foo-1.2.3/bin/foo", "executable"},
+		{"foo-1.2.3/bin/foo-helper", "helper"},
+	} {
+		w, err := z.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tgz := tarGz(t, map[string][]byte{"./foo-1.2.3/foo": []byte("wrapper script"), "./foo-1.2.3/bin/foo": []byte("executable")})
+
+	for _, tc := range []struct {
+		what    string
+		archive []byte
+		url     string
+		cmd     string
+		want    string
+	}{
+		{"glob in zip", buf.Bytes(), "foo.zip", "**/bin/foo", "executable"},
+		{"glob in tar.gz", tgz, "foo.tar.gz", "**/bin/foo", "executable"},
+		{"glob with leading dot", buf.Bytes(), "foo.zip", "./foo-*/sbin/foo", "daemon"},
+		{"first match of glob", buf.Bytes(), "foo.zip", "foo-1.2.3/*/foo*", "daemon"},
+		{"base name", buf.Bytes(), "foo.zip", "foo", "wrapper script"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			p := platform{"linux", "amd64"}
+			r, err := uncompressCommand(bytes.NewReader(tc.archive), tc.url, []string{tc.cmd}, "", nil, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.want {
+				t.Fatalf("Wanted %q but got %q", tc.want, b)
+			}
+		})
+	}
+
+	_, err := UncompressCommand(bytes.NewReader(buf.Bytes()), "foo.zip", "**/lib/foo")
+	if !errors.Is(err, ErrAssetNotFound) {
+		t.Fatal("Unmatched pattern should not be found:", err)
+	}
+
+	_, err = UncompressCommand(bytes.NewReader(buf.Bytes()), "foo.zip", "**/bin/[foo")
+	if err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Fatal("Invalid pattern should be rejected:", err)
+	}
+	if _, err := NewUpdater(Config{ArchiveBinaryName: "**/bin/[foo"}); err == nil {
+		t.Fatal("Invalid pattern should be rejected by NewUpdater")
+	}
+}
+
+func TestUncompressTarLongNames(t *testing.T) {
+	// The fixtures have the executable at a path longer than 100 bytes, and another file whose path truncated to 100
+	// bytes in the tar header ends with '/bar'
+	for _, n := range []string{
+		"testdata/long-name-gnu.tar.gz",
+		"testdata/long-name-pax.tar.gz",
+	} {
+		for _, cmd := range []string{"bar", "**/bin/bar"} {
+			t.Run(n+" "+cmd, func(t *testing.T) {
+				f, err := os.Open(n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+
+				r, err := UncompressCommand(f, "https://github.com/foo/bar/releases/download/v1.2.3/bar.tar.gz", cmd)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != "this is test\n" {
+					t.Fatalf("Unexpected file was matched: %q", b)
+				}
+			})
+		}
+	}
+}
+
+func TestUncompressNestedArchive(t *testing.T) {
+	exe := []byte("this is test")
+	payload := tarGz(t, map[string][]byte{"README.md": []byte("readme"), "bin/foo": exe})
+
+	for _, tc := range []struct {
+		what    string
+		url     string
+		archive []byte
+	}{
+		{"tar.gz in zip", "release.zip", testZip(t, []archiveEntry{{name: "payload.tar.gz", content: string(payload)}})},
+		{"zip in tar.gz", "release.tar.gz", tarGz(t, map[string][]byte{"NOTICE": []byte("notice"), "payload.zip": testZip(t, []archiveEntry{{name: "foo", content: string(exe)}})})},
+		{"tar.lzma in zip", "release.zip", testZip(t, []archiveEntry{{name: "payload.tar.lzma", content: string(tarLzma(t, payload))}})},
+		{"two levels", "release.zip", testZip(t, []archiveEntry{{name: "outer.tar.gz", content: string(tarGz(t, map[string][]byte{"payload.tar.gz": payload}))}})},
+		{"other archive first", "release.tar.gz", tarGz(t, map[string][]byte{"docs.zip": testZip(t, []archiveEntry{{name: "index.html"}}), "payload.tar.gz": payload})},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			r, err := UncompressCommand(bytes.NewReader(tc.archive), "https://github.com/foo/bar/releases/download/v1.2.3/"+tc.url, "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Unexpected content %q", b)
+			}
+		})
+	}
+
+	// The executable is nested three levels deep
+	deep := testZip(t, []archiveEntry{{name: "c.tar.gz", content: string(payload)}})
+	for _, name := range []string{"b.zip", "a.zip"} {
+		deep = testZip(t, []archiveEntry{{name: name, content: string(deep)}})
+	}
+	_, err := UncompressCommand(bytes.NewReader(deep), "https://github.com/foo/bar/releases/download/v1.2.3/release.zip", "foo")
+	if !errors.Is(err, ErrAssetNotFound) || !strings.Contains(err.Error(), "nested in it up to 2 levels") {
+		t.Fatal("Archive nested too deep should not be searched:", err)
+	}
+
+	notFound := testZip(t, []archiveEntry{{name: "payload.tar.gz", content: string(tarGz(t, map[string][]byte{"bar": exe}))}})
+	_, err = UncompressCommand(bytes.NewReader(notFound), "https://github.com/foo/bar/releases/download/v1.2.3/release.zip", "foo")
+	if !errors.Is(err, ErrAssetNotFound) || !strings.Contains(err.Error(), "'foo' for the command is not found in") {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestUncompressGzipWithoutExtension(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	url := "https://github.com/foo/bar/releases/download/v1.2.3/foo_linux_amd64"
+
+	for _, name := range []string{"", "foo"} {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Name = name
+		if _, err := w.Write(exe); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := UncompressCommand(&buf, url, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadAll(r); !bytes.Equal(b, exe) {
+			t.Fatalf("gzip stream at %s should be uncompressed (file name %q) but got %q", url, name, b)
+		}
+	}
+
+	r, err := UncompressCommand(bytes.NewReader(exe), url, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(r); !bytes.Equal(b, exe) {
+		t.Fatal("Plain executable should be returned as-is:", string(b))
+	}
+}
+
+func TestUpdateWithGzipAssetWithoutExtension(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(exe); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: buf.Bytes()}}})
+
+	for _, magic := range []bool{false, true} {
+		up, _ := newTestUpdater(t, Config{CheckAssetMagic: magic}, gh)
+		rel, ok, err := up.DetectLatest("owner/repo")
+		if err != nil || !ok {
+			t.Fatal("Release should be detected:", ok, err)
+		}
+
+		path := setupOldExecutable(t)
+		if err := up.UpdateTo(rel, path); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadFile(path); !bytes.Equal(b, exe) {
+			t.Fatalf("Executable should be uncompressed from gzip stream (CheckAssetMagic: %v) but got %q", magic, b)
+		}
+	}
+}
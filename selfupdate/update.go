@@ -2,120 +2,972 @@ package selfupdate
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"net/http"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
-	"github.com/inconshreveable/go-update"
+	"github.com/google/go-github/v30/github"
 )
 
-func uncompressAndUpdate(src io.Reader, assetURL, cmdPath string) error {
-	_, cmd := filepath.Split(cmdPath)
-
-	asset, err := UncompressCommand(src, assetURL, cmd)
+// uncompressAndUpdate extracts the executable named any of cmds for the platform from the asset and replaces the
+// executable at cmdPath with it. The executable is checked to be built for any of archs unless it is empty, and
+// applied with the hooks.
+func uncompressAndUpdate(src io.Reader, assetURL, cmdPath string, cmds []string, zipPassword string, plain []string, p platform, archs []string, hooks applyHooks) error {
+	asset, err := uncompressCommand(src, assetURL, cmds, zipPassword, plain, p)
 	if err != nil {
 		return err
 	}
 
 	log.Println("Will update", cmdPath, "to the latest downloaded from", assetURL)
 
-	return update.Apply(asset, update.Options{
-		TargetPath: cmdPath,
-	})
+	return applyUpdateFor(asset, cmdPath, p.goos, archs, hooks)
+}
+
+// archiveBinaryNames returns the names of the executable looked up in the asset, which are binaryName followed by
+// the alternatives. When binaryName is empty, the file name of cmdPath is used instead. The extension of executables
+// for the OS such as '.exe' on Windows is added to the names when it is missing.
+func archiveBinaryNames(cmdPath, binaryName string, alternatives []string, goos string) []string {
+	if binaryName == "" {
+		_, binaryName = filepath.Split(cmdPath)
+	}
+
+	names := make([]string, 0, 1+len(alternatives))
+
+	for _, n := range append([]string{binaryName}, alternatives...) {
+		if ext := executableExt(goos); !strings.HasSuffix(n, ext) {
+			n += ext
+		}
+
+		names = append(names, n)
+	}
+
+	return names
 }
 
 func (up *Updater) downloadDirectlyFromURL(assetURL string) (io.ReadCloser, error) {
-	req, err := http.NewRequest(http.MethodGet, assetURL, nil)
+	return up.downloadDirectlyFromURLContext(up.apiCtx, assetURL)
+}
+
+func (up *Updater) downloadDirectlyFromURLContext(ctx context.Context, assetURL string) (io.ReadCloser, error) {
+	src, _, err := up.assetDownloader().Download(ctx, assetURL)
+
+	return src, err
+}
+
+// UpdateTo downloads an executable from GitHub Releases API and replace current binary with the downloaded one.
+// It downloads a release asset via GitHub Releases API so this function is available for update releases on private repository.
+// If a redirect occurs, it fallbacks into directly downloading from the redirect URL.
+func (up *Updater) UpdateTo(rel *Release, cmdPath string) error {
+	return up.updateTo(up.apiCtx, rel, cmdPath, func(Progress) {})
+}
+
+// UpdateToWithProgress is the same as UpdateTo, but it runs the update in a new goroutine and streams its progress
+// on the returned progress channel, which is closed when the update finishes. Sending progress never blocks
+// the download: when the receiver is slow, older progress is dropped and only the latest one is kept.
+// The returned error channel receives exactly one value, which is nil on success, after the progress channel is closed.
+// Cancelling ctx aborts the download.
+func (up *Updater) UpdateToWithProgress(ctx context.Context, rel *Release, cmdPath string) (<-chan Progress, <-chan error) {
+	progress := make(chan Progress, 1)
+	done := make(chan error, 1)
+
+	go func() {
+		err := up.updateTo(ctx, rel, cmdPath, func(p Progress) {
+			sendProgress(progress, p)
+		})
+		close(progress)
+		done <- err
+		close(done)
+	}()
+
+	return progress, done
+}
+
+// UpdateToAsset updates the executable at targetPath with the asset named assetName of the release, bypassing
+// the matching of assets with the platform, Config.Filters and Config.Extensions. It is an escape hatch when the exact
+// asset is known, e.g. 'foo_linux_amd64_v3.tar.gz'. The release must be detected by an Updater since the asset is looked
+// up with GitHub API. The asset is validated as usual with the validation file for assetName. An error matching
+// ErrAssetNotFound is returned when the release has no asset named assetName.
+func (up *Updater) UpdateToAsset(rel *Release, assetName, targetPath string) error {
+	named, err := up.releaseWithAsset(up.apiCtx, rel, assetName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request to %s: %w", assetURL, err)
+		return err
+	}
+
+	return up.updateTo(up.apiCtx, named, targetPath, func(Progress) {})
+}
+
+// releaseWithAsset returns the release whose asset is the one named assetName instead of the asset for the platform.
+func (up *Updater) releaseWithAsset(ctx context.Context, rel *Release, assetName string) (*Release, error) {
+	if rel.RepoOwner == "" || rel.RepoName == "" || rel.tagName == "" {
+		return nil, fmt.Errorf("release %s was not detected by an updater. Its asset %q cannot be looked up", rel.Version, assetName)
 	}
 
-	req.Header.Add("Accept", "application/octet-stream")
-	req = req.WithContext(up.apiCtx)
+	slug := rel.RepoOwner + "/" + rel.RepoName
 
-	// OAuth HTTP client is not available to download blob from URL when the URL is a redirect URL
-	// returned from GitHub Releases API (response status 400).
-	// Use default HTTP client instead.
-	res, err := http.DefaultClient.Do(req)
+	gh, _, err := up.api.Repositories.GetReleaseByTag(ctx, rel.RepoOwner, rel.RepoName, rel.tagName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download a release file from %s: %w", assetURL, err)
+		return nil, fmt.Errorf("failed to get release %s of repository %s: %w", rel.tagName, slug, asRateLimitError(err))
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download a release file from %s: Not successful status %d", assetURL, res.StatusCode)
+	parts := map[*github.ReleaseAsset][]AssetPart{}
+	if up.split != nil {
+		gh, parts = joinSplitAssets(gh, up.split)
 	}
 
-	return res.Body, nil
+	for _, a := range gh.Assets {
+		if a.GetName() == assetName {
+			log.Println("Found asset", assetName, "in release", rel.tagName, "of", slug)
+
+			return up.newRelease(gh, a, rel.Version, []string{rel.RepoOwner, rel.RepoName}, parts[a])
+		}
+	}
+
+	return nil, fmt.Errorf("%w: release %s of %s has no asset named %q", ErrAssetNotFound, rel.tagName, slug, assetName)
 }
 
-// UpdateTo downloads an executable from GitHub Releases API and replace current binary with the downloaded one.
-// It downloads a release asset via GitHub Releases API so this function is available for update releases on private repository.
-// If a redirect occurs, it fallbacks into directly downloading from the redirect URL.
-func (up *Updater) UpdateTo(rel *Release, cmdPath string) error { //nolint:cyclop
-	var client http.Client
+// checkValidatorConfigured fails when no validator is configured with Config.RequireValidation. Otherwise a warning is
+// logged once since the release asset is applied without being verified.
+func (up *Updater) checkValidatorConfigured(rel *Release) error {
+	if up.validator != nil {
+		return nil
+	}
+
+	if up.requireVal {
+		return markError(ErrValidationFailed, fmt.Errorf("no validator is configured to validate release %s while RequireValidation is set", rel.Version))
+	}
+
+	up.warnUnsigned.Do(func() {
+		log.Println("WARNING: No validator is configured. Release assets are applied without verifying them. Set Config.Validator to validate them, or Config.RequireValidation to forbid unverified updates")
+	})
+
+	return nil
+}
+
+// releaseFile is a file of a release to download.
+type releaseFile struct {
+	id   int64
+	name string
+	url  string
+	// kind describes the file in messages such as "validation "
+	kind string
+	// owner and repo are the repository of the file when it is not the repository of the release
+	owner string
+	repo  string
+}
+
+// repository returns the owner and the name of the repository of the file.
+func (f releaseFile) repository(rel *Release) (string, string) {
+	if f.owner != "" {
+		return f.owner, f.repo
+	}
+
+	return rel.RepoOwner, rel.RepoName
+}
+
+// downloadReleaseAsset downloads the release file via the asset endpoint of GitHub Releases API with the API token,
+// which is required for private repositories. If a redirect occurs, it fallbacks into directly downloading from
+// the redirect URL. The file is downloaded from its browser download URL instead when Config.AssetURLMode prefers it,
+// Config.Downloader is set or the ID of the file is unknown, e.g. for a release built from a stored asset URL.
+// The metadata of the response is recorded when ctx has a download recorder.
+func (up *Updater) downloadReleaseAsset(ctx context.Context, rel *Release, f releaseFile) (io.ReadCloser, error) {
+	info := &DownloadInfo{Name: f.name, ContentLength: -1}
+	ctx = context.WithValue(ctx, downloadInfoKey{}, info)
+	owner, repo := f.repository(rel)
+
+	var cache *assetCacheEntry
+	if up.cacheDir != "" {
+		cache = newAssetCacheEntry(up.cacheDir, owner, repo, f.name)
+		ctx = context.WithValue(ctx, assetCacheKey{}, cache)
+	}
 
-	src, redirectURL, err := up.api.Repositories.DownloadReleaseAsset(up.apiCtx, rel.RepoOwner, rel.RepoName, rel.AssetID, &client)
+	if up.useBrowserURL(f) {
+		src, size, err := up.assetDownloader().Download(ctx, f.url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download a release %sasset %s: %w", f.kind, f.name, err)
+		}
+
+		// Downloaders other than HTTPDownloader do not know the context
+		if info.URL == "" {
+			info.URL, info.ContentLength = f.url, size
+		}
+
+		info.Cached = cache != nil && cache.hit
+		recordDownload(ctx, *info)
+
+		return src, nil
+	}
+
+	src, redirectURL, err := up.api.Repositories.DownloadReleaseAsset(ctx, owner, repo, f.id, up.downloadClient())
 	if err != nil {
-		return fmt.Errorf("failed to call GitHub Releases API for getting an asset(ID: %d) for repository '%s/%s': %w", rel.AssetID, rel.RepoOwner, rel.RepoName, err)
+		return nil, fmt.Errorf("failed to call GitHub Releases API for getting an %sasset(ID: %d) for repository '%s/%s': %w", f.kind, f.id, owner, repo, asRateLimitError(err))
 	}
 
 	if redirectURL != "" {
-		log.Println("Redirect URL was returned while trying to download a release asset from GitHub API. Falling back to downloading from asset URL directly:", redirectURL)
+		log.Printf("Redirect URL was returned while trying to download a release %sasset from GitHub API. Falling back to downloading from asset URL directly: %s\n", f.kind, redirectURL)
 
-		src, err = up.downloadDirectlyFromURL(redirectURL)
+		src, err = up.downloadDirectlyFromURLContext(ctx, redirectURL)
 		if err != nil {
+			return nil, err
+		}
+	}
+
+	info.Cached = cache != nil && cache.hit
+	recordDownload(ctx, *info)
+
+	return src, nil
+}
+
+func (up *Updater) updateTo(ctx context.Context, rel *Release, cmdPath string, progress func(Progress)) error {
+	if err := up.checkValidatorConfigured(rel); err != nil {
+		return err
+	}
+
+	if err := up.resolveRelease(ctx, rel); err != nil {
+		return err
+	}
+
+	if err := up.verifyTag(ctx, rel); err != nil {
+		return err
+	}
+
+	current := Progress{Phase: ProgressDownloading, Total: int64(rel.AssetByteSize)}
+	progress(current)
+
+	if up.validator != nil && up.target == ValidateBinary {
+		if validate := streamValidation(up.validator, rel.assetName()); validate != nil {
+			return up.updateToStreamingBinary(ctx, rel, cmdPath, current, progress, validate)
+		}
+
+		return up.updateToValidatingBinary(ctx, rel, cmdPath, current, progress)
+	}
+
+	cache := up.validatedAssetEntry(rel)
+	if cache != nil {
+		if f, ok := cache.open(); ok {
+			defer f.Close()
+
+			if r := verificationReport(ctx); r != nil {
+				r.Validator, r.Target, r.SHA256, r.Cached = fmt.Sprintf("%T", innerValidator(up.validator)), up.target, cache.sha256, true
+			}
+
+			return up.applyWithProgress(ctx, rel, f, rel.assetName(), cmdPath, current, progress)
+		}
+	}
+
+	if up.validator != nil {
+		if validate := streamValidation(up.validator, rel.assetName()); validate != nil {
+			return up.updateToStreaming(ctx, rel, cmdPath, current, progress, validate, cache)
+		}
+	}
+
+	src, assetURL, err := up.openAsset(ctx, rel)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	reader := &progressReader{src: &contextReader{ctx: ctx, src: src}, current: current, progress: progress}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed reading asset body: %w", err)
+	}
+
+	if err := checkAssetSize(rel, int64(len(data))); err != nil {
+		return err
+	}
+
+	current = reader.current
+
+	if up.validator != nil {
+		current.Phase = ProgressValidating
+		progress(current)
+
+		validationData, err := up.fetchValidationData(ctx, rel, data)
+		if err != nil {
+			return err
+		}
+
+		if err := validateAsset(up.validator, rel.assetName(), data, validationData); err != nil {
+			return markError(ErrValidationFailed, fmt.Errorf("failed validating asset content: %w", err))
+		}
+
+		if err := up.reportValidation(ctx, rel.assetName(), bytes.NewReader(data), validationData); err != nil {
+			return err
+		}
+	}
+
+	digest := sha256.Sum256(data)
+	reportAssetDigest(ctx, digest[:])
+
+	if err := up.verifyProvenance(ctx, rel, digest[:]); err != nil {
+		return err
+	}
+
+	if cache != nil {
+		cache.store(bytes.NewReader(data))
+	}
+
+	return up.applyWithProgress(ctx, rel, bytes.NewReader(data), assetURL, cmdPath, current, progress)
+}
+
+// updateToStreaming validates the release asset while downloading it into a temporary file, so that huge assets
+// are never buffered in memory. The validation asset is downloaded first, and the executable is extracted from
+// the temporary file only after the validation succeeded.
+func (up *Updater) updateToStreaming(ctx context.Context, rel *Release, cmdPath string, current Progress, progress func(Progress), validate func(io.Reader, []byte) error, cache *validatedAssetEntry) error {
+	validationData, err := up.downloadValidationAsset(ctx, rel)
+	if err != nil {
+		return err
+	}
+
+	src, assetURL, err := up.openAsset(ctx, rel)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(up.tempDir, "selfupdate-asset-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for downloading asset: %w", err)
+	}
+
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	reader := &progressReader{src: &contextReader{ctx: ctx, src: src}, current: current, progress: progress}
+	hash := sha256.New()
+	tee := io.TeeReader(reader, io.MultiWriter(tmp, hash))
+
+	if err := validate(tee, validationData); err != nil {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating asset content: %w", err))
+	}
+
+	// Bytes which the validator did not read are not validated
+	n, err := io.Copy(ioutil.Discard, tee)
+	if err != nil {
+		return fmt.Errorf("failed reading asset body: %w", err)
+	}
+
+	if n > 0 {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating asset content: validator did not read the last %d bytes of asset %s", n, rel.assetName()))
+	}
+
+	if err := checkAssetSize(rel, reader.current.Downloaded); err != nil {
+		return err
+	}
+
+	reportAssetDigest(ctx, hash.Sum(nil))
+
+	if err := up.verifyProvenance(ctx, rel, hash.Sum(nil)); err != nil {
+		return err
+	}
+
+	rewind := func() error {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read downloaded asset from temporary file: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := rewind(); err != nil {
+		return err
+	}
+
+	if verificationReport(ctx) != nil {
+		if err := up.reportValidation(ctx, rel.assetName(), tmp, validationData); err != nil {
+			return err
+		}
+
+		if err := rewind(); err != nil {
+			return err
+		}
+	}
+
+	if cache != nil {
+		cache.store(tmp)
+
+		if err := rewind(); err != nil {
 			return err
 		}
 	}
+
+	return up.applyWithProgress(ctx, rel, tmp, assetURL, cmdPath, reader.current, progress)
+}
+
+// updateToValidatingBinary validates the executable extracted from the release asset instead of the asset itself.
+func (up *Updater) updateToValidatingBinary(ctx context.Context, rel *Release, cmdPath string, current Progress, progress func(Progress)) error {
+	src, assetURL, err := up.openAsset(ctx, rel)
+	if err != nil {
+		return err
+	}
 	defer src.Close()
 
-	data, err := io.ReadAll(src)
+	reader := &progressReader{src: &contextReader{ctx: ctx, src: src}, current: current, progress: progress}
+
+	data, err := io.ReadAll(reader)
 	if err != nil {
 		return fmt.Errorf("failed reading asset body: %w", err)
 	}
 
-	if up.validator == nil {
-		return uncompressAndUpdate(bytes.NewReader(data), rel.AssetURL, cmdPath)
+	if err := checkAssetSize(rel, int64(len(data))); err != nil {
+		return err
 	}
 
-	validationSrc, validationRedirectURL, err := up.api.Repositories.DownloadReleaseAsset(up.apiCtx, rel.RepoOwner, rel.RepoName, rel.ValidationAssetID, &client)
+	current = reader.current
+	current.Phase = ProgressValidating
+	progress(current)
+
+	p := up.platform()
+	cmds := archiveBinaryNames(cmdPath, up.binaryName, up.binaryAlts, p.goos)
+
+	exe, err := uncompressCommand(bytes.NewReader(data), assetURL, cmds, up.zipPassword, up.plain, p)
 	if err != nil {
-		return fmt.Errorf("failed to call GitHub Releases API for getting an validation asset(ID: %d) for repository '%s/%s': %w", rel.ValidationAssetID, rel.RepoOwner, rel.RepoName, err)
+		return err
 	}
 
-	if validationRedirectURL != "" {
-		log.Println("Redirect URL was returned while trying to download a release validation asset from GitHub API. Falling back to downloading from asset URL directly:", redirectURL)
+	exeData, err := io.ReadAll(exe)
+	if err != nil {
+		return fmt.Errorf("failed reading executable from asset %s: %w", rel.assetName(), err)
+	}
 
-		validationSrc, err = up.downloadDirectlyFromURL(validationRedirectURL)
+	validationData, err := up.fetchValidationData(ctx, rel, exeData)
+	if err != nil {
+		return err
+	}
+
+	if err := validateAsset(up.validator, rel.assetName(), exeData, validationData); err != nil {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating executable in asset: %w", err))
+	}
+
+	if err := up.reportValidation(ctx, rel.assetName(), bytes.NewReader(exeData), validationData); err != nil {
+		return err
+	}
+
+	// Provenance is about the asset as published, not the executable in it
+	digest := sha256.Sum256(data)
+	reportAssetDigest(ctx, digest[:])
+
+	if err := up.verifyProvenance(ctx, rel, digest[:]); err != nil {
+		return err
+	}
+
+	current.Phase = ProgressApplying
+	progress(current)
+
+	log.Println("Will update", cmdPath, "to the latest downloaded from", assetURL)
+
+	if err := applyUpdateFor(bytes.NewReader(exeData), cmdPath, p.goos, up.executableArchs(), up.applyHooks(rel)); err != nil {
+		return err
+	}
+
+	current.Phase = ProgressDone
+	progress(current)
+
+	return nil
+}
+
+// updateToStreamingBinary validates the executable while it is extracted from the release asset being downloaded,
+// so that neither the asset nor the executable is buffered in memory. The executable is written to a temporary file
+// in the same pass, and replaces the command only after the validation succeeded.
+func (up *Updater) updateToStreamingBinary(ctx context.Context, rel *Release, cmdPath string, current Progress, progress func(Progress), validate func(io.Reader, []byte) error) error { //nolint:cyclop,funlen
+	validationData, err := up.downloadValidationAsset(ctx, rel)
+	if err != nil {
+		return err
+	}
+
+	src, assetURL, err := up.openAsset(ctx, rel)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
 
+	reader := &progressReader{src: &contextReader{ctx: ctx, src: src}, current: current, progress: progress}
+	hash := sha256.New()
+	asset := io.TeeReader(reader, hash)
+
+	var archive io.Reader = asset
+
+	// A zip archive needs random access, so it is spooled to a temporary file instead of being read into memory
+	if archiveFormatOf(assetURL) == FormatZip {
+		spool, err := ioutil.TempFile(up.tempDir, "selfupdate-asset-")
 		if err != nil {
+			return fmt.Errorf("failed to create temporary file for downloading asset: %w", err)
+		}
+
+		defer func() {
+			spool.Close()
+			os.Remove(spool.Name())
+		}()
+
+		if _, err := io.Copy(spool, asset); err != nil {
+			return fmt.Errorf("failed reading asset body: %w", err)
+		}
+
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read downloaded asset from temporary file: %w", err)
+		}
+
+		archive = spool
+	}
+
+	p := up.platform()
+	cmds := archiveBinaryNames(cmdPath, up.binaryName, up.binaryAlts, p.goos)
+
+	exe, err := uncompressCommand(archive, assetURL, cmds, up.zipPassword, up.plain, p)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(up.tempDir, "selfupdate-executable-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for extracting executable: %w", err)
+	}
+
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	tee := io.TeeReader(exe, tmp)
+
+	if err := validate(tee, validationData); err != nil {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating executable in asset: %w", err))
+	}
+
+	// Bytes which the validator did not read are not validated
+	n, err := io.Copy(ioutil.Discard, tee)
+	if err != nil {
+		return fmt.Errorf("failed reading executable from asset %s: %w", rel.assetName(), err)
+	}
+
+	if n > 0 {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating executable in asset: validator did not read the last %d bytes of the executable in asset %s", n, rel.assetName()))
+	}
+
+	// The rest of the archive after the executable is read for the digest of the whole asset
+	if _, err := io.Copy(ioutil.Discard, asset); err != nil {
+		return fmt.Errorf("failed reading asset body: %w", err)
+	}
+
+	if err := checkAssetSize(rel, reader.current.Downloaded); err != nil {
+		return err
+	}
+
+	// Provenance is about the asset as published, not the executable in it
+	reportAssetDigest(ctx, hash.Sum(nil))
+
+	if err := up.verifyProvenance(ctx, rel, hash.Sum(nil)); err != nil {
+		return err
+	}
+
+	rewind := func() error {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read extracted executable from temporary file: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := rewind(); err != nil {
+		return err
+	}
+
+	if verificationReport(ctx) != nil {
+		if err := up.reportValidation(ctx, rel.assetName(), tmp, validationData); err != nil {
+			return err
+		}
+
+		if err := rewind(); err != nil {
 			return err
 		}
 	}
 
-	defer validationSrc.Close()
+	current = reader.current
+	current.Phase = ProgressApplying
+	progress(current)
+
+	log.Println("Will update", cmdPath, "to the latest downloaded from", assetURL)
+
+	if err := applyUpdateFor(&contextReader{ctx: ctx, src: tmp}, cmdPath, p.goos, up.executableArchs(), up.applyHooks(rel)); err != nil {
+		return err
+	}
+
+	current.Phase = ProgressDone
+	progress(current)
+
+	return nil
+}
+
+// Download downloads the release asset and returns the executable extracted from it, without writing it to disk.
+// The executable is validated with Config.Validator and Config.Provenance of the updater which detected the release
+// before it is returned, so the whole asset is downloaded into memory first.
+//
+// The executable is looked up in the asset with Config.ArchiveBinaryName and Config.ArchiveBinaryAlternatives. When
+// ArchiveBinaryName is not set, the name of the asset before the platform (e.g. 'foo' of 'foo_linux_amd64.tar.gz')
+// and the repository name are looked up.
+func (r *Release) Download(ctx context.Context) (io.ReadCloser, error) {
+	up := r.updater
+	if up == nil {
+		up = DefaultUpdater()
+	}
+
+	exe, err := up.downloadExecutable(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(exe), nil
+}
+
+// WriteUpdateTo downloads the release asset, validates it with Config.Validator and Config.Provenance, extracts the
+// executable from it and writes the executable to w instead of installing it, e.g. to pipe it to the standard output
+// or to inspect it in tests. It returns the number of bytes written. Nothing is written when the validation fails or
+// the extracted file is not an executable for the target platform, so w only receives verified executables. Options
+// on installing the executable such as Config.SmokeTest and Config.CommitFunc are not applied.
+func (up *Updater) WriteUpdateTo(ctx context.Context, rel *Release, w io.Writer) (int64, error) {
+	exe, err := up.downloadExecutable(ctx, rel)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := io.ReadAll(exe)
+	if err != nil {
+		return 0, fmt.Errorf("failed reading executable from asset %s: %w", rel.assetName(), err)
+	}
+
+	if !up.skipExeCheck {
+		if err := checkExecutableHeader(data, up.platform().goos); err != nil {
+			return 0, fmt.Errorf("executable in asset %s is broken: %w", rel.assetName(), err)
+		}
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		return int64(n), fmt.Errorf("failed to write executable: %w", err)
+	}
+
+	return int64(n), nil
+}
+
+// downloadExecutable downloads the release asset and returns the executable validated and extracted from it, which
+// is in memory.
+func (up *Updater) downloadExecutable(ctx context.Context, r *Release) (io.Reader, error) {
+	if err := up.checkValidatorConfigured(r); err != nil {
+		return nil, err
+	}
+
+	if err := up.resolveRelease(ctx, r); err != nil {
+		return nil, err
+	}
+
+	if err := up.verifyTag(ctx, r); err != nil {
+		return nil, err
+	}
+
+	src, assetURL, err := up.openAsset(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(&contextReader{ctx: ctx, src: src})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading asset body: %w", err)
+	}
+
+	if err := checkAssetSize(r, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	validateExe := up.validator != nil && up.target == ValidateBinary
+
+	if up.validator != nil && !validateExe {
+		validationData, err := up.fetchValidationData(ctx, r, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateAsset(up.validator, r.assetName(), data, validationData); err != nil {
+			return nil, markError(ErrValidationFailed, fmt.Errorf("failed validating asset content: %w", err))
+		}
+	}
+
+	digest := sha256.Sum256(data)
+	if err := up.verifyProvenance(ctx, r, digest[:]); err != nil {
+		return nil, err
+	}
+
+	p := up.platform()
+
+	exe, err := uncompressCommand(bytes.NewReader(data), assetURL, r.executableNames(up, p.goos), up.zipPassword, up.plain, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validateExe {
+		return exe, nil
+	}
+
+	exeData, err := io.ReadAll(exe)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading executable from asset %s: %w", r.assetName(), err)
+	}
+
+	validationData, err := up.fetchValidationData(ctx, r, exeData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateAsset(up.validator, r.assetName(), exeData, validationData); err != nil {
+		return nil, markError(ErrValidationFailed, fmt.Errorf("failed validating executable in asset: %w", err))
+	}
+
+	return bytes.NewReader(exeData), nil
+}
+
+// executableNames returns the names of the executable looked up in the asset by Download.
+func (r *Release) executableNames(up *Updater, goos string) []string {
+	if up.binaryName != "" {
+		return archiveBinaryNames("", up.binaryName, up.binaryAlts, goos)
+	}
+
+	name := r.assetName()
+	names := []string{}
+
+	for _, o := range platformOSNames(goos) {
+		for _, sep := range []string{"_", "-"} {
+			if i := strings.Index(name, sep+o+sep); i > 0 {
+				names = append(names, name[:i])
+			}
+		}
+	}
+
+	if r.RepoName != "" {
+		names = append(names, r.RepoName)
+	}
+
+	if len(names) == 0 {
+		names = append(names, name)
+	}
+
+	return archiveBinaryNames("", names[0], append(names[1:], up.binaryAlts...), goos)
+}
+
+// validatedAssetEntry returns the entry of the release asset in Config.ValidatedAssetCacheDir. nil is returned when
+// the cache is disabled or nothing validates the asset, since only validated assets are cached.
+func (up *Updater) validatedAssetEntry(rel *Release) *validatedAssetEntry {
+	if up.validCacheDir == "" || (up.validator == nil && up.provenance == nil) {
+		return nil
+	}
+
+	return newValidatedAssetEntry(up.validCacheDir, rel)
+}
+
+// openAsset starts downloading the release asset. Parts of a split asset are downloaded in order as it is read.
+// It also returns the URL used for detecting the format of the asset.
+func (up *Updater) openAsset(ctx context.Context, rel *Release) (io.ReadCloser, string, error) {
+	src, assetURL, err := up.openAssetParts(ctx, rel)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if up.downloadDir != "" {
+		src = newKeepReader(ctx, src, keptAssetPath(up.downloadDir, rel))
+	}
+
+	if !up.checkMagic {
+		return src, assetURL, nil
+	}
+
+	return newMagicCheckReader(src, assetURL, up.platform().goos), assetURL, nil
+}
+
+func (up *Updater) openAssetParts(ctx context.Context, rel *Release) (io.ReadCloser, string, error) {
+	if len(rel.AssetParts) == 0 {
+		src, err := up.downloadReleaseAsset(ctx, rel, releaseFile{id: rel.AssetID, name: rel.AssetName, url: rel.AssetURL})
+		if err != nil {
+			return nil, "", err
+		}
+
+		return src, rel.AssetURL, nil
+	}
+
+	log.Println("Downloading", len(rel.AssetParts), "parts of split asset", rel.assetName())
+
+	src := &assetPartsReader{
+		parts: rel.AssetParts,
+		open: func(p AssetPart) (io.ReadCloser, error) {
+			return up.downloadReleaseAsset(ctx, rel, releaseFile{id: p.ID, name: p.Name, url: p.URL, kind: "part "})
+		},
+	}
+
+	// The URL of the first part does not have the file extension of the joined asset
+	return src, rel.assetName(), nil
+}
+
+// checkAssetSize checks the size of a reassembled split asset against the sum of the sizes of its parts.
+func checkAssetSize(rel *Release, size int64) error {
+	if len(rel.AssetParts) > 0 && rel.AssetByteSize > 0 && size != int64(rel.AssetByteSize) {
+		return fmt.Errorf("size of reassembled asset %s mismatch: expected=%d, got=%d", rel.assetName(), rel.AssetByteSize, size)
+	}
+
+	return nil
+}
+
+// fetchValidationData returns the data to validate the release with. It is fetched from GitHub API for remote
+// validators, or the validation asset is downloaded otherwise.
+func (up *Updater) fetchValidationData(ctx context.Context, rel *Release, release []byte) ([]byte, error) {
+	if v, ok := up.validator.(remoteValidator); ok {
+		return v.fetchValidationData(ctx, up.api, rel, release)
+	}
+
+	return up.downloadValidationAsset(ctx, rel)
+}
+
+// downloadValidationAsset downloads the validation asset. When the validator requires the validation asset to be
+// signed, its signature is verified as well.
+func (up *Updater) downloadValidationAsset(ctx context.Context, rel *Release) ([]byte, error) {
+	file, sigFile, err := up.validationFiles(ctx, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	validationData, err := up.downloadValidationFile(ctx, rel, file)
+	if err != nil {
+		return nil, err
+	}
+
+	reportValidationAsset(ctx, file.name)
+
+	if sig := signatureValidator(up.validator); sig != nil {
+		if err := up.validateSignature(ctx, rel, sig, file.name, sigFile, validationData); err != nil {
+			return nil, err
+		}
+	}
+
+	return validationData, nil
+}
 
-	validationData, err := io.ReadAll(validationSrc)
+// validateSignature verifies the signature of the validation asset before the validation asset is trusted.
+func (up *Updater) validateSignature(ctx context.Context, rel *Release, sig Validator, name string, sigFile releaseFile, validationData []byte) error {
+	sigData, err := up.downloadValidationFile(ctx, rel, sigFile)
 	if err != nil {
-		return fmt.Errorf("failed reading validation asset body: %w", err)
+		return err
+	}
+
+	if name == "" {
+		name = validationAssetName(up.validator, rel.assetName())
+	}
+
+	if err := validateAsset(sig, name, validationData, sigData); err != nil {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating signature of validation asset %s: %w", name, err))
+	}
+
+	log.Println("Signature of validation asset", name, "was verified")
+
+	reportValidationAsset(ctx, sigFile.name)
+
+	if d, ok := innerValidator(sig).(signerDescriber); ok {
+		if r := verificationReport(ctx); r != nil {
+			r.Signer = d.signer(sigData)
+		}
 	}
 
-	if err := up.validator.Validate(data, validationData); err != nil {
-		return fmt.Errorf("failed validating asset content: %w", err)
+	return nil
+}
+
+func (up *Updater) applyWithProgress(ctx context.Context, rel *Release, src io.Reader, assetURL, cmdPath string, current Progress, progress func(Progress)) error {
+	current.Phase = ProgressApplying
+	progress(current)
+
+	// Extracting a huge executable can also be aborted
+	p := up.platform()
+	cmds := archiveBinaryNames(cmdPath, up.binaryName, up.binaryAlts, p.goos)
+
+	if err := uncompressAndUpdate(&contextReader{ctx: ctx, src: src}, assetURL, cmdPath, cmds, up.zipPassword, up.plain, p, up.executableArchs(), up.applyHooks(rel)); err != nil {
+		return err
 	}
 
-	return uncompressAndUpdate(bytes.NewReader(data), rel.AssetURL, cmdPath)
+	current.Phase = ProgressDone
+	progress(current)
+
+	return nil
+}
+
+// UpdateToWithResult is the same as UpdateTo, but it returns a summary of the update. Since the current version of
+// the executable is unknown here, PreviousVersion of the result is left empty.
+func (up *Updater) UpdateToWithResult(rel *Release, cmdPath string) (*UpdateResult, error) {
+	return up.updateToWithResult(rel, semver.Version{}, cmdPath, time.Now())
+}
+
+// updateToWithResult is the same as UpdateTo, but it also records the metadata of the downloaded files in the result.
+func (up *Updater) updateToWithResult(rel *Release, previous semver.Version, cmdPath string, start time.Time) (*UpdateResult, error) {
+	ctx, rec := withDownloadRecorder(up.apiCtx)
+	ctx, report := withVerificationReport(ctx)
+
+	if err := up.updateTo(ctx, rel, cmdPath, func(Progress) {}); err != nil {
+		return nil, err
+	}
+
+	res := up.newUpdateResult(rel, previous, cmdPath, start)
+	res.Downloads = rec.result()
+	res.DownloadPath = rec.keptAsset()
+
+	if up.validator != nil || up.provenance != nil || up.signedTag || up.expectCommit != "" {
+		res.Verification = report
+	}
+
+	return res, nil
+}
+
+func (up *Updater) newUpdateResult(rel *Release, previous semver.Version, cmdPath string, start time.Time) *UpdateResult {
+	return &UpdateResult{
+		PreviousVersion: previous,
+		NewVersion:      rel.Version,
+		Release:         rel,
+		Updated:         true,
+		TargetPath:      cmdPath,
+		AssetName:       rel.assetName(),
+		Validated:       up.validator != nil,
+		Duration:        time.Since(start),
+	}
 }
 
 // UpdateCommand updates a given command binary to the latest version.
 // 'slug' represents 'owner/name' repository on GitHub and 'current' means the current version.
+// Use UpdateCommandWithResult to get the summary of the update.
 func (up *Updater) UpdateCommand(cmdPath string, current semver.Version, slug string) (*Release, error) {
-	if runtime.GOOS == "windows" && !strings.HasSuffix(cmdPath, ".exe") {
+	res, err := up.UpdateCommandWithResult(cmdPath, current, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Release == nil {
+		return &Release{Version: res.PreviousVersion}, nil
+	}
+
+	return res.Release, nil
+}
+
+// UpdateCommandWithResult updates a given command binary to the latest version and returns the summary of the update.
+// 'slug' represents 'owner/name' repository on GitHub and 'current' means the current version. When 'current' is zero
+// and Config.CurrentVersionFunc is set, the current version is read from the command binary with it instead.
+// When no release is detected or the current version is the latest, Updated of the result is false.
+func (up *Updater) UpdateCommandWithResult(cmdPath string, current semver.Version, slug string) (*UpdateResult, error) {
+	start := time.Now()
+
+	if up.platform().goos == windows && !strings.HasSuffix(strings.ToLower(cmdPath), ".exe") {
 		// Ensure to add '.exe' to given path on Windows
 		cmdPath += ".exe"
 	}
@@ -125,7 +977,13 @@ func (up *Updater) UpdateCommand(cmdPath string, current semver.Version, slug st
 		return nil, fmt.Errorf("failed to stat '%s'. File may not exist: %w", cmdPath, err)
 	}
 
-	if stat.Mode()&os.ModeSymlink != 0 {
+	if err := checkManagedInstall(cmdPath, up.managed); err != nil {
+		return nil, err
+	}
+
+	if stat.Mode()&os.ModeSymlink != 0 && up.replaceLinks {
+		log.Println("Symlink", cmdPath, "will be replaced with the new executable")
+	} else if stat.Mode()&os.ModeSymlink != 0 {
 		p, err := filepath.EvalSymlinks(cmdPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to resolve symlink '%s' for executable: %w", cmdPath, err)
@@ -134,6 +992,17 @@ func (up *Updater) UpdateCommand(cmdPath string, current semver.Version, slug st
 		cmdPath = p
 	}
 
+	if up.currentVer != nil && current.Equals(semver.Version{}) {
+		v, err := up.currentVer(cmdPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the current version of '%s': %w", cmdPath, err)
+		}
+
+		log.Println("Current version of", cmdPath, "is", v)
+
+		current = v
+	}
+
 	rel, ok, err := up.DetectLatest(slug)
 	if err != nil {
 		return nil, err
@@ -142,28 +1011,70 @@ func (up *Updater) UpdateCommand(cmdPath string, current semver.Version, slug st
 	if !ok {
 		log.Println("No release detected. Current version is considered up-to-date")
 
-		return &Release{Version: current}, nil
+		return &UpdateResult{PreviousVersion: current, NewVersion: current, TargetPath: cmdPath, Duration: time.Since(start)}, nil
 	}
 
 	if current.Equals(rel.Version) {
 		log.Println("Current version", current, "is the latest. Update is not needed")
 
-		return rel, nil
+		res := up.newUpdateResult(rel, current, cmdPath, start)
+		res.Updated = false
+		res.Validated = false
+
+		return res, nil
 	}
 
 	log.Println("Will update", cmdPath, "to the latest version", rel.Version)
 
-	if err := up.UpdateTo(rel, cmdPath); err != nil {
-		return nil, err
+	return up.updateToWithResult(rel, current, cmdPath, start)
+}
+
+// executablePath returns the path of the running executable. os.Executable resolves symlinks on some OSes such as
+// Linux, so the path the executable was invoked with is looked up when symlinks are replaced in place. Otherwise
+// symlinks are followed by UpdateCommand.
+func (up *Updater) executablePath() (string, error) {
+	p, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the path of the running executable: %w", err)
+	}
+
+	if !up.replaceLinks || len(os.Args) == 0 {
+		return p, nil
 	}
 
-	return rel, nil
+	invoked, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return p, nil
+	}
+
+	invoked, err = filepath.Abs(invoked)
+	if err != nil {
+		return p, nil
+	}
+
+	st, err := os.Lstat(invoked)
+	if err != nil || st.Mode()&os.ModeSymlink == 0 {
+		return p, nil
+	}
+
+	// Use the invoked path only when it is a symlink to the running executable
+	resolved, err := filepath.EvalSymlinks(invoked)
+	if err != nil {
+		return p, nil
+	}
+
+	if real, err := filepath.EvalSymlinks(p); err != nil || real != resolved {
+		return p, nil
+	}
+
+	return invoked, nil
 }
 
 // UpdateSelf updates the running executable itself to the latest version.
 // 'slug' represents 'owner/name' repository on GitHub and 'current' means the current version.
+// Use UpdateSelfWithResult to get the summary of the update.
 func (up *Updater) UpdateSelf(current semver.Version, slug string) (*Release, error) {
-	cmdPath, err := os.Executable()
+	cmdPath, err := up.executablePath()
 	if err != nil {
 		return nil, err
 	}
@@ -171,6 +1082,17 @@ func (up *Updater) UpdateSelf(current semver.Version, slug string) (*Release, er
 	return up.UpdateCommand(cmdPath, current, slug)
 }
 
+// UpdateSelfWithResult updates the running executable itself to the latest version and returns the summary of the update.
+// 'slug' represents 'owner/name' repository on GitHub and 'current' means the current version.
+func (up *Updater) UpdateSelfWithResult(current semver.Version, slug string) (*UpdateResult, error) {
+	cmdPath, err := up.executablePath()
+	if err != nil {
+		return nil, err
+	}
+
+	return up.UpdateCommandWithResult(cmdPath, current, slug)
+}
+
 // UpdateTo downloads an executable from assetURL and replace the current binary with the downloaded one.
 // This function is low-level API to update the binary. Because it does not use GitHub API and downloads asset directly from the URL via HTTP,
 // this function is not available to update a release for private repositories.
@@ -184,7 +1106,21 @@ func UpdateTo(assetURL, cmdPath string) error {
 	}
 	defer src.Close()
 
-	return uncompressAndUpdate(src, assetURL, cmdPath)
+	p := runtimePlatform()
+
+	return uncompressAndUpdate(src, assetURL, cmdPath, archiveBinaryNames(cmdPath, "", nil, p.goos), "", nil, p, nil, applyHooks{})
+}
+
+// WriteUpdateTo writes the verified executable of the release to w instead of installing it.
+// This function is a shortcut version of updater.WriteUpdateTo.
+func WriteUpdateTo(ctx context.Context, rel *Release, w io.Writer) (int64, error) {
+	return DefaultUpdater().WriteUpdateTo(ctx, rel, w)
+}
+
+// UpdateToAsset updates the executable at targetPath with the asset named assetName of the release.
+// This function is a shortcut version of updater.UpdateToAsset.
+func UpdateToAsset(rel *Release, assetName, targetPath string) error {
+	return DefaultUpdater().UpdateToAsset(rel, assetName, targetPath)
 }
 
 // UpdateCommand updates a given command binary to the latest version.
@@ -198,3 +1134,15 @@ func UpdateCommand(cmdPath string, current semver.Version, slug string) (*Releas
 func UpdateSelf(current semver.Version, slug string) (*Release, error) {
 	return DefaultUpdater().UpdateSelf(current, slug)
 }
+
+// UpdateCommandWithResult updates a given command binary to the latest version and returns the summary of the update.
+// This function is a shortcut version of updater.UpdateCommandWithResult.
+func UpdateCommandWithResult(cmdPath string, current semver.Version, slug string) (*UpdateResult, error) {
+	return DefaultUpdater().UpdateCommandWithResult(cmdPath, current, slug)
+}
+
+// UpdateSelfWithResult updates the running executable itself to the latest version and returns the summary of the update.
+// This function is a shortcut version of updater.UpdateSelfWithResult.
+func UpdateSelfWithResult(current semver.Version, slug string) (*UpdateResult, error) {
+	return DefaultUpdater().UpdateSelfWithResult(current, slug)
+}
@@ -1,6 +1,14 @@
 package selfupdate
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -351,3 +359,714 @@ func TestUpdateFromGitHubPrivateRepo(t *testing.T) {
 		t.Error("Output from test binary after update is unexpected:", out)
 	}
 }
+
+// headStreamValidator reads only the first bytes of the release and accepts it
+type headStreamValidator struct{}
+
+func (v *headStreamValidator) Validate(release, asset []byte) error { return nil }
+func (v *headStreamValidator) Suffix() string                       { return ".sha256" }
+func (v *headStreamValidator) ValidateStream(release io.Reader, asset []byte) error {
+	_, err := io.ReadFull(release, make([]byte, 10))
+	return err
+}
+
+func TestUpdateWithStreamValidator(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	w, err := z.Create("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(exe); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	asset := buf.Bytes()
+	name := platformAssetName("foo", ".zip")
+
+	for _, tc := range []struct {
+		validator Validator
+		err       string
+	}{
+		{&SHA2Validator{}, ""},
+		{&NamedValidator{Validator: &SHA2Validator{}, Template: "{{asset}}.sha256"}, ""},
+		{&headStreamValidator{}, "validator did not read the last"},
+	} {
+		t.Run(fmt.Sprintf("%T", tc.validator), func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{
+				tag: "v1.2.3",
+				assets: []fakeAsset{
+					{name: name, content: asset},
+					{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+				},
+			})
+			up, _ := newTestUpdater(t, Config{Validator: tc.validator}, gh)
+
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Error should contain %q but got %v", tc.err, err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateWithValidateTarget(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	for _, tc := range []struct {
+		what   string
+		target ValidationTarget
+		hashed []byte
+		ok     bool
+	}{
+		{"archive", ValidateArchive, asset, true},
+		{"binary", ValidateBinary, exe, true},
+		{"binary checksum for archive", ValidateArchive, exe, false},
+		{"archive checksum for binary", ValidateBinary, asset, false},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{
+				tag: "v1.2.3",
+				assets: []fakeAsset{
+					{name: name, content: asset},
+					{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(tc.hashed)))},
+				},
+			})
+			up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}, ValidateTarget: tc.target}, gh)
+
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if !tc.ok {
+				if err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+					t.Fatal("Validation should fail:", err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateStreamingBinaryValidation(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	// An entry after the executable must be read for the digest of the whole asset
+	readme := bytes.Repeat([]byte("readme "), 100000)
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{{"foo", exe}, {"README", readme}} {
+		w, err := z.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ext   string
+		asset []byte
+	}{
+		{".tar.gz", tarGz(t, map[string][]byte{"foo": exe, "README": readme})},
+		{".zip", buf.Bytes()},
+		{"", exe},
+	} {
+		t.Run("asset"+tc.ext, func(t *testing.T) {
+			name := platformAssetName("foo", tc.ext)
+			sum := fmt.Sprintf("%x", sha256.Sum256(exe))
+
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{
+				tag: "v1.2.3",
+				assets: []fakeAsset{
+					{name: name, content: tc.asset},
+					{name: "checksums.txt", content: []byte(sum + "  " + name + "\n")},
+				},
+			})
+			up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}, ValidateTarget: ValidateBinary}, gh)
+
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := setupOldExecutable(t)
+			res, err := up.UpdateToWithResult(rel, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+
+			rep := res.Verification
+			if want := fmt.Sprintf("%x", sha256.Sum256(tc.asset)); rep.SHA256 != want {
+				t.Errorf("Digest of asset should be %s but got %s", want, rep.SHA256)
+			}
+			if len(rep.Digests) != 1 || rep.Digests[0].Computed != sum || rep.Target != ValidateBinary {
+				t.Errorf("Unexpected report: %+v", rep)
+			}
+		})
+	}
+}
+
+func TestUpdateStreamingBinaryValidationMismatch(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag: "v1.2.3",
+		assets: []fakeAsset{
+			{name: name, content: tarGz(t, map[string][]byte{"foo": exe})},
+			{name: "checksums.txt", content: []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("other")), name))},
+		},
+	})
+	up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}, ValidateTarget: ValidateBinary}, gh)
+
+	path := setupOldExecutable(t)
+	_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+	if err == nil || !strings.Contains(err.Error(), "failed validating executable in asset") {
+		t.Fatal("Validation should fail:", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Old executable should be kept but got %q", b)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Fatal("New executable should not be written:", matches)
+	}
+}
+
+func TestUpdateWithArchiveBinaryName(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	server := "server"
+	if runtime.GOOS == "windows" {
+		server += ".exe"
+	}
+	asset := tarGz(t, map[string][]byte{server: exe})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag:    "v1.2.3",
+		assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: asset}},
+	})
+
+	up, _ := newTestUpdater(t, Config{}, gh)
+	if _, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatal("Executable with other name should not be found:", err)
+	}
+
+	for _, config := range []Config{
+		{ArchiveBinaryName: "server"},
+		{ArchiveBinaryAlternatives: []string{"foo-cli", "server"}},
+	} {
+		up, _ = newTestUpdater(t, config, gh)
+		path := setupOldExecutable(t)
+		if _, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, exe) {
+			t.Fatalf("Executable was not updated: %q", b)
+		}
+	}
+}
+
+func TestUpdateWasmTarget(t *testing.T) {
+	module := append([]byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}, "new module"...)
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/wasi", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "native")})},
+		{name: "foo_wasip1_wasm.wasm", content: module},
+	}})
+	gh.addRelease("owner/js", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_js_wasm.tar.gz", content: tarGz(t, map[string][]byte{"foo_js_wasm.wasm": module})},
+	}})
+	gh.addRelease("owner/broken", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_wasip1_wasm.wasm", content: []byte("not a module")},
+	}})
+
+	for _, tc := range []struct {
+		slug string
+		os   string
+		want string
+	}{
+		{"owner/wasi", "wasip1", ""},
+		{"owner/js", "js", ""},
+		{"owner/broken", "wasip1", "magic number of an executable for wasip1"},
+	} {
+		t.Run(tc.slug, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "foo.wasm")
+			if err := ioutil.WriteFile(path, []byte("old module"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			up, _ := newTestUpdater(t, Config{OS: tc.os, Arch: "wasm"}, gh)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), tc.slug)
+			if tc.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("wanted %q in error but got %v", tc.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, module) {
+				t.Fatalf("module was not updated: %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateWindowsBareExecutable(t *testing.T) {
+	exe := append([]byte("MZ\x90\x00"), "new executable"...)
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/platform", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_linux_amd64.tar.gz", content: tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "linux")})},
+		{name: "foo_windows_amd64.exe", content: exe},
+	}})
+	gh.addRelease("owner/bare", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_linux_amd64.tar.gz", content: tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "linux")})},
+		{name: "foo.exe", content: exe},
+	}})
+	gh.addRelease("owner/ambiguous", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo.exe", content: exe},
+		{name: "foo-cli.exe", content: exe},
+	}})
+	gh.addRelease("owner/other-arch", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_windows_arm64.exe", content: exe},
+	}})
+
+	for _, tc := range []struct {
+		slug string
+		cmd  string
+		want string
+	}{
+		{"owner/platform", "foo.exe", string(exe)},
+		{"owner/bare", "foo.exe", string(exe)},
+		{"owner/bare", "foo", string(exe)},
+		{"owner/ambiguous", "foo.exe", "old executable"},
+		{"owner/other-arch", "foo.exe", "old executable"},
+	} {
+		t.Run(tc.slug+" "+tc.cmd, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "foo.exe")
+			if err := ioutil.WriteFile(path, []byte("old executable"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			up, _ := newTestUpdater(t, Config{OS: "windows", Arch: "amd64"}, gh)
+			if _, err := up.UpdateCommand(filepath.Join(dir, tc.cmd), semver.MustParse("1.2.2"), tc.slug); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.want {
+				t.Fatalf("wanted executable %q but got %q", tc.want, b)
+			}
+		})
+	}
+}
+
+func TestReleaseDownload(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+	hash := sha256.Sum256(asset)
+
+	for _, tc := range []struct {
+		what   string
+		config Config
+		sum    string
+		err    string
+	}{
+		{"no validator", Config{}, "", ""},
+		{"valid", Config{Validator: &SHA2Validator{}}, fmt.Sprintf("%x", hash), ""},
+		{"hash mismatch", Config{Validator: &SHA2Validator{}}, strings.Repeat("0", 64), "failed validating asset content"},
+		{"binary name", Config{ArchiveBinaryName: "bar"}, "", "is not found in"},
+		{"validation required", Config{RequireValidation: true}, "", "RequireValidation"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			assets := []fakeAsset{{name: name, content: asset}}
+			if tc.sum != "" {
+				assets = append(assets, fakeAsset{name: name + ".sha256", content: []byte(tc.sum)})
+			}
+
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: assets})
+			up, _ := newTestUpdater(t, tc.config, gh)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Release was not detected:", ok, err)
+			}
+
+			r, err := rel.Download(context.Background())
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Error should contain %q but got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Unexpected executable: %q", b)
+			}
+		})
+	}
+}
+
+func TestWriteUpdateTo(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	name := platformAssetName("foo", ".tar.gz")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	broken := tarGz(t, map[string][]byte{"foo": []byte("<html>Not Found</html>")})
+	hash := sha256.Sum256(asset)
+
+	for _, tc := range []struct {
+		what   string
+		asset  []byte
+		config Config
+		sum    string
+		err    string
+	}{
+		{"no validator", asset, Config{}, "", ""},
+		{"valid", asset, Config{Validator: &SHA2Validator{}}, fmt.Sprintf("%x", hash), ""},
+		{"hash mismatch", asset, Config{Validator: &SHA2Validator{}}, strings.Repeat("0", 64), "failed validating asset content"},
+		{"not executable", broken, Config{}, "", "is broken"},
+		{"validation required", asset, Config{RequireValidation: true}, "", "RequireValidation"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			assets := []fakeAsset{{name: name, content: tc.asset}}
+			if tc.sum != "" {
+				assets = append(assets, fakeAsset{name: name + ".sha256", content: []byte(tc.sum)})
+			}
+
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: assets})
+			up, _ := newTestUpdater(t, tc.config, gh)
+
+			rel, ok, err := up.DetectLatest("owner/repo")
+			if err != nil || !ok {
+				t.Fatal("Release was not detected:", ok, err)
+			}
+
+			var buf bytes.Buffer
+			n, err := up.WriteUpdateTo(context.Background(), rel, &buf)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Error should contain %q but got %v", tc.err, err)
+				}
+				if n != 0 || buf.Len() != 0 {
+					t.Fatalf("Nothing should be written on error but got %q", buf.Bytes())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), exe) || n != int64(len(exe)) {
+				t.Fatalf("Unexpected executable (%d bytes written): %q", n, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestUpdateCommandSymlinkMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping because creating symlink on windows requires the root privilege")
+	}
+
+	exe := fakeExecutableContent(t, "v1.2.3")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{
+		tag:    "v1.2.3",
+		assets: []fakeAsset{{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": exe})}},
+	})
+
+	for _, replace := range []bool{false, true} {
+		t.Run(fmt.Sprint("replace=", replace), func(t *testing.T) {
+			real := setupOldExecutable(t)
+			link := filepath.Join(t.TempDir(), "foo")
+			if err := os.Symlink(real, link); err != nil {
+				t.Fatal(err)
+			}
+
+			up, _ := newTestUpdater(t, Config{ReplaceSymlinks: replace}, gh)
+			res, err := up.UpdateCommandWithResult(link, semver.MustParse("1.2.2"), "owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			st, err := os.Lstat(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(real)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if replace {
+				if st.Mode()&os.ModeSymlink != 0 || res.TargetPath != link {
+					t.Fatal("Symlink should be replaced in place:", st.Mode(), res.TargetPath)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("File pointed by the symlink should be kept but got %q", b)
+				}
+				return
+			}
+
+			if st.Mode()&os.ModeSymlink == 0 || res.TargetPath != real {
+				t.Fatal("Symlink should be kept and followed:", st.Mode(), res.TargetPath)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("File pointed by the symlink was not updated: %q", b)
+			}
+		})
+	}
+}
+
+func TestUpdateWithTempDir(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: "checksums.txt", content: []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(asset), name))},
+	}})
+	gh.addRelease("owner/binary", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: "checksums.txt", content: []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(exe), name))},
+	}})
+
+	for _, tc := range []struct {
+		slug   string
+		target ValidationTarget
+	}{
+		{"owner/repo", ValidateArchive},
+		{"owner/binary", ValidateBinary},
+	} {
+		t.Run(tc.slug, func(t *testing.T) {
+			dir := t.TempDir()
+			up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}, ValidateTarget: tc.target, TempDir: dir}, gh)
+			path := setupOldExecutable(t)
+			if _, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), tc.slug); err != nil {
+				t.Fatal(err)
+			}
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Fatal("Temporary files should be removed:", files)
+			}
+
+			missing := filepath.Join(dir, "missing")
+			up, _ = newTestUpdater(t, Config{Validator: &ChecksumValidator{}, ValidateTarget: tc.target, TempDir: missing}, gh)
+			_, err = up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), tc.slug)
+			if err == nil || !strings.Contains(err.Error(), missing) {
+				t.Fatal("Temporary file should be created in TempDir:", err)
+			}
+		})
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	err := ApplyFromReader(bytes.NewReader(asset), setupOldExecutable(t), ApplyOptions{
+		AssetName:      name,
+		Validator:      &ChecksumValidator{},
+		ValidationData: []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(asset), name)),
+		TempDir:        missing,
+	})
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Fatal("Temporary file should be created in TempDir:", err)
+	}
+}
+
+func TestUpdateToAsset(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	v3 := fakeExecutableContent(t, "v1.2.3 for x86-64-v3")
+	name := platformAssetName("foo", ".tar.gz")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	// The asset for the micro-architecture level is not matched with the platform
+	v3Name := strings.TrimSuffix(name, ".tar.gz") + "_v3.tar.gz"
+	v3Asset := tarGz(t, map[string][]byte{"foo": v3})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: v3Name, content: v3Asset},
+		{name: "checksums.txt", content: []byte(fmt.Sprintf("%x  %s\n%x  %s\n", sha256.Sum256(asset), name, sha256.Sum256(v3Asset), v3Name))},
+	}})
+	up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}}, gh)
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || rel.AssetName != name {
+		t.Fatal("Asset for the platform should be detected:", rel)
+	}
+
+	path := setupOldExecutable(t)
+	if err := up.UpdateToAsset(rel, v3Name, path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, v3) {
+		t.Fatalf("Executable should be updated with the named asset but got %q", b)
+	}
+
+	path = setupOldExecutable(t)
+	if err := up.UpdateToAsset(rel, "foo_plan9_amd64.tar.gz", path); !errors.Is(err, ErrAssetNotFound) {
+		t.Fatal("Missing asset should be reported:", err)
+	}
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Old executable should be kept but got %q", b)
+	}
+
+	if err := up.UpdateToAsset(&Release{Version: rel.Version}, v3Name, path); err == nil || !strings.Contains(err.Error(), "was not detected") {
+		t.Fatal("Release not detected by an updater should be rejected:", err)
+	}
+}
+
+func TestUpdateWithoutValidator(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(ioutil.Discard)
+
+	exe := fakeExecutableContent(t, "v1.2.3")
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: platformAssetName("foo", ".tar.gz"), content: tarGz(t, map[string][]byte{"foo": exe})},
+	}})
+
+	up, _ := newTestUpdater(t, Config{}, gh)
+	for i := 0; i < 2; i++ {
+		if _, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), "No validator is configured"); n != 1 {
+		t.Fatalf("Warning should be logged once but got %d times: %q", n, buf.String())
+	}
+
+	up, _ = newTestUpdater(t, Config{RequireValidation: true}, gh)
+	path := setupOldExecutable(t)
+	_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+	if !errors.Is(err, ErrValidationFailed) || !strings.Contains(err.Error(), "RequireValidation") {
+		t.Fatal("Update without validator should fail:", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old executable" {
+		t.Fatalf("Old executable should be kept but got %q", b)
+	}
+
+	buf.Reset()
+	up, _ = newTestUpdater(t, Config{Validator: &SHA2Validator{}, RequireValidation: true}, gh)
+	if _, err := up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo"); errors.Is(err, ErrValidationFailed) && strings.Contains(err.Error(), "RequireValidation") {
+		t.Fatal("Validator is configured:", err)
+	}
+	if strings.Contains(buf.String(), "No validator is configured") {
+		t.Fatal("No warning should be logged with validator:", buf.String())
+	}
+}
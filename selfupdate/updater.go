@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/google/go-github/v30/github"
@@ -16,9 +21,21 @@ import (
 
 type UpdaterIn interface {
 	DetectLatest(slug string) (release *Release, found bool, err error)
+	DetectLatestIncludingAssets(slug string) (release *Release, found bool, err error)
+	DetectLatestBatch(ctx context.Context, slugs []string) (map[string]*Release, error)
+	DetectStable(slug string) (release *Release, found bool, err error)
+	DetectChannels(slug string) (map[string]*Release, error)
 	DetectVersion(slug string, version string) (release *Release, found bool, err error)
+	IsUpdateAvailable(slug string, current semver.Version) (bool, *Release, error)
+	FindRelease(slug string, version string) (*Release, error)
+	CompareVersions(a, b string) (int, error)
+	VersionsBehind(slug string, current semver.Version) (int, error)
+	ListReleases(ctx context.Context, slug string, fn func(releases []*Release) bool) error
 	downloadDirectlyFromURL(assetURL string) (io.ReadCloser, error)
 	UpdateTo(rel *Release, cmdPath string) error
+	UpdateToAsset(rel *Release, assetName, targetPath string) error
+	ExtractRelease(ctx context.Context, rel *Release, destDir string) ([]string, error)
+	WriteUpdateTo(ctx context.Context, rel *Release, w io.Writer) (int64, error)
 	UpdateCommand(cmdPath string, current semver.Version, slug string) (*Release, error)
 	UpdateSelf(current semver.Version, slug string) (*Release, error)
 }
@@ -26,12 +43,69 @@ type UpdaterIn interface {
 // Updater is responsible for managing the context of self-update.
 // It contains GitHub client and its context.
 type Updater struct {
-	api       *github.Client
-	apiCtx    context.Context //nolint:containedctx
-	validator Validator
-	filters   []*regexp.Regexp
-	pre       bool
-	draft     bool
+	api           *github.Client
+	apiCtx        context.Context //nolint:containedctx
+	validator     Validator
+	filters       []*regexp.Regexp
+	pre           bool
+	draft         bool
+	strategy      SelectionStrategy
+	preference    AssetPreference
+	zipPassword   string
+	split         *regexp.Regexp
+	target        ValidationTarget
+	extensions    []string
+	binaryName    string
+	binaryAlts    []string
+	maxRedirects  int
+	downloader    Downloader
+	provenance    *SLSAProvenanceVerifier
+	urlMode       AssetURLMode
+	hasToken      bool
+	token         string
+	retry         retryConfig
+	cacheDir      string
+	checkMagic    bool
+	concurrency   int
+	tagPrefix     string
+	tagFilter     *regexp.Regexp
+	versionSource VersionSource
+	versionParser func(string) (semver.Version, error)
+	emulation     bool
+	goos          string
+	goarch        string
+	replaceLinks  bool
+	validCacheDir string
+	rewriteURL    func(string) (string, error)
+	managed       []string
+	signedTag     bool
+	tagSigners    []string
+	expectCommit  string
+	plain         []string
+	headers       map[string]string
+	decorate      func(*http.Request)
+	valSource     *ValidationSource
+	skipVersions  []semver.Version
+	checkPlatform bool
+	tempDir       string
+	downloadDir   string
+	requireVal    bool
+	warnUnsigned  sync.Once
+	digests       *assetDigests
+	latestFlag    bool
+	commit        func(string, string) error
+	smokeTest     func(string) error
+	smokeArgs     []string
+	skipNoAsset   bool
+	fileMode      os.FileMode
+	verifyInst    bool
+	skipExeCheck  bool
+	source        SourceArchive
+	strictVers    bool
+	valFiles      *validationFileCache
+	relCache      ReleaseCache
+	useStale      bool
+	currentVer    func(string) (semver.Version, error)
 }
 
 // Config represents the configuration of self-update.
@@ -44,8 +118,22 @@ type Config struct {
 	// EnterpriseUploadURL is a URL to upload stuffs to GitHub Enterprise instance. This is often the same as an API base URL.
 	// So if this field is not set and EnterpriseBaseURL is set, EnterpriseBaseURL is also set to this field.
 	EnterpriseUploadURL string
-	// Validator represents types which enable additional validation of downloaded release.
+	// EnterpriseExactURL uses EnterpriseBaseURL and EnterpriseUploadURL as the exact base paths of the API. By default
+	// "api/v3/" is appended to the URLs not ending with "/api/v3/", which breaks deployments serving the API under
+	// another path such as "https://code.example.com/github-api/v3/" behind a reverse proxy.
+	EnterpriseExactURL bool
+	// Validator represents types which enable additional validation of downloaded release. When it is nil, a warning
+	// is logged once per Updater on the first update since the release assets are applied without being verified.
 	Validator Validator
+	// RequireValidation makes updates fail with an error matching ErrValidationFailed when Validator is nil, instead
+	// of applying unverified release assets with a warning. Set it to make sure that a misconfiguration never skips
+	// the verification of signed releases.
+	RequireValidation bool
+	// PlatformValidators maps a platform to the validator of its release assets when platforms are signed differently,
+	// e.g. {"windows": authenticode, "linux/amd64": pgp}. The key is 'os/arch' or 'os' of the target platform
+	// (Config.OS and Config.Arch), and 'os/arch' takes precedence. Validator is used for the platforms not in the map.
+	// A nil value disables the validation for the platform.
+	PlatformValidators map[string]Validator
 	// Filters are regexp used to filter on specific assets for releases with multiple assets.
 	// An asset is selected if it matches any of those, in addition to the regular tag, os, arch, extensions.
 	// Please make sure that your filter(s) uniquely match an asset.
@@ -54,6 +142,313 @@ type Config struct {
 	PreRelease bool
 	// Draft indicates if drafts are allowed.
 	Draft bool
+	// SelectionStrategy specifies how the latest release is picked. HighestVersion is used by default.
+	SelectionStrategy SelectionStrategy
+	// AssetPreference specifies which asset of a release is selected when both an archived asset and a bare executable
+	// match the platform, such as 'foo_linux_amd64.tar.gz' and 'foo_linux_amd64'. PreferArchive is used by default.
+	// Since the validation file is looked up for the selected asset, pick the one which Validator expects, e.g.
+	// PreferBare when '.sha256' files are published only for the bare executables, or PreferAuto to select the asset
+	// having its validation file in each release. A checksum file shared by all assets works with any of them.
+	AssetPreference AssetPreference
+	// SourceArchive selects the source archive which GitHub generates for the tag of each release as its asset instead
+	// of the asset built for the platform, e.g. for tools built or interpreted from their sources on update. It
+	// bypasses the matching of assets with the platform, and Filters and AssetPreference are ignored. The asset is
+	// named '<repo>-<tag>.tar.gz' or '<repo>-<tag>.zip', and its validation file is looked up with the name. Use
+	// ExtractRelease to extract the files of the source archive into a directory. SourceArchiveNone is the default.
+	SourceArchive SourceArchive
+	// UseGitHubLatestFlag detects the release marked as latest on GitHub as the latest release instead of selecting it
+	// from all releases with SelectionStrategy. Only the release from the '/releases/latest' endpoint is fetched, so
+	// maintainers can keep an older line as the recommended release. It is never a draft or a pre-release. No release
+	// is detected when it does not match the other options such as Filters or TagPrefix, or has no asset for the
+	// platform. Detecting a specific version is not affected.
+	UseGitHubLatestFlag bool
+	// SkipReleasesWithoutAssets detects the next-newest release having an asset for the platform when the latest one
+	// has none, e.g. a source-only release, in the cases where detection would fail otherwise: the release marked as
+	// latest on GitHub with UseGitHubLatestFlag has no asset, or the asset of the release has no validation file
+	// required by Validator. Releases newer than the one marked as latest are not considered. ErrAssetNotFound is
+	// returned by FindRelease only when none of the releases has a suitable asset. Releases without an asset are always
+	// skipped when the latest release is selected from all releases. Detecting a specific version is not affected.
+	SkipReleasesWithoutAssets bool
+	// ZipPassword is the password to decrypt the executable in zip assets encrypted with ZipCrypto or AES.
+	ZipPassword string
+	// PlainBinaryExtensions are the file extensions of release assets applied as uncompressed executables, such as
+	// '.exe'. An asset with another extension which is not any of the known archive formats fails with
+	// ErrUnsupportedFormat instead of being applied as a broken executable, e.g. '.dmg' or '.msi'. Assets without an
+	// extension are always applied as-is. DefaultPlainBinaryExtensions are used when nil
+	PlainBinaryExtensions []string
+	// SplitAssetPattern is a regular expression matching the suffix of release assets split into multiple parts,
+	// such as 'foo_linux_amd64.tar.gz.part01', 'foo_linux_amd64.tar.gz.part02', ... It must have exactly one capturing
+	// group for the part number. Parts are downloaded in the order of the part numbers and concatenated into one
+	// asset. Split assets are not detected when this field is empty. DefaultSplitAssetPattern is available for the
+	// convention above.
+	SplitAssetPattern string
+	// ValidateTarget specifies whether Validator validates the downloaded asset as-is or the executable extracted
+	// from it. ValidateArchive is used by default.
+	ValidateTarget ValidationTarget
+	// ExpectedDigest is the digest of the release asset in the form of 'sha256:<hex digest>' ('sha512' is also
+	// supported), pinned in code so that the asset is trusted only when it is the expected build, regardless of the
+	// checksum files which the release ships. When it is set, the downloaded asset is validated with it instead of
+	// Validator and PlatformValidators, and ValidateTarget is ignored. The update fails with an error matching
+	// ErrValidationFailed, telling both digests, on mismatch.
+	ExpectedDigest string
+	// AssetExtensions maps a GOOS such as "windows" to the file extension of the release assets for the platform,
+	// e.g. {"windows": ".zip", "default": ".tar.gz"}. The DefaultAssetExtensionKey entry is used for the platforms
+	// not in the map. An empty extension means an uncompressed executable. When no entry is found for the platform,
+	// all supported extensions are tried.
+	AssetExtensions map[string]string
+	// ArchiveBinaryName is the name of the executable in release assets when it differs from the name of the
+	// installed command, e.g. "server" for the command installed as 'mytool'. '.exe' is added on Windows when it is
+	// missing. When empty, the file name of the command being updated is looked up. A name containing any of '*', '?'
+	// and '[' is a glob pattern matched against the whole path of files relative to the root of the archive, where
+	// '**' matches zero or more directories, e.g. "**/bin/foo" to pick 'foo-1.2.3/bin/foo' rather than a wrapper
+	// script 'foo-1.2.3/foo'. Other names are matched against the base names of files.
+	ArchiveBinaryName string
+	// ArchiveBinaryAlternatives are other names of the executable in release assets, such as 'foo-cli' when the
+	// executable is named 'foo' or 'foo-cli' depending on the build. The first file in the asset matching
+	// ArchiveBinaryName (or the name of the installed command) or any of the alternatives is used.
+	ArchiveBinaryAlternatives []string
+	// MaxRedirects is the maximum number of redirects followed on downloading a release file. When it is exceeded,
+	// ErrTooManyRedirects is returned. DefaultMaxRedirects is used when zero. A negative value disallows redirects.
+	MaxRedirects int
+	// Downloader downloads release files from their browser download URLs instead of GitHub API when it is set.
+	// Since browser download URLs are not authenticated, it is not available for private repositories unless
+	// the downloader authenticates requests by itself. When nil, files are downloaded via GitHub API and the URLs
+	// redirected from it are fetched with HTTPDownloader.
+	Downloader Downloader
+	// Provenance verifies the SLSA provenance of the release asset before the update is applied. Releases without
+	// provenance fail to update unless SLSAProvenanceVerifier.Optional is set.
+	Provenance *SLSAProvenanceVerifier
+	// AssetURLMode specifies whether release files are downloaded from their browser download URLs or from the asset
+	// endpoint of GitHub API, e.g. when a proxy allows only one of the hosts. AssetURLAuto is used by default.
+	// It is ignored when Downloader is set.
+	AssetURLMode AssetURLMode
+	// RetryStatusCodes are the HTTP status codes of responses from GitHub API and download URLs which are retried,
+	// such as 502 Bad Gateway. DefaultRetryStatusCodes is used when nil. Set an empty slice to disable the retries.
+	// Responses telling that the rate limit is exhausted are never retried. Network errors are not retried either,
+	// except that the downloads of small validation files such as checksum files are retried on any transient failure.
+	RetryStatusCodes []int
+	// MaxRetries is the maximum number of retries of a request. DefaultMaxRetries is used when zero. A negative value
+	// disables the retries.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, which is doubled on each retry. DefaultRetryWait is used when zero.
+	RetryWait time.Duration
+	// WaitForRateLimit waits for the duration told by GitHub and retries the request when a secondary rate limit is
+	// exceeded by bursty access, up to 3 times per request. The wait is aborted when the context is cancelled.
+	// Otherwise, or when the primary rate limit is exhausted, *RateLimitError is returned.
+	WaitForRateLimit bool
+	// AssetCacheDir is a directory to keep the downloaded release files in. When a file is downloaded again, the
+	// request is made conditional with its ETag (If-None-Match) and Last-Modified (If-Modified-Since), and the cached
+	// copy is used when the server responds 304 Not Modified. Files are not cached when empty.
+	AssetCacheDir string
+	// ReleaseCache stores the release detected by DetectLatest, DetectVersion and the like on each successful
+	// detection, e.g. NewFileReleaseCache(dir) to persist it across restarts. Nothing is stored when nil. Failures of
+	// the cache are logged and do not fail the detection. The releases are keyed with the options selecting them, such
+	// as Filters, TagPrefix and SkipVersions, so that updaters configured differently can share a cache. Updaters with
+	// different VersionParser must not share a cache since it is not part of the key.
+	ReleaseCache ReleaseCache
+	// UseStaleRelease returns the release stored in ReleaseCache by the same detection last time, flagged with
+	// Release.Stale, instead of an error when GitHub API is unreachable: on network errors, server errors after the
+	// retries and exceeded rate limits. Whether a stale release is applied is up to the caller. Applying it still
+	// needs its asset, e.g. from Config.ValidatedAssetCacheDir. The error is returned when nothing is stored.
+	UseStaleRelease bool
+	// HTTPCache wraps the transport of the requests to GitHub API with an HTTP cache honoring cache headers, such as
+	// httpcache.NewTransport of github.com/gregjones/httpcache, so that the storage of the cache is controlled by
+	// the caller, e.g. in memory, on disk or in Redis shared by a fleet. base sends requests with the API token, retries
+	// and Config.RateLimiter. The returned transport must send requests which it cannot serve from the cache with base.
+	// Responses revalidated with 304 Not Modified do not count against the rate limit of GitHub API. Since responses
+	// are cached by URL regardless of the token, share a cache only among updaters with the same access. Downloads of
+	// release files are not sent via the cache; see AssetCacheDir for them.
+	HTTPCache func(base http.RoundTripper) http.RoundTripper
+	// CheckAssetMagic checks the first kilobyte of the release asset against the magic number of the format given by
+	// its file extension, and aborts the download immediately when it does not match, e.g. when the URL serves an HTML
+	// error page. It is disabled by default to avoid false positives on unusual formats.
+	CheckAssetMagic bool
+	// CheckExecutablePlatform checks that the executable extracted from the release asset was built for the target
+	// platform, i.e. runtime.GOARCH or Config.Arch, by reading the machine in its ELF, Mach-O or PE header before it
+	// is put in place, so that a mislabeled asset does not replace the executable with one which cannot run. A
+	// universal binary of macOS is accepted when it contains the arch, and the amd64 executable is also accepted on
+	// the platforms of EmulationFallback when it is enabled. Executables of unknown archs and WebAssembly modules are
+	// not checked. Disabled by default.
+	CheckExecutablePlatform bool
+	// TempDir is the directory of the intermediate files of updates, such as the release asset downloaded for
+	// validating it while it is streamed and the executable extracted from it, e.g. a volume mounted for them in a
+	// container whose root file system is read-only or too small for the asset. os.TempDir() is used when empty. The
+	// new executable itself is always written next to the executable being updated and renamed into place, since a
+	// rename is atomic only within the same file system, and the old executable is kept there until the update
+	// succeeds.
+	TempDir string
+	// DownloadDir is a directory to keep the release assets downloaded by the updater, as '<tag>/<asset name>' under
+	// it, e.g. for support teams to inspect what was fetched when an update misbehaves or to re-apply it later with
+	// ApplyFromReader. The path is reported in UpdateResult.DownloadPath. An asset is kept once it was downloaded
+	// completely, even when the update fails after that. Kept assets are never removed, and failing to keep one does
+	// not fail the update. Assets are not kept when empty.
+	DownloadDir string
+	// DetectConcurrency is the maximum number of repositories whose releases are detected concurrently by
+	// DetectLatestBatch. DefaultDetectConcurrency is used when zero or negative.
+	DetectConcurrency int
+	// TagPrefix is the prefix of the tags of the releases to detect, such as "cli/" for the tags like 'cli/v1.2.3' of
+	// a component in a monorepo. Releases whose tags do not have the prefix are ignored, and the prefix is stripped
+	// before parsing the version. All releases are considered when empty.
+	TagPrefix string
+	// TagFilter restricts the tags of the releases to detect to the ones matching it, e.g. `^v\d+\.\d+\.\d+$` in a
+	// repository having unrelated tags such as 'nightly-20210101' or 'docs-v2'. Releases with other tags are skipped
+	// silently. All tags are considered when nil.
+	TagFilter *regexp.Regexp
+	// SkipVersions are the versions of releases never detected as the latest one, such as a broken release which was
+	// yanked but cannot be deleted. The next best release is selected instead. Each entry is parsed as the versions of
+	// releases are, so '1.2.3', 'v1.2.3' and the tag with TagPrefix are all accepted. NewUpdater fails with an error
+	// matching ErrInvalidVersion when an entry cannot be parsed. A skipped version can still be detected explicitly by
+	// DetectVersion.
+	SkipVersions []string
+	// StrictVersions fails the detection with an error matching ErrAmbiguousVersion when multiple releases having an
+	// asset for the platform have the same version, such as releases tagged 'v1.2.3' and '1.2.3' by mistake. Build
+	// metadata is ignored as it is on comparing versions. By default, any one of them is selected silently.
+	StrictVersions bool
+	// VersionSource specifies whether the versions of releases are read from their tags or their names.
+	// VersionFromTag is used by default.
+	VersionSource VersionSource
+	// VersionParser parses the version from the text of a tag or a release name when it is set, e.g. for the names
+	// like 'Release 1.2.3 (2021-01-01)'. An error skips the release. When nil, the first version number such as
+	// '1.2.3' in the text is parsed.
+	VersionParser func(text string) (semver.Version, error)
+	// EmulationFallback selects the amd64 asset on the platforms running amd64 executables under emulation, i.e.
+	// Windows on ARM and macOS on Apple silicon, when a release has no native arm64 asset. The native asset is always
+	// preferred. Since the executable in the amd64 archive is looked up with the name of the installed command, add
+	// its full name such as 'foo_windows_amd64.exe' to ArchiveBinaryAlternatives when it has the platform in its name.
+	// Disabled by default.
+	EmulationFallback bool
+	// OS and Arch are the target platform of the executable to update, such as "wasip1" and "wasm" for a WebAssembly
+	// module run by a WASI runtime or "js" and "wasm" for JavaScript hosts. Release assets for the platform are
+	// selected and the executable is checked to be for the OS. runtime.GOOS and runtime.GOARCH are used when empty.
+	OS   string
+	Arch string
+	// RateLimiter gates all requests to GitHub API and downloads of release files, including retries. Share one
+	// limiter among updaters to keep their requests within a common budget. NewGitHubRateLimiter returns a limiter
+	// sized to the quota of authenticated requests. Requests are not limited when nil.
+	RateLimiter RateLimiter
+	// ReplaceSymlinks replaces a symlink to the executable, such as '/usr/local/bin/foo -> /opt/foo/1.2/foo', in place
+	// with the new executable instead of updating the file it points to. By default the symlink chain is followed and
+	// the real file is replaced, keeping the symlink. Following suits layouts where the symlink is managed by a package
+	// manager, and replacing suits layouts where the target directory is versioned and must be kept as-is.
+	ReplaceSymlinks bool
+	// CommitFunc puts the new executable in place instead of CommitByRename, the default atomic rename. It is called
+	// with the path of the new executable, which was written next to the target, validated and checked, and the path
+	// of the executable to update, e.g. to flip a symlink, to hand the file over to a supervisor or to relabel it for
+	// SELinux. The new file is removed after it returns unless it was moved. The current executable is not backed up,
+	// so the function must keep it intact when it fails.
+	CommitFunc func(newBinaryPath, targetPath string) error
+	// SmokeTest is called with the path of the new executable after it was downloaded, validated and checked, and
+	// before it is put in place, e.g. to run it in a sandbox. When it returns an error, the update is aborted and
+	// the current executable is kept.
+	SmokeTest func(newBinaryPath string) error
+	// SmokeTestArgs runs the new executable with the arguments such as []string{"--version"} before it is put in
+	// place, and aborts the update unless it exits with 0 and prints the version of the release. See SmokeTestVersion.
+	// An empty slice runs it with '--version'. It is run before SmokeTest when both are set. Nothing is run when nil.
+	SmokeTestArgs []string
+	// CurrentVersionFunc returns the version of the installed executable at binaryPath, e.g. CommandVersion() running
+	// 'foo --version'. UpdateCommand, UpdateSelf and their variants call it when the current version passed to them is
+	// zero (semver.Version{}), which is useful for launchers updating executables they did not build. The update fails
+	// when it returns an error.
+	CurrentVersionFunc func(binaryPath string) (semver.Version, error)
+	// FileMode is the permission bits of the new executable such as 0o750. Only the permission bits are applied, and
+	// they are not masked by umask. When zero, the permission bits of the current executable are kept as long as it
+	// is executable, and 0o755 masked by umask is used otherwise. It is ignored on Windows, which has no such bits.
+	FileMode os.FileMode
+	// VerifyInstalled reads the executable back after it was put in place and checks that its SHA-256 digest is the
+	// one of the validated executable written by the update, which guards against a partial write or another process
+	// replacing it meanwhile. The current executable is backed up before it is replaced, and restored when the check
+	// fails with an error matching ErrInstalledMismatch. It also applies to custom CommitFunc.
+	VerifyInstalled bool
+	// SkipExecutableCheck disables the check that the new executable has the executable permission and starts with
+	// the magic number of an executable for the target OS (ELF, Mach-O, PE or WebAssembly, or '#!' of a script on
+	// Unix) before it is put in place, e.g. for executables in other formats. The check catches a broken download
+	// such as an HTML error page replacing the executable, so keep it enabled unless it rejects valid releases.
+	SkipExecutableCheck bool
+	// ValidatedAssetCacheDir is a directory to keep the release assets which passed the validation by Validator and
+	// Provenance. When the same asset of the same release is applied again, e.g. on repeated self-healing, the cached
+	// copy is applied without downloading and validating it again, as long as its SHA-256 digest still matches the one
+	// recorded after the validation. An asset re-uploaded to the release gets a new ID and never hits the cache of the
+	// previous one. Assets are not cached when nothing validates them or ValidateTarget is ValidateBinary. Since the
+	// cached copies are trusted, the directory must be writable only by the user running the update.
+	ValidatedAssetCacheDir string
+	// URLRewriter rewrites the URL of each request downloading a release file or a validation file right before it is
+	// sent, e.g. from 'https://github.com/...' to 'https://cache.internal/github/...' for a caching proxy. Unlike
+	// a fallback, the rewritten URL is always used. URLs redirected from GitHub API and by the proxy are rewritten as
+	// well, so the function should return URLs which it has already rewritten as-is. Requests to GitHub API are not
+	// rewritten. An error aborts the download.
+	URLRewriter func(url string) (string, error)
+	// ManagedPrefixes are the locations managed by package managers. UpdateCommand and UpdateSelf fail with
+	// *ManagedInstallError, which matches ErrManagedInstall, when the executable or any symlink leading to it is under
+	// one of them, instead of breaking the installation managed by the package manager. DefaultManagedPrefixes is used
+	// when nil. Set an empty slice to disable the check.
+	ManagedPrefixes []string
+	// VerifyTagSignature requires the tag of the release to be an annotated tag whose signature was verified by
+	// GitHub before the release asset is downloaded. The update fails with an error matching ErrTagNotVerified
+	// otherwise, including for lightweight tags. This adds trust in the source of the release beyond the signatures
+	// of its assets. Two requests to GitHub API are made per update.
+	VerifyTagSignature bool
+	// TagSigners are the emails of the taggers allowed to sign the tags of releases when VerifyTagSignature is set.
+	// GitHub API tells the email of the tagger rather than the login of the signer, and verifies a signature only
+	// when the signing key belongs to the account with the email. Any signer is allowed when empty.
+	TagSigners []string
+	// ExpectedCommit is the SHA of the commit which the tag of the release must point at, so that a tag re-pointed to
+	// another commit after review is not applied. The update fails with an error matching ErrCommitMismatch before the
+	// release asset is downloaded otherwise. An abbreviated SHA of at least 7 characters is allowed. One request to
+	// GitHub API is made per update, or two for annotated tags.
+	ExpectedCommit string
+	// RequestHeaders are added to each request to GitHub API and each download of release files, such as a bespoke
+	// authentication header required by a corporate gateway in front of the asset origin. They are sent on redirects
+	// as well, including the ones to other hosts, so use RequestDecorator for headers which must be sent only to some
+	// hosts. They are not added to the requests of a custom Downloader.
+	RequestHeaders map[string]string
+	// RequestDecorator is called with each request to GitHub API and each download of release files right before it
+	// is sent, after RequestHeaders were added and the URL was rewritten by URLRewriter. It may modify the headers of
+	// the request, e.g. depending on its host. It is not called for the requests of a custom Downloader.
+	RequestDecorator func(req *http.Request)
+	// ValidationSource is where the validation files of Validator are fetched from instead of the release of the asset,
+	// e.g. another repository keeping the signatures. The validation files are not looked up on detecting releases
+	// then, but when the release is downloaded.
+	ValidationSource *ValidationSource
+}
+
+// retryConfig is the configuration of retries on retriable status codes. The limiter gates each attempt.
+type retryConfig struct {
+	statuses      []int
+	maxRetries    int
+	wait          time.Duration
+	waitRateLimit bool
+	limiter       RateLimiter
+}
+
+func newRetryConfig(config Config) retryConfig {
+	c := retryConfig{
+		statuses:      config.RetryStatusCodes,
+		maxRetries:    config.MaxRetries,
+		wait:          config.RetryWait,
+		waitRateLimit: config.WaitForRateLimit,
+		limiter:       config.RateLimiter,
+	}
+
+	if c.statuses == nil {
+		c.statuses = DefaultRetryStatusCodes
+	}
+
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = DefaultMaxRetries
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+
+	if c.wait == 0 {
+		c.wait = DefaultRetryWait
+	}
+
+	return c
+}
+
+func (c retryConfig) client(hc *http.Client) *http.Client {
+	return withRetryTransport(withRateLimiter(hc, c.limiter), c)
 }
 
 func newHTTPClient(ctx context.Context, token string) *http.Client {
@@ -66,6 +461,37 @@ func newHTTPClient(ctx context.Context, token string) *http.Client {
 	return oauth2.NewClient(ctx, src)
 }
 
+// platformAssetExtensions returns the file extensions of release assets for the GOOS, or nil when all supported
+// extensions should be tried.
+func platformAssetExtensions(m map[string]string, goos string) ([]string, error) {
+	for k, ext := range m {
+		supported := false
+
+		for _, e := range assetExtensions {
+			if ext == e {
+				supported = true
+
+				break
+			}
+		}
+
+		if !supported {
+			return nil, fmt.Errorf("unsupported asset extension %q for %q. Supported extensions are %q", ext, k, assetExtensions)
+		}
+	}
+
+	ext, ok := m[goos]
+	if !ok {
+		ext, ok = m[DefaultAssetExtensionKey]
+	}
+
+	if !ok {
+		return nil, nil
+	}
+
+	return []string{ext}, nil
+}
+
 // NewUpdater creates a new updater instance. It initializes GitHub API client.
 // If you set your API token to $GITHUB_TOKEN, the client will use it.
 func NewUpdater(config Config) (*Updater, error) {
@@ -80,7 +506,11 @@ func NewUpdater(config Config) (*Updater, error) {
 
 	ctx := context.Background()
 
-	hc := newHTTPClient(ctx, token)
+	retry := newRetryConfig(config)
+
+	// Metadata of responses serving release assets are recorded for UpdateResult.Downloads
+	digests := &assetDigests{}
+	hc := withDownloadInfoTransport(withAssetDigests(withAPICache(retry.client(withRequestHeaders(newHTTPClient(ctx, token), config.RequestHeaders, config.RequestDecorator)), config.HTTPCache), digests))
 
 	filtersRe := make([]*regexp.Regexp, 0, len(config.Filters))
 
@@ -93,10 +523,147 @@ func NewUpdater(config Config) (*Updater, error) {
 		filtersRe = append(filtersRe, re)
 	}
 
+	if config.ExpectedCommit != "" && !commitSHAPattern.MatchString(config.ExpectedCommit) {
+		return nil, fmt.Errorf("expected commit %q is not a SHA of at least 7 hex characters", config.ExpectedCommit)
+	}
+
+	var splitRe *regexp.Regexp
+
+	if config.SplitAssetPattern != "" {
+		re, err := regexp.Compile(config.SplitAssetPattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile regular expression %q for split assets: %w", config.SplitAssetPattern, err)
+		}
+
+		if re.NumSubexp() != 1 {
+			return nil, fmt.Errorf("regular expression %q for split assets must have exactly one capturing group for the part number", config.SplitAssetPattern)
+		}
+
+		splitRe = re
+	}
+
+	if config.ValidationSource != nil {
+		if err := config.ValidationSource.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	skipVersions, err := parseSkipVersions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPathPatterns(append([]string{config.ArchiveBinaryName}, config.ArchiveBinaryAlternatives...)); err != nil {
+		return nil, err
+	}
+
+	goos := config.OS
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+
+	goarch := config.Arch
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+
+	extensions, err := platformAssetExtensions(config.AssetExtensions, goos)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, target := platformValidator(config, goos, goarch), config.ValidateTarget
+
+	if config.ExpectedDigest != "" {
+		if _, _, err := parseDigest(config.ExpectedDigest); err != nil {
+			return nil, fmt.Errorf("invalid expected digest: %w", err)
+		}
+
+		if validator != nil {
+			log.Printf("Validator %T is not used since the asset is validated with the expected digest\n", validator)
+		}
+
+		validator, target = &pinnedDigestValidator{digest: config.ExpectedDigest}, ValidateArchive
+	}
+
+	up := &Updater{
+		apiCtx:        ctx,
+		validator:     validator,
+		filters:       filtersRe,
+		pre:           config.PreRelease,
+		draft:         config.Draft,
+		strategy:      config.SelectionStrategy,
+		preference:    config.AssetPreference,
+		source:        config.SourceArchive,
+		strictVers:    config.StrictVersions,
+		zipPassword:   config.ZipPassword,
+		split:         splitRe,
+		target:        target,
+		extensions:    extensions,
+		binaryName:    config.ArchiveBinaryName,
+		binaryAlts:    config.ArchiveBinaryAlternatives,
+		downloader:    config.Downloader,
+		provenance:    config.Provenance,
+		urlMode:       config.AssetURLMode,
+		hasToken:      token != "",
+		token:         token,
+		retry:         retry,
+		cacheDir:      config.AssetCacheDir,
+		checkMagic:    config.CheckAssetMagic,
+		concurrency:   config.DetectConcurrency,
+		tagPrefix:     config.TagPrefix,
+		tagFilter:     config.TagFilter,
+		versionSource: config.VersionSource,
+		versionParser: config.VersionParser,
+		emulation:     config.EmulationFallback,
+		goos:          config.OS,
+		goarch:        config.Arch,
+		replaceLinks:  config.ReplaceSymlinks,
+		validCacheDir: config.ValidatedAssetCacheDir,
+		rewriteURL:    config.URLRewriter,
+		managed:       config.ManagedPrefixes,
+		signedTag:     config.VerifyTagSignature,
+		tagSigners:    config.TagSigners,
+		expectCommit:  config.ExpectedCommit,
+		plain:         config.PlainBinaryExtensions,
+		headers:       config.RequestHeaders,
+		decorate:      config.RequestDecorator,
+		valSource:     config.ValidationSource,
+		skipVersions:  skipVersions,
+		checkPlatform: config.CheckExecutablePlatform,
+		tempDir:       config.TempDir,
+		downloadDir:   config.DownloadDir,
+		requireVal:    config.RequireValidation,
+		digests:       digests,
+		latestFlag:    config.UseGitHubLatestFlag,
+		commit:        config.CommitFunc,
+		smokeTest:     config.SmokeTest,
+		smokeArgs:     config.SmokeTestArgs,
+		fileMode:      config.FileMode,
+		verifyInst:    config.VerifyInstalled,
+		skipExeCheck:  config.SkipExecutableCheck,
+		valFiles:      &validationFileCache{},
+		relCache:      config.ReleaseCache,
+		useStale:      config.UseStaleRelease,
+		currentVer:    config.CurrentVersionFunc,
+		skipNoAsset:   config.SkipReleasesWithoutAssets,
+	}
+
+	if up.managed == nil {
+		up.managed = DefaultManagedPrefixes
+	}
+
+	switch {
+	case config.MaxRedirects == 0:
+		up.maxRedirects = DefaultMaxRedirects
+	case config.MaxRedirects > 0:
+		up.maxRedirects = config.MaxRedirects
+	}
+
 	if config.EnterpriseBaseURL == "" {
-		client := github.NewClient(hc)
+		up.api = github.NewClient(hc)
 
-		return &Updater{api: client, apiCtx: ctx, validator: config.Validator, filters: filtersRe, pre: config.PreRelease, draft: config.Draft}, nil
+		return up, nil
 	}
 
 	u := config.EnterpriseUploadURL
@@ -104,12 +671,56 @@ func NewUpdater(config Config) (*Updater, error) {
 		u = config.EnterpriseBaseURL
 	}
 
-	client, err := github.NewEnterpriseClient(config.EnterpriseBaseURL, u, hc)
+	newClient := github.NewEnterpriseClient
+	if config.EnterpriseExactURL {
+		newClient = newExactEnterpriseClient
+	}
+
+	client, err := newClient(config.EnterpriseBaseURL, u, hc)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Updater{api: client, apiCtx: ctx, validator: config.Validator, filters: filtersRe, pre: config.PreRelease, draft: config.Draft}, nil
+	up.api = client
+
+	return up, nil
+}
+
+// newExactEnterpriseClient is the same as github.NewEnterpriseClient, but it uses the paths of the URLs as they are
+// instead of appending "api/v3/" to them. Only the trailing slash is added since the API paths are relative to them.
+func newExactEnterpriseClient(baseURL, uploadURL string, hc *http.Client) (*github.Client, error) {
+	exact := func(s string) (*url.URL, error) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("URL of GitHub Enterprise API must be absolute but got %q", s)
+		}
+
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+
+		return u, nil
+	}
+
+	base, err := exact(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := exact(uploadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := github.NewClient(hc)
+	client.BaseURL = base
+	client.UploadURL = upload
+
+	return client, nil
 }
 
 // DefaultUpdater creates a new updater instance with default configuration.
@@ -123,7 +734,9 @@ func DefaultUpdater() *Updater {
 
 	ctx := context.Background()
 
-	client := newHTTPClient(ctx, token)
+	retry := newRetryConfig(Config{})
+	digests := &assetDigests{}
+	client := withDownloadInfoTransport(withAssetDigests(retry.client(newHTTPClient(ctx, token)), digests))
 
-	return &Updater{api: github.NewClient(client), apiCtx: ctx}
+	return &Updater{api: github.NewClient(client), apiCtx: ctx, maxRedirects: DefaultMaxRedirects, hasToken: token != "", token: token, retry: retry, managed: DefaultManagedPrefixes, digests: digests, valFiles: &validationFileCache{}}
 }
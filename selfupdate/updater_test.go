@@ -1,6 +1,8 @@
 package selfupdate
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -69,6 +71,77 @@ func TestGitHubEnterpriseClientInvalidURL(t *testing.T) {
 	}
 }
 
+func TestGitHubEnterpriseClientExactURL(t *testing.T) {
+	for _, tc := range []struct {
+		base   string
+		upload string
+		want   string
+		wantUp string
+	}{
+		{"https://code.corp/github-api/v3/", "", "https://code.corp/github-api/v3/", "https://code.corp/github-api/v3/"},
+		{"https://code.corp/github-api/v3", "https://upload.code.corp/uploads", "https://code.corp/github-api/v3/", "https://upload.code.corp/uploads/"},
+		{"https://code.corp", "", "https://code.corp/", "https://code.corp/"},
+	} {
+		t.Run(tc.base, func(t *testing.T) {
+			up, err := NewUpdater(Config{EnterpriseBaseURL: tc.base, EnterpriseUploadURL: tc.upload, EnterpriseExactURL: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if up.api.BaseURL.String() != tc.want {
+				t.Error("Base URL was set to", up.api.BaseURL, ", want", tc.want)
+			}
+			if up.api.UploadURL.String() != tc.wantUp {
+				t.Error("Upload URL was set to", up.api.UploadURL, ", want", tc.wantUp)
+			}
+		})
+	}
+
+	for _, u := range []string{":this is not a URL", "code.corp/github-api/v3/"} {
+		if _, err := NewUpdater(Config{EnterpriseBaseURL: u, EnterpriseExactURL: true}); err == nil {
+			t.Errorf("Invalid URL %q should raise an error", u)
+		}
+	}
+}
+
+func TestGitHubEnterpriseExactURLRequests(t *testing.T) {
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: platformAssetName("foo", ""), content: []byte("foo")}}})
+
+	const prefix = "/github-api/v3/"
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		r.URL.Path = "/api/v3/" + strings.TrimPrefix(r.URL.Path, prefix)
+		gh.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	up, err := NewUpdater(Config{APIToken: "test-token", EnterpriseBaseURL: ts.URL + prefix, EnterpriseExactURL: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, ok, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || rel.Version.String() != "1.2.3" {
+		t.Fatal("Release was not detected:", rel)
+	}
+	if len(paths) == 0 {
+		t.Fatal("No request was sent")
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, prefix+"repos/owner/repo/") {
+			t.Error("Request was not sent under the configured prefix:", p)
+		}
+	}
+}
+
 func TestCompileRegexForFiltering(t *testing.T) {
 	filters := []string{
 		"^hello$",
@@ -104,3 +177,25 @@ func TestFilterRegexIsBroken(t *testing.T) {
 		t.Fatalf("Error message is unexpected: %q", msg)
 	}
 }
+
+func TestPlatformAssetExtensions(t *testing.T) {
+	m := map[string]string{"windows": ".zip", DefaultAssetExtensionKey: ".tar.gz"}
+	for goos, want := range map[string]string{"windows": ".zip", "linux": ".tar.gz", "darwin": ".tar.gz"} {
+		exts, err := platformAssetExtensions(m, goos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(exts) != 1 || exts[0] != want {
+			t.Errorf("Wanted %q for %s but got %q", want, goos, exts)
+		}
+	}
+
+	exts, err := platformAssetExtensions(map[string]string{"windows": ".zip"}, "linux")
+	if err != nil || exts != nil {
+		t.Error("All extensions should be tried for platform not in map:", exts, err)
+	}
+
+	if _, err := NewUpdater(Config{AssetExtensions: map[string]string{"linux": ".rar"}}); err == nil || !strings.Contains(err.Error(), ".rar") {
+		t.Error("Unsupported extension should cause an error:", err)
+	}
+}
@@ -1,11 +1,21 @@
 package selfupdate
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/asn1"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 // Validator represents an interface which enables additional validation of releases.
@@ -18,6 +28,204 @@ type Validator interface {
 	Suffix() string
 }
 
+// ValidationTarget specifies what the validator validates.
+type ValidationTarget int
+
+const (
+	// ValidateArchive validates the downloaded release asset as-is, e.g. 'foo_linux_amd64.tar.gz'. This is the
+	// default and matches checksums published by GoReleaser.
+	ValidateArchive ValidationTarget = iota
+	// ValidateBinary validates the executable extracted from the downloaded release asset. The validation asset is
+	// still looked up with the name of the release asset.
+	ValidateBinary
+)
+
+// AssetNameValidator is an optional interface which a Validator can implement when the validation depends on the
+// file name of the release asset, e.g. for looking up its entry in a checksum file shared by all assets.
+// See ChecksumValidator for more information.
+type AssetNameValidator interface {
+	Validator
+	// ValidateAsset validates release bytes of the asset named filename against an additional asset bytes.
+	ValidateAsset(filename string, release, asset []byte) error
+	// GetValidationAssetName returns the name of the additional asset used for validating the release asset
+	// named filename.
+	GetValidationAssetName(filename string) string
+}
+
+// validationAssetName returns the name of the additional asset for validating the release asset named filename.
+func validationAssetName(v Validator, filename string) string {
+	if nv, ok := v.(AssetNameValidator); ok {
+		return nv.GetValidationAssetName(filename)
+	}
+
+	return filename + v.Suffix()
+}
+
+// ValidationAssetNamesValidator is an optional interface which a Validator can implement when its validation asset
+// can have several names, e.g. depending on the version of the signing tool. The names are tried in order against
+// the assets of the release and the first existing one is used.
+type ValidationAssetNamesValidator interface {
+	Validator
+	// GetValidationAssetNames returns the candidate names of the additional asset used for validating the release
+	// asset named filename, in order of preference.
+	GetValidationAssetNames(filename string) []string
+}
+
+// platformValidator returns the validator of Config.PlatformValidators for the platform, looked up by 'os/arch' and
+// then by 'os'. Config.Validator is returned when neither is in the map.
+func platformValidator(config Config, goos, goarch string) Validator {
+	for _, key := range []string{goos + "/" + goarch, goos} {
+		if v, ok := config.PlatformValidators[key]; ok {
+			return v
+		}
+	}
+
+	return config.Validator
+}
+
+// validationAssetNames returns the candidate names of the additional asset for validating the release asset named
+// filename.
+func validationAssetNames(v Validator, filename string) []string {
+	if nv, ok := v.(ValidationAssetNamesValidator); ok {
+		return nv.GetValidationAssetNames(filename)
+	}
+
+	return []string{validationAssetName(v, filename)}
+}
+
+// validateAsset validates the release asset named filename with the validator.
+func validateAsset(v Validator, filename string, release, asset []byte) error {
+	if nv, ok := v.(AssetNameValidator); ok {
+		return nv.ValidateAsset(filename, release, asset)
+	}
+
+	return v.Validate(release, asset)
+}
+
+// VerifyFile validates the local file at path with the validator against the content of its validation asset, such as
+// a checksum file or a signature downloaded beforehand. Nothing is fetched from the network, so validators which
+// fetch their data by themselves, e.g. AttestationValidator, need the data to be given as validationAsset as well.
+// The file name of path is passed to validators looking up the asset by its name, such as ChecksumValidator. The file
+// is streamed into the validator when it supports streaming, otherwise it is read into memory.
+func VerifyFile(path string, v Validator, validationAsset []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file to verify: %w", err)
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+
+	if validate := streamValidation(v, name); validate != nil {
+		if err := validate(f, validationAsset); err != nil {
+			return markError(ErrValidationFailed, fmt.Errorf("failed validating file %s: %w", path, err))
+		}
+
+		return nil
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read file to verify: %w", err)
+	}
+
+	if err := validateAsset(v, name, data, validationAsset); err != nil {
+		return markError(ErrValidationFailed, fmt.Errorf("failed validating file %s: %w", path, err))
+	}
+
+	return nil
+}
+
+// StreamValidator is an optional interface which a Validator can implement when it can validate the release while
+// it is being downloaded. The release is then streamed into a temporary file instead of being buffered in memory,
+// which matters for huge assets. The executable is extracted from the temporary file only after the validation
+// succeeded. The validation asset is still passed as bytes since it is small.
+type StreamValidator interface {
+	Validator
+	// ValidateStream validates the release read from the reader against an additional asset bytes. It must read
+	// the release until EOF.
+	ValidateStream(release io.Reader, asset []byte) error
+}
+
+// AssetNameStreamValidator is the streaming counterpart of AssetNameValidator.
+type AssetNameStreamValidator interface {
+	AssetNameValidator
+	// ValidateAssetStream validates the release of the asset named filename read from the reader against
+	// an additional asset bytes. It must read the release until EOF.
+	ValidateAssetStream(filename string, release io.Reader, asset []byte) error
+}
+
+// streamValidation returns the function validating the release asset named filename read from a reader, or nil
+// when the validator does not support streaming.
+func streamValidation(v Validator, filename string) func(release io.Reader, asset []byte) error {
+	switch sv := v.(type) {
+	case *NamedValidator:
+		return streamValidation(sv.Validator, filename)
+	case AssetNameStreamValidator:
+		return func(release io.Reader, asset []byte) error {
+			return sv.ValidateAssetStream(filename, release, asset)
+		}
+	case StreamValidator:
+		return sv.ValidateStream
+	default:
+		return nil
+	}
+}
+
+// AssetNamePlaceholder is replaced with the file name of the release asset in NamedValidator.Template.
+const AssetNamePlaceholder = "{{asset}}"
+
+// NamedValidator wraps a Validator to look up its validation asset with a custom naming convention instead of the
+// suffix of the validator. For example, the template "{{asset}}-SIGNATURE" looks up 'foo_linux_amd64.tar.gz-SIGNATURE'
+// for the release asset 'foo_linux_amd64.tar.gz'. A template without the placeholder names a fixed file.
+type NamedValidator struct {
+	// Validator is the validator to validate the release asset.
+	Validator Validator
+	// Template is the name of the validation asset. AssetNamePlaceholder in it is replaced with the release asset name.
+	Template string
+	// FallbackTemplates are tried in order when no asset matching Template is found in the release.
+	FallbackTemplates []string
+}
+
+// Validate validates the release with the wrapped validator.
+func (v *NamedValidator) Validate(release, asset []byte) error {
+	return v.Validator.Validate(release, asset)
+}
+
+// ValidateAsset validates the release asset named filename with the wrapped validator.
+func (v *NamedValidator) ValidateAsset(filename string, release, asset []byte) error {
+	return validateAsset(v.Validator, filename, release, asset)
+}
+
+func (v *NamedValidator) signatureValidator() Validator {
+	return signatureValidator(v.Validator)
+}
+
+// Suffix returns the part of the template following the placeholder when the template starts with it.
+// Otherwise it returns an empty string. See GetValidationAssetName.
+func (v *NamedValidator) Suffix() string {
+	if !strings.HasPrefix(v.Template, AssetNamePlaceholder) {
+		return ""
+	}
+
+	return strings.TrimPrefix(v.Template, AssetNamePlaceholder)
+}
+
+// GetValidationAssetName returns the name of the validation asset generated from the template.
+func (v *NamedValidator) GetValidationAssetName(filename string) string {
+	return strings.ReplaceAll(v.Template, AssetNamePlaceholder, filename)
+}
+
+// GetValidationAssetNames returns the names of the validation asset generated from Template and FallbackTemplates.
+func (v *NamedValidator) GetValidationAssetNames(filename string) []string {
+	names := make([]string, 0, 1+len(v.FallbackTemplates))
+	for _, t := range append([]string{v.Template}, v.FallbackTemplates...) {
+		names = append(names, strings.ReplaceAll(t, AssetNamePlaceholder, filename))
+	}
+
+	return names
+}
+
 // SHA2Validator specifies a SHA256 validator for additional file validation
 // before updating.
 type SHA2Validator struct {
@@ -26,7 +234,17 @@ type SHA2Validator struct {
 // Validate validates the SHA256 sum of the release against the contents of an
 // additional asset file.
 func (v *SHA2Validator) Validate(release, asset []byte) error {
-	calculatedHash := fmt.Sprintf("%x", sha256.Sum256(release))
+	return v.ValidateStream(bytes.NewReader(release), asset)
+}
+
+// ValidateStream is the same as Validate, but the release is read from the reader.
+func (v *SHA2Validator) ValidateStream(release io.Reader, asset []byte) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, release); err != nil {
+		return fmt.Errorf("sha2: failed to read release: %w", err)
+	}
+
+	calculatedHash := fmt.Sprintf("%x", h.Sum(nil))
 
 	hash := fmt.Sprintf("%s", asset[:sha256.BlockSize]) //nolint:gosimple
 	if calculatedHash != hash {
@@ -41,6 +259,12 @@ func (v *SHA2Validator) Suffix() string {
 	return ".sha256"
 }
 
+// GetValidationAssetNames returns the names of the hash file. In addition to the suffix, '.sha256sum' is also tried
+// since the output of sha256sum can be validated as well.
+func (v *SHA2Validator) GetValidationAssetNames(filename string) []string {
+	return []string{filename + v.Suffix(), filename + ".sha256sum"}
+}
+
 // ECDSAValidator specifies a ECDSA validator for additional file validation
 // before updating.
 type ECDSAValidator struct {
@@ -51,8 +275,15 @@ type ECDSAValidator struct {
 // contained in an additional asset file.
 // additional asset file.
 func (v *ECDSAValidator) Validate(input, signature []byte) error {
+	return v.ValidateStream(bytes.NewReader(input), signature)
+}
+
+// ValidateStream is the same as Validate, but the release is read from the reader.
+func (v *ECDSAValidator) ValidateStream(input io.Reader, signature []byte) error {
 	h := sha256.New()
-	h.Write(input)
+	if _, err := io.Copy(h, input); err != nil {
+		return fmt.Errorf("ecdsa: failed to read release: %w", err)
+	}
 
 	var rs struct {
 		R *big.Int
@@ -74,3 +305,111 @@ func (v *ECDSAValidator) Validate(input, signature []byte) error {
 func (v *ECDSAValidator) Suffix() string {
 	return ".sig"
 }
+
+// ECDSAValidatorFromPEM creates an ECDSAValidator from PEM-encoded data. The data can be either a public key
+// ('PUBLIC KEY' block) or a certificate ('CERTIFICATE' block) containing an ECDSA public key.
+func ECDSAValidatorFromPEM(data []byte) (*ECDSAValidator, error) {
+	key, err := parsePublicKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("ecdsa: public key is not an ECDSA key but %T", key)
+	}
+
+	return &ECDSAValidator{PublicKey: pub}, nil
+}
+
+// ECDSAValidatorFromPEMFile creates an ECDSAValidator from the PEM file at path. See ECDSAValidatorFromPEM
+// for the details of the format.
+func ECDSAValidatorFromPEMFile(path string) (*ECDSAValidator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ecdsa: failed to read PEM file: %w", err)
+	}
+
+	return ECDSAValidatorFromPEM(data)
+}
+
+// Ed25519Validator specifies an Ed25519 validator for additional file validation
+// before updating.
+type Ed25519Validator struct {
+	PublicKey ed25519.PublicKey
+}
+
+// Validate validates the Ed25519 signature of the release against the signature
+// contained in an additional asset file. The signature must be raw 64 bytes as generated by
+// 'openssl pkeyutl -sign -rawin'.
+func (v *Ed25519Validator) Validate(input, signature []byte) error {
+	if len(v.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("ed25519: invalid public key size %d", len(v.PublicKey))
+	}
+
+	if !ed25519.Verify(v.PublicKey, input, signature) {
+		return fmt.Errorf("ed25519: signature verification failed")
+	}
+
+	return nil
+}
+
+// Suffix returns the suffix for Ed25519 validation.
+func (v *Ed25519Validator) Suffix() string {
+	return ".sig"
+}
+
+// Ed25519ValidatorFromPEM creates an Ed25519Validator from PEM-encoded data. The data can be either a public key
+// ('PUBLIC KEY' block) or a certificate ('CERTIFICATE' block) containing an Ed25519 public key.
+func Ed25519ValidatorFromPEM(data []byte) (*Ed25519Validator, error) {
+	key, err := parsePublicKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("ed25519: public key is not an Ed25519 key but %T", key)
+	}
+
+	return &Ed25519Validator{PublicKey: pub}, nil
+}
+
+// Ed25519ValidatorFromPEMFile creates an Ed25519Validator from the PEM file at path. See Ed25519ValidatorFromPEM
+// for the details of the format.
+func Ed25519ValidatorFromPEMFile(path string) (*Ed25519Validator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ed25519: failed to read PEM file: %w", err)
+	}
+
+	return Ed25519ValidatorFromPEM(data)
+}
+
+// parsePublicKeyPEM parses a public key from the first PEM block of data, which is either a PKIX public key or
+// an X.509 certificate.
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM data: no PEM block was found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key in PEM data: %w", err)
+		}
+
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in PEM data: %w", err)
+		}
+
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unexpected PEM block type %q. 'PUBLIC KEY' or 'CERTIFICATE' is expected", block.Type)
+	}
+}
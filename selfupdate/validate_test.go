@@ -1,10 +1,17 @@
 package selfupdate
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -126,6 +133,10 @@ func TestValidatorSuffix(t *testing.T) {
 			v:      &ECDSAValidator{},
 			suffix: ".sig",
 		},
+		{
+			v:      &Ed25519Validator{},
+			suffix: ".sig",
+		},
 	} {
 		want := test.suffix
 		got := test.v.Suffix()
@@ -134,3 +145,287 @@ func TestValidatorSuffix(t *testing.T) {
 		}
 	}
 }
+
+func TestECDSAValidatorFromPEMFile(t *testing.T) {
+	validator, err := ECDSAValidatorFromPEMFile("testdata/Test.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("testdata/foo.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureData, err := ioutil.ReadFile("testdata/foo.zip.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.Validate(data, signatureData); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestECDSAValidatorFromPublicKeyPEM(t *testing.T) {
+	pemData, err := ioutil.ReadFile("testdata/Test.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pemData)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := ECDSAValidatorFromPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !validator.PublicKey.Equal(cert.PublicKey) {
+		t.Fatal("Parsed public key is different from the certificate's one")
+	}
+}
+
+func generateEd25519PEM(t *testing.T) (ed25519.PrivateKey, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestEd25519Validator(t *testing.T) {
+	priv, pemData := generateEd25519PEM(t)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(path, pemData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := Ed25519ValidatorFromPEMFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile("testdata/foo.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := ed25519.Sign(priv, data)
+	if err := validator.Validate(data, signature); err != nil {
+		t.Fatal(err)
+	}
+
+	data[0]++
+	if err := validator.Validate(data, signature); err == nil {
+		t.Fatal("Validation should fail for tampered data")
+	}
+}
+
+func TestValidatorFromPEMError(t *testing.T) {
+	_, ed25519PEM := generateEd25519PEM(t)
+	ecdsaPEM, err := ioutil.ReadFile("testdata/Test.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM, err := ioutil.ReadFile("testdata/Test.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		what string
+		pem  []byte
+		msg  string
+		fn   func([]byte) error
+	}{
+		{"ECDSA from Ed25519 key", ed25519PEM, "not an ECDSA key", func(b []byte) error { _, err := ECDSAValidatorFromPEM(b); return err }},
+		{"Ed25519 from ECDSA cert", ecdsaPEM, "not an Ed25519 key", func(b []byte) error { _, err := Ed25519ValidatorFromPEM(b); return err }},
+		{"ECDSA from private key", privatePEM, "unexpected PEM block type", func(b []byte) error { _, err := ECDSAValidatorFromPEM(b); return err }},
+		{"ECDSA from malformed PEM", []byte("not a PEM"), "no PEM block", func(b []byte) error { _, err := ECDSAValidatorFromPEM(b); return err }},
+		{"Ed25519 from broken key", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("broken")}), "failed to parse public key", func(b []byte) error { _, err := Ed25519ValidatorFromPEM(b); return err }},
+	} {
+		err := tc.fn(tc.pem)
+		if err == nil {
+			t.Errorf("%s: error should occur", tc.what)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("%s: unexpected error: %s", tc.what, err)
+		}
+	}
+
+	if _, err := ECDSAValidatorFromPEMFile("testdata/not-existing.pem"); err == nil {
+		t.Error("Error should occur for not existing PEM file")
+	}
+}
+
+func TestNamedValidator(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/foo.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashData, err := ioutil.ReadFile("testdata/foo.zip.sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &NamedValidator{Validator: &SHA2Validator{}, Template: "{{asset}}-SIGNATURE"}
+	if n := validationAssetName(v, "foo.zip"); n != "foo.zip-SIGNATURE" {
+		t.Error("Unexpected validation asset name:", n)
+	}
+	if s := v.Suffix(); s != "-SIGNATURE" {
+		t.Error("Unexpected suffix:", s)
+	}
+	if err := validateAsset(v, "foo.zip", data, hashData); err != nil {
+		t.Fatal(err)
+	}
+
+	v = &NamedValidator{Validator: &SHA2Validator{}, Template: "SHA256SUMS-for-{{asset}}"}
+	if n := validationAssetName(v, "foo.zip"); n != "SHA256SUMS-for-foo.zip" {
+		t.Error("Unexpected validation asset name:", n)
+	}
+	if s := v.Suffix(); s != "" {
+		t.Error("Suffix should be empty:", s)
+	}
+
+	// Asset name is passed to the wrapped validator
+	checksums := []byte(strings.TrimSpace(string(hashData))[:64] + "  foo.zip\n")
+	v = &NamedValidator{Validator: &ChecksumValidator{}, Template: "SHA256SUMS"}
+	if n := validationAssetName(v, "foo.zip"); n != "SHA256SUMS" {
+		t.Error("Unexpected validation asset name:", n)
+	}
+	if err := validateAsset(v, "foo.zip", data, checksums); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateAsset(v, "bar.zip", data, checksums); err == nil {
+		t.Fatal("Validation should fail for asset not in checksum file")
+	}
+}
+
+func TestValidationAssetNames(t *testing.T) {
+	for _, tc := range []struct {
+		validator Validator
+		want      string
+	}{
+		{&SHA2Validator{}, "foo.zip.sha256,foo.zip.sha256sum"},
+		{&MinisignValidator{}, "foo.zip.minisig,foo.zip.sig"},
+		{&ECDSAValidator{}, "foo.zip.sig"},
+		{&ChecksumValidator{}, "checksums.txt"},
+		{&NamedValidator{Validator: &SHA2Validator{}, Template: "{{asset}}.sig", FallbackTemplates: []string{"{{asset}}.asc", "SIGNATURES"}}, "foo.zip.sig,foo.zip.asc,SIGNATURES"},
+	} {
+		if s := strings.Join(validationAssetNames(tc.validator, "foo.zip"), ","); s != tc.want {
+			t.Errorf("Wanted %q for %T but got %q", tc.want, tc.validator, s)
+		}
+	}
+}
+
+func TestStreamValidation(t *testing.T) {
+	for _, tc := range []struct {
+		validator Validator
+		ok        bool
+	}{
+		{&SHA2Validator{}, true},
+		{&ECDSAValidator{}, true},
+		{&PGPValidator{}, true},
+		{&ChecksumValidator{}, true},
+		{&NamedValidator{Validator: &ChecksumValidator{}, Template: "SUMS"}, true},
+		{&Ed25519Validator{}, false},
+		{&NamedValidator{Validator: &Ed25519Validator{}, Template: "{{asset}}.sig"}, false},
+	} {
+		if ok := streamValidation(tc.validator, "foo.zip") != nil; ok != tc.ok {
+			t.Errorf("Streaming support of %T should be %v", tc.validator, tc.ok)
+		}
+	}
+
+	data := []byte("this is test\n")
+	checksums := []byte(fmt.Sprintf("%x  foo.zip\n", sha256.Sum256(data)))
+	validate := streamValidation(&ChecksumValidator{}, "foo.zip")
+	if err := validate(bytes.NewReader(data), checksums); err != nil {
+		t.Fatal(err)
+	}
+	if err := streamValidation(&ChecksumValidator{}, "bar.zip")(bytes.NewReader(data), checksums); err == nil {
+		t.Fatal("Validation should fail for asset not in checksum file")
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/foo.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := []byte(fmt.Sprintf("%x", sha256.Sum256(data)))
+
+	for _, tc := range []struct {
+		what  string
+		v     Validator
+		asset []byte
+		ok    bool
+	}{
+		{"sha256", &SHA2Validator{}, sum, true},
+		{"sha256 mismatch", &SHA2Validator{}, bytes.Repeat([]byte("0"), 64), false},
+		{"checksum file", &ChecksumValidator{}, []byte(string(sum) + "  foo.zip\n"), true},
+		{"checksum file without entry", &ChecksumValidator{}, []byte(string(sum) + "  bar.zip\n"), false},
+		{"zip crc32", &ZipCRC32Validator{}, nil, true},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			err := VerifyFile("testdata/foo.zip", tc.v, tc.asset)
+			if tc.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.ok && (err == nil || !strings.Contains(err.Error(), "testdata/foo.zip")) {
+				t.Fatal("Verification should fail with the file path:", err)
+			}
+		})
+	}
+
+	if err := VerifyFile(filepath.Join(t.TempDir(), "not-exist"), &SHA2Validator{}, sum); err == nil {
+		t.Fatal("Missing file should fail")
+	}
+}
+
+func TestPlatformValidators(t *testing.T) {
+	sha2 := &SHA2Validator{}
+	ed := &Ed25519Validator{}
+	ec := &ECDSAValidator{}
+	validators := map[string]Validator{"windows": sha2, "linux/arm64": ed, "darwin": nil}
+
+	for _, tc := range []struct {
+		goos string
+		arch string
+		want Validator
+	}{
+		{"windows", "amd64", sha2},
+		{"linux", "arm64", ed},
+		{"linux", "amd64", ec},
+		{"darwin", "arm64", nil},
+	} {
+		up, err := NewUpdater(Config{Validator: ec, PlatformValidators: validators, OS: tc.goos, Arch: tc.arch})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if up.validator != tc.want {
+			t.Errorf("Wanted %T for %s/%s but got %T", tc.want, tc.goos, tc.arch, up.validator)
+		}
+	}
+
+	// The validation file of the platform-specific validator is looked up
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "foo_windows_amd64.zip", content: []byte("windows")},
+		{name: "foo_windows_amd64.zip.sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256([]byte("windows"))))},
+		{name: "foo_linux_amd64.tar.gz", content: []byte("linux")},
+		{name: "foo_linux_amd64.tar.gz.sig", content: []byte("signature")},
+	}})
+	for _, goos := range []string{"windows", "linux"} {
+		up, _ := newTestUpdater(t, Config{Validator: ec, PlatformValidators: map[string]Validator{"windows": sha2}, OS: goos, Arch: "amd64"}, gh)
+		if _, found, err := up.DetectLatest("owner/repo"); err != nil || !found {
+			t.Fatal("Validation file for", goos, "should be found:", err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// validatedAssetMeta identifies a release asset which was validated before, and records the SHA-256 digest of its
+// cached copy.
+type validatedAssetMeta struct {
+	URL    string `json:"url"`
+	ID     int64  `json:"id"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// validatedAssetEntry is a validated release asset in the directory of Config.ValidatedAssetCacheDir. The entry is
+// keyed by the URL, the ID and the size of the asset, so a re-uploaded asset, which gets a new ID, or another release
+// never hits the entry of the previous one.
+type validatedAssetEntry struct {
+	path string
+	meta validatedAssetMeta
+	// sha256 is the digest of the cached copy checked on opening it
+	sha256 string
+}
+
+func newValidatedAssetEntry(dir string, rel *Release) *validatedAssetEntry {
+	meta := validatedAssetMeta{URL: rel.AssetURL, ID: rel.AssetID, Size: rel.AssetByteSize}
+	key := sha256.Sum256([]byte(meta.URL + "\n" + strconv.FormatInt(meta.ID, 10) + "\n" + strconv.Itoa(meta.Size)))
+
+	return &validatedAssetEntry{path: filepath.Join(dir, hex.EncodeToString(key[:])), meta: meta}
+}
+
+// open returns the cached asset. false is returned when the asset was not validated before, or the cached copy does
+// not match the digest recorded when it was validated. Broken entries are removed. The digest is verified on the
+// opened file, so replacing the file after the check does not affect the returned content.
+func (e *validatedAssetEntry) open() (*os.File, bool) {
+	b, err := ioutil.ReadFile(e.path + ".json")
+	if err != nil {
+		return nil, false
+	}
+
+	var meta validatedAssetMeta
+	if err := json.Unmarshal(b, &meta); err != nil || meta.URL != e.meta.URL || meta.ID != e.meta.ID || meta.Size != e.meta.Size {
+		log.Println("Removing validated asset cache", e.path, "since it does not match asset", e.meta.URL)
+		e.remove()
+
+		return nil, false
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		e.remove()
+
+		return nil, false
+	}
+
+	if err := checkCachedDigest(f, meta); err != nil {
+		f.Close()
+		log.Println("Removing validated asset cache", e.path, ":", err)
+		e.remove()
+
+		return nil, false
+	}
+
+	e.sha256 = meta.SHA256
+
+	log.Println("Using validated asset cache", e.path, "for", e.meta.URL)
+
+	return f, true
+}
+
+// checkCachedDigest checks the digest and the size of the cached file, and rewinds it.
+func checkCachedDigest(f *os.File, meta validatedAssetMeta) error {
+	expected, err := hex.DecodeString(meta.SHA256)
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("invalid digest %q", meta.SHA256)
+	}
+
+	h := sha256.New()
+
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+
+	if meta.Size > 0 && n != int64(meta.Size) {
+		return fmt.Errorf("size mismatch: expected=%d, got=%d", meta.Size, n)
+	}
+
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return fmt.Errorf("digest mismatch: expected=%s, got=%x", meta.SHA256, h.Sum(nil))
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+
+	return err
+}
+
+// store records the asset read from src after it was validated. The asset is written before its metadata so that
+// a crash never leaves the metadata with another content.
+func (e *validatedAssetEntry) store(src io.Reader) {
+	if err := e.write(src); err != nil {
+		log.Println("Could not store validated asset", e.meta.URL, "in cache:", err)
+		e.remove()
+
+		return
+	}
+
+	log.Println("Stored validated asset", e.meta.URL, "in cache", e.path)
+}
+
+func (e *validatedAssetEntry) write(src io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o700); err != nil {
+		return err
+	}
+
+	os.Remove(e.path + ".json")
+
+	h := sha256.New()
+	if err := writeFileAtomic(e.path, io.TeeReader(src, h)); err != nil {
+		return err
+	}
+
+	meta := e.meta
+	meta.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	b, err := json.Marshal(&meta)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(e.path+".json", bytes.NewReader(b))
+}
+
+func (e *validatedAssetEntry) remove() {
+	os.Remove(e.path + ".json")
+	os.Remove(e.path)
+}
+
+// writeFileAtomic writes the file via a temporary file in the same directory.
+func writeFileAtomic(path string, src io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatedAssetCache(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: name + ".sha256", content: []byte(fmt.Sprintf("%x", sha256.Sum256(asset)))},
+	}})
+
+	served := 0
+	gh.handleAsset = func(w http.ResponseWriter, r *http.Request, a fakeAsset) bool {
+		served++
+		return false
+	}
+
+	dir := t.TempDir()
+	up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}, ValidatedAssetCacheDir: dir}, gh)
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := func() {
+		path := setupOldExecutable(t)
+		if err := up.UpdateTo(rel, path); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, exe) {
+			t.Fatalf("Executable was not updated: %q", b)
+		}
+	}
+
+	update()
+	if served != 2 {
+		t.Fatal("Asset and validation file should be downloaded:", served)
+	}
+
+	update()
+	if served != 2 {
+		t.Fatal("Validated asset should be applied from cache:", served)
+	}
+
+	// Tampered copy is not trusted and is downloaded and validated again. The validation file is kept by the updater
+	entry := newValidatedAssetEntry(dir, rel)
+	if err := ioutil.WriteFile(entry.path, []byte("tampered"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	update()
+	if served != 3 {
+		t.Fatal("Tampered cache should be ignored:", served)
+	}
+	if b, err := ioutil.ReadFile(entry.path); err != nil || !bytes.Equal(b, asset) {
+		t.Fatal("Cache entry should be stored again after validation:", err)
+	}
+
+	// Re-uploaded asset has another ID
+	reuploaded := *rel
+	reuploaded.AssetID++
+	if f, ok := newValidatedAssetEntry(dir, &reuploaded).open(); ok {
+		f.Close()
+		t.Fatal("Re-uploaded asset should not hit the cache")
+	}
+}
+
+func TestValidatedAssetCacheNotStoredOnValidationFailure(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: name + ".sha256", content: []byte(strings.Repeat("0", 64))},
+	}})
+
+	dir := t.TempDir()
+	up, _ := newTestUpdater(t, Config{Validator: &SHA2Validator{}, ValidatedAssetCacheDir: dir}, gh)
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := up.UpdateTo(rel, setupOldExecutable(t)); err == nil {
+		t.Fatal("Validation should fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, filepath.Base(newValidatedAssetEntry(dir, rel).path)+".json")); !os.IsNotExist(err) {
+		t.Fatal("Asset which failed the validation should not be cached:", err)
+	}
+}
@@ -0,0 +1,139 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// validationFileCache keeps the contents of validation files such as checksum files and their signatures downloaded
+// by an updater, so that a retry of a failed update does not download them again. Only complete downloads are kept.
+type validationFileCache struct {
+	mu     sync.Mutex
+	byFile map[string][]byte
+}
+
+// validationFileKey returns the key of the release file. The ID of the asset changes when it is uploaded again,
+// while the URL is used for the files whose ID is unknown.
+func validationFileKey(rel *Release, f releaseFile) string {
+	owner, repo := f.repository(rel)
+	if f.id > 0 {
+		return owner + "/" + repo + "#" + strconv.FormatInt(f.id, 10)
+	}
+
+	return owner + "/" + repo + " " + f.url
+}
+
+func (v *validationFileCache) get(key string) ([]byte, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	data, ok := v.byFile[key]
+
+	return data, ok
+}
+
+func (v *validationFileCache) put(key string, data []byte) {
+	if v == nil {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.byFile == nil {
+		v.byFile = map[string][]byte{}
+	}
+
+	v.byFile[key] = data
+}
+
+// isTransientDownloadError returns true when the download failed on the way, such as a reset connection or a truncated
+// body, and may succeed when it is tried again. Error responses are not transient since the retriable status codes
+// were already retried by the transport.
+func isTransientDownloadError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTooManyRedirects) {
+		return false
+	}
+
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return false
+	}
+
+	var res *github.ErrorResponse
+	if errors.As(err, &res) {
+		return false
+	}
+
+	var ne net.Error
+
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// downloadValidationFile downloads the whole content of the small release file such as a checksum file or its
+// signature. Transient failures are retried with the backoff of Config.MaxRetries and Config.RetryWait, as well as
+// responses with Config.RetryStatusCodes, so that a flaky download of the small file does not abort the update.
+// The content is kept in the updater for retries of the update, unless Config.AssetCacheDir revalidates the files on
+// each download instead.
+func (up *Updater) downloadValidationFile(ctx context.Context, rel *Release, f releaseFile) ([]byte, error) {
+	files := up.valFiles
+	if up.cacheDir != "" {
+		files = nil
+	}
+
+	key := validationFileKey(rel, f)
+	if data, ok := files.get(key); ok {
+		log.Println("Use validation file", f.name, "already downloaded")
+
+		return data, nil
+	}
+
+	backoff := up.retry.wait
+
+	for retries := 0; ; retries++ {
+		data, err := up.readReleaseFile(ctx, rel, f)
+		if err == nil {
+			files.put(key, data)
+
+			return data, nil
+		}
+
+		if retries >= up.retry.maxRetries || !isTransientDownloadError(err) {
+			return nil, err
+		}
+
+		log.Printf("Retrying download of %sasset %s in %s since it failed: %s (retry %d/%d)\n", f.kind, f.name, backoff, err, retries+1, up.retry.maxRetries)
+
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+
+		backoff *= 2
+	}
+}
+
+func (up *Updater) readReleaseFile(ctx context.Context, rel *Release, f releaseFile) ([]byte, error) {
+	src, err := up.downloadReleaseAsset(ctx, rel, f)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(&contextReader{ctx: ctx, src: src})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %sasset body: %w", f.kind, err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,165 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/google/go-github/v30/github"
+)
+
+func TestIsTransientDownloadError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("failed reading validation asset body: %w", io.ErrUnexpectedEOF), true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: io.EOF}, true},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}, false},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: context.Canceled}, false},
+		{&RateLimitError{}, false},
+		{fmt.Errorf("wrapped: %w", ErrTooManyRedirects), false},
+		{errors.New("failed to download a release file: Not successful status 404"), false},
+	} {
+		if got := isTransientDownloadError(tc.err); got != tc.want {
+			t.Errorf("Wanted %v for %v but got %v", tc.want, tc.err, got)
+		}
+	}
+}
+
+func TestDownloadValidationFileRetry(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+	checksums := []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(asset), name))
+
+	for _, tc := range []struct {
+		what     string
+		failures int
+		fail     func(w http.ResponseWriter)
+		requests int
+		err      string
+	}{
+		{"reset connection", 2, resetConnection, 3, ""},
+		{"truncated body", 1, truncatedBody(checksums), 2, ""},
+		{"persistent failure", 10, truncatedBody(checksums), 4, "failed reading validation asset body"},
+		{"error response", 10, func(w http.ResponseWriter) { http.Error(w, "Validation Failed", http.StatusUnprocessableEntity) }, 1, "Not successful status 422"},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: asset}, {name: "checksums.txt", content: checksums}}})
+
+			var mu sync.Mutex
+			requests := 0
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/releases/download/v1.2.3/checksums.txt") {
+					mu.Lock()
+					requests++
+					n := requests
+					mu.Unlock()
+					if n <= tc.failures {
+						tc.fail(w)
+						return
+					}
+				}
+				gh.ServeHTTP(w, r)
+			})
+
+			up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}, AssetURLMode: AssetURLBrowser, RetryWait: time.Millisecond}, handler)
+			rel, _, err := up.DetectLatest("owner/repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := setupOldExecutable(t)
+			err = up.UpdateTo(rel, path)
+			if tc.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("Wanted error %q but got %v", tc.err, err)
+			}
+			if requests != tc.requests {
+				t.Fatalf("Checksum file should be requested %d times but got %d", tc.requests, requests)
+			}
+		})
+	}
+}
+
+func resetConnection(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func truncatedBody(content []byte) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content[:len(content)/2])
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestValidationFileKeptForRetriedUpdate(t *testing.T) {
+	name := platformAssetName("foo", ".tar.gz")
+	asset := tarGz(t, map[string][]byte{"foo": fakeExecutableContent(t, "v1.2.3")})
+
+	gh := newFakeGitHub()
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: "checksums.txt", content: []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(asset), name))},
+	}})
+
+	var mu sync.Mutex
+	tampered := true
+	checksumRequests := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/checksums.txt"):
+			checksumRequests++
+		case strings.HasSuffix(r.URL.Path, "/"+name) && tampered:
+			tampered = false
+			_, _ = w.Write([]byte("tampered"))
+			return
+		}
+		gh.ServeHTTP(w, r)
+	})
+
+	up, _ := newTestUpdater(t, Config{Validator: &ChecksumValidator{}, AssetURLMode: AssetURLBrowser}, handler)
+	rel, _, err := up.DetectLatest("owner/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := setupOldExecutable(t)
+	if err := up.UpdateTo(rel, path); !errors.Is(err, ErrValidationFailed) {
+		t.Fatal("Tampered asset should fail the validation:", err)
+	}
+	if _, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) == "old executable" {
+		t.Fatal("Executable was not updated:", err)
+	}
+	if checksumRequests != 1 {
+		t.Fatal("Checksum file should be downloaded once but got", checksumRequests)
+	}
+}
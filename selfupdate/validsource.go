@@ -0,0 +1,131 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ValidationNamePlaceholder is replaced with the file name of the validation file, such as 'checksums.txt' or
+	// 'checksums.txt.sig', in ValidationSource.URLTemplate.
+	ValidationNamePlaceholder = "{{name}}"
+	// TagPlaceholder is replaced with the tag of the release, such as 'v1.2.3', in ValidationSource.URLTemplate.
+	TagPlaceholder = "{{tag}}"
+	// VersionPlaceholder is replaced with the version of the release, such as '1.2.3', in
+	// ValidationSource.URLTemplate.
+	VersionPlaceholder = "{{version}}"
+)
+
+// ValidationSource tells where the validation files of releases are published when they are not assets of the
+// releases themselves, e.g. the checksums and their signatures kept in a separate access-controlled repository so that
+// publishing binaries and signing them are separated. The validation file and the signature of it are both fetched
+// from the source. Either Repository or URLTemplate must be set.
+type ValidationSource struct {
+	// Repository is the slug (owner/repo) of another repository whose release of the same tag has the validation files
+	// as its assets. The release is looked up with one more request to GitHub API on each update, and the files are
+	// downloaded as the release asset is, with the API token.
+	Repository string
+	// URLTemplate is the URL of the validation files such as 'https://sigs.example.com/foo/{{tag}}/{{name}}'.
+	// ValidationNamePlaceholder, AssetNamePlaceholder, TagPlaceholder and VersionPlaceholder are replaced as-is. When
+	// the validator accepts several names of the validation file, e.g. with NamedValidator.FallbackTemplates, only
+	// the first one is downloaded.
+	URLTemplate string
+}
+
+func (s *ValidationSource) check() error {
+	if (s.Repository == "") == (s.URLTemplate == "") {
+		return errors.New("either Repository or URLTemplate of ValidationSource must be set")
+	}
+
+	if s.Repository != "" {
+		if _, err := parseSlug(s.Repository); err != nil {
+			return fmt.Errorf("invalid repository of ValidationSource: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ValidationSource) expand(name string, rel *Release) string {
+	return strings.NewReplacer(
+		ValidationNamePlaceholder, name,
+		AssetNamePlaceholder, rel.assetName(),
+		TagPlaceholder, rel.tagName,
+		VersionPlaceholder, rel.Version.String(),
+	).Replace(s.URLTemplate)
+}
+
+// validationFiles returns the validation file of the release and the signature file of it. The signature file is
+// the zero value when the validator does not verify the validation file.
+func (up *Updater) validationFiles(ctx context.Context, rel *Release) (releaseFile, releaseFile, error) {
+	sig := signatureValidator(up.validator)
+	src := up.valSource
+
+	if src == nil {
+		v := releaseFile{id: rel.ValidationAssetID, name: rel.validationAssetName, url: rel.validationAssetURL, kind: "validation "}
+
+		var s releaseFile
+		if sig != nil {
+			s = releaseFile{id: rel.ValidationSignatureAssetID, name: rel.validationSignatureAssetName, url: rel.validationSignatureAssetURL, kind: "validation signature "}
+		}
+
+		return v, s, nil
+	}
+
+	names := validationAssetNames(up.validator, rel.assetName())
+
+	if src.URLTemplate != "" {
+		v := releaseFile{id: -1, name: names[0], url: src.expand(names[0], rel), kind: "validation "}
+
+		var s releaseFile
+		if sig != nil {
+			name := validationAssetNames(sig, v.name)[0]
+			s = releaseFile{id: -1, name: name, url: src.expand(name, rel), kind: "validation signature "}
+		}
+
+		return v, s, nil
+	}
+
+	repo, _ := parseSlug(src.Repository)
+
+	if rel.tagName == "" {
+		return releaseFile{}, releaseFile{}, fmt.Errorf("tag of release %s is unknown to look up its validation files in repository %s", rel.Version, src.Repository)
+	}
+
+	other, _, err := up.api.Repositories.GetReleaseByTag(ctx, repo[0], repo[1], rel.tagName)
+	if err != nil {
+		return releaseFile{}, releaseFile{}, fmt.Errorf("failed to get release %s of repository %s for validation files: %w", rel.tagName, src.Repository, asRateLimitError(err))
+	}
+
+	a, ok := findValidationAsset(other, names...)
+	if !ok {
+		quoted := make([]string, 0, len(names))
+		for _, n := range names {
+			quoted = append(quoted, strconv.Quote(n))
+		}
+
+		return releaseFile{}, releaseFile{}, markError(ErrValidationFailed, fmt.Errorf("failed finding validation file %s in release %s of repository %s", strings.Join(quoted, " or "), rel.tagName, src.Repository))
+	}
+
+	log.Println("Found validation file", a.GetName(), "in repository", src.Repository)
+
+	v := releaseFile{id: a.GetID(), name: a.GetName(), url: a.GetBrowserDownloadURL(), kind: "validation ", owner: repo[0], repo: repo[1]}
+
+	var s releaseFile
+
+	if sig != nil {
+		sigNames := validationAssetNames(sig, a.GetName())
+
+		sa, ok := findValidationAsset(other, sigNames...)
+		if !ok {
+			return releaseFile{}, releaseFile{}, markError(ErrValidationFailed, fmt.Errorf("failed finding signature file %q of validation file %q in release %s of repository %s", sigNames[0], a.GetName(), rel.tagName, src.Repository))
+		}
+
+		s = releaseFile{id: sa.GetID(), name: sa.GetName(), url: sa.GetBrowserDownloadURL(), kind: "validation signature ", owner: repo[0], repo: repo[1]}
+	}
+
+	return v, s, nil
+}
@@ -0,0 +1,160 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestValidationSource(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	checksums, err := GenerateChecksums(map[string]io.Reader{name: bytes.NewReader(asset)}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(priv, checksums)
+	sigs := []fakeAsset{{name: "checksums.txt", content: checksums}, {name: "checksums.txt.sig", content: sig}}
+
+	for _, tc := range []struct {
+		what   string
+		source func(base string) *ValidationSource
+		sigs   []fakeAsset
+		err    string
+	}{
+		{
+			"repository",
+			func(string) *ValidationSource { return &ValidationSource{Repository: "owner/sigs"} },
+			sigs,
+			"",
+		},
+		{
+			"url template",
+			func(base string) *ValidationSource {
+				return &ValidationSource{URLTemplate: base + "/owner/sigs/releases/download/{{tag}}/{{name}}"}
+			},
+			sigs,
+			"",
+		},
+		{
+			"no signature in repository",
+			func(string) *ValidationSource { return &ValidationSource{Repository: "owner/sigs"} },
+			sigs[:1],
+			`failed finding signature file "checksums.txt.sig" of validation file "checksums.txt" in release v1.2.3 of repository owner/sigs`,
+		},
+		{
+			"no release in repository",
+			func(string) *ValidationSource { return &ValidationSource{Repository: "owner/missing"} },
+			sigs,
+			"failed to get release v1.2.3 of repository owner/missing",
+		},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			gh := newFakeGitHub()
+			// The asset release has no validation file, so it cannot be validated without the source
+			gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{{name: name, content: asset}}})
+			gh.addRelease("owner/sigs", fakeRelease{tag: "v1.2.3", assets: tc.sigs})
+
+			up, ts := newTestUpdater(t, Config{Validator: &ChecksumValidator{Signature: &Ed25519Validator{PublicKey: pub}}}, gh)
+			// The URL of the test server is known only after the updater is created
+			up.valSource = tc.source(ts.URL)
+
+			path := setupOldExecutable(t)
+			_, err := up.UpdateCommand(path, semver.MustParse("1.2.2"), "owner/repo")
+
+			b, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Wanted error %q but got %v", tc.err, err)
+				}
+				if string(b) != "old executable" {
+					t.Fatalf("Old executable should be kept but got %q", b)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, exe) {
+				t.Fatalf("Executable was not updated: %q", b)
+			}
+
+			fromSigs := 0
+			for _, r := range gh.requested() {
+				if strings.Contains(r.URL.Path, "/owner/sigs/") {
+					fromSigs++
+				}
+			}
+			if fromSigs < 2 {
+				t.Fatal("Validation files should be fetched from the other repository:", fromSigs)
+			}
+		})
+	}
+}
+
+func TestValidationSourceTamperedChecksums(t *testing.T) {
+	exe := fakeExecutableContent(t, "v1.2.3")
+	asset := tarGz(t, map[string][]byte{"foo": exe})
+	name := platformAssetName("foo", ".tar.gz")
+
+	checksums, err := GenerateChecksums(map[string]io.Reader{name: strings.NewReader("evil")}, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gh := newFakeGitHub()
+	// Checksums and their signature in the release of the asset are ignored when the source is set
+	gh.addRelease("owner/repo", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: name, content: asset},
+		{name: "checksums.txt", content: checksums},
+		{name: "checksums.txt.sig", content: ed25519.Sign(priv, checksums)},
+	}})
+	gh.addRelease("owner/sigs", fakeRelease{tag: "v1.2.3", assets: []fakeAsset{
+		{name: "checksums.txt", content: checksums},
+		{name: "checksums.txt.sig", content: make([]byte, ed25519.SignatureSize)},
+	}})
+	up, _ := newTestUpdater(t, Config{
+		Validator:        &ChecksumValidator{Signature: &Ed25519Validator{PublicKey: pub}},
+		ValidationSource: &ValidationSource{Repository: "owner/sigs"},
+	}, gh)
+
+	_, err = up.UpdateCommand(setupOldExecutable(t), semver.MustParse("1.2.2"), "owner/repo")
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Fatal("Signature in the other repository should be verified:", err)
+	}
+}
+
+func TestValidationSourceConfig(t *testing.T) {
+	for _, s := range []*ValidationSource{
+		{},
+		{Repository: "owner/sigs", URLTemplate: "https://example.com/{{name}}"},
+		{Repository: "sigs"},
+	} {
+		if _, err := NewUpdater(Config{ValidationSource: s}); err == nil {
+			t.Errorf("Invalid source %+v should be rejected", s)
+		}
+	}
+}
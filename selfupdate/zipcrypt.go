@@ -0,0 +1,389 @@
+package selfupdate
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // PBKDF2 and HMAC of WinZip AES encryption are defined with SHA-1
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrZipPasswordRequired is returned when the executable in a zip asset is encrypted but no password is set
+	// to Config.ZipPassword.
+	ErrZipPasswordRequired = errors.New("zip: password is required to decrypt the encrypted file. Please set it to Config.ZipPassword")
+	// ErrZipWrongPassword is returned when the password set to Config.ZipPassword cannot decrypt the executable
+	// in a zip asset.
+	ErrZipWrongPassword = errors.New("zip: wrong password for the encrypted file")
+
+	errZipCorrupted = errors.New("the file may be corrupted")
+)
+
+const (
+	zipFlagEncrypted      = 0x1
+	zipFlagDataDescriptor = 0x8
+	zipMethodAES          = 99
+	zipExtraAES           = 0x9901
+	zipCryptoHeaderSize   = 12
+	zipAESVerifierSize    = 2
+	zipAESAuthCodeSize    = 10
+	zipAESIterations      = 1000
+)
+
+// openZipFile opens the file in a zip archive. Files encrypted with traditional PKWARE encryption (ZipCrypto)
+// and WinZip AES encryption are decrypted with the password.
+func openZipFile(f *zip.File, password string) (io.Reader, error) {
+	if f.Flags&zipFlagEncrypted == 0 {
+		// Archives created by streaming writers do not record sizes and CRC-32 in local file headers, but only in
+		// data descriptors and the central directory. archive/zip reads sizes from the central directory and
+		// verifies both the uncompressed size and CRC-32 (including the one in the data descriptor) on EOF.
+		return f.Open()
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("%w: %s", ErrZipPasswordRequired, f.Name)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted file %s in zip file: %w", f.Name, err)
+	}
+
+	if f.Method == zipMethodAES {
+		return openZipAES(f, raw, password)
+	}
+
+	return openZipCrypto(f, raw, password)
+}
+
+func decompressZipFile(f *zip.File, method uint16, src io.Reader) (io.Reader, error) {
+	switch method {
+	case zip.Store:
+		return src, nil
+	case zip.Deflate:
+		return flate.NewReader(src), nil
+	default:
+		return nil, markError(ErrUnsupportedFormat, fmt.Errorf("unsupported compression method %d of encrypted file %s in zip file", method, f.Name))
+	}
+}
+
+// zipChecksumReader verifies the size and the CRC-32 checksum of a file in a zip archive on reaching EOF.
+type zipChecksumReader struct {
+	src      io.Reader
+	name     string
+	hash     hash.Hash32
+	size     uint64
+	wantSize uint64
+	wantCRC  uint32
+	checkCRC bool
+	wrongErr error
+	// verify is called on EOF before the size and the checksum are checked when not nil
+	verify func() error
+}
+
+func (r *zipChecksumReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.hash.Write(p[:n])
+	r.size += uint64(n)
+
+	if !errors.Is(err, io.EOF) {
+		return n, err
+	}
+
+	if r.verify != nil {
+		if err := r.verify(); err != nil {
+			return n, err
+		}
+	}
+
+	if r.size != r.wantSize {
+		return n, fmt.Errorf("size of %s in zip file mismatch: expected=%d, got=%d: %w", r.name, r.wantSize, r.size, r.wrongErr)
+	}
+
+	if r.checkCRC && r.hash.Sum32() != r.wantCRC {
+		return n, fmt.Errorf("CRC-32 checksum of %s in zip file mismatch: %w", r.name, r.wrongErr)
+	}
+
+	return n, err
+}
+
+type zipCryptoKeys [3]uint32
+
+func zipCryptoCRC(crc uint32, b byte) uint32 {
+	return (crc >> 8) ^ crc32.IEEETable[byte(crc)^b]
+}
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = zipCryptoCRC(k[0], b)
+	k[1] = (k[1]+(k[0]&0xff))*134775813 + 1
+	k[2] = zipCryptoCRC(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i, c := range buf {
+		t := k[2] | 2
+		buf[i] = c ^ byte((t*(t^1))>>8)
+		k.update(buf[i])
+	}
+}
+
+type zipCryptoReader struct {
+	src  io.Reader
+	keys *zipCryptoKeys
+}
+
+func (r *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.keys.decrypt(p[:n])
+
+	return n, err
+}
+
+func openZipCrypto(f *zip.File, raw io.Reader, password string) (io.Reader, error) {
+	header := make([]byte, zipCryptoHeaderSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header of %s in zip file: %w", f.Name, err)
+	}
+
+	keys := newZipCryptoKeys(password)
+	keys.decrypt(header)
+
+	// The last byte of the header is the high-order byte of the CRC-32, or of the modification time
+	// when the CRC-32 is not known until the data descriptor.
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipFlagDataDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8) //nolint:staticcheck // MS-DOS time is what the header is checked against
+	}
+
+	if header[zipCryptoHeaderSize-1] != check {
+		return nil, fmt.Errorf("%w: %s", ErrZipWrongPassword, f.Name)
+	}
+
+	r, err := decompressZipFile(f, f.Method, &zipCryptoReader{src: raw, keys: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	// The check byte above can match by chance with a wrong password. It is detected by the checksum.
+	return &zipChecksumReader{
+		src:      r,
+		name:     f.Name,
+		hash:     crc32.NewIEEE(),
+		wantSize: f.UncompressedSize64,
+		wantCRC:  f.CRC32,
+		checkCRC: true,
+		wrongErr: ErrZipWrongPassword,
+	}, nil
+}
+
+type zipAESExtra struct {
+	version  uint16
+	keySize  int
+	method   uint16
+	hasExtra bool
+}
+
+func parseZipAESExtra(extra []byte) zipAESExtra {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+
+		if size > len(extra) {
+			break
+		}
+
+		// Version (2 bytes), vendor ID "AE" (2 bytes), strength (1 byte) and actual compression method (2 bytes)
+		if id == zipExtraAES && size == 7 && string(extra[2:4]) == "AE" {
+			e := zipAESExtra{
+				version:  binary.LittleEndian.Uint16(extra),
+				method:   binary.LittleEndian.Uint16(extra[5:]),
+				hasExtra: true,
+			}
+
+			switch extra[4] {
+			case 1:
+				e.keySize = 16
+			case 2:
+				e.keySize = 24
+			case 3:
+				e.keySize = 32
+			}
+
+			return e
+		}
+
+		extra = extra[size:]
+	}
+
+	return zipAESExtra{}
+}
+
+// zipAESCTR is AES in CTR mode using a little-endian counter starting at 1, as specified by WinZip AES encryption.
+// cipher.NewCTR cannot be used since it increments the counter in big endian.
+type zipAESCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newZipAESCTR(key []byte) (*zipAESCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipAESCTR{block: block, used: aes.BlockSize}, nil
+}
+
+func (c *zipAESCTR) XORKeyStream(dst, src []byte) {
+	for i, b := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+
+		dst[i] = b ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+// zipAESReader decrypts the content of a file encrypted with WinZip AES encryption while it is read, and checks the
+// authentication code following the content on reaching its end.
+type zipAESReader struct {
+	src     io.Reader
+	raw     io.Reader
+	mac     hash.Hash
+	ctr     *zipAESCTR
+	name    string
+	checked bool
+	authErr error
+}
+
+func (r *zipAESReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.mac.Write(p[:n])
+	r.ctr.XORKeyStream(p[:n], p[:n])
+
+	if errors.Is(err, io.EOF) {
+		if err := r.authenticate(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
+
+func (r *zipAESReader) authenticate() error {
+	if r.checked {
+		return r.authErr
+	}
+
+	r.checked = true
+
+	authCode := make([]byte, zipAESAuthCodeSize)
+	if _, err := io.ReadFull(r.raw, authCode); err != nil {
+		r.authErr = fmt.Errorf("failed to read authentication code of encrypted file %s in zip file: %w", r.name, err)
+	} else if !hmac.Equal(r.mac.Sum(nil)[:zipAESAuthCodeSize], authCode) {
+		r.authErr = fmt.Errorf("authentication code of encrypted file %s in zip file mismatch: %w", r.name, errZipCorrupted)
+	}
+
+	return r.authErr
+}
+
+// verify reads the rest of the content, which the decompressor may not read after its end, and checks the
+// authentication code.
+func (r *zipAESReader) verify() error {
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+
+	return r.authenticate()
+}
+
+func openZipAES(f *zip.File, raw io.Reader, password string) (io.Reader, error) {
+	extra := parseZipAESExtra(f.Extra)
+	if !extra.hasExtra || extra.keySize == 0 {
+		return nil, fmt.Errorf("invalid AES extra field of encrypted file %s in zip file", f.Name)
+	}
+
+	saltSize := extra.keySize / 2
+
+	contentSize := int64(f.CompressedSize64) - int64(saltSize+zipAESVerifierSize+zipAESAuthCodeSize)
+	if contentSize < 0 {
+		return nil, fmt.Errorf("encrypted file %s in zip file is too short", f.Name)
+	}
+
+	header := make([]byte, saltSize+zipAESVerifierSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header of %s in zip file: %w", f.Name, err)
+	}
+
+	salt, verifier := header[:saltSize], header[saltSize:]
+
+	keys := pbkdf2.Key([]byte(password), salt, zipAESIterations, 2*extra.keySize+zipAESVerifierSize, sha1.New)
+	encKey, authKey := keys[:extra.keySize], keys[extra.keySize:2*extra.keySize]
+
+	if !hmac.Equal(keys[2*extra.keySize:], verifier) {
+		return nil, fmt.Errorf("%w: %s", ErrZipWrongPassword, f.Name)
+	}
+
+	ctr, err := newZipAESCTR(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s in zip file: %w", f.Name, err)
+	}
+
+	// The decrypted content is passed on before it is authenticated, but the authentication code is checked before
+	// EOF is returned, so a tampered executable fails the update before it is put in place
+	dec := &zipAESReader{
+		src:  io.LimitReader(raw, contentSize),
+		raw:  raw,
+		mac:  hmac.New(sha1.New, authKey),
+		ctr:  ctr,
+		name: f.Name,
+	}
+
+	r, err := decompressZipFile(f, extra.method, dec)
+	if err != nil {
+		return nil, err
+	}
+
+	// AE-2 does not store CRC-32 since the content is authenticated by HMAC
+	return &zipChecksumReader{
+		src:      r,
+		name:     f.Name,
+		hash:     crc32.NewIEEE(),
+		wantSize: f.UncompressedSize64,
+		wantCRC:  f.CRC32,
+		checkCRC: extra.version == 1,
+		wrongErr: errZipCorrupted,
+		verify:   dec.verify,
+	}, nil
+}
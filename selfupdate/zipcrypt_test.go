@@ -0,0 +1,167 @@
+package selfupdate
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func uncompressEncryptedZip(t *testing.T, name, password string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := uncompressCommand(f, "https://github.com/foo/bar/releases/download/v1.2.3/bar.zip", []string{"bar"}, password, nil, runtimePlatform())
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+func TestUncompressEncryptedZip(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		want string
+	}{
+		{"testdata/encrypted-zipcrypto.zip", "this is test\n"},
+		{"testdata/encrypted-aes.zip", strings.Repeat("this is test\n", 5)},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			s, err := uncompressEncryptedZip(t, tc.file, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tc.want {
+				t.Fatalf("Unexpected content %q", s)
+			}
+
+			if _, err := uncompressEncryptedZip(t, tc.file, ""); !errors.Is(err, ErrZipPasswordRequired) {
+				t.Error("ErrZipPasswordRequired should be returned but got", err)
+			}
+
+			if _, err := uncompressEncryptedZip(t, tc.file, "wrong"); !errors.Is(err, ErrZipWrongPassword) {
+				t.Error("ErrZipWrongPassword should be returned but got", err)
+			}
+		})
+	}
+}
+
+func TestUncompressTamperedAESZip(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/encrypted-aes.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := z.File[len(z.File)-1]
+	if f.Name != "foo/bar" {
+		t.Fatal("Unexpected file in fixture:", f.Name)
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := offset + int64(f.CompressedSize64)
+
+	for _, tc := range []struct {
+		what string
+		pos  int64
+	}{
+		// The content is decrypted as is, and the tampering is only detected by the authentication code
+		{"authentication code", end - 1},
+		{"content", end - zipAESAuthCodeSize - 1},
+	} {
+		t.Run(tc.what, func(t *testing.T) {
+			tampered := append([]byte{}, data...)
+			tampered[tc.pos] ^= 0xff
+
+			r, err := uncompressCommand(bytes.NewReader(tampered), "https://github.com/foo/bar/releases/download/v1.2.3/bar.zip", []string{"bar"}, "password", nil, runtimePlatform())
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			if err == nil {
+				t.Fatal("Tampered file should be rejected")
+			}
+			if tc.what == "authentication code" && !strings.Contains(err.Error(), "authentication code") {
+				t.Fatal("Authentication code mismatch should be detected but got", err)
+			}
+		})
+	}
+}
+
+func TestUncompressPlainZipWithPassword(t *testing.T) {
+	s, err := uncompressEncryptedZip(t, "testdata/foo.zip", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "this is test\n" {
+		t.Fatalf("Unexpected content %q", s)
+	}
+}
+
+func TestZipChecksumReader(t *testing.T) {
+	r := &zipChecksumReader{
+		src:      strings.NewReader("foo"),
+		name:     "foo",
+		hash:     crc32.NewIEEE(),
+		wantSize: 3,
+		wantCRC:  0,
+		checkCRC: true,
+		wrongErr: ErrZipWrongPassword,
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrZipWrongPassword) || !strings.Contains(err.Error(), "CRC-32") {
+		t.Fatal("Checksum mismatch should be detected:", err)
+	}
+
+	r = &zipChecksumReader{src: strings.NewReader("foo"), name: "foo", hash: crc32.NewIEEE(), wantSize: 4, wrongErr: ErrZipWrongPassword}
+	if _, err := ioutil.ReadAll(r); err == nil || !strings.Contains(err.Error(), "size of foo") {
+		t.Fatal("Size mismatch should be detected:", err)
+	}
+}
+
+func TestOpenZipFileWithDataDescriptor(t *testing.T) {
+	z, err := zip.OpenReader("testdata/streaming.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	f := z.File[0]
+	if f.Flags&zipFlagDataDescriptor == 0 {
+		t.Fatal("Fixture should be created in streaming mode with data descriptor")
+	}
+
+	r, err := openZipFile(f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "this is test\n" {
+		t.Fatalf("Unexpected content %q", b)
+	}
+
+	// Size recorded in the archive does not match the actual content
+	for _, size := range []uint64{0, 5, 20} {
+		f.UncompressedSize64 = size
+		r, err = openZipFile(f, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil {
+			t.Errorf("Size mismatch should be detected for size %d", size)
+		}
+	}
+}